@@ -16,8 +16,12 @@ package blockstore
 import (
 	"context"         // Контекст для управления временем жизни операций и отмены
 	"errors"          // Создание и обработка ошибок
+	"fmt"             // Оборачивание ошибок с контекстом
 	"io"              // Базовые интерфейсы ввода-вывода
+	"math"            // Предельные значения для неограниченного по числу кэша
 	"sync"            // Примитивы синхронизации для thread-safe операций
+	"sync/atomic"     // Lock-free счетчики статистики кэша
+	"time"            // Время жизни записей негативного кэша
 	s "ues/datastore" // Локальный пакет datastore для персистентного хранения
 
 	// LRU кэш для оптимизации доступа к часто используемым блокам
@@ -45,6 +49,7 @@ import (
 
 	// IPLD Prime - современная реализация IPLD с улучшенной производительностью
 	"github.com/ipld/go-ipld-prime"                     // Основные типы и интерфейсы IPLD
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"     // Регистрация DAG-CBOR кодека для DefaultLP
 	"github.com/ipld/go-ipld-prime/datamodel"           // Модель данных IPLD
 	"github.com/ipld/go-ipld-prime/linking"             // Система связывания узлов через ссылки
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid" // CID-based linking
@@ -79,6 +84,62 @@ const (
 	RabinMaxSize = DefaultChunkSize * 2 // 512 KiB
 )
 
+// DefaultCacheSize - размер LRU кэша блоков по умолчанию (в блоках).
+// Используется NewBlockstore и NewBlockstoreWithOptions с нулевыми Options.
+const DefaultCacheSize = 1000
+
+// Options задает параметры blockstore, создаваемого NewBlockstoreWithOptions.
+//
+// Кэш может ограничиваться числом блоков, суммарным размером их данных или
+// обоими лимитами сразу (вытеснение идет, пока нарушен любой из них).
+// Лимит в байтах предпочтителен, когда размеры блоков сильно различаются:
+// узел MST занимает десятки байт, а фрагмент файла - 256 KiB.
+//
+// Нулевые Options соответствуют NewBlockstore: кэш на DefaultCacheSize блоков.
+type Options struct {
+	// CacheSize - максимальное число блоков в кэше.
+	// 0 - без ограничения числа, если задан CacheBytes, иначе DefaultCacheSize;
+	// отрицательное значение отключает кэш.
+	CacheSize int
+
+	// CacheBytes - максимальный суммарный размер данных блоков в кэше.
+	// 0 - без ограничения по размеру. Блоки крупнее лимита не кэшируются.
+	CacheBytes int64
+
+	// NegativeCacheSize - число недавно отсутствовавших блоков, которые
+	// запоминаются, чтобы повторные Has/Get не обращались к datastore.
+	// 0 отключает негативный кэш. Полезен при частых проверках заведомо
+	// отсутствующих блоков, например при поиске пропусков синхронизации.
+	NegativeCacheSize int
+
+	// NegativeCacheTTL - время жизни записи негативного кэша
+	// (0 - DefaultNegativeCacheTTL). Блок, записанный в datastore в обход
+	// blockstore, становится видимым не позже чем через TTL.
+	NegativeCacheTTL time.Duration
+
+	// ReadOnly запрещает запись: Put, PutMany, PutManyIfAbsent, DeleteBlock,
+	// Pin, Unpin и GC возвращают ErrReadOnly. Включается автоматически,
+	// если datastore открыт только для чтения (datastore.NewDatastorageReadOnly).
+	ReadOnly bool
+
+	// Metrics получает метрики Get, Put, PutMany и PutManyIfAbsent (как put),
+	// DeleteBlock, а также попадания и промахи кэша блоков при Get
+	// с компонентом datastore.ComponentBlockstore. nil отключает метрики.
+	Metrics s.Metrics
+
+	// CodecIndex включает индекс кодеков: Put и PutMany дополнительно
+	// записывают метки кодеков блоков, что позволяет фильтровать
+	// AllKeysChanFiltered и CopyTo по кодеку. По умолчанию выключен, чтобы
+	// не удваивать число записей в datastore. Блоки, записанные до включения
+	// индекса, индексирует RebuildCodecIndex.
+	CodecIndex bool
+}
+
+// ErrReadOnly возвращается операциями записи blockstore в режиме только
+// для чтения. Совпадает с datastore.ErrReadOnly, поэтому errors.Is
+// распознает обе ошибки одной проверкой.
+var ErrReadOnly = s.ErrReadOnly
+
 // DefaultLP - прототип ссылки по умолчанию для создания CID.
 // Определяет стандартные параметры для content-addressable идентификаторов:
 // - CIDv1: современная версия формата CID с улучшенной совместимостью
@@ -325,6 +386,10 @@ type Blockstore interface {
 	//   - error: ошибка создания архива или записи данных
 	ExportCARV2(ctx context.Context, root cid.Cid, selectorNode datamodel.Node, w io.Writer, opts ...carv2.WriteOption) error
 
+	// ExportSubtree экспортирует в CAR v2 архив подграф корня, ограниченный
+	// глубиной maxDepth (0 - только корневой блок).
+	ExportSubtree(ctx context.Context, root cid.Cid, maxDepth int, w io.Writer) error
+
 	// ImportCARV2 импортирует блоки данных из CAR архива в blockstore.
 	// Поддерживает как CAR v1, так и CAR v2 для максимальной совместимости.
 	//
@@ -349,6 +414,52 @@ type Blockstore interface {
 	//   - []cid.Cid: список корневых CID из заголовка архива
 	//   - error: ошибка чтения архива или импорта блоков
 	ImportCARV2(ctx context.Context, r io.Reader, opts ...carv2.ReadOption) ([]cid.Cid, error)
+
+	// Pin закрепляет корень, защищая достижимые от него блоки от сборки мусора.
+	// Закрепления хранятся в datastore и переживают перезапуск.
+	Pin(ctx context.Context, root cid.Cid) error
+
+	// Unpin снимает закрепление корня; блоки при этом не удаляются.
+	Unpin(ctx context.Context, root cid.Cid) error
+
+	// IsPinned сообщает, закреплен ли корень.
+	IsPinned(ctx context.Context, root cid.Cid) (bool, error)
+
+	// Pins возвращает все закрепленные корни.
+	Pins(ctx context.Context) ([]cid.Cid, error)
+
+	// Reachable возвращает множество CID блоков, достижимых от указанных корней.
+	Reachable(ctx context.Context, roots []cid.Cid) (*cid.Set, error)
+
+	// GC удаляет блоки, недостижимые от roots и закрепленных корней.
+	// Безопасен при конкурентной записи: блоки, добавленные после начала
+	// пометки, не удаляются. Возвращает количество удаленных блоков.
+	GC(ctx context.Context, roots []cid.Cid) (deleted int, err error)
+
+	// CacheStats возвращает счетчики попаданий, промахов и вытеснений
+	// кэша блоков, а также его текущий размер.
+	CacheStats() CacheStats
+
+	// AllKeysChanFiltered возвращает CID блоков, удовлетворяющих фильтру
+	// по кодеку и типу мультихеша, не выдавая в канал остальные ключи.
+	// Фильтр по кодеку требует Options.CodecIndex.
+	AllKeysChanFiltered(ctx context.Context, filter KeyFilter) (<-chan cid.Cid, error)
+
+	// RebuildCodecIndex индексирует кодеки блоков, достижимых от roots
+	// и закрепленных корней, и удаляет метки отсутствующих блоков.
+	// Возвращает количество проиндексированных блоков.
+	RebuildCodecIndex(ctx context.Context, roots []cid.Cid) (indexed int, err error)
+
+	// Usage возвращает общий размер хранилища и гистограмму размеров блоков.
+	Usage(ctx context.Context) (UsageReport, error)
+
+	// CopyTo копирует в dst блоки, которых в нем еще нет, и возвращает
+	// количество скопированных блоков.
+	CopyTo(ctx context.Context, dst Blockstore, opts CopyOptions) (copied int, err error)
+
+	// PutManyIfAbsent сохраняет только отсутствующие блоки и возвращает
+	// количество записанных и пропущенных блоков.
+	PutManyIfAbsent(ctx context.Context, blks []blocks.Block) (written, skipped int, err error)
 }
 
 // blockstore представляет конкретную реализацию расширенного интерфейса Blockstore.
@@ -408,6 +519,42 @@ type blockstore struct {
 	// - Настраиваемый размер для баланса памяти и производительности
 	// - Thread-safe реализация с minimal lock contention
 	cache *lru.Cache[string, blocks.Block]
+
+	// cacheBytes - суммарный размер данных блоков в кэше; изменяется
+	// в cacheBlock и в callback вытеснения, читается без блокировки.
+	cacheBytes atomic.Int64
+
+	// cacheMaxBytes - лимит cacheBytes (0 - без ограничения по размеру).
+	cacheMaxBytes int64
+
+	// cacheHits, cacheMisses, cacheEvictions - счетчики для CacheStats.
+	// Атомарные, чтобы не усиливать конкуренцию за mu на пути чтения.
+	cacheHits      atomic.Uint64
+	cacheMisses    atomic.Uint64
+	cacheEvictions atomic.Uint64
+
+	// negCache - негативный кэш отсутствующих блоков (nil, если отключен).
+	negCache *negativeCache
+
+	// gcMu - сериализует сборки мусора: одновременно выполняется не более одной.
+	gcMu sync.Mutex
+
+	// gcTrackMu - защищает gcAdded и делает атомарными проверку и удаление
+	// блока в фазе очистки относительно конкурентных Put.
+	gcTrackMu sync.Mutex
+
+	// gcAdded - мультихеши блоков, записанных после начала текущей сборки
+	// мусора (nil, если сборка не выполняется).
+	gcAdded map[string]struct{}
+
+	// readOnly - запись запрещена (Options.ReadOnly или datastore только для чтения).
+	readOnly bool
+
+	// metrics - получатель метрик операций (s.NopMetrics, если не задан).
+	metrics s.Metrics
+
+	// codecIndex - ведется индекс кодеков (Options.CodecIndex).
+	codecIndex bool
 }
 
 // Compile-time проверка корректности реализации интерфейса.
@@ -452,21 +599,55 @@ var _ Blockstore = (*blockstore)(nil)
 //	cid, err := bs.PutNode(ctx, someIPLDNode)
 //	if err != nil { log.Fatal(err) }
 func NewBlockstore(ds s.Datastore) *blockstore {
+	// Размер 1000 выбран как компромисс между использованием памяти и hit rate
+	return NewBlockstoreWithOptions(ds, Options{CacheSize: DefaultCacheSize})
+}
+
+// NewBlockstoreWithOptions создает blockstore с настраиваемым кэшем блоков.
+// NewBlockstore эквивалентен вызову с Options{CacheSize: DefaultCacheSize}.
+//
+// Пример использования:
+//
+//	// Встраиваемое устройство: не более 4 MiB кэша
+//	bs := NewBlockstoreWithOptions(datastore, Options{CacheBytes: 4 << 20})
+func NewBlockstoreWithOptions(ds s.Datastore, opts Options) *blockstore {
 	// Создаем базовый blockstore поверх нашего datastore
 	// Это обеспечивает стандартную функциональность IPFS blockstore
 	base := bstor.NewBlockstore(ds)
 
 	// Инициализируем структуру blockstore с базовым blockstore
 	bs := &blockstore{
-		ds:         ds,
-		Blockstore: base,
+		ds:            ds,
+		Blockstore:    base,
+		cacheMaxBytes: opts.CacheBytes,
+		readOnly:      opts.ReadOnly || ds.ReadOnly(),
+		metrics:       opts.Metrics,
+		codecIndex:    opts.CodecIndex,
+	}
+	if bs.metrics == nil {
+		bs.metrics = s.NopMetrics{}
 	}
 
-	// Создаем LRU кэш для 1000 блоков для оптимизации производительности
+	// Создаем LRU кэш для оптимизации производительности
 	// LRU (Least Recently Used) автоматически вытесняет старые блоки при превышении лимита
-	// Размер 1000 выбран как компромисс между использованием памяти и hit rate
-	cache, _ := lru.New[string, blocks.Block](1000)
-	bs.cache = cache
+	size := opts.CacheSize
+	if size == 0 {
+		size = DefaultCacheSize
+		if opts.CacheBytes > 0 {
+			// Ограничивает только размер в байтах
+			size = math.MaxInt
+		}
+	}
+	if opts.NegativeCacheSize > 0 {
+		bs.negCache = newNegativeCache(opts.NegativeCacheSize, opts.NegativeCacheTTL)
+	}
+	if size > 0 {
+		// Callback вытеснения поддерживает учет суммарного размера кэша
+		cache, _ := lru.NewWithEvict(size, func(_ string, b blocks.Block) {
+			bs.cacheBytes.Add(-int64(len(b.RawData())))
+		})
+		bs.cache = cache
+	}
 
 	// Инициализируем мьютекс для thread-safe доступа к кэшу
 	// RWMutex позволяет множественным читателям работать параллельно
@@ -478,7 +659,11 @@ func NewBlockstore(ds s.Datastore) *blockstore {
 	// - Интеграция с сетевым обменом (в будущем)
 	// - Дополнительные методы для работы с блоками
 	// Передаем nil как exchange, так как используем только локальное хранилище
-	bs.bS = blockservice.New(bs.Blockstore, nil)
+	// Оборачиваем сам blockstore (а не базовый), чтобы записи через
+	// LinkSystem и DAGService проходили через Put/PutMany с кэшированием
+	// и учетом для сборки мусора. WriteThrough отключает проверку Has перед
+	// записью: повторная запись существующего блока тоже должна дойти до Put
+	bs.bS = blockservice.New(bs, nil, blockservice.WriteThrough(true))
 
 	// Создаем DAGService для работы с направленными ациклическими графами
 	// DAGService обеспечивает:
@@ -543,51 +728,58 @@ func (bs *blockstore) cacheBlock(b blocks.Block) {
 		return
 	}
 
+	// Блок крупнее всего кэша вытеснил бы все остальное и сам не поместился бы
+	size := int64(len(b.RawData()))
+	if bs.cacheMaxBytes > 0 && size > bs.cacheMaxBytes {
+		return
+	}
+
 	// Добавляем блок в LRU кэш, используя строковое представление CID как ключ
 	// LRU автоматически обрабатывает вытеснение старых элементов при превышении лимита
-	bs.cache.Add(b.Cid().String(), b)
+	key := b.Cid().String()
+	if !bs.cache.Contains(key) {
+		bs.cacheBytes.Add(size)
+	}
+	if bs.cache.Add(key, b) {
+		bs.cacheEvictions.Add(1)
+	}
+
+	// Вытесняем старые блоки до соблюдения лимита по размеру
+	for bs.cacheMaxBytes > 0 && bs.cacheBytes.Load() > bs.cacheMaxBytes {
+		if _, _, ok := bs.cache.RemoveOldest(); !ok {
+			break
+		}
+		bs.cacheEvictions.Add(1)
+	}
 }
 
-// cacheGet пытается получить блок из LRU кэша для ускорения операций чтения.
-// Метод thread-safe и использует read lock для минимизации блокировок
-// при конкурентном доступе. Возвращает блок и флаг успешности поиска.
-//
-// Преимущества кэш-попаданий:
-// - Мгновенный доступ к данным без обращения к storage
-// - Снижение latency для часто используемых блоков
-// - Уменьшение I/O операций и нагрузки на диск
-// - Улучшение общей производительности системы
-//
-// Cache miss handling:
-// - При отсутствии блока в кэше возвращается (nil, false)
-// - Calling code должен обратиться к persistent storage
-// - Полученный блок рекомендуется добавить в кэш через cacheBlock
-//
-// Параметры:
-//   - key: строковое представление CID блока для поиска в кэше
-//
-// Возвращает:
-//   - blocks.Block: найденный блок данных (nil если не найден)
-//   - bool: флаг успешности поиска (true = найден, false = cache miss)
+// CacheStats - снимок статистики кэша блоков.
 //
-// Особенности:
-// - Lock-free reads: минимальное время блокировки для читающих операций
-// - Memory efficiency: кэш хранит ссылки на блоки, не копирует данные
-// - LRU update: обращение к элементу обновляет его позицию в LRU списке
-func (bs *blockstore) cacheGet(key string) (blocks.Block, bool) {
-	// Получаем read lock для безопасного чтения из кэша
-	// RWMutex позволяет множественным читателям работать параллельно
-	bs.mu.RLock()
-	defer bs.mu.RUnlock()
+// Hits, Misses и Evictions накапливаются за время жизни blockstore и не
+// сбрасываются при очистке кэша. Evictions учитывает только вытеснение
+// из-за лимитов (Options), но не явное удаление блоков.
+type CacheStats struct {
+	Hits      uint64 // Обращения, обслуженные кэшем
+	Misses    uint64 // Обращения, ушедшие в хранилище
+	Evictions uint64 // Блоки, вытесненные при превышении лимитов
+	Entries   int    // Текущее число блоков в кэше
+	Bytes     int64  // Текущий суммарный размер данных блоков в кэше
+}
 
-	// Проверяем, что кэш инициализирован (graceful degradation)
-	if bs.cache == nil {
-		return nil, false
+// CacheStats возвращает статистику кэша для подбора Options.CacheSize
+// и Options.CacheBytes. Счетчики читаются без блокировок, поэтому поля
+// снимка согласованы лишь приблизительно при конкурентной нагрузке.
+func (bs *blockstore) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:      bs.cacheHits.Load(),
+		Misses:    bs.cacheMisses.Load(),
+		Evictions: bs.cacheEvictions.Load(),
+		Bytes:     bs.cacheBytes.Load(),
 	}
-
-	// Пытаемся найти блок в LRU кэше
-	// Get() автоматически обновляет позицию элемента в LRU списке
-	return bs.cache.Get(key)
+	if bs.cache != nil {
+		stats.Entries = bs.cache.Len()
+	}
+	return stats
 }
 
 // Put сохраняет блок данных в blockstore с автоматическим кэшированием.
@@ -604,38 +796,143 @@ func (bs *blockstore) cacheGet(key string) (blocks.Block, bool) {
 //   - block: блок данных для сохранения с CID и raw data
 //
 // Возвращает:
-//   - error: ошибка сохранения в storage или добавления в кэш
-func (bs *blockstore) Put(ctx context.Context, block blocks.Block) error {
+//   - error: ошибка сохранения в storage, ErrReadOnly в режиме только для
+//     чтения или ctx.Err() для отмененного контекста
+func (bs *blockstore) Put(ctx context.Context, block blocks.Block) (err error) {
+	defer bs.observe(s.MetricPut, time.Now(), &err)
+	if bs.readOnly {
+		return ErrReadOnly
+	}
+	// Отмененный запрос не должен ничего записывать
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Регистрируем блок до записи, чтобы конкурентная сборка мусора его не удалила
+	bs.trackAdded(block.Cid())
 	// Сохраняем блок в persistent storage через базовый blockstore
-	if err := bs.Blockstore.Put(ctx, block); err != nil {
+	err = bs.Blockstore.Put(ctx, block)
+	// Инвалидируем негативный кэш после записи (даже частичной)
+	bs.negCache.forget(block.Cid())
+	if err != nil {
 		return err
 	}
+	// Запоминаем кодек блока для AllKeysChanFiltered
+	if err := bs.indexCodecs(ctx, block.Cid()); err != nil {
+		return fmt.Errorf("index codec: %w", err)
+	}
 	// Добавляем блок в LRU кэш для ускорения последующих обращений
 	bs.cacheBlock(block)
 	return nil
 }
 
-// PutMany сохраняет множество блоков в одной операции с пакетным кэшированием.
+// PutMany сохраняет множество блоков пакетами с пакетным кэшированием.
 // Обеспечивает высокую производительность при массовом импорте данных
 // за счет минимизации количества операций с storage и оптимизации кэша.
 //
 // Преимущества пакетной операции:
 // - Снижение накладных расходов на I/O операции
-// - Атомарность: либо все блоки сохраняются, либо ни один
 // - Эффективное использование кэша и memory bandwidth
 // - Оптимизация для случаев массового импорта данных
 //
+// Отмена контекста:
+// Блоки записываются частями по putManyBatchSize; контекст проверяется
+// перед каждой частью, и при отмене PutMany возвращает ctx.Err(), не
+// записывая оставшиеся блоки. Уже записанные блоки остаются: они адресуются
+// по содержимому, поэтому частичная запись не нарушает согласованность.
+//
 // Параметры:
 //   - ctx: контекст для управления временем жизни операции
 //   - blks: массив блоков для пакетного сохранения
 //
 // Возвращает:
-//   - error: ошибка пакетного сохранения или кэширования блоков
-func (bs *blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+//   - error: ошибка пакетного сохранения или отмены контекста
+func (bs *blockstore) PutMany(ctx context.Context, blks []blocks.Block) (err error) {
+	defer bs.observe(s.MetricPut, time.Now(), &err)
+	if bs.readOnly {
+		return ErrReadOnly
+	}
+	for start := 0; start < len(blks); start += putManyBatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(start+putManyBatchSize, len(blks))
+		if err := bs.putBatch(ctx, blks[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutManyIfAbsent сохраняет только блоки, которых еще нет в blockstore,
+// и возвращает количество записанных и пропущенных блоков.
+//
+// Для данных, адресуемых по содержимому, пропуск всегда безопасен: блок
+// с тем же мультихешем хранит те же байты. Полезно при повторном импорте
+// и импорте пересекающихся CAR архивов. Как и PutMany, записывает блоки
+// частями и прекращает работу при отмене контекста.
+func (bs *blockstore) PutManyIfAbsent(ctx context.Context, blks []blocks.Block) (written, skipped int, err error) {
+	defer bs.observe(s.MetricPut, time.Now(), &err)
+	if bs.readOnly {
+		return 0, 0, ErrReadOnly
+	}
+	// Пропущенные блоки тоже регистрируем: вызывающий считает их записанными,
+	// и конкурентная сборка мусора не должна их удалить
+	for _, b := range blks {
+		bs.trackAdded(b.Cid())
+	}
+
+	missing := make([]blocks.Block, 0, len(blks))
+	for _, b := range blks {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		has, err := bs.Has(ctx, b.Cid())
+		if err != nil {
+			return 0, 0, fmt.Errorf("check %s: %w", b.Cid(), err)
+		}
+		if has {
+			skipped++
+			continue
+		}
+		missing = append(missing, b)
+	}
+
+	for start := 0; start < len(missing); start += putManyBatchSize {
+		if err := ctx.Err(); err != nil {
+			return written, skipped, err
+		}
+		end := min(start+putManyBatchSize, len(missing))
+		if err := bs.putBatch(ctx, missing[start:end]); err != nil {
+			return written, skipped, err
+		}
+		written += end - start
+	}
+	return written, skipped, nil
+}
+
+// putManyBatchSize - число блоков в одной пакетной записи PutMany.
+// Ограничивает объем работы, выполняемой после отмены контекста.
+const putManyBatchSize = 128
+
+// putBatch записывает одну часть PutMany через базовый blockstore
+func (bs *blockstore) putBatch(ctx context.Context, blks []blocks.Block) error {
+	cids := make([]cid.Cid, len(blks))
+	for i, b := range blks {
+		cids[i] = b.Cid()
+	}
+	// Регистрируем блоки до записи, чтобы конкурентная сборка мусора их не удалила
+	bs.trackAdded(cids...)
 	// Выполняем пакетное сохранение через базовый blockstore
-	if err := bs.Blockstore.PutMany(ctx, blks); err != nil {
+	err := bs.Blockstore.PutMany(ctx, blks)
+	// Инвалидируем негативный кэш после записи (даже частичной)
+	bs.negCache.forget(cids...)
+	if err != nil {
 		return err
 	}
+	// Запоминаем кодеки блоков для AllKeysChanFiltered
+	if err := bs.indexCodecs(ctx, cids...); err != nil {
+		return fmt.Errorf("index codecs: %w", err)
+	}
 	// Добавляем все блоки в кэш для ускорения последующих операций
 	for _, b := range blks {
 		bs.cacheBlock(b)
@@ -643,6 +940,16 @@ func (bs *blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
 	return nil
 }
 
+// observe передает в метрики операцию op, начатую в start, с ошибкой *err.
+// Отсутствие блока ошибкой операции не считается.
+func (bs *blockstore) observe(op string, start time.Time, err *error) {
+	opErr := *err
+	if format.IsNotFound(opErr) {
+		opErr = nil
+	}
+	bs.metrics.ObserveOp(s.ComponentBlockstore, op, time.Since(start), opErr)
+}
+
 // Get загружает блок данных с приоритетной проверкой кэша.
 // Реализует стратегию cache-first для минимизации обращений к persistent storage
 // и максимального ускорения операций чтения горячих данных.
@@ -664,15 +971,31 @@ func (bs *blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
 // Возвращает:
 //   - blocks.Block: найденный блок с данными и метаданными
 //   - error: ошибка поиска в кэше или загрузки из storage
-func (bs *blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
-	// Сначала проверяем LRU кэш для быстрого доступа
-	if blk, ok := bs.cacheGet(c.String()); ok {
+func (bs *blockstore) Get(ctx context.Context, c cid.Cid) (_ blocks.Block, err error) {
+	defer bs.observe(s.MetricGet, time.Now(), &err)
+
+	// Сначала проверяем LRU кэш для быстрого доступа (с учетом эквивалентной
+	// формы CIDv0/CIDv1, см. политику версий CID в cidversion.go)
+	if blk, ok := bs.cacheLookup(c); ok {
+		bs.metrics.Hit(s.ComponentBlockstore)
 		return blk, nil // Cache hit - возвращаем блок немедленно
 	}
+	if bs.cache != nil {
+		bs.metrics.Miss(s.ComponentBlockstore)
+	}
+
+	// Блок недавно отсутствовал - не обращаемся к storage повторно
+	if bs.negCache.missing(c) {
+		return nil, format.ErrNotFound{Cid: c}
+	}
 
 	// Cache miss - загружаем блок из persistent storage
+	gen := bs.negCache.generation()
 	blk, err := bs.Blockstore.Get(ctx, c)
 	if err != nil {
+		if format.IsNotFound(err) {
+			bs.negCache.remember(c, gen)
+		}
 		return nil, err
 	}
 
@@ -681,6 +1004,23 @@ func (bs *blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error)
 	return blk, nil
 }
 
+// Has проверяет наличие блока в blockstore.
+// При включенном негативном кэше (Options.NegativeCacheSize) недавно
+// отсутствовавшие блоки сообщаются как отсутствующие без обращения
+// к datastore, пока запись не истечет или блок не будет записан через Put.
+func (bs *blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if bs.negCache.missing(c) {
+		return false, nil
+	}
+
+	gen := bs.negCache.generation()
+	has, err := bs.Blockstore.Has(ctx, c)
+	if err == nil && !has {
+		bs.negCache.remember(c, gen)
+	}
+	return has, err
+}
+
 // DeleteBlock удаляет блок из persistent storage и кэша.
 // Обеспечивает синхронизацию между всеми уровнями хранения данных
 // для предотвращения inconsistent state и stale cache entries.
@@ -700,18 +1040,31 @@ func (bs *blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error)
 //   - c: CID блока для удаления
 //
 // Возвращает:
-//   - error: ошибка удаления из storage или очистки кэша
-func (bs *blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+//   - error: ошибка удаления из storage, очистки кэша или ErrReadOnly
+func (bs *blockstore) DeleteBlock(ctx context.Context, c cid.Cid) (err error) {
+	defer bs.observe(s.MetricDelete, time.Now(), &err)
+	if bs.readOnly {
+		return ErrReadOnly
+	}
 	// Удаляем блок из persistent storage
 	if err := bs.Blockstore.DeleteBlock(ctx, c); err != nil {
 		return err
 	}
+	// Блок хранится по мультихешу, поэтому удаляем метки индекса кодеков
+	// под всеми кодеками, с которыми он был записан
+	if err := bs.unindexCodecs(ctx, c); err != nil {
+		return fmt.Errorf("unindex codecs: %w", err)
+	}
 
 	// Принудительно удаляем блок из LRU кэша для предотвращения stale data
 	bs.mu.Lock()
 	if bs.cache != nil {
 		// Используем Remove() для явного удаления из кэша
 		bs.cache.Remove(c.String())
+		// Блок мог быть закэширован под эквивалентной формой CID
+		if alt := equivalentCid(c); alt.Defined() {
+			bs.cache.Remove(alt.String())
+		}
 	}
 	bs.mu.Unlock()
 	return nil
@@ -889,6 +1242,17 @@ func BuildSelectorNodeExploreAll() datamodel.Node {
 		).Node()
 }
 
+// BuildSelectorNodeExploreDepth создает селектор-узел для обхода графа
+// с ограничением глубины рекурсии depth (в уровнях модели данных IPLD,
+// включая уровень корневого узла). Используется ExportSubtree.
+func BuildSelectorNodeExploreDepth(depth int64) datamodel.Node {
+	sb := selb.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return sb.
+		ExploreRecursive(selector.RecursionLimitDepth(depth),
+			sb.ExploreAll(sb.ExploreRecursiveEdge()),
+		).Node()
+}
+
 // CompileSelector преобразует IPLD узел-селектор в executable selector.
 // Компилирует декларативное описание селектора в оптимизированную
 // структуру данных для эффективного выполнения обхода графа.
@@ -1045,6 +1409,29 @@ func (bs *blockstore) ExportCARV2(ctx context.Context, root cid.Cid, selectorNod
 	return err
 }
 
+// ExportSubtree экспортирует в CAR v2 архив корень и его подграф,
+// ограниченный глубиной maxDepth.
+//
+// Глубина считается в уровнях вложенности модели данных IPLD ниже корневого
+// узла; переход по ссылке уровня не добавляет. 0 - только корневой блок.
+// Для узлов, ссылки в которых лежат непосредственно в полях map или list,
+// maxDepth совпадает с числом переходов по ссылкам.
+//
+// Применение: передача части репозитория легким клиентам, которым не нужен
+// весь граф.
+func (bs *blockstore) ExportSubtree(ctx context.Context, root cid.Cid, maxDepth int, w io.Writer) error {
+	if maxDepth < 0 {
+		return fmt.Errorf("invalid export depth %d", maxDepth)
+	}
+
+	// Корневой узел занимает первый уровень рекурсии селектора
+	selectorNode := BuildSelectorNodeExploreDepth(int64(maxDepth) + 1)
+	if _, err := CompileSelector(selectorNode); err != nil {
+		return fmt.Errorf("compile depth selector: %w", err)
+	}
+	return bs.ExportCARV2(ctx, root, selectorNode, w)
+}
+
 // ImportCARV2 импортирует блоки из CAR архива в blockstore.
 // Поддерживает как CAR v1, так и CAR v2 с автоматическим определением формата
 // и эффективной пакетной загрузкой блоков с проверкой целостности.
@@ -3,18 +3,26 @@ package blockstore
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	s "ues/datastore"
 
 	bstor "github.com/ipfs/boxo/blockstore"
 	"github.com/ipfs/boxo/files"
 	blocks "github.com/ipfs/go-block-format"
 	cd "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	badger4 "github.com/ipfs/go-ds-badger4"
+	format "github.com/ipfs/go-ipld-format"
+	carv2 "github.com/ipld/go-car/v2"
 	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	traversal "github.com/ipld/go-ipld-prime/traversal"
 	"github.com/multiformats/go-multihash"
@@ -88,7 +96,7 @@ func TestNewBlockstore(t *testing.T) {
 		// Это важно: если кэш работает по LRU, последний блок должен быть доступен
 		data := []byte("test data " + string(rune(999)))
 		blk := blocks.NewBlock(data)
-		cachedBlock, found := bs.cacheGet(blk.Cid().String())
+		cachedBlock, found := cachePeek(bs, blk.Cid().String())
 		assert.True(t, found, "последний блок должен быть в кэше")
 		if found {
 			assert.Equal(t, blk.RawData(), cachedBlock.RawData())
@@ -96,6 +104,102 @@ func TestNewBlockstore(t *testing.T) {
 	})
 }
 
+// TestNewBlockstoreWithOptions проверяет, что вытеснение из кэша соблюдает
+// заданные лимиты по числу блоков и по суммарному размеру.
+func TestNewBlockstoreWithOptions(t *testing.T) {
+	ctx := context.Background()
+
+	// putSized сохраняет n блоков размера size и возвращает их
+	putSized := func(t *testing.T, bs *blockstore, n, size int) []blocks.Block {
+		var out []blocks.Block
+		for i := 0; i < n; i++ {
+			data := make([]byte, size)
+			copy(data, fmt.Sprintf("блок-%d-%d", size, i))
+			blk := blocks.NewBlock(data)
+			require.NoError(t, bs.Put(ctx, blk))
+			out = append(out, blk)
+		}
+		return out
+	}
+
+	// cachedBytes считает суммарный размер блоков в кэше
+	cachedBytes := func(bs *blockstore) int64 {
+		var total int64
+		for _, b := range bs.cache.Values() {
+			total += int64(len(b.RawData()))
+		}
+		return total
+	}
+
+	t.Run("лимит по числу блоков", func(t *testing.T) {
+		ds := createTestDatastore(t)
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{CacheSize: 10})
+
+		blks := putSized(t, bs, 25, 64)
+		assert.Equal(t, 10, bs.cache.Len())
+
+		// Остались последние блоки, первые вытеснены
+		_, found := cachePeek(bs, blks[24].Cid().String())
+		assert.True(t, found)
+		_, found = cachePeek(bs, blks[0].Cid().String())
+		assert.False(t, found)
+	})
+
+	t.Run("лимит по размеру", func(t *testing.T) {
+		ds := createTestDatastore(t)
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{CacheBytes: 4096})
+
+		putSized(t, bs, 50, 100)
+		big := putSized(t, bs, 3, 1000)
+
+		assert.LessOrEqual(t, cachedBytes(bs), int64(4096))
+		assert.Equal(t, cachedBytes(bs), bs.cacheBytes.Load(), "учет размера должен совпадать с содержимым")
+		_, found := cachePeek(bs, big[2].Cid().String())
+		assert.True(t, found, "последний блок должен быть в кэше")
+
+		// Блок крупнее всего кэша не кэшируется и не вытесняет остальные
+		before := bs.cache.Len()
+		huge := putSized(t, bs, 1, 8192)
+		_, found = cachePeek(bs, huge[0].Cid().String())
+		assert.False(t, found)
+		assert.Equal(t, before, bs.cache.Len())
+
+		// Блок по-прежнему читается из хранилища
+		got, err := bs.Get(ctx, huge[0].Cid())
+		require.NoError(t, err)
+		assert.Equal(t, huge[0].RawData(), got.RawData())
+	})
+
+	t.Run("оба лимита", func(t *testing.T) {
+		ds := createTestDatastore(t)
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{CacheSize: 5, CacheBytes: 1 << 20})
+
+		putSized(t, bs, 20, 64)
+		assert.Equal(t, 5, bs.cache.Len())
+		assert.Equal(t, int64(5*64), bs.cacheBytes.Load())
+
+		// Удаление блока уменьшает учтенный размер
+		blks := putSized(t, bs, 1, 100)
+		require.NoError(t, bs.DeleteBlock(ctx, blks[0].Cid()))
+		assert.Equal(t, cachedBytes(bs), bs.cacheBytes.Load())
+	})
+
+	t.Run("отключенный кэш", func(t *testing.T) {
+		ds := createTestDatastore(t)
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{CacheSize: -1})
+		assert.Nil(t, bs.cache)
+
+		blks := putSized(t, bs, 3, 64)
+		got, err := bs.Get(ctx, blks[1].Cid())
+		require.NoError(t, err)
+		assert.Equal(t, blks[1].RawData(), got.RawData())
+	})
+}
+
 // =====================================
 // ТЕСТЫ БАЗОВЫХ ОПЕРАЦИЙ С БЛОКАМИ (CRUD)
 // =====================================
@@ -207,7 +311,7 @@ func TestPutMany(t *testing.T) {
 
 			// Проверяем, что блоки также попали в кэш
 			// Это важно для производительности последующих операций
-			cachedBlock, found := bs.cacheGet(block.Cid().String())
+			cachedBlock, found := cachePeek(bs, block.Cid().String())
 			assert.True(t, found, "блок должен быть в кэше")
 			if found {
 				assert.Equal(t, block.RawData(), cachedBlock.RawData())
@@ -264,7 +368,7 @@ func TestDeleteBlock(t *testing.T) {
 
 		// Критически важно: проверяем удаление из кэша
 		// Если блок остался в кэше, это может привести к inconsistency
-		_, found := bs.cacheGet(block.Cid().String())
+		_, found := cachePeek(bs, block.Cid().String())
 		assert.False(t, found, "блок должен быть удален из кэша")
 	})
 
@@ -655,7 +759,7 @@ func TestCaching(t *testing.T) {
 
 		// Проверяем, что блок автоматически попал в кэш
 		// Это критично для производительности последующих операций Get
-		cachedBlock, found := bs.cacheGet(block.Cid().String())
+		cachedBlock, found := cachePeek(bs, block.Cid().String())
 		assert.True(t, found, "блок должен быть в кэше после Put")
 		if found {
 			assert.Equal(t, testData, cachedBlock.RawData())
@@ -688,7 +792,7 @@ func TestCaching(t *testing.T) {
 		require.NoError(t, err)
 
 		// Проверяем наличие в кэше
-		_, found := bs.cacheGet(block.Cid().String())
+		_, found := cachePeek(bs, block.Cid().String())
 		assert.True(t, found)
 
 		// Удаляем блок
@@ -696,7 +800,7 @@ func TestCaching(t *testing.T) {
 		require.NoError(t, err)
 
 		// Проверяем, что блок удален из кэша
-		_, found = bs.cacheGet(block.Cid().String())
+		_, found = cachePeek(bs, block.Cid().String())
 		assert.False(t, found, "блок должен быть удален из кэша")
 	})
 }
@@ -895,9 +999,8 @@ func TestEdgeCases(t *testing.T) {
 		assert.Contains(t, err.Error(), "links system is nil")
 
 		// GetNode должен также корректно обработать ошибку
-		h, err := multihash.Sum([]byte("test"), multihash.BLAKE3, -1)
+		fakeCID, err := ComputeCID([]byte("test"), uint64(cd.DagCBOR))
 		require.NoError(t, err)
-		fakeCID := cd.NewCidV1(uint64(cd.DagCBOR), h)
 
 		_, err = bs.GetNode(ctx, fakeCID)
 		assert.Error(t, err)
@@ -1101,10 +1204,55 @@ func TestContextCancellation(t *testing.T) {
 		testData := []byte("данные с отмененным контекстом")
 		block := blocks.NewBlock(testData)
 
+		// Отмененный запрос ничего не записывает
 		err := bs.Put(ctx, block)
-		// Put может быть успешным или завершиться ошибкой
-		// в зависимости от реализации (синхронная vs асинхронная)
-		_ = err
+		assert.ErrorIs(t, err, context.Canceled)
+
+		has, err := bs.Has(context.Background(), block.Cid())
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("отмена контекста при PutMany", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var blks []blocks.Block
+		for i := 0; i < putManyBatchSize*3; i++ {
+			blks = append(blks, blocks.NewBlock([]byte(fmt.Sprintf("пакет с отменой %d", i))))
+		}
+
+		err := bs.PutMany(ctx, blks)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		for _, blk := range []blocks.Block{blks[0], blks[len(blks)-1]} {
+			has, err := bs.Has(context.Background(), blk.Cid())
+			require.NoError(t, err)
+			assert.False(t, has, "блоки не должны записываться после отмены")
+		}
+	})
+
+	t.Run("истекший дедлайн при PutMany", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		blk := blocks.NewBlock([]byte("пакет с истекшим дедлайном"))
+		err := bs.PutMany(ctx, []blocks.Block{blk})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("PutMany больше одной части", func(t *testing.T) {
+		var blks []blocks.Block
+		for i := 0; i < putManyBatchSize*2+1; i++ {
+			blks = append(blks, blocks.NewBlock([]byte(fmt.Sprintf("большой пакет %d", i))))
+		}
+		require.NoError(t, bs.PutMany(context.Background(), blks))
+
+		for _, blk := range blks {
+			has, err := bs.Has(context.Background(), blk.Cid())
+			require.NoError(t, err)
+			require.True(t, has)
+		}
 	})
 
 	t.Run("отмена контекста при GetReader", func(t *testing.T) {
@@ -1346,9 +1494,8 @@ func TestPutNodeAndGetNode(t *testing.T) {
 	})
 
 	t.Run("получение несуществующего узла", func(t *testing.T) {
-		h, err := multihash.Sum([]byte("несуществующие данные"), multihash.BLAKE3, -1)
+		fakeCID, err := ComputeCID([]byte("несуществующие данные"), uint64(cd.DagCBOR))
 		require.NoError(t, err)
-		fakeCID := cd.NewCidV1(uint64(cd.DagCBOR), h)
 
 		_, err = bs.GetNode(ctx, fakeCID)
 		assert.Error(t, err, "должна возвращаться ошибка для несуществующего узла")
@@ -1380,9 +1527,8 @@ func TestGetSubgraph(t *testing.T) {
 	})
 
 	t.Run("несуществующий корневой CID", func(t *testing.T) {
-		h, err := multihash.Sum([]byte("несуществующий"), multihash.BLAKE3, -1)
+		fakeCID, err := ComputeCID([]byte("несуществующий"), uint64(cd.DagCBOR))
 		require.NoError(t, err)
-		fakeCID := cd.NewCidV1(uint64(cd.DagCBOR), h)
 
 		selectorNode := BuildSelectorNodeExploreAll()
 		_, err = bs.GetSubgraph(ctx, fakeCID, selectorNode)
@@ -1432,6 +1578,65 @@ func TestDifferentCIDVersions(t *testing.T) {
 
 		t.Logf("Создан CID версии: %d", actualVersion)
 	})
+
+	t.Run("запись CIDv0 и чтение CIDv1", func(t *testing.T) {
+		block := blocks.NewBlock([]byte("записан как CIDv0"))
+		require.Equal(t, uint64(0), block.Cid().Version())
+		require.NoError(t, bs.Put(ctx, block))
+
+		v1 := cd.NewCidV1(cd.DagProtobuf, block.Cid().Hash())
+		has, err := bs.Has(ctx, v1)
+		require.NoError(t, err)
+		assert.True(t, has)
+
+		// Блок найден в кэше под CIDv0, но возвращается с запрошенным CID
+		hits := bs.CacheStats().Hits
+		got, err := bs.Get(ctx, v1)
+		require.NoError(t, err)
+		assert.Equal(t, v1, got.Cid())
+		assert.Equal(t, block.RawData(), got.RawData())
+		assert.Equal(t, hits+1, bs.CacheStats().Hits)
+	})
+
+	t.Run("запись CIDv1 и чтение CIDv0", func(t *testing.T) {
+		data := []byte("записан как CIDv1")
+		v0 := blocks.NewBlock(data).Cid()
+		block, err := blocks.NewBlockWithCid(data, cd.NewCidV1(cd.DagProtobuf, v0.Hash()))
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, block))
+
+		has, err := bs.Has(ctx, v0)
+		require.NoError(t, err)
+		assert.True(t, has)
+		got, err := bs.Get(ctx, v0)
+		require.NoError(t, err)
+		assert.Equal(t, v0, got.Cid())
+		assert.Equal(t, data, got.RawData())
+
+		// Без кэша блок находится в хранилище по мультихешу
+		bs.mu.Lock()
+		bs.cache.Purge()
+		bs.mu.Unlock()
+		got, err = bs.Get(ctx, v0)
+		require.NoError(t, err)
+		assert.Equal(t, v0, got.Cid())
+
+		// Удаление по одной форме удаляет блок и для другой
+		_, err = bs.Get(ctx, block.Cid())
+		require.NoError(t, err)
+		require.NoError(t, bs.DeleteBlock(ctx, v0))
+		_, err = bs.Get(ctx, block.Cid())
+		assert.True(t, format.IsNotFound(err), "ожидалась ошибка отсутствия блока: %v", err)
+	})
+
+	t.Run("CID без эквивалентной формы", func(t *testing.T) {
+		c, err := DefaultLP.Sum([]byte("dag-cbor"))
+		require.NoError(t, err)
+		assert.False(t, equivalentCid(c).Defined())
+
+		v0 := blocks.NewBlock([]byte("v0")).Cid()
+		assert.Equal(t, v0, equivalentCid(equivalentCid(v0)))
+	})
 }
 
 func TestLinkSystemEdgeCases(t *testing.T) {
@@ -1477,7 +1682,7 @@ func TestErrorHandling(t *testing.T) {
 		// Методы должны работать без паники
 		bs.cacheBlock(block) // Не должно вызывать панику
 
-		_, found := bs.cacheGet(block.Cid().String())
+		_, found := cachePeek(bs, block.Cid().String())
 		assert.False(t, found, "должно возвращать false при поврежденном кэше")
 
 		// Восстанавливаем кэш
@@ -1521,7 +1726,7 @@ func TestCacheEviction(t *testing.T) {
 		recentBlocksInCache := 0
 		checkLast := 100
 		for i := totalBlocks - checkLast; i < totalBlocks; i++ {
-			_, found := bs.cacheGet(allBlocks[i].Cid().String())
+			_, found := cachePeek(bs, allBlocks[i].Cid().String())
 			if found {
 				recentBlocksInCache++
 			}
@@ -1535,7 +1740,7 @@ func TestCacheEviction(t *testing.T) {
 		// Сравнение с первыми блоками
 		firstBlocksInCache := 0
 		for i := 0; i < checkLast; i++ {
-			_, found := bs.cacheGet(allBlocks[i].Cid().String())
+			_, found := cachePeek(bs, allBlocks[i].Cid().String())
 			if found {
 				firstBlocksInCache++
 			}
@@ -1576,7 +1781,7 @@ func TestCacheEviction(t *testing.T) {
 		err := bs.Put(ctx, block)
 		require.NoError(t, err)
 
-		cachedBlock, found := bs.cacheGet(block.Cid().String())
+		cachedBlock, found := cachePeek(bs, block.Cid().String())
 		assert.True(t, found, "блок должен быть найден в кэше")
 		if found {
 			assert.Equal(t, testData, cachedBlock.RawData(), "данные в кэше должны совпадать")
@@ -1586,6 +1791,887 @@ func TestCacheEviction(t *testing.T) {
 	})
 }
 
+// TestCacheStats проверяет счетчики попаданий, промахов и вытеснений кэша.
+func TestCacheStats(t *testing.T) {
+	ctx := context.Background()
+	ds := createTestDatastore(t)
+	defer ds.Close()
+	bs := NewBlockstoreWithOptions(ds, Options{CacheSize: 2})
+
+	assert.Equal(t, CacheStats{}, bs.CacheStats())
+
+	var blks []blocks.Block
+	for i := 0; i < 3; i++ {
+		blk := blocks.NewBlock([]byte(fmt.Sprintf("статистика-%d", i)))
+		require.NoError(t, bs.Put(ctx, blk))
+		blks = append(blks, blk)
+	}
+
+	// Третий блок вытеснил первый
+	stats := bs.CacheStats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(len(blks[1].RawData())+len(blks[2].RawData())), stats.Bytes)
+
+	// Два попадания и один промах; промах загружает блок и вытесняет еще один
+	for _, blk := range []blocks.Block{blks[2], blks[1], blks[0]} {
+		_, err := bs.Get(ctx, blk.Cid())
+		require.NoError(t, err)
+	}
+	stats = bs.CacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(2), stats.Evictions)
+
+	// Очистка кэша обнуляет размер, но не накопленные счетчики
+	bs.mu.Lock()
+	bs.cache.Purge()
+	bs.mu.Unlock()
+
+	stats = bs.CacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(2), stats.Evictions)
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Bytes)
+
+	_, err := bs.Get(ctx, blks[2].Cid())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), bs.CacheStats().Misses)
+}
+
+// TestNegativeCache проверяет, что повторные проверки отсутствующего блока
+// не обращаются к datastore, а запись блока инвалидирует негативный кэш.
+func TestNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	missing := blocks.NewBlock([]byte("отсутствующий блок"))
+
+	t.Run("повторная проверка без обращения к datastore", func(t *testing.T) {
+		ds := &countingDatastore{Datastore: createTestDatastore(t)}
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{NegativeCacheSize: 16})
+
+		has, err := bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.False(t, has)
+		reads := ds.reads.Load()
+		assert.Greater(t, reads, int64(0))
+
+		has, err = bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.False(t, has)
+		_, err = bs.Get(ctx, missing.Cid())
+		assert.True(t, format.IsNotFound(err), "ожидалась ошибка отсутствия блока: %v", err)
+		assert.Equal(t, reads, ds.reads.Load(), "повторные обращения не должны доходить до datastore")
+
+		// Запись блока инвалидирует негативную запись
+		require.NoError(t, bs.Put(ctx, missing))
+		has, err = bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.True(t, has)
+		got, err := bs.Get(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.Equal(t, missing.RawData(), got.RawData())
+	})
+
+	t.Run("запись истекает по TTL", func(t *testing.T) {
+		ds := &countingDatastore{Datastore: createTestDatastore(t)}
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{
+			NegativeCacheSize: 16,
+			NegativeCacheTTL:  20 * time.Millisecond,
+		})
+
+		_, err := bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		reads := ds.reads.Load()
+
+		time.Sleep(50 * time.Millisecond)
+		_, err = bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.Greater(t, ds.reads.Load(), reads)
+	})
+
+	t.Run("отключен по умолчанию", func(t *testing.T) {
+		ds := &countingDatastore{Datastore: createTestDatastore(t)}
+		defer ds.Close()
+		bs := NewBlockstore(ds)
+
+		_, err := bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		reads := ds.reads.Load()
+		_, err = bs.Has(ctx, missing.Cid())
+		require.NoError(t, err)
+		assert.Greater(t, ds.reads.Load(), reads)
+	})
+}
+
+// =====================================
+// ТЕСТЫ ЗАКРЕПЛЕНИЯ (PIN)
+// =====================================
+
+// TestPins проверяет закрепление корней и вычисление достижимого множества.
+func TestPins(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("закрепление и перечисление", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+		root, children := putTestDAG(t, bs, "a")
+		other, _ := putTestDAG(t, bs, "b")
+
+		require.NoError(t, bs.Pin(ctx, root))
+		require.NoError(t, bs.Pin(ctx, root), "повторное закрепление не ошибка")
+		require.NoError(t, bs.Pin(ctx, other))
+
+		pins, err := bs.Pins(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []cd.Cid{root, other}, pins)
+
+		pinned, err := bs.IsPinned(ctx, root)
+		require.NoError(t, err)
+		assert.True(t, pinned)
+
+		// Снятие закрепления не удаляет блоки
+		require.NoError(t, bs.Unpin(ctx, other))
+		require.NoError(t, bs.Unpin(ctx, other), "повторное снятие не ошибка")
+		pins, err = bs.Pins(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []cd.Cid{root}, pins)
+		has, err := bs.Has(ctx, other)
+		require.NoError(t, err)
+		assert.True(t, has)
+
+		// Записи закреплений не видны среди блоков
+		keys, err := bs.AllKeysChan(ctx)
+		require.NoError(t, err)
+		n := 0
+		for range keys {
+			n++
+		}
+		assert.Equal(t, 2*(len(children)+1), n)
+	})
+
+	t.Run("закрепление отсутствующего блока", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+
+		missing, err := ComputeCID([]byte("несуществующий"), uint64(cd.DagCBOR))
+		require.NoError(t, err)
+		err = bs.Pin(ctx, missing)
+		assert.Error(t, err)
+
+		pins, err := bs.Pins(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, pins)
+	})
+
+	t.Run("закрепления переживают перезапуск", func(t *testing.T) {
+		ds := createTestDatastore(t)
+		defer ds.Close()
+
+		bs := NewBlockstore(ds)
+		root, _ := putTestDAG(t, bs, "a")
+		require.NoError(t, bs.Pin(ctx, root))
+
+		reopened := NewBlockstore(ds)
+		pins, err := reopened.Pins(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []cd.Cid{root}, pins)
+	})
+
+	t.Run("достижимое множество включает закрепленные подграфы", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+		root, children := putTestDAG(t, bs, "a")
+		garbage, _ := putTestDAG(t, bs, "b")
+		require.NoError(t, bs.Pin(ctx, root))
+
+		pins, err := bs.Pins(ctx)
+		require.NoError(t, err)
+		reachable, err := bs.Reachable(ctx, pins)
+		require.NoError(t, err)
+
+		assert.True(t, reachable.Has(root))
+		for _, c := range children {
+			assert.True(t, reachable.Has(c), "дочерний блок %s должен быть достижим", c)
+		}
+		assert.False(t, reachable.Has(garbage))
+		assert.Equal(t, len(children)+1, reachable.Len())
+	})
+
+	t.Run("общие поддеревья обходятся один раз", func(t *testing.T) {
+		ds := &countingDatastore{Datastore: createTestDatastore(t)}
+		defer ds.Close()
+		bs := NewBlockstoreWithOptions(ds, Options{CacheSize: -1})
+
+		// Цепочка "ромбов": каждый узел дважды ссылается на предыдущий,
+		// поэтому путей от вершины до листа 2^depth, а блоков depth+1
+		const depth = 16
+		nb := basicnode.Prototype.String.NewBuilder()
+		require.NoError(t, nb.AssignString("общий лист"))
+		prev, err := bs.PutNode(ctx, nb.Build())
+		require.NoError(t, err)
+		for i := 0; i < depth; i++ {
+			lb := basicnode.Prototype.List.NewBuilder()
+			la, err := lb.BeginList(2)
+			require.NoError(t, err)
+			require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: prev}))
+			require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: prev}))
+			require.NoError(t, la.Finish())
+			prev, err = bs.PutNode(ctx, lb.Build())
+			require.NoError(t, err)
+		}
+		top := prev
+
+		// Второй корень разделяет с первым все поддерево
+		lb := basicnode.Prototype.List.NewBuilder()
+		la, err := lb.BeginList(1)
+		require.NoError(t, err)
+		require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: top}))
+		require.NoError(t, la.Finish())
+		other, err := bs.PutNode(ctx, lb.Build())
+		require.NoError(t, err)
+
+		unique := int64(depth + 2)
+		ds.reads.Store(0)
+		reachable, err := bs.Reachable(ctx, []cd.Cid{top, other})
+		require.NoError(t, err)
+		assert.Equal(t, int(unique), reachable.Len())
+		assert.LessOrEqual(t, ds.reads.Load(), 2*unique,
+			"каждый блок должен загружаться один раз")
+	})
+}
+
+// =====================================
+// ТЕСТЫ СБОРКИ МУСОРА
+// =====================================
+
+// TestGC проверяет, что сборка мусора удаляет только недостижимые блоки.
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("удаляет недостижимые блоки", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+		root, children := putTestDAG(t, bs, "a")
+		pinned, pinnedChildren := putTestDAG(t, bs, "b")
+		garbage, garbageChildren := putTestDAG(t, bs, "c")
+		require.NoError(t, bs.Pin(ctx, pinned))
+
+		// Прогреваем кэш мусорным блоком: после сборки он не должен читаться
+		_, err := bs.GetNode(ctx, garbage)
+		require.NoError(t, err)
+
+		deleted, err := bs.GC(ctx, []cd.Cid{root})
+		require.NoError(t, err)
+		assert.Equal(t, len(garbageChildren)+1, deleted)
+
+		for _, c := range append(append([]cd.Cid{root, pinned}, children...), pinnedChildren...) {
+			has, err := bs.Has(ctx, c)
+			require.NoError(t, err)
+			assert.True(t, has, "достижимый блок %s должен сохраниться", c)
+		}
+		for _, c := range append([]cd.Cid{garbage}, garbageChildren...) {
+			has, err := bs.Has(ctx, c)
+			require.NoError(t, err)
+			assert.False(t, has, "мусорный блок %s должен быть удален", c)
+		}
+		_, err = bs.GetNode(ctx, garbage)
+		assert.Error(t, err, "удаленный блок не должен читаться из кэша")
+
+		// Повторная сборка ничего не удаляет
+		deleted, err = bs.GC(ctx, []cd.Cid{root})
+		require.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+	})
+
+	t.Run("не удаляет блоки, записанные после пометки", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+		root, _ := putTestDAG(t, bs, "a")
+		_, garbageChildren := putTestDAG(t, bs, "c")
+
+		var fresh, rewritten cd.Cid
+		deleted, err := bs.collectGarbage(ctx, []cd.Cid{root}, func() {
+			// Новый блок и повторная запись блока, который уже помечен как мусор
+			nb := basicnode.Prototype.String.NewBuilder()
+			require.NoError(t, nb.AssignString("новый"))
+			var err error
+			fresh, err = bs.PutNode(ctx, nb.Build())
+			require.NoError(t, err)
+
+			nb = basicnode.Prototype.String.NewBuilder()
+			require.NoError(t, nb.AssignString("c-лист-0"))
+			rewritten, err = bs.PutNode(ctx, nb.Build())
+			require.NoError(t, err)
+		})
+		require.NoError(t, err)
+		require.Equal(t, garbageChildren[0], rewritten)
+
+		// Корень мусорного графа и два листа удалены, повторно записанный лист - нет
+		assert.Equal(t, 3, deleted)
+		for _, c := range []cd.Cid{fresh, rewritten} {
+			has, err := bs.Has(ctx, c)
+			require.NoError(t, err)
+			assert.True(t, has, "блок %s записан после пометки и должен сохраниться", c)
+		}
+	})
+
+	t.Run("неполный корень прерывает сборку", func(t *testing.T) {
+		bs := createTestBlockstore(t)
+		root, children := putTestDAG(t, bs, "a")
+		require.NoError(t, bs.DeleteBlock(ctx, children[1]))
+
+		deleted, err := bs.GC(ctx, []cd.Cid{root})
+		assert.Error(t, err)
+		assert.Equal(t, 0, deleted)
+
+		has, err := bs.Has(ctx, children[0])
+		require.NoError(t, err)
+		assert.True(t, has)
+	})
+}
+
+// =====================================
+// ТЕСТЫ ФИЛЬТРАЦИИ КЛЮЧЕЙ
+// =====================================
+
+// TestAllKeysChanFiltered проверяет отбор ключей по кодеку и типу мультихеша.
+func TestAllKeysChanFiltered(t *testing.T) {
+	ctx := context.Background()
+	bs := createIndexedBlockstore(t)
+
+	// collect читает канал отфильтрованных ключей целиком
+	collect := func(filter KeyFilter) []cd.Cid {
+		keys, err := bs.AllKeysChanFiltered(ctx, filter)
+		require.NoError(t, err)
+		var out []cd.Cid
+		for c := range keys {
+			out = append(out, c)
+		}
+		return out
+	}
+
+	// Raw блоки с SHA2-256 (как фрагменты файлов) и DAG-CBOR узлы с BLAKE3
+	var raw []cd.Cid
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("фрагмент %d", i))
+		h, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		blk, err := blocks.NewBlockWithCid(data, cd.NewCidV1(cd.Raw, h))
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, blk))
+		raw = append(raw, blk.Cid())
+	}
+	root, children := putTestDAG(t, bs, "a")
+	nodes := append([]cd.Cid{root}, children...)
+
+	t.Run("по кодеку", func(t *testing.T) {
+		assert.ElementsMatch(t, nodes, collect(KeyFilter{Codecs: []uint64{cd.DagCBOR}}))
+		assert.ElementsMatch(t, raw, collect(KeyFilter{Codecs: []uint64{cd.Raw}}))
+		assert.ElementsMatch(t, append(append([]cd.Cid{}, raw...), nodes...),
+			collect(KeyFilter{Codecs: []uint64{cd.Raw, cd.DagCBOR}}))
+		assert.Empty(t, collect(KeyFilter{Codecs: []uint64{cd.DagJSON}}))
+	})
+
+	t.Run("по типу мультихеша", func(t *testing.T) {
+		// Без фильтра по кодеку CID выдаются как raw, поэтому сравниваем мультихеши
+		hashes := func(cids []cd.Cid) []string {
+			var out []string
+			for _, c := range cids {
+				out = append(out, c.Hash().String())
+			}
+			return out
+		}
+		assert.ElementsMatch(t, hashes(nodes), hashes(collect(KeyFilter{MhTypes: []uint64{multihash.BLAKE3}})))
+		assert.ElementsMatch(t, hashes(raw), hashes(collect(KeyFilter{MhTypes: []uint64{multihash.SHA2_256}})))
+		assert.Len(t, collect(KeyFilter{}), len(raw)+len(nodes))
+	})
+
+	t.Run("условия объединяются по И", func(t *testing.T) {
+		assert.Empty(t, collect(KeyFilter{Codecs: []uint64{cd.Raw}, MhTypes: []uint64{multihash.BLAKE3}}))
+		assert.ElementsMatch(t, nodes, collect(KeyFilter{
+			Codecs:  []uint64{cd.DagCBOR},
+			MhTypes: []uint64{multihash.BLAKE3},
+		}))
+	})
+
+	t.Run("удаленные блоки не выдаются", func(t *testing.T) {
+		require.NoError(t, bs.DeleteBlock(ctx, raw[0]))
+		assert.ElementsMatch(t, raw[1:], collect(KeyFilter{Codecs: []uint64{cd.Raw}}))
+
+		// Сборка мусора удаляет блоки по raw CID и очищает метки индекса
+		other, _ := putTestDAG(t, bs, "b")
+		keep := append(append([]cd.Cid{}, raw[1:]...), root)
+		_, err := bs.GC(ctx, keep)
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, nodes, collect(KeyFilter{Codecs: []uint64{cd.DagCBOR}}))
+		has, err := bs.ds.Has(ctx, codecIndexKey(other))
+		require.NoError(t, err)
+		assert.False(t, has, "метка удаленного блока должна быть очищена")
+	})
+
+	t.Run("удаление блока под двумя кодеками", func(t *testing.T) {
+		// Одни и те же данные под raw и DAG-CBOR CID - один блок в хранилище
+		data := []byte{0xa0}
+		asRaw, err := ComputeCID(data, cd.Raw)
+		require.NoError(t, err)
+		asNode := cd.NewCidV1(cd.DagCBOR, asRaw.Hash())
+		for _, c := range []cd.Cid{asRaw, asNode} {
+			blk, err := blocks.NewBlockWithCid(data, c)
+			require.NoError(t, err)
+			require.NoError(t, bs.Put(ctx, blk))
+		}
+
+		require.NoError(t, bs.DeleteBlock(ctx, asRaw))
+		for _, c := range []cd.Cid{asRaw, asNode} {
+			for _, key := range []ds.Key{codecIndexKey(c), codecHashKey(c)} {
+				has, err := bs.ds.Has(ctx, key)
+				require.NoError(t, err)
+				assert.False(t, has, "метка %s должна быть удалена", key)
+			}
+		}
+	})
+
+	t.Run("индекс выключен по умолчанию", func(t *testing.T) {
+		plain := createTestBlockstore(t)
+		root, _ := putTestDAG(t, plain, "plain")
+
+		_, err := plain.AllKeysChanFiltered(ctx, KeyFilter{Codecs: []uint64{cd.DagCBOR}})
+		assert.ErrorIs(t, err, ErrCodecIndexDisabled)
+		_, err = plain.RebuildCodecIndex(ctx, []cd.Cid{root})
+		assert.ErrorIs(t, err, ErrCodecIndexDisabled)
+
+		has, err := plain.ds.Has(ctx, codecIndexKey(root))
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("перестроение индекса", func(t *testing.T) {
+		// Блоки записаны до включения индекса
+		plain := createTestBlockstore(t)
+		root, children := putTestDAG(t, plain, "old")
+		loose := blocks.NewBlock([]byte("вне графа"))
+		require.NoError(t, plain.Put(ctx, loose))
+
+		indexed := NewBlockstoreWithOptions(plain.ds, Options{CodecIndex: true})
+		keys, err := indexed.AllKeysChanFiltered(ctx, KeyFilter{Codecs: []uint64{cd.DagCBOR}})
+		require.NoError(t, err)
+		for range keys {
+			t.Fatal("до перестроения индекс пуст")
+		}
+
+		count, err := indexed.RebuildCodecIndex(ctx, []cd.Cid{root})
+		require.NoError(t, err)
+		assert.Equal(t, 1+len(children), count)
+
+		keys, err = indexed.AllKeysChanFiltered(ctx, KeyFilter{Codecs: []uint64{cd.DagCBOR}})
+		require.NoError(t, err)
+		var found []cd.Cid
+		for c := range keys {
+			found = append(found, c)
+		}
+		assert.ElementsMatch(t, append([]cd.Cid{root}, children...), found)
+
+		// Блок вне графов от корней остается без метки
+		keys, err = indexed.AllKeysChanFiltered(ctx, KeyFilter{Codecs: []uint64{cd.Raw}})
+		require.NoError(t, err)
+		for c := range keys {
+			t.Fatalf("неожиданный raw блок %s", c)
+		}
+	})
+}
+
+// TestExportSubtree проверяет экспорт подграфа, ограниченного глубиной.
+func TestExportSubtree(t *testing.T) {
+	ctx := context.Background()
+	bs := createTestBlockstore(t)
+
+	// Корень ссылается на два двухуровневых графа: всего 1 + 2*(1+3) блоков
+	a, _ := putTestDAG(t, bs, "a")
+	b, _ := putTestDAG(t, bs, "b")
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(2)
+	require.NoError(t, err)
+	require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: a}))
+	require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: b}))
+	require.NoError(t, la.Finish())
+	root, err := bs.PutNode(ctx, nb.Build())
+	require.NoError(t, err)
+
+	// exported возвращает CID блоков CAR архива
+	exported := func(export func(w io.Writer) error) []cd.Cid {
+		var buf bytes.Buffer
+		require.NoError(t, export(&buf))
+		br, err := carv2.NewBlockReader(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, []cd.Cid{root}, br.Roots)
+
+		var out []cd.Cid
+		for {
+			blk, err := br.Next()
+			if err == io.EOF {
+				return out
+			}
+			require.NoError(t, err)
+			out = append(out, blk.Cid())
+		}
+	}
+
+	full := exported(func(w io.Writer) error {
+		return bs.ExportCARV2(ctx, root, BuildSelectorNodeExploreAll(), w)
+	})
+	require.Len(t, full, 9)
+
+	depth0 := exported(func(w io.Writer) error { return bs.ExportSubtree(ctx, root, 0, w) })
+	assert.Equal(t, []cd.Cid{root}, depth0)
+
+	depth1 := exported(func(w io.Writer) error { return bs.ExportSubtree(ctx, root, 1, w) })
+	assert.ElementsMatch(t, []cd.Cid{root, a, b}, depth1)
+	assert.Less(t, len(depth1), len(full))
+
+	depth2 := exported(func(w io.Writer) error { return bs.ExportSubtree(ctx, root, 2, w) })
+	assert.ElementsMatch(t, full, depth2)
+
+	assert.Error(t, bs.ExportSubtree(ctx, root, -1, io.Discard))
+}
+
+// TestPutManyIfAbsent проверяет, что повторный импорт не записывает блоки заново.
+func TestPutManyIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	bs := createTestBlockstore(t)
+
+	var blks []blocks.Block
+	for i := 0; i < putManyBatchSize+10; i++ {
+		blks = append(blks, blocks.NewBlock([]byte(fmt.Sprintf("импорт %d", i))))
+	}
+
+	written, skipped, err := bs.PutManyIfAbsent(ctx, blks)
+	require.NoError(t, err)
+	assert.Equal(t, len(blks), written)
+	assert.Equal(t, 0, skipped)
+
+	// Повторный импорт того же набора ничего не записывает
+	written, skipped, err = bs.PutManyIfAbsent(ctx, blks)
+	require.NoError(t, err)
+	assert.Equal(t, 0, written)
+	assert.Equal(t, len(blks), skipped)
+
+	// Пересекающийся набор: записываются только новые блоки
+	extra := blocks.NewBlock([]byte("новый блок"))
+	written, skipped, err = bs.PutManyIfAbsent(ctx, []blocks.Block{blks[0], extra, blks[1]})
+	require.NoError(t, err)
+	assert.Equal(t, 1, written)
+	assert.Equal(t, 2, skipped)
+
+	usage, err := bs.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(blks)+1), usage.Blocks)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = bs.PutManyIfAbsent(cancelled, []blocks.Block{blocks.NewBlock([]byte("отмена"))})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestCopyTo проверяет перенос блоков в другой blockstore.
+func TestCopyTo(t *testing.T) {
+	ctx := context.Background()
+
+	// Источник: DAG-CBOR граф, raw блок и UnixFS файл из нескольких фрагментов
+	src := createIndexedBlockstore(t)
+	root, children := putTestDAG(t, src, "a")
+	nodes := append([]cd.Cid{root}, children...)
+	rawBlk := blocks.NewBlock([]byte("отдельный блок"))
+	require.NoError(t, src.Put(ctx, rawBlk))
+	fileData := make([]byte, DefaultChunkSize*2+100)
+	for i := range fileData {
+		fileData[i] = byte(i % 251)
+	}
+	fileCID, err := src.AddFile(ctx, bytes.NewReader(fileData), false)
+	require.NoError(t, err)
+
+	total, err := src.Usage(ctx)
+	require.NoError(t, err)
+
+	t.Run("полное копирование", func(t *testing.T) {
+		dst := createIndexedBlockstore(t)
+
+		copied, err := src.CopyTo(ctx, dst, CopyOptions{BatchSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int(total.Blocks), copied)
+
+		for _, c := range append(append([]cd.Cid{rawBlk.Cid()}, nodes...), fileCID) {
+			has, err := dst.Has(ctx, c)
+			require.NoError(t, err)
+			assert.True(t, has, "блок %s должен быть скопирован", c)
+		}
+		node, err := dst.GetNode(ctx, root)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(children)), node.Length())
+
+		reader, err := dst.GetReader(ctx, fileCID)
+		require.NoError(t, err)
+		got, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, fileData, got)
+
+		// Кодеки сохраняются: dst находит узлы фильтром по кодеку
+		keys, err := dst.AllKeysChanFiltered(ctx, KeyFilter{Codecs: []uint64{cd.DagCBOR}})
+		require.NoError(t, err)
+		var dagCBOR []cd.Cid
+		for c := range keys {
+			dagCBOR = append(dagCBOR, c)
+		}
+		assert.ElementsMatch(t, nodes, dagCBOR)
+
+		// Повторное копирование ничего не записывает
+		copied, err = src.CopyTo(ctx, dst, CopyOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, copied)
+	})
+
+	t.Run("копирование с фильтром", func(t *testing.T) {
+		dst := createIndexedBlockstore(t)
+
+		copied, err := src.CopyTo(ctx, dst, CopyOptions{Filter: KeyFilter{Codecs: []uint64{cd.DagCBOR}}})
+		require.NoError(t, err)
+		assert.Equal(t, len(nodes), copied)
+
+		has, err := dst.Has(ctx, rawBlk.Cid())
+		require.NoError(t, err)
+		assert.False(t, has)
+
+		// Без индекса кодеков фильтр по кодеку недоступен
+		plain := NewBlockstoreWithOptions(src.ds, Options{})
+		_, err = plain.CopyTo(ctx, createTestBlockstore(t), CopyOptions{Filter: KeyFilter{Codecs: []uint64{cd.DagCBOR}}})
+		assert.ErrorIs(t, err, ErrCodecIndexDisabled)
+	})
+
+	t.Run("ошибка записи прерывает копирование", func(t *testing.T) {
+		errWrite := errors.New("запись недоступна")
+		dst := &failingPutBlockstore{Blockstore: createTestBlockstore(t), err: errWrite}
+
+		copied, err := src.CopyTo(ctx, dst, CopyOptions{BatchSize: 1})
+		assert.ErrorIs(t, err, errWrite)
+		assert.Equal(t, 0, copied)
+	})
+}
+
+// =====================================
+// ТЕСТЫ ОТЧЕТА ОБ ИСПОЛЬЗОВАНИИ
+// =====================================
+
+// TestUsage проверяет подсчет размера хранилища и гистограмму размеров блоков.
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+	bs := createTestBlockstore(t)
+
+	report, err := bs.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Blocks)
+	require.Len(t, report.Buckets, 4)
+
+	sizes := []int{10, 1023, 1024, 100 << 10, DefaultChunkSize, DefaultChunkSize + 1}
+	var total int64
+	for i, size := range sizes {
+		data := make([]byte, size)
+		copy(data, fmt.Sprintf("блок %d", i))
+		require.NoError(t, bs.Put(ctx, blocks.NewBlock(data)))
+		total += int64(size)
+	}
+
+	report, err = bs.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(sizes)), report.Blocks)
+	assert.Equal(t, total, report.TotalBytes)
+
+	counts := make([]int64, len(report.Buckets))
+	for i, b := range report.Buckets {
+		counts[i] = b.Count
+	}
+	assert.Equal(t, []int64{2, 1, 2, 1}, counts)
+	assert.Equal(t, int64(10+1023), report.Buckets[0].Bytes)
+	assert.Equal(t, int64(100<<10+DefaultChunkSize), report.Buckets[2].Bytes)
+
+	// Отмененный контекст прерывает подсчет
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = bs.Usage(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestReadOnly проверяет режим только для чтения: чтение работает,
+// а операции записи возвращают ErrReadOnly
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("datastore только для чтения", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := s.NewDatastorage(dir, nil)
+		require.NoError(t, err)
+		writable := NewBlockstore(store)
+		root, children := putTestDAG(t, writable, "снимок")
+		require.NoError(t, writable.Pin(ctx, root))
+		require.NoError(t, store.Close())
+
+		ro, err := s.NewDatastorageReadOnly(dir)
+		require.NoError(t, err)
+		defer ro.Close()
+		bs := NewBlockstore(ro)
+
+		// Чтение
+		node, err := bs.GetNode(ctx, children[0])
+		require.NoError(t, err)
+		str, err := node.AsString()
+		require.NoError(t, err)
+		assert.Equal(t, "снимок-лист-0", str)
+		pinned, err := bs.IsPinned(ctx, root)
+		require.NoError(t, err)
+		assert.True(t, pinned)
+
+		// Запись
+		blk := blocks.NewBlock([]byte("новый блок"))
+		assert.ErrorIs(t, bs.Put(ctx, blk), ErrReadOnly)
+		assert.ErrorIs(t, bs.PutMany(ctx, []blocks.Block{blk}), ErrReadOnly)
+		_, _, err = bs.PutManyIfAbsent(ctx, []blocks.Block{blk})
+		assert.ErrorIs(t, err, ErrReadOnly)
+		assert.ErrorIs(t, bs.DeleteBlock(ctx, children[0]), ErrReadOnly)
+		assert.ErrorIs(t, bs.Unpin(ctx, root), ErrReadOnly)
+		_, err = bs.GC(ctx, nil)
+		assert.ErrorIs(t, err, ErrReadOnly)
+
+		nb := basicnode.Prototype.String.NewBuilder()
+		require.NoError(t, nb.AssignString("узел"))
+		_, err = bs.PutNode(ctx, nb.Build())
+		assert.ErrorIs(t, err, ErrReadOnly)
+		assert.ErrorIs(t, err, s.ErrReadOnly, "та же ошибка, что в datastore")
+
+		// Ничего не изменилось
+		has, err := bs.Has(ctx, children[0])
+		require.NoError(t, err)
+		assert.True(t, has)
+		has, err = bs.Has(ctx, blk.Cid())
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("опция ReadOnly", func(t *testing.T) {
+		writable := createTestBlockstore(t)
+		blk := blocks.NewBlock([]byte("существующий"))
+		require.NoError(t, writable.Put(ctx, blk))
+
+		bs := NewBlockstoreWithOptions(writable.Datastore(), Options{ReadOnly: true})
+		got, err := bs.Get(ctx, blk.Cid())
+		require.NoError(t, err)
+		assert.Equal(t, blk.RawData(), got.RawData())
+		assert.ErrorIs(t, bs.Put(ctx, blocks.NewBlock([]byte("новый"))), ErrReadOnly)
+		assert.ErrorIs(t, bs.DeleteBlock(ctx, blk.Cid()), ErrReadOnly)
+		assert.ErrorIs(t, bs.Pin(ctx, blk.Cid()), ErrReadOnly)
+	})
+}
+
+// TestMetrics проверяет, что операции blockstore передают метрики
+// с правильными метками и в порядке операций
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := s.NewMemoryMetrics()
+	bs := NewBlockstoreWithOptions(createTestDatastore(t), Options{Metrics: m})
+
+	blk := blocks.NewBlock([]byte("блок с метриками"))
+	missing := blocks.NewBlock([]byte("отсутствующий блок"))
+	require.NoError(t, bs.Put(ctx, blk))
+	_, err := bs.Get(ctx, blk.Cid()) // из кэша
+	require.NoError(t, err)
+	_, err = bs.Get(ctx, missing.Cid())
+	require.True(t, format.IsNotFound(err))
+	require.NoError(t, bs.PutMany(ctx, []blocks.Block{missing}))
+	require.NoError(t, bs.DeleteBlock(ctx, blk.Cid()))
+
+	var names []string
+	for _, ev := range m.Events() {
+		assert.Equal(t, s.ComponentBlockstore, ev.Component)
+		assert.NoError(t, ev.Err)
+		names = append(names, ev.Name)
+	}
+	assert.Equal(t, []string{
+		s.MetricPut,
+		s.MetricHit, s.MetricGet,
+		s.MetricMiss, s.MetricGet,
+		s.MetricPut,
+		s.MetricDelete,
+	}, names)
+
+	// Ошибка операции передается в метрики
+	m.Reset()
+	ro := NewBlockstoreWithOptions(bs.Datastore(), Options{ReadOnly: true, Metrics: m})
+	assert.ErrorIs(t, ro.Put(ctx, blk), ErrReadOnly)
+	events := m.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, s.MetricPut, events[0].Name)
+	assert.ErrorIs(t, events[0].Err, ErrReadOnly)
+}
+
+// TestComputeCID проверяет, что вычисленные CID детерминированы и совпадают
+// с CID, которые присваивает blockstore при записи
+func TestComputeCID(t *testing.T) {
+	ctx := context.Background()
+	bs := createTestBlockstore(t)
+
+	t.Run("данные", func(t *testing.T) {
+		data := []byte("одинаковые данные")
+		c1, err := ComputeCID(data, uint64(cd.Raw))
+		require.NoError(t, err)
+		c2, err := ComputeCID(data, uint64(cd.Raw))
+		require.NoError(t, err)
+		assert.Equal(t, c1, c2)
+
+		assert.Equal(t, uint64(1), c1.Version())
+		assert.Equal(t, uint64(cd.Raw), c1.Prefix().Codec)
+		assert.Equal(t, uint64(multihash.BLAKE3), c1.Prefix().MhType)
+
+		// Кодек входит в CID, мультихеш - нет
+		c3, err := ComputeCID(data, uint64(cd.DagCBOR))
+		require.NoError(t, err)
+		assert.NotEqual(t, c1, c3)
+		assert.Equal(t, c1.Hash(), c3.Hash())
+
+		other, err := ComputeCID([]byte("другие данные"), uint64(cd.Raw))
+		require.NoError(t, err)
+		assert.NotEqual(t, c1, other)
+	})
+
+	t.Run("узел совпадает с PutNode", func(t *testing.T) {
+		nb := basicnode.Prototype.Map.NewBuilder()
+		ma, err := nb.BeginMap(2)
+		require.NoError(t, err)
+		require.NoError(t, ma.AssembleKey().AssignString("text"))
+		require.NoError(t, ma.AssembleValue().AssignString("привет"))
+		require.NoError(t, ma.AssembleKey().AssignString("likes"))
+		require.NoError(t, ma.AssembleValue().AssignInt(42))
+		require.NoError(t, ma.Finish())
+		node := nb.Build()
+
+		computed, err := ComputeNodeCID(node)
+		require.NoError(t, err)
+		again, err := ComputeNodeCID(node)
+		require.NoError(t, err)
+		assert.Equal(t, computed, again)
+
+		has, err := bs.Has(ctx, computed)
+		require.NoError(t, err)
+		assert.False(t, has, "вычисление CID ничего не записывает")
+
+		stored, err := bs.PutNode(ctx, node)
+		require.NoError(t, err)
+		assert.Equal(t, stored, computed)
+
+		// Данные блока дают тот же CID через ComputeCID
+		blk, err := bs.Get(ctx, stored)
+		require.NoError(t, err)
+		fromData, err := ComputeCID(blk.RawData(), uint64(cd.DagCBOR))
+		require.NoError(t, err)
+		assert.Equal(t, stored, fromData)
+	})
+}
+
 // =====================================
 // ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ
 // =====================================
@@ -1604,6 +2690,22 @@ func createTestBlockstore(t *testing.T) *blockstore {
 	return NewBlockstore(ds)
 }
 
+// createIndexedBlockstore создает blockstore с индексом кодеков для тестов.
+func createIndexedBlockstore(t *testing.T) *blockstore {
+	return NewBlockstoreWithOptions(createTestBlockstore(t).ds, Options{CodecIndex: true})
+}
+
+// failingPutBlockstore возвращает ошибку err из PutMany.
+type failingPutBlockstore struct {
+	Blockstore
+	err error
+}
+
+// PutMany возвращает заданную ошибку, ничего не записывая.
+func (f *failingPutBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return f.err
+}
+
 // createBenchBlockstore создает blockstore для бенчмарков.
 func createBenchBlockstore(b *testing.B) *blockstore {
 	tmpDir, err := os.MkdirTemp("", "blockstore_bench_*")
@@ -1636,6 +2738,64 @@ func createTestDatastore(t *testing.T) s.Datastore {
 	return ds
 }
 
+// countingDatastore считает чтения (Has и Get) из datastore.
+type countingDatastore struct {
+	s.Datastore
+	reads atomic.Int64
+}
+
+// Has увеличивает счетчик чтений и делегирует вызов.
+func (c *countingDatastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	c.reads.Add(1)
+	return c.Datastore.Has(ctx, key)
+}
+
+// Get увеличивает счетчик чтений и делегирует вызов.
+func (c *countingDatastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	c.reads.Add(1)
+	return c.Datastore.Get(ctx, key)
+}
+
+// cachePeek проверяет наличие блока в кэше по строке CID, не изменяя
+// статистику кэша и порядок вытеснения LRU.
+func cachePeek(bs *blockstore, key string) (blocks.Block, bool) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	if bs.cache == nil {
+		return nil, false
+	}
+	return bs.cache.Peek(key)
+}
+
+// putTestDAG сохраняет двухуровневый DAG-CBOR граф: корень со ссылками на
+// три листа. tag делает графы с разными тегами различными.
+func putTestDAG(t *testing.T, bs *blockstore, tag string) (cd.Cid, []cd.Cid) {
+	t.Helper()
+	ctx := context.Background()
+
+	var children []cd.Cid
+	for i := 0; i < 3; i++ {
+		nb := basicnode.Prototype.String.NewBuilder()
+		require.NoError(t, nb.AssignString(fmt.Sprintf("%s-лист-%d", tag, i)))
+		c, err := bs.PutNode(ctx, nb.Build())
+		require.NoError(t, err)
+		children = append(children, c)
+	}
+
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(int64(len(children)))
+	require.NoError(t, err)
+	for _, c := range children {
+		require.NoError(t, la.AssembleValue().AssignLink(cidlink.Link{Cid: c}))
+	}
+	require.NoError(t, la.Finish())
+
+	root, err := bs.PutNode(ctx, nb.Build())
+	require.NoError(t, err)
+	return root, children
+}
+
 // min возвращает минимальное из двух значений (для Go < 1.21).
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,67 @@
+package blockstore
+
+import (
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// Политика версий CID
+//
+// Один и тот же блок DAG-PB с хешем SHA2-256 адресуется двумя CID: CIDv0
+// (так создает blocks.NewBlock и UnixFS) и эквивалентным CIDv1 с кодеком
+// DagProtobuf. Blockstore считает их одним блоком:
+//   - datastore хранит блоки по мультихешу, поэтому Has, Get, GetSize,
+//     View и DeleteBlock находят блок по любой из форм, независимо от того,
+//     под какой формой он был записан;
+//   - кэш блоков индексирован строкой CID, поэтому Get при промахе по
+//     запрошенной форме пробует эквивалентную;
+//   - Get всегда возвращает блок с запрошенным CID, даже если блок найден
+//     в кэше под другой формой;
+//   - DeleteBlock удаляет из кэша обе формы.
+//
+// Для остальных CID (другие кодеки или хеш-функции) CIDv0 не существует,
+// и нормализация не применяется.
+
+// equivalentCid возвращает эквивалентную форму CID другой версии
+// или cid.Undef, если ее не существует
+func equivalentCid(c cid.Cid) cid.Cid {
+	switch c.Version() {
+	case 0:
+		return cid.NewCidV1(cid.DagProtobuf, c.Hash())
+	case 1:
+		p := c.Prefix()
+		if p.Codec == cid.DagProtobuf && p.MhType == multihash.SHA2_256 && p.MhLength == 32 {
+			return cid.NewCidV0(c.Hash())
+		}
+	}
+	return cid.Undef
+}
+
+// cacheLookup ищет блок в кэше по CID и его эквивалентной форме.
+// Найденный под другой формой блок возвращается с запрошенным CID.
+// Обращение учитывается в статистике кэша один раз.
+func (bs *blockstore) cacheLookup(c cid.Cid) (blocks.Block, bool) {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	if bs.cache == nil {
+		return nil, false
+	}
+
+	if blk, ok := bs.cache.Get(c.String()); ok {
+		bs.cacheHits.Add(1)
+		return blk, true
+	}
+	if alt := equivalentCid(c); alt.Defined() {
+		if blk, ok := bs.cache.Get(alt.String()); ok {
+			if rewrapped, err := blocks.NewBlockWithCid(blk.RawData(), c); err == nil {
+				bs.cacheHits.Add(1)
+				return rewrapped, true
+			}
+		}
+	}
+
+	bs.cacheMisses.Add(1)
+	return nil, false
+}
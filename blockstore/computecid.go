@@ -0,0 +1,63 @@
+package blockstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// ComputeCID вычисляет CID данных с кодеком codec по каноническому
+// префиксу DefaultLP (CIDv1, BLAKE3), не обращаясь к хранилищу. Блок
+// с этими данными и кодеком, записанный в blockstore, получит тот же CID.
+//
+// Параметры:
+//   - data: содержимое блока
+//   - codec: кодек CID (например, cid.Raw или cid.DagCBOR)
+//
+// Возвращает:
+//   - cid.Cid: CID данных
+//   - error: ошибка вычисления мультихеша
+//
+// Пример использования:
+//
+//	c, err := blockstore.ComputeCID(data, cid.Raw)
+//	blk, err := blocks.NewBlockWithCid(data, c)
+func ComputeCID(data []byte, codec uint64) (cid.Cid, error) {
+	prefix := DefaultLP.Prefix
+	prefix.Codec = codec
+
+	c, err := prefix.Sum(data)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("compute CID: %w", err)
+	}
+	return c, nil
+}
+
+// ComputeNodeCID кодирует узел в DAG-CBOR и вычисляет его CID так же,
+// как PutNode, но без записи в хранилище. Полезно, чтобы заранее узнать
+// CID записи или проверить, сохранен ли узел.
+//
+// Параметры:
+//   - node: IPLD узел
+//
+// Возвращает:
+//   - cid.Cid: CID, который PutNode вернет для этого узла
+//   - error: ошибка кодирования узла
+//
+// Пример использования:
+//
+//	c, err := blockstore.ComputeNodeCID(node)
+//	if err != nil {
+//	    return err
+//	}
+//	exists, err := bs.Has(ctx, c)
+func ComputeNodeCID(node datamodel.Node) (cid.Cid, error) {
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(node, &buf); err != nil {
+		return cid.Undef, fmt.Errorf("encode node: %w", err)
+	}
+	return ComputeCID(buf.Bytes(), cid.DagCBOR)
+}
@@ -0,0 +1,140 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// DefaultCopyBatchSize - размер пакета записи CopyTo по умолчанию (в блоках).
+const DefaultCopyBatchSize = 256
+
+// CopyOptions задает параметры CopyTo.
+type CopyOptions struct {
+	// Filter ограничивает копируемые блоки (см. AllKeysChanFiltered).
+	// Нулевой фильтр копирует все блоки. Фильтр по кодеку требует
+	// Options.CodecIndex у источника.
+	Filter KeyFilter
+
+	// BatchSize - число блоков в одном вызове dst.PutMany
+	// (0 - DefaultCopyBatchSize).
+	BatchSize int
+}
+
+// CopyTo копирует блоки в другой blockstore, например при переносе данных
+// в новый datastore. Блоки, уже присутствующие в dst, пропускаются, поэтому
+// прерванное копирование можно безопасно повторить.
+//
+// Копирование потоковое: блоки читаются по одному и записываются пакетами
+// по BatchSize. Сначала копируются блоки из индекса кодеков (с настоящими
+// кодеками CID, чтобы dst смог фильтровать их по кодеку), затем - остальные
+// блоки из AllKeysChan (если фильтр не ограничивает кодеки). Блоки читаются
+// в обход кэша, чтобы массовое копирование не вытесняло горячие данные.
+//
+// Если индекс кодеков выключен, первый проход пропускается и все блоки
+// копируются как raw; фильтр по кодеку в этом случае возвращает
+// ErrCodecIndexDisabled.
+//
+// Возвращает количество записанных в dst блоков.
+func (bs *blockstore) CopyTo(ctx context.Context, dst Blockstore, opts CopyOptions) (int, error) {
+	if len(opts.Filter.Codecs) > 0 && !bs.codecIndex {
+		return 0, ErrCodecIndexDisabled
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultCopyBatchSize
+	}
+
+	copied := 0
+	batch := make([]blocks.Block, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.PutMany(ctx, batch); err != nil {
+			return fmt.Errorf("write batch: %w", err)
+		}
+		copied += len(batch)
+		// dst может удерживать переданный срез, поэтому буфер не переиспользуем
+		batch = make([]blocks.Block, 0, batchSize)
+		return nil
+	}
+
+	// copyKeys копирует блоки из канала ключей, открытого open. Канал
+	// открывается с собственным контекстом, отмена которого при выходе
+	// (в том числе по ошибке) останавливает перебор ключей, не дочитывая их
+	copyKeys := func(open func(context.Context) (<-chan cid.Cid, error)) error {
+		keysCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		keys, err := open(keysCtx)
+		if err != nil {
+			return err
+		}
+		for c := range keys {
+			if err := bs.copyBlock(ctx, dst, c, &batch); err != nil {
+				return err
+			}
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return ctx.Err()
+	}
+
+	// Блоки с известным кодеком; пакет записывается до второго прохода,
+	// чтобы dst.Has видел все уже скопированные блоки
+	if bs.codecIndex {
+		err := copyKeys(func(ctx context.Context) (<-chan cid.Cid, error) {
+			return bs.indexedKeysChan(ctx, opts.Filter), nil
+		})
+		if err != nil {
+			return copied, err
+		}
+		if err := flush(); err != nil {
+			return copied, err
+		}
+	}
+
+	// Блоки вне индекса кодеков (записанные до его появления)
+	if len(opts.Filter.Codecs) == 0 {
+		err := copyKeys(func(ctx context.Context) (<-chan cid.Cid, error) {
+			return bs.AllKeysChanFiltered(ctx, opts.Filter)
+		})
+		if err != nil {
+			return copied, err
+		}
+	}
+
+	if err := flush(); err != nil {
+		return copied, err
+	}
+	return copied, nil
+}
+
+// copyBlock добавляет блок c в пакет batch, если его еще нет в dst
+func (bs *blockstore) copyBlock(ctx context.Context, dst Blockstore, c cid.Cid, batch *[]blocks.Block) error {
+	has, err := dst.Has(ctx, c)
+	if err != nil {
+		return fmt.Errorf("check %s: %w", c, err)
+	}
+	if has {
+		return nil
+	}
+	blk, err := bs.Blockstore.Get(ctx, c)
+	if format.IsNotFound(err) {
+		// Удален во время копирования
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", c, err)
+	}
+	*batch = append(*batch, blk)
+	return nil
+}
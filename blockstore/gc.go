@@ -0,0 +1,167 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// trackAdded регистрирует CID записываемых блоков, если идет сборка мусора.
+//
+// Put и PutMany вызывают его до сохранения блоков. Фаза очистки проверяет
+// и удаляет каждый блок под той же блокировкой, поэтому конкурентная
+// запись либо регистрируется раньше проверки (блок пропускается), либо
+// выполняется после удаления (блок записывается заново). Так не теряются
+// и повторно записанные копии блоков, бывших мусором на момент пометки.
+func (bs *blockstore) trackAdded(cids ...cid.Cid) {
+	bs.gcTrackMu.Lock()
+	defer bs.gcTrackMu.Unlock()
+
+	if bs.gcAdded == nil {
+		return
+	}
+	for _, c := range cids {
+		bs.gcAdded[string(c.Hash())] = struct{}{}
+	}
+}
+
+// GC выполняет сборку мусора методом пометки и очистки (mark-and-sweep).
+//
+// Живыми считаются блоки, достижимые от roots и от закрепленных корней
+// (Pins). Все остальные блоки, существовавшие к началу сборки, удаляются.
+// Блоки, записанные после начала фазы пометки, не удаляются, поэтому
+// сборку можно выполнять параллельно с чтением и записью. Одновременно
+// выполняется не более одной сборки.
+//
+// Корни должны быть полными: отсутствие любого достижимого блока
+// прерывает сборку до удаления чего-либо.
+//
+// Возвращает количество удаленных блоков. При ошибке во время очистки
+// возвращается количество блоков, удаленных до ошибки.
+func (bs *blockstore) GC(ctx context.Context, roots []cid.Cid) (int, error) {
+	return bs.collectGarbage(ctx, roots, nil)
+}
+
+// collectGarbage реализует GC; afterMark вызывается между пометкой и
+// очисткой и позволяет тестам воспроизвести конкурентную запись.
+func (bs *blockstore) collectGarbage(ctx context.Context, roots []cid.Cid, afterMark func()) (int, error) {
+	if bs.readOnly {
+		return 0, ErrReadOnly
+	}
+	bs.gcMu.Lock()
+	defer bs.gcMu.Unlock()
+
+	// === Отсечка: начинаем отслеживать новые блоки ===
+	bs.gcTrackMu.Lock()
+	bs.gcAdded = make(map[string]struct{})
+	bs.gcTrackMu.Unlock()
+	defer func() {
+		bs.gcTrackMu.Lock()
+		bs.gcAdded = nil
+		bs.gcTrackMu.Unlock()
+	}()
+
+	// === Кандидаты: блоки, существующие к началу сборки ===
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list blocks: %w", err)
+	}
+	var candidates []cid.Cid
+	for c := range keys {
+		candidates = append(candidates, c)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// === Пометка ===
+	pins, err := bs.Pins(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list pins: %w", err)
+	}
+	reachable, err := bs.Reachable(ctx, append(append([]cid.Cid{}, roots...), pins...))
+	if err != nil {
+		return 0, fmt.Errorf("mark: %w", err)
+	}
+	// AllKeysChan восстанавливает CID из ключей как raw CIDv1, поэтому
+	// блоки сопоставляются по мультихешу, а не по CID целиком
+	live := make(map[string]struct{}, reachable.Len())
+	_ = reachable.ForEach(func(c cid.Cid) error {
+		live[string(c.Hash())] = struct{}{}
+		return nil
+	})
+
+	if afterMark != nil {
+		afterMark()
+	}
+
+	// === Очистка ===
+	deleted := make(map[string]struct{})
+	defer bs.uncacheHashes(deleted)
+
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return len(deleted), err
+		}
+		if _, ok := live[string(c.Hash())]; ok {
+			continue
+		}
+
+		removed, err := bs.sweepBlock(ctx, c)
+		if err != nil {
+			return len(deleted), fmt.Errorf("delete %s: %w", c, err)
+		}
+		if removed {
+			deleted[string(c.Hash())] = struct{}{}
+		}
+	}
+
+	// Удаленные блоки оставляют метки в индексе кодеков
+	if len(deleted) > 0 {
+		if err := bs.pruneCodecIndex(ctx); err != nil {
+			return len(deleted), fmt.Errorf("prune codec index: %w", err)
+		}
+	}
+
+	return len(deleted), nil
+}
+
+// sweepBlock удаляет блок, если он не был записан после начала сборки
+func (bs *blockstore) sweepBlock(ctx context.Context, c cid.Cid) (bool, error) {
+	bs.gcTrackMu.Lock()
+	defer bs.gcTrackMu.Unlock()
+
+	if _, ok := bs.gcAdded[string(c.Hash())]; ok {
+		return false, nil
+	}
+	if err := bs.DeleteBlock(ctx, c); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// uncacheHashes удаляет из кэша блоки с указанными мультихешами.
+// Кэш индексирован строкой CID, а очистка знает только мультихеш
+// (кодек в CID из AllKeysChan потерян), поэтому ключи кэша перебираются.
+func (bs *blockstore) uncacheHashes(hashes map[string]struct{}) {
+	if len(hashes) == 0 {
+		return
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.cache == nil {
+		return
+	}
+	for _, key := range bs.cache.Keys() {
+		c, err := cid.Decode(key)
+		if err != nil {
+			continue
+		}
+		if _, ok := hashes[string(c.Hash())]; ok {
+			bs.cache.Remove(key)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package blockstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ipfs/boxo/datastore/dshelp"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// codecIndexPrefix - зарезервированный префикс индекса кодеков.
+//
+// Базовый blockstore хранит блоки по мультихешу, поэтому кодек CID при
+// записи теряется (AllKeysChan возвращает все ключи как raw CIDv1). Чтобы
+// фильтровать по кодеку без чтения блоков, при включенном Options.CodecIndex
+// Put и PutMany записывают пустую метку /codecs/<кодек>/<мультихеш> и
+// обратную метку /codechashes/<мультихеш>/<кодек>. По обратным меткам
+// DeleteBlock удаляет метки всех кодеков, под которыми был записан блок.
+// Метки блоков, удаленных сборкой мусора, очищаются ею же. Для блоков,
+// записанных до включения индекса, метки создает RebuildCodecIndex.
+var codecIndexPrefix = ds.NewKey("/codecs")
+
+// codecHashPrefix - префикс обратных меток индекса кодеков
+var codecHashPrefix = ds.NewKey("/codechashes")
+
+// ErrCodecIndexDisabled возвращается фильтрацией и копированием по кодеку
+// и RebuildCodecIndex, если индекс кодеков не включен в Options.
+var ErrCodecIndexDisabled = errors.New("blockstore: codec index is disabled")
+
+// codecPrefix возвращает префикс меток индекса для кодека
+func codecPrefix(codec uint64) ds.Key {
+	return codecIndexPrefix.ChildString(strconv.FormatUint(codec, 10))
+}
+
+// codecIndexKey возвращает ключ метки индекса кодеков для блока
+func codecIndexKey(c cid.Cid) ds.Key {
+	return codecPrefix(c.Type()).Child(dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// codecHashesPrefix возвращает префикс обратных меток мультихеша блока
+func codecHashesPrefix(c cid.Cid) ds.Key {
+	return codecHashPrefix.Child(dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// codecHashKey возвращает ключ обратной метки индекса кодеков для блока
+func codecHashKey(c cid.Cid) ds.Key {
+	return codecHashesPrefix(c).ChildString(strconv.FormatUint(c.Type(), 10))
+}
+
+// KeyFilter задает условия отбора ключей для AllKeysChanFiltered.
+// Пустой список означает отсутствие ограничения; заданные условия
+// объединяются по И.
+type KeyFilter struct {
+	// Codecs - допустимые кодеки CID (например, cid.DagCBOR, cid.Raw).
+	Codecs []uint64
+
+	// MhTypes - допустимые типы мультихеша (например, multihash.BLAKE3).
+	MhTypes []uint64
+}
+
+// matchesHash проверяет условие по типу мультихеша
+func (f KeyFilter) matchesHash(c cid.Cid) bool {
+	return len(f.MhTypes) == 0 || slices.Contains(f.MhTypes, c.Prefix().MhType)
+}
+
+// AllKeysChanFiltered возвращает CID блоков, удовлетворяющих фильтру.
+//
+// Фильтр применяется на уровне ключей datastore, без чтения данных блоков:
+//   - без Codecs перебираются ключи блоков (как в AllKeysChan), а CID
+//     отбрасываются по типу мультихеша до выдачи в канал;
+//   - с Codecs перебираются только метки индекса кодеков указанных кодеков,
+//     поэтому блоки других кодеков (например, фрагменты файлов) не читаются
+//     вовсе. Такие CID выдаются с настоящим кодеком.
+//
+// Фильтр по кодеку требует Options.CodecIndex, иначе возвращается
+// ErrCodecIndexDisabled. Индекс ведется для блоков, записанных через этот
+// blockstore при включенном индексе; блоки, записанные раньше или в обход
+// blockstore, находятся только после RebuildCodecIndex. Как и AllKeysChan,
+// при ошибке итерации канал закрывается досрочно; отмена ctx прекращает
+// перебор.
+func (bs *blockstore) AllKeysChanFiltered(ctx context.Context, filter KeyFilter) (<-chan cid.Cid, error) {
+	if len(filter.Codecs) == 0 {
+		keys, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan cid.Cid)
+		go func() {
+			defer close(out)
+			for c := range keys {
+				if !filter.matchesHash(c) {
+					continue
+				}
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+
+	if !bs.codecIndex {
+		return nil, ErrCodecIndexDisabled
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for _, codec := range filter.Codecs {
+			if !bs.sendIndexedKeys(ctx, codecPrefix(codec), filter, out) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// indexedKeysChan возвращает CID всех блоков из индекса кодеков (с их
+// настоящими кодеками), удовлетворяющих фильтру
+func (bs *blockstore) indexedKeysChan(ctx context.Context, filter KeyFilter) <-chan cid.Cid {
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		bs.sendIndexedKeys(ctx, codecIndexPrefix, filter, out)
+	}()
+	return out
+}
+
+// sendIndexedKeys выдает в out блоки из меток индекса кодеков под prefix.
+// Возвращает false, если перебор нужно прекратить (ошибка или отмена).
+func (bs *blockstore) sendIndexedKeys(ctx context.Context, prefix ds.Key, filter KeyFilter, out chan<- cid.Cid) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys, errc, err := bs.ds.Keys(ctx, prefix)
+	if err != nil {
+		return false
+	}
+	// При досрочном выходе дочитываем канал, чтобы итератор datastore завершился
+	defer func() {
+		cancel()
+		for range keys {
+		}
+	}()
+
+	for key := range keys {
+		// Ключ метки: /codecs/<кодек>/<мультихеш>
+		codecKey := key.Parent()
+		if !codecKey.Parent().Equal(codecIndexPrefix) {
+			continue
+		}
+		codec, err := strconv.ParseUint(codecKey.BaseNamespace(), 10, 64)
+		if err != nil {
+			continue
+		}
+		// Префикс datastore не учитывает границы сегментов: /codecs/85 и /codecs/850
+		if len(filter.Codecs) > 0 && !slices.Contains(filter.Codecs, codec) {
+			continue
+		}
+		h, err := dshelp.DsKeyToMultihash(ds.NewKey(key.BaseNamespace()))
+		if err != nil {
+			continue
+		}
+		c := cid.NewCidV1(codec, h)
+		if !filter.matchesHash(c) {
+			continue
+		}
+
+		// Метка могла пережить блок (например, удаленный по CID с другим кодеком)
+		has, err := bs.Blockstore.Has(ctx, c)
+		if err != nil {
+			return false
+		}
+		if !has {
+			continue
+		}
+
+		select {
+		case out <- c:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return <-errc == nil
+}
+
+// indexCodecs записывает метки индекса кодеков для записанных блоков.
+// Ничего не делает, если индекс кодеков выключен.
+func (bs *blockstore) indexCodecs(ctx context.Context, cids ...cid.Cid) error {
+	if !bs.codecIndex {
+		return nil
+	}
+
+	batch, err := bs.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range cids {
+		if err := batch.Put(ctx, codecIndexKey(c), []byte{}); err != nil {
+			return err
+		}
+		if err := batch.Put(ctx, codecHashKey(c), []byte{}); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+// unindexCodecs удаляет метки индекса кодеков удаленного блока c под всеми
+// кодеками, найденными по обратным меткам его мультихеша
+func (bs *blockstore) unindexCodecs(ctx context.Context, c cid.Cid) error {
+	if !bs.codecIndex {
+		return nil
+	}
+
+	prefix := codecHashesPrefix(c)
+	keys, errc, err := bs.ds.Keys(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	// Метка кодека из самого CID удаляется, даже если обратной метки нет
+	stale := []cid.Cid{c}
+	for key := range keys {
+		// Префикс datastore не учитывает границы сегментов
+		if !key.Parent().Equal(prefix) {
+			continue
+		}
+		codec, err := strconv.ParseUint(key.BaseNamespace(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if codec != c.Type() {
+			stale = append(stale, cid.NewCidV1(codec, c.Hash()))
+		}
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	batch, err := bs.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sc := range stale {
+		if err := batch.Delete(ctx, codecIndexKey(sc)); err != nil {
+			return err
+		}
+		if err := batch.Delete(ctx, codecHashKey(sc)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+// RebuildCodecIndex создает метки индекса кодеков для блоков, достижимых
+// от roots и от закрепленных корней, и удаляет метки отсутствующих блоков.
+//
+// Нужен после включения Options.CodecIndex для хранилища с уже записанными
+// блоками: кодек блока известен только из ссылок на него, поэтому метки
+// получают блоки, найденные обходом графов от корней (с кодеками из ссылок).
+// Блоки, недостижимые от корней, остаются без меток. Как и GC, выполняется
+// под блокировкой сборки мусора; отсутствие достижимого блока - ошибка.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//   - roots: корни графов, блоки которых нужно проиндексировать
+//
+// Возвращает:
+//   - int: количество блоков, получивших метки
+//   - error: ErrCodecIndexDisabled, ErrReadOnly, ошибка обхода или записи
+//
+// Пример использования:
+//
+//	bs := blockstore.NewBlockstoreWithOptions(ds, blockstore.Options{CodecIndex: true})
+//	indexed, err := bs.RebuildCodecIndex(ctx, []cid.Cid{repoRoot})
+func (bs *blockstore) RebuildCodecIndex(ctx context.Context, roots []cid.Cid) (int, error) {
+	if bs.readOnly {
+		return 0, ErrReadOnly
+	}
+	if !bs.codecIndex {
+		return 0, ErrCodecIndexDisabled
+	}
+	bs.gcMu.Lock()
+	defer bs.gcMu.Unlock()
+
+	// Отслеживаем конкурентные записи, чтобы очистка не удалила их метки
+	bs.gcTrackMu.Lock()
+	bs.gcAdded = make(map[string]struct{})
+	bs.gcTrackMu.Unlock()
+	defer func() {
+		bs.gcTrackMu.Lock()
+		bs.gcAdded = nil
+		bs.gcTrackMu.Unlock()
+	}()
+
+	pins, err := bs.Pins(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list pins: %w", err)
+	}
+	reachable, err := bs.Reachable(ctx, append(append([]cid.Cid{}, roots...), pins...))
+	if err != nil {
+		return 0, fmt.Errorf("walk roots: %w", err)
+	}
+
+	cids := make([]cid.Cid, 0, reachable.Len())
+	_ = reachable.ForEach(func(c cid.Cid) error {
+		cids = append(cids, c)
+		return nil
+	})
+	for start := 0; start < len(cids); start += putManyBatchSize {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		end := min(start+putManyBatchSize, len(cids))
+		if err := bs.indexCodecs(ctx, cids[start:end]...); err != nil {
+			return 0, fmt.Errorf("index codecs: %w", err)
+		}
+	}
+
+	if err := bs.pruneCodecIndex(ctx); err != nil {
+		return 0, fmt.Errorf("prune codec index: %w", err)
+	}
+	return len(cids), nil
+}
+
+// pruneCodecIndex удаляет метки индекса кодеков (прямые и обратные), блоки
+// которых отсутствуют. Вызывается сборкой мусора и RebuildCodecIndex (пока
+// активно отслеживание gcAdded): сборка удаляет блоки по raw CID из
+// AllKeysChan и не знает их настоящих кодеков.
+func (bs *blockstore) pruneCodecIndex(ctx context.Context) error {
+	keys, errc, err := bs.ds.Keys(ctx, codecIndexPrefix)
+	if err != nil {
+		return err
+	}
+
+	type staleMark struct {
+		key  ds.Key
+		c    cid.Cid
+		hash string
+	}
+	var stale []staleMark
+	for key := range keys {
+		codec, err := strconv.ParseUint(key.Parent().BaseNamespace(), 10, 64)
+		if err != nil {
+			continue
+		}
+		h, err := dshelp.DsKeyToMultihash(ds.NewKey(key.BaseNamespace()))
+		if err != nil {
+			continue
+		}
+		has, err := bs.Blockstore.Has(ctx, cid.NewCidV1(cid.Raw, h))
+		if err != nil {
+			for range keys {
+			}
+			return err
+		}
+		if !has {
+			stale = append(stale, staleMark{key: key, c: cid.NewCidV1(codec, h), hash: string(h)})
+		}
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	// Блок мог быть записан заново после проверки: Put регистрирует его
+	// в gcAdded до записи, поэтому такие метки пропускаются
+	bs.gcTrackMu.Lock()
+	defer bs.gcTrackMu.Unlock()
+	for _, m := range stale {
+		if _, ok := bs.gcAdded[m.hash]; ok {
+			continue
+		}
+		if err := bs.ds.Delete(ctx, m.key); err != nil {
+			return err
+		}
+		if err := bs.ds.Delete(ctx, codecHashKey(m.c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
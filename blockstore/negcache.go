@@ -0,0 +1,84 @@
+package blockstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/ipfs/go-cid"
+)
+
+// DefaultNegativeCacheTTL - время жизни записи негативного кэша по умолчанию.
+// Короткое, так как блок может появиться в datastore в обход blockstore
+// (например, при записи другим процессом в общий datastore).
+const DefaultNegativeCacheTTL = 5 * time.Second
+
+// negativeCache запоминает недавно отсутствовавшие блоки, чтобы повторные
+// Has/Get для них не обращались к datastore.
+//
+// Ключ - мультихеш: базовый blockstore хранит блоки по мультихешу, поэтому
+// отсутствие блока не зависит от версии и кодека CID.
+//
+// Запись, добавленная конкурентно с Put того же блока, могла бы пережить
+// его инвалидацию и скрыть записанный блок. Поэтому Put инвалидирует кэш
+// после записи и увеличивает поколение gen, а промах запоминается, только
+// если поколение не изменилось с момента перед обращением к datastore.
+type negativeCache struct {
+	mu      sync.Mutex
+	gen     uint64
+	entries *expirable.LRU[string, struct{}]
+}
+
+// newNegativeCache создает негативный кэш на size записей с временем жизни ttl
+func newNegativeCache(size int, ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		ttl = DefaultNegativeCacheTTL
+	}
+	return &negativeCache{
+		entries: expirable.NewLRU[string, struct{}](size, nil, ttl),
+	}
+}
+
+// missing сообщает, известно ли, что блок недавно отсутствовал
+func (n *negativeCache) missing(c cid.Cid) bool {
+	if n == nil {
+		return false
+	}
+	_, ok := n.entries.Get(string(c.Hash()))
+	return ok
+}
+
+// generation возвращает текущее поколение; вызывается перед обращением к datastore
+func (n *negativeCache) generation() uint64 {
+	if n == nil {
+		return 0
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.gen
+}
+
+// remember запоминает отсутствие блока, если с момента generation не было записей
+func (n *negativeCache) remember(c cid.Cid, gen uint64) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.gen == gen {
+		n.entries.Add(string(c.Hash()), struct{}{})
+	}
+}
+
+// forget удаляет записи о записанных блоках; вызывается после записи
+func (n *negativeCache) forget(cids ...cid.Cid) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.gen++
+	for _, c := range cids {
+		n.entries.Remove(string(c.Hash()))
+	}
+}
@@ -0,0 +1,139 @@
+package blockstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+)
+
+// pinPrefix - зарезервированный префикс ключей datastore для корней закрепления.
+// Базовый blockstore хранит блоки под префиксом /blocks, поэтому записи
+// закреплений не пересекаются с блоками и не попадают в AllKeysChan.
+var pinPrefix = ds.NewKey("/pins")
+
+// pinKey возвращает ключ datastore для закрепления корня
+func pinKey(root cid.Cid) ds.Key {
+	return pinPrefix.ChildString(root.String())
+}
+
+// Pin закрепляет корень: сборка мусора сохраняет все блоки, достижимые
+// от закрепленных корней. Блок корня должен присутствовать в blockstore;
+// повторное закрепление не является ошибкой.
+func (bs *blockstore) Pin(ctx context.Context, root cid.Cid) error {
+	if bs.readOnly {
+		return ErrReadOnly
+	}
+	if !root.Defined() {
+		return errors.New("pin: undefined CID")
+	}
+
+	has, err := bs.Has(ctx, root)
+	if err != nil {
+		return fmt.Errorf("pin %s: %w", root, err)
+	}
+	if !has {
+		return fmt.Errorf("pin %s: %w", root, format.ErrNotFound{Cid: root})
+	}
+
+	return bs.ds.Put(ctx, pinKey(root), []byte{})
+}
+
+// Unpin снимает закрепление корня. Снятие отсутствующего закрепления
+// не является ошибкой. Сами блоки не удаляются - это задача сборки мусора.
+func (bs *blockstore) Unpin(ctx context.Context, root cid.Cid) error {
+	if bs.readOnly {
+		return ErrReadOnly
+	}
+	return bs.ds.Delete(ctx, pinKey(root))
+}
+
+// IsPinned сообщает, закреплен ли корень
+func (bs *blockstore) IsPinned(ctx context.Context, root cid.Cid) (bool, error) {
+	return bs.ds.Has(ctx, pinKey(root))
+}
+
+// Pins возвращает все закрепленные корни, упорядоченные по строковому
+// представлению CID
+func (bs *blockstore) Pins(ctx context.Context) ([]cid.Cid, error) {
+	keys, errc, err := bs.ds.Keys(ctx, pinPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var pins []cid.Cid
+	for key := range keys {
+		c, err := cid.Decode(key.BaseNamespace())
+		if err != nil {
+			// Дочитываем канал, чтобы не оставлять горутину итератора
+			for range keys {
+			}
+			return nil, fmt.Errorf("invalid pin key %s: %w", key, err)
+		}
+		pins = append(pins, c)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pins, func(i, j int) bool { return pins[i].String() < pins[j].String() })
+	return pins, nil
+}
+
+// Reachable возвращает множество CID всех блоков, достижимых от roots
+// (включая сами корни).
+//
+// Обход выполняется по ссылкам блоков (traversal.SelectLinks) с общим
+// множеством посещенных CID для всех корней: каждый блок загружается
+// один раз, даже если на него ссылаются многие узлы или несколько корней,
+// поэтому общие поддеревья не обходятся повторно. Отсутствие любого
+// достижимого блока - ошибка: неполное множество сделало бы сборку мусора
+// небезопасной.
+func (bs *blockstore) Reachable(ctx context.Context, roots []cid.Cid) (*cid.Set, error) {
+	set := cid.NewSet()
+
+	// Стек блоков, которые еще предстоит загрузить; в множество CID
+	// попадает при загрузке, поэтому повторные ссылки отбрасываются
+	stack := append([]cid.Cid(nil), roots...)
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !set.Visit(c) {
+			continue
+		}
+
+		n, err := bs.lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c}, basicnode.Prototype.Any)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", c, err)
+		}
+		links, err := traversal.SelectLinks(n)
+		if err != nil {
+			return nil, fmt.Errorf("links of %s: %w", c, err)
+		}
+		for _, l := range links {
+			cl, ok := l.(cidlink.Link)
+			if !ok || set.Has(cl.Cid) {
+				continue
+			}
+			stack = append(stack, cl.Cid)
+		}
+	}
+
+	return set, nil
+}
@@ -0,0 +1,83 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// UsageBucket - диапазон размеров блоков гистограммы Usage.
+// Границы включительные: Min <= размер <= Max.
+type UsageBucket struct {
+	Min   int64 // Нижняя граница размера блока
+	Max   int64 // Верхняя граница размера блока (math.MaxInt64 - без ограничения)
+	Count int64 // Количество блоков в диапазоне
+	Bytes int64 // Суммарный размер блоков в диапазоне
+}
+
+// UsageReport - отчет о распределении хранилища по размерам блоков.
+type UsageReport struct {
+	Blocks     int64         // Общее количество блоков
+	TotalBytes int64         // Общий размер данных блоков
+	Buckets    []UsageBucket // Гистограмма по размерам, по возрастанию границ
+}
+
+// newUsageBuckets возвращает пустую гистограмму: <1 KiB, 1-64 KiB,
+// 64-256 KiB и >256 KiB. Полный фрагмент файла (DefaultChunkSize)
+// попадает в диапазон 64-256 KiB, поэтому по заполнению последнего
+// диапазона видно, что разбиение на фрагменты работает не так, как ожидалось.
+func newUsageBuckets() []UsageBucket {
+	return []UsageBucket{
+		{Min: 0, Max: 1<<10 - 1},
+		{Min: 1 << 10, Max: 64<<10 - 1},
+		{Min: 64 << 10, Max: DefaultChunkSize},
+		{Min: DefaultChunkSize + 1, Max: math.MaxInt64},
+	}
+}
+
+// Usage подсчитывает количество и суммарный размер блоков и строит
+// гистограмму их размеров.
+//
+// Перебор потоковый: размеры читаются через GetSize (без загрузки данных)
+// и сразу учитываются, поэтому память не зависит от числа блоков. Блоки,
+// удаленные во время перебора, пропускаются.
+func (bs *blockstore) Usage(ctx context.Context) (UsageReport, error) {
+	report := UsageReport{Buckets: newUsageBuckets()}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	for c := range keys {
+		size, err := bs.Blockstore.GetSize(ctx, c)
+		if format.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			// Дочитываем канал, чтобы не оставлять горутину итератора
+			for range keys {
+			}
+			return UsageReport{}, fmt.Errorf("get size %s: %w", c, err)
+		}
+
+		report.Blocks++
+		report.TotalBytes += int64(size)
+		for i := range report.Buckets {
+			b := &report.Buckets[i]
+			if int64(size) >= b.Min && int64(size) <= b.Max {
+				b.Count++
+				b.Bytes += int64(size)
+				break
+			}
+		}
+	}
+
+	// AllKeysChan молча закрывает канал при отмене контекста
+	if err := ctx.Err(); err != nil {
+		return UsageReport{}, err
+	}
+	return report, nil
+}
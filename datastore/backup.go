@@ -0,0 +1,116 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// restorePendingWrites - количество пакетов записи, ожидающих применения при Restore
+const restorePendingWrites = 256
+
+// prefixBackuper реализуется хранилищами, которые умеют выгружать только
+// ключи с префиксом; через него пространства имен выгружают свои ключи
+// из базового хранилища
+type prefixBackuper interface {
+	backupPrefix(ctx context.Context, w io.Writer, since uint64, prefix string) (uint64, error)
+}
+
+// Backup выгружает записи BadgerDB с версией больше since в поток w
+// (формат DB.Backup BadgerDB) и возвращает версию для следующей
+// инкрементальной копии.
+func (s *datastorage) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	return s.backupPrefix(ctx, w, since, "")
+}
+
+// backupPrefix выгружает записи с ключами, начинающимися с prefix
+// (пустой префикс - все записи)
+func (s *datastorage) backupPrefix(ctx context.Context, w io.Writer, since uint64, prefix string) (uint64, error) {
+	stream := s.DB.NewStream()
+	stream.LogPrefix = "datastore.Backup"
+	stream.SinceTs = since
+	if prefix != "" {
+		stream.Prefix = []byte(prefix)
+	}
+
+	// Stream.Backup не принимает контекст, поэтому отмена проверяется при записи
+	last, err := stream.Backup(&ctxWriter{ctx: ctx, w: w}, since)
+	if err != nil {
+		return since, fmt.Errorf("backup: %w", err)
+	}
+	// Поток выгружает версии строго больше since, поэтому следующая копия
+	// начинается с последней выгруженной версии
+	if last < since {
+		return since, nil // Новых записей нет
+	}
+	return last, nil
+}
+
+// Restore загружает записи из потока, созданного Backup. Записи применяются
+// с версиями из копии поверх текущего содержимого; инкрементальные копии
+// загружаются по порядку после полной. Во время Restore хранилище не должно
+// изменяться другими транзакциями.
+func (s *datastorage) Restore(ctx context.Context, r io.Reader) error {
+	if err := s.DB.Load(&ctxReader{ctx: ctx, r: r}, restorePendingWrites); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
+
+// Backup выгружает только ключи пространства имен; ключи в копии хранятся
+// вместе с префиксом
+func (n *namespaced) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	return n.backupPrefix(ctx, w, since, "")
+}
+
+// backupPrefix выгружает ключи пространства имен с префиксом prefix
+func (n *namespaced) backupPrefix(ctx context.Context, w io.Writer, since uint64, prefix string) (uint64, error) {
+	base, ok := n.base.(prefixBackuper)
+	if !ok {
+		return since, fmt.Errorf("backup: base datastore %T does not support namespaced backup", n.base)
+	}
+
+	// Слеш на конце отделяет "/ns/..." от соседнего пространства "/nsx/..."
+	full := n.prefix.Prefix.String()
+	if prefix != "" {
+		full = n.prefix.ConvertKey(ds.NewKey(prefix)).String()
+	}
+	if full != "/" {
+		full += "/"
+	}
+	return base.backupPrefix(ctx, w, since, full)
+}
+
+// Restore загружает копию пространства имен в базовое хранилище: ключи
+// в копии уже содержат префикс
+func (n *namespaced) Restore(ctx context.Context, r io.Reader) error {
+	return n.base.Restore(ctx, r)
+}
+
+// ctxWriter прерывает запись при отмене контекста
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// ctxReader прерывает чтение при отмене контекста
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -5,8 +5,13 @@ package datastore
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
+	"github.com/dgraph-io/badger/v4"        // BadgerDB v4 для уплотнения и сборки мусора
 	ds "github.com/ipfs/go-datastore"       // Базовый интерфейс datastore из IPFS экосистемы
 	"github.com/ipfs/go-datastore/query"    // Система запросов для datastore
 	badger4 "github.com/ipfs/go-ds-badger4" // BadgerDB v4 адаптер для go-datastore
@@ -21,7 +26,9 @@ type Datastore interface {
 	ds.Datastore
 
 	// BatchingFeature добавляет поддержку пакетных операций для оптимизации производительности.
-	// Позволяет группировать несколько операций записи/удаления в одну атомарную транзакцию
+	// Позволяет группировать несколько операций записи/удаления в одну атомарную транзакцию.
+	// Изменения пакета не видны до Commit; пакет без Commit (или отмененный через
+	// Cancel() error реализации BadgerDB) не изменяет хранилище
 	ds.BatchingFeature
 
 	// TxnFeature предоставляет поддержку транзакций с ACID гарантиями.
@@ -54,6 +61,23 @@ type Datastore interface {
 	//   - error: ошибка инициализации итератора
 	Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error)
 
+	// QueryEntries создает асинхронный итератор пар ключ-значение с заданным префиксом
+	// с ограничением количества и смещением. В отличие от пары Keys + Get на каждый ключ,
+	// значения читаются тем же проходом по хранилищу. При Limit или Offset записи
+	// упорядочиваются по ключу, чтобы страницы были стабильными; Reverse обходит
+	// ключи в обратном порядке.
+	//
+	// Параметры:
+	//   - ctx: контекст для управления временем жизни итератора и отмены операции
+	//   - prefix: префикс ключей для фильтрации результатов
+	//   - opts: опции запроса (только ключи, лимит, смещение, обратный порядок)
+	//
+	// Возвращает:
+	//   - <-chan KeyValue: канал для получения пар ключ-значение (Value пустое при KeysOnly)
+	//   - <-chan error: канал для получения ошибок во время итерации
+	//   - error: ошибка инициализации запроса (в том числе отрицательные Limit или Offset)
+	QueryEntries(ctx context.Context, prefix ds.Key, opts QueryOptions) (<-chan KeyValue, <-chan error, error)
+
 	// Merge выполняет слияние текущего хранилища с другим хранилищем данных.
 	// Копирует все ключ-значение пары из другого хранилища в текущее с использованием батчинга
 	// для оптимизации производительности. Операция атомарная - либо все данные копируются успешно,
@@ -91,8 +115,64 @@ type Datastore interface {
 	//   - <-chan error: канал для получения ошибок во время итерации
 	//   - error: ошибка инициализации итератора ключей
 	Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <-chan error, error)
+
+	// Compact принудительно уплотняет хранилище, освобождая место на диске после
+	// массовых удалений: сводит таблицы LSM-дерева на один уровень и запускает
+	// сборку мусора value log до тех пор, пока есть что переписывать.
+	// Безопасен для вызова на открытом хранилище параллельно с чтением и записью.
+	//
+	// Параметры:
+	//   - ctx: контекст для отмены между раундами сборки мусора
+	//
+	// Возвращает:
+	//   - error: ошибка уплотнения или сборки мусора
+	Compact(ctx context.Context) error
+
+	// Backup выгружает в поток w записи, измененные после версии since,
+	// в формате резервной копии BadgerDB, независимо от слоя репозитория и CAR.
+	// since = 0 создает полную копию; возвращаемая версия передается как since
+	// следующего вызова для инкрементальной копии (включая удаления и TTL).
+	// Для пространства имен выгружаются только его ключи.
+	//
+	// Параметры:
+	//   - ctx: контекст для отмены выгрузки
+	//   - w: поток для записи копии
+	//   - since: версия, после которой выгружаются изменения
+	//
+	// Возвращает:
+	//   - uint64: версия для следующей инкрементальной копии
+	//   - error: ошибка чтения хранилища или записи в поток
+	//
+	// Пример использования:
+	//
+	//	next, err := store.Backup(ctx, full, 0)
+	//	// ... позже
+	//	next, err = store.Backup(ctx, incremental, next)
+	Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error)
+
+	// Restore загружает копию, созданную Backup, поверх текущего содержимого.
+	// Инкрементальные копии загружаются по порядку после полной. Во время
+	// загрузки хранилище не должно изменяться другими транзакциями.
+	//
+	// Параметры:
+	//   - ctx: контекст для отмены загрузки
+	//   - r: поток с копией
+	//
+	// Возвращает:
+	//   - error: ошибка чтения потока или записи в хранилище
+	Restore(ctx context.Context, r io.Reader) error
+
+	// ReadOnly сообщает, открыто ли хранилище только для чтения
+	// (см. NewDatastorageReadOnly). Пространство имен наследует режим
+	// базового хранилища.
+	ReadOnly() bool
 }
 
+// ErrReadOnly возвращается при попытке записи в хранилище, открытое только
+// для чтения. Blockstore поверх такого хранилища возвращает эту ошибку
+// из операций записи до обращения к BadgerDB.
+var ErrReadOnly = errors.New("datastore is read-only")
+
 // KeyValue представляет простую структуру для хранения пары ключ-значение.
 // Используется в итераторах для передачи данных через каналы и обеспечивает
 // типобезопасное представление элементов хранилища данных.
@@ -101,6 +181,17 @@ type KeyValue struct {
 	Value []byte // Значение в виде массива байт (сериализованные данные)
 }
 
+// QueryOptions задает параметры выборки QueryEntries.
+// Нулевое значение выбирает все записи с префиксом вместе со значениями.
+// Выборка с Reverse сортируется в памяти, поэтому для больших префиксов
+// Reverse лучше сочетать с KeysOnly.
+type QueryOptions struct {
+	KeysOnly bool // Возвращать только ключи без чтения значений
+	Limit    int  // Максимальное количество записей (0 - без ограничения)
+	Offset   int  // Количество пропускаемых записей от начала выборки
+	Reverse  bool // Обходить ключи в обратном порядке (смещение и лимит - с конца)
+}
+
 // Compile-time проверки соответствия интерфейсам для обеспечения корректной реализации.
 // Эти объявления гарантируют, что структура datastorage корректно реализует все необходимые интерфейсы
 // из экосистемы go-datastore. Если какой-то метод не реализован, компилятор выдаст ошибку.
@@ -117,6 +208,9 @@ var _ ds.Batching = (*datastorage)(nil)            // Интерфейс для
 // и надежность хранения данных на основе LSM-tree архитектуры.
 type datastorage struct {
 	*badger4.Datastore // Встроенное хранилище данных на основе BadgerDB v4
+
+	readOnly bool    // BadgerDB открыта в режиме только для чтения
+	metrics  Metrics // Метрики Get, Put и Delete (NopMetrics, если не заданы)
 }
 
 // NewDatastorage создает новый экземпляр расширенного хранилища данных на основе BadgerDB.
@@ -150,7 +244,103 @@ func NewDatastorage(path string, opts *badger4.Options) (Datastore, error) {
 	}
 
 	// Оборачиваем BadgerDB datastore в нашу расширенную структуру
-	return &datastorage{Datastore: badgerDS}, nil
+	return &datastorage{
+		Datastore: badgerDS,
+		readOnly:  opts != nil && opts.ReadOnly,
+		metrics:   NopMetrics{},
+	}, nil
+}
+
+// NewDatastorageWithMetrics создает хранилище, как NewDatastorage, и
+// передает в m метрики операций Get, Put и Delete: длительность, ошибки,
+// а также попадания (ключ найден) и промахи (ключ отсутствует) Get.
+// Операции пакетов и транзакций не учитываются. m = nil эквивалентно
+// NewDatastorage.
+//
+// Пример использования:
+//
+//	m := datastore.NewMemoryMetrics()
+//	store, err := datastore.NewDatastorageWithMetrics(path, nil, m)
+func NewDatastorageWithMetrics(path string, opts *badger4.Options, m Metrics) (Datastore, error) {
+	store, err := NewDatastorage(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		store.(*datastorage).metrics = m
+	}
+	return store, nil
+}
+
+// Get читает значение ключа и регистрирует операцию в метриках
+func (s *datastorage) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	start := time.Now()
+	value, err := s.Datastore.Get(ctx, key)
+
+	opErr := err
+	switch {
+	case err == nil:
+		s.metrics.Hit(ComponentDatastore)
+	case errors.Is(err, ds.ErrNotFound):
+		s.metrics.Miss(ComponentDatastore)
+		opErr = nil // Отсутствие ключа - промах, а не ошибка операции
+	}
+	s.metrics.ObserveOp(ComponentDatastore, MetricGet, time.Since(start), opErr)
+	return value, err
+}
+
+// Put записывает значение ключа и регистрирует операцию в метриках
+func (s *datastorage) Put(ctx context.Context, key ds.Key, value []byte) error {
+	start := time.Now()
+	err := s.Datastore.Put(ctx, key, value)
+	s.metrics.ObserveOp(ComponentDatastore, MetricPut, time.Since(start), err)
+	return err
+}
+
+// Delete удаляет ключ и регистрирует операцию в метриках
+func (s *datastorage) Delete(ctx context.Context, key ds.Key) error {
+	start := time.Now()
+	err := s.Datastore.Delete(ctx, key)
+	s.metrics.ObserveOp(ComponentDatastore, MetricDelete, time.Since(start), err)
+	return err
+}
+
+// NewDatastorageReadOnly открывает существующую базу BadgerDB только для
+// чтения, например для раздачи снимка репликой без риска изменить общие
+// данные.
+//
+// База открывается с опцией ReadOnly BadgerDB: транзакции записи
+// отклоняются самой BadgerDB, а Blockstore поверх хранилища возвращает
+// ErrReadOnly из Put и DeleteBlock. Фоновая сборка мусора не запускается.
+// Несколько процессов могут открыть базу только для чтения одновременно,
+// но не одновременно с процессом, открывшим ее для записи.
+//
+// Параметры:
+//   - path: путь к директории существующей базы BadgerDB
+//
+// Возвращает:
+//   - Datastore: хранилище только для чтения
+//   - error: ошибка открытия базы (в том числе отсутствующей директории)
+//
+// Пример использования:
+//
+//	store, err := datastore.NewDatastorageReadOnly("/var/lib/ues/snapshot")
+//	if err != nil {
+//	    return err
+//	}
+//	defer store.Close()
+//	bs := blockstore.NewBlockstore(store)
+func NewDatastorageReadOnly(path string) (Datastore, error) {
+	opts := badger4.DefaultOptions
+	opts.ReadOnly = true
+	opts.GcInterval = 0 // Сборка мусора переписывает value log
+
+	return NewDatastorage(path, &opts)
+}
+
+// ReadOnly сообщает, открыта ли BadgerDB только для чтения
+func (s *datastorage) ReadOnly() bool {
+	return s.readOnly
 }
 
 // Iterator создает асинхронный итератор для обхода ключ-значение пар с заданным префиксом.
@@ -200,14 +390,58 @@ func NewDatastorage(path string, opts *badger4.Options) (Datastore, error) {
 //	  }
 //	}
 func (s *datastorage) Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error) {
+	return queryEntries(ctx, s.Datastore, prefix, QueryOptions{KeysOnly: keysOnly})
+}
+
+// QueryEntries возвращает пары ключ-значение с префиксом prefix с учетом
+// лимита и смещения. Подробное описание - в интерфейсе Datastore.
+//
+// Пример использования:
+//
+//	// Вторая страница по 50 записей
+//	data, errs, err := store.QueryEntries(ctx, ds.NewKey("/users"), datastore.QueryOptions{
+//	    Limit:  50,
+//	    Offset: 50,
+//	})
+//	if err != nil { return err }
+//	for kv := range data {
+//	    // обработка kv.Key и kv.Value
+//	}
+//	if err := <-errs; err != nil { return err }
+func (s *datastorage) QueryEntries(ctx context.Context, prefix ds.Key, opts QueryOptions) (<-chan KeyValue, <-chan error, error) {
+	return queryEntries(ctx, s.Datastore, prefix, opts)
+}
+
+// queryEntries реализует Iterator и QueryEntries поверх любого хранилища
+// с поддержкой запросов
+func queryEntries(ctx context.Context, d ds.Read, prefix ds.Key, opts QueryOptions) (<-chan KeyValue, <-chan error, error) {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return nil, nil, fmt.Errorf("invalid query options: limit %d, offset %d", opts.Limit, opts.Offset)
+	}
+
 	// Создаем запрос с заданным префиксом и флагом для получения только ключей
 	q := query.Query{
 		Prefix:   prefix.String(), // Преобразуем ключ в строковое представление для запроса
-		KeysOnly: keysOnly,        // Флаг определяет, нужны ли значения или только ключи
+		KeysOnly: opts.KeysOnly,   // Флаг определяет, нужны ли значения или только ключи
+		Limit:    opts.Limit,
+		Offset:   opts.Offset,
+	}
+	switch {
+	case opts.Reverse:
+		// Обратный итератор BadgerDB с префиксом начинает обход перед диапазоном
+		// префикса и не находит записей, поэтому вместо OrderByKeyDescending
+		// порядок задается функцией и применяется к выборке в памяти
+		q.Orders = []query.Order{query.OrderByFunction(func(a, b query.Entry) int {
+			return strings.Compare(b.Key, a.Key)
+		})}
+	case opts.Limit > 0 || opts.Offset > 0:
+		// Страницы имеют смысл только при фиксированном порядке;
+		// BadgerDB обходит ключи по порядку без дополнительной сортировки
+		q.Orders = []query.Order{query.OrderByKey{}}
 	}
 
-	// Выполняем запрос к базовому datastore
-	result, err := s.Datastore.Query(ctx, q)
+	// Выполняем запрос к хранилищу
+	result, err := d.Query(ctx, q)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -300,8 +534,13 @@ func (s *datastorage) Iterator(ctx context.Context, prefix ds.Key, keysOnly bool
 //	err := targetDS.Merge(ctx, sourceDS)
 //	if err != nil { log.Fatal("Ошибка слияния:", err) }
 func (s *datastorage) Merge(ctx context.Context, other Datastore) error {
+	return merge(ctx, s.Datastore, other)
+}
+
+// merge реализует Merge: копирует все записи other в d одним пакетом
+func merge(ctx context.Context, d ds.Batching, other Datastore) error {
 	// Создаем пакетную операцию для атомарного выполнения множественных записей
-	batch, err := s.Batch(ctx)
+	batch, err := d.Batch(ctx)
 	if err != nil {
 		return err
 	}
@@ -397,10 +636,15 @@ func (s *datastorage) Merge(ctx context.Context, other Datastore) error {
 //	if err != nil { log.Fatal("Ошибка очистки хранилища:", err) }
 //	log.Println("Хранилище успешно очищено")
 func (s *datastorage) Clear(ctx context.Context) error {
+	return clearAll(ctx, s.Datastore)
+}
+
+// clearAll реализует Clear: удаляет все ключи d одним пакетом
+func clearAll(ctx context.Context, d ds.Batching) error {
 	// Создаем запрос для получения всех ключей в хранилище
 	// KeysOnly=true означает, что нам нужны только ключи без значений
 	// Это экономит память и ускоряет операцию при работе с большими объемами данных
-	q, err := s.Query(ctx, query.Query{
+	q, err := d.Query(ctx, query.Query{
 		KeysOnly: true,
 	})
 	if err != nil {
@@ -410,7 +654,7 @@ func (s *datastorage) Clear(ctx context.Context) error {
 	defer q.Close()
 
 	// Создаем пакетную операцию для атомарного выполнения множественных удалений
-	b, err := s.Batch(ctx)
+	b, err := d.Batch(ctx)
 	if err != nil {
 		return err
 	}
@@ -507,14 +751,19 @@ func (s *datastorage) Clear(ctx context.Context) error {
 //	  }
 //	}
 func (s *datastorage) Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <-chan error, error) {
+	return keys(ctx, s.Datastore, prefix)
+}
+
+// keys реализует Keys поверх любого хранилища с поддержкой запросов
+func keys(ctx context.Context, d ds.Read, prefix ds.Key) (<-chan ds.Key, <-chan error, error) {
 	// Создаем запрос с заданным префиксом и флагом для получения только ключей
 	q := query.Query{
 		Prefix:   prefix.String(), // Преобразуем ключ в строковое представление для фильтрации
 		KeysOnly: true,            // Важно: получаем только ключи для экономии памяти и производительности
 	}
 
-	// Выполняем запрос к базовому datastore
-	result, err := s.Datastore.Query(ctx, q)
+	// Выполняем запрос к хранилищу
+	result, err := d.Query(ctx, q)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -566,7 +815,8 @@ func (s *datastorage) Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <
 //
 // Принцип работы TTL:
 // - BadgerDB использует внутренний механизм отслеживания времени истечения
-// - Записи с истекшим TTL становятся недоступными для чтения
+// - Записи с истекшим TTL недоступны: Get возвращает ds.ErrNotFound, Has - false
+// - Время истечения хранится с точностью до секунды
 // - Физическое удаление происходит во время сборки мусора (garbage collection)
 // - TTL проверяется при каждом обращении к ключу
 //
@@ -774,6 +1024,37 @@ func (s *datastorage) GetExpiration(ctx context.Context, key ds.Key) (time.Time,
 	return s.Datastore.GetExpiration(ctx, key)
 }
 
+const (
+	// compactDiscardRatio - доля устаревших данных в файле value log, при
+	// которой Compact переписывает файл
+	compactDiscardRatio = 0.5
+
+	// compactWorkers - количество параллельных уплотнений LSM-дерева в Compact
+	compactWorkers = 2
+)
+
+// Compact уплотняет LSM-дерево BadgerDB (Flatten) и повторяет сборку мусора
+// value log, пока BadgerDB находит файлы для перезаписи. Если сборка мусора
+// уже выполняется (например, периодическая GC), раунды завершаются без ошибки.
+func (s *datastorage) Compact(ctx context.Context) error {
+	if err := s.DB.Flatten(compactWorkers); err != nil {
+		return fmt.Errorf("flatten: %w", err)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := s.DB.RunValueLogGC(compactDiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("value log GC: %w", err)
+		}
+	}
+}
+
 // Close корректно закрывает хранилище данных и освобождает все связанные ресурсы.
 // Метод обеспечивает безопасное завершение работы с BadgerDB, включая закрытие файлов,
 // освобождение памяти и завершение фоновых горутин.
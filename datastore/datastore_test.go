@@ -1,9 +1,11 @@
 package datastore
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -306,6 +308,107 @@ func TestKeys(t *testing.T) {
 	})
 }
 
+// TestQueryEntries тестирует выборку пар ключ-значение с лимитом и смещением.
+func TestQueryEntries(t *testing.T) {
+	store := createTestDatastore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Put(ctx, ds.NewKey(fmt.Sprintf("/list/item%d", i)), []byte(fmt.Sprintf("value%d", i))))
+	}
+	require.NoError(t, store.Put(ctx, ds.NewKey("/listing/other"), []byte("other")))
+	require.NoError(t, store.Put(ctx, ds.NewKey("/other/item"), []byte("other")))
+
+	// query выполняет выборку и собирает результаты.
+	query := func(t *testing.T, store Datastore, prefix string, opts QueryOptions) []KeyValue {
+		t.Helper()
+		data, errs, err := store.QueryEntries(ctx, ds.NewKey(prefix), opts)
+		require.NoError(t, err)
+
+		var entries []KeyValue
+		for kv := range data {
+			entries = append(entries, kv)
+		}
+		require.NoError(t, <-errs)
+		return entries
+	}
+
+	t.Run("фильтрация по префиксу", func(t *testing.T) {
+		entries := query(t, store, "/list", QueryOptions{})
+		require.Len(t, entries, 5)
+		for _, kv := range entries {
+			// Префикс сравнивается по сегментам пути: /listing не входит в /list.
+			assert.Equal(t, "/list", kv.Key.Parent().String())
+			assert.Equal(t, "value"+strings.TrimPrefix(kv.Key.Name(), "item"), string(kv.Value))
+		}
+	})
+
+	t.Run("лимит и смещение", func(t *testing.T) {
+		entries := query(t, store, "/list", QueryOptions{Limit: 2, Offset: 1})
+		assert.Equal(t, []KeyValue{
+			{Key: ds.NewKey("/list/item1"), Value: []byte("value1")},
+			{Key: ds.NewKey("/list/item2"), Value: []byte("value2")},
+		}, entries)
+
+		// Смещение за пределами выборки дает пустой результат.
+		assert.Empty(t, query(t, store, "/list", QueryOptions{Offset: 10}))
+		// Лимит больше выборки возвращает все записи.
+		assert.Len(t, query(t, store, "/list", QueryOptions{Limit: 100}), 5)
+	})
+
+	t.Run("только ключи", func(t *testing.T) {
+		entries := query(t, store, "/list", QueryOptions{KeysOnly: true, Limit: 3})
+		require.Len(t, entries, 3)
+		for i, kv := range entries {
+			assert.Equal(t, ds.NewKey(fmt.Sprintf("/list/item%d", i)), kv.Key)
+			assert.Empty(t, kv.Value)
+		}
+	})
+
+	t.Run("обратный порядок", func(t *testing.T) {
+		entries := query(t, store, "/list", QueryOptions{KeysOnly: true, Reverse: true})
+		var keys []string
+		for _, kv := range entries {
+			keys = append(keys, kv.Key.String())
+		}
+		assert.Equal(t, []string{"/list/item4", "/list/item3", "/list/item2", "/list/item1", "/list/item0"}, keys)
+
+		// Лимит и смещение отсчитываются от конца.
+		entries = query(t, store, "/list", QueryOptions{Reverse: true, Limit: 2, Offset: 1})
+		assert.Equal(t, []KeyValue{
+			{Key: ds.NewKey("/list/item3"), Value: []byte("value3")},
+			{Key: ds.NewKey("/list/item2"), Value: []byte("value2")},
+		}, entries)
+
+		// Нулевой лимит означает выборку без ограничения.
+		assert.Len(t, query(t, store, "/list", QueryOptions{Reverse: true, Limit: 0}), 5)
+	})
+
+	t.Run("обратный порядок в пространстве имен", func(t *testing.T) {
+		entries := query(t, NewNamespaced(store, "/list"), "/", QueryOptions{KeysOnly: true, Reverse: true, Limit: 2})
+		require.Len(t, entries, 2)
+		assert.Equal(t, ds.NewKey("/item4"), entries[0].Key)
+		assert.Equal(t, ds.NewKey("/item3"), entries[1].Key)
+	})
+
+	t.Run("отрицательные опции", func(t *testing.T) {
+		_, _, err := store.QueryEntries(ctx, ds.NewKey("/list"), QueryOptions{Limit: -1})
+		assert.Error(t, err)
+		_, _, err = store.QueryEntries(ctx, ds.NewKey("/list"), QueryOptions{Offset: -1})
+		assert.Error(t, err)
+	})
+
+	t.Run("пространство имен", func(t *testing.T) {
+		list := NewNamespaced(store, "/list")
+		entries := query(t, list, "/", QueryOptions{Limit: 2, Offset: 3})
+		assert.Equal(t, []KeyValue{
+			{Key: ds.NewKey("/item3"), Value: []byte("value3")},
+			{Key: ds.NewKey("/item4"), Value: []byte("value4")},
+		}, entries)
+	})
+}
+
 // TestClear тестирует полную очистку хранилища.
 // Это критически важная операция для сброса состояния или обслуживания.
 func TestClear(t *testing.T) {
@@ -499,6 +602,39 @@ func TestTTL(t *testing.T) {
 		}
 	})
 
+	t.Run("истекший ключ не найден", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("ожидание истечения TTL пропускается в режиме -short")
+		}
+
+		// BadgerDB хранит время истечения с точностью до секунды.
+		expiring := ds.NewKey("/ttl/expiring/session")
+		require.NoError(t, store.PutWithTTL(ctx, expiring, value, time.Second))
+
+		exists, err := store.Has(ctx, expiring)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		time.Sleep(2 * time.Second)
+
+		exists, err = store.Has(ctx, expiring)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		_, err = store.Get(ctx, expiring)
+		assert.ErrorIs(t, err, ds.ErrNotFound)
+
+		// Истекшие ключи не попадают и в обход ключей.
+		keys, errs, err := store.Keys(ctx, ds.NewKey("/ttl/expiring"))
+		require.NoError(t, err)
+		var found []ds.Key
+		for k := range keys {
+			found = append(found, k)
+		}
+		require.NoError(t, <-errs)
+		assert.Empty(t, found)
+	})
+
 	t.Run("GetExpiration для несуществующего ключа", func(t *testing.T) {
 		// Тестируем обработку запроса TTL для несуществующего ключа.
 		nonExistentKey := ds.NewKey("/ttl/does_not_exist")
@@ -554,6 +690,61 @@ func TestBatching(t *testing.T) {
 			assert.Equal(t, expectedValue, string(value))
 		}
 	})
+
+	t.Run("записи и удаления одним коммитом", func(t *testing.T) {
+		// Записи и удаления одного пакета применяются вместе,
+		// как запись данных и указателя HEAD при коммите репозитория.
+		require.NoError(t, store.Put(ctx, ds.NewKey("/batch/mixed/old"), []byte("old")))
+
+		batch, err := store.Batch(ctx)
+		require.NoError(t, err)
+		require.NoError(t, batch.Put(ctx, ds.NewKey("/batch/mixed/record"), []byte("record")))
+		require.NoError(t, batch.Put(ctx, ds.NewKey("/batch/mixed/head"), []byte("head")))
+		require.NoError(t, batch.Delete(ctx, ds.NewKey("/batch/mixed/old")))
+
+		// До коммита хранилище не изменилось.
+		exists, err := store.Has(ctx, ds.NewKey("/batch/mixed/old"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = store.Has(ctx, ds.NewKey("/batch/mixed/head"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		require.NoError(t, batch.Commit(ctx))
+
+		for k, want := range map[string]bool{
+			"/batch/mixed/record": true,
+			"/batch/mixed/head":   true,
+			"/batch/mixed/old":    false,
+		} {
+			exists, err := store.Has(ctx, ds.NewKey(k))
+			require.NoError(t, err)
+			assert.Equal(t, want, exists, k)
+		}
+	})
+
+	t.Run("отмененный пакет", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, ds.NewKey("/batch/cancel/keep"), []byte("keep")))
+
+		batch, err := store.Batch(ctx)
+		require.NoError(t, err)
+		require.NoError(t, batch.Put(ctx, ds.NewKey("/batch/cancel/new"), []byte("new")))
+		require.NoError(t, batch.Delete(ctx, ds.NewKey("/batch/cancel/keep")))
+
+		// ds.Batch не объявляет отмену; пакет BadgerDB отменяется через Cancel.
+		canceler, ok := batch.(interface{ Cancel() error })
+		require.True(t, ok)
+		require.NoError(t, canceler.Cancel())
+
+		// Отмененный пакет не оставляет изменений.
+		exists, err := store.Has(ctx, ds.NewKey("/batch/cancel/new"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		value, err := store.Get(ctx, ds.NewKey("/batch/cancel/keep"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("keep"), value)
+	})
 }
 
 // TestTransactions тестирует транзакционную функциональность.
@@ -622,6 +813,226 @@ func TestGC(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// TestCompact тестирует уплотнение хранилища после массового удаления.
+// Данные, оставшиеся после удаления, должны пережить уплотнение без изменений.
+func TestCompact(t *testing.T) {
+	store := createTestDatastore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	value := func(i int) []byte {
+		return []byte(strings.Repeat(fmt.Sprintf("value-%04d;", i), 100))
+	}
+
+	// Заполняем хранилище и удаляем большую часть ключей
+	const total = 1000
+	for i := 0; i < total; i++ {
+		require.NoError(t, store.Put(ctx, ds.NewKey(fmt.Sprintf("/data/%04d", i)), value(i)))
+	}
+	for i := 0; i < total; i++ {
+		if i%10 != 0 {
+			require.NoError(t, store.Delete(ctx, ds.NewKey(fmt.Sprintf("/data/%04d", i))))
+		}
+	}
+
+	require.NoError(t, store.Compact(ctx))
+
+	// Оставшиеся данные не изменились, удаленные не вернулись
+	assert.Len(t, collectKeys(t, store, ds.NewKey("/data")), total/10)
+	for i := 0; i < total; i += 10 {
+		got, err := store.Get(ctx, ds.NewKey(fmt.Sprintf("/data/%04d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, value(i), got)
+	}
+	_, err := store.Get(ctx, ds.NewKey("/data/0001"))
+	assert.ErrorIs(t, err, ds.ErrNotFound)
+
+	t.Run("пространство имен и запись после уплотнения", func(t *testing.T) {
+		ns := NewNamespaced(store, "/ns")
+		require.NoError(t, ns.Compact(ctx))
+
+		require.NoError(t, store.Put(ctx, ds.NewKey("/after"), []byte("ok")))
+		got, err := store.Get(ctx, ds.NewKey("/after"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("ok"), got)
+	})
+
+	t.Run("отмененный контекст", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.ErrorIs(t, store.Compact(canceled), context.Canceled)
+	})
+}
+
+// TestBackup тестирует полную и инкрементальную резервную копию хранилища
+// с восстановлением в новое хранилище.
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+
+	// snapshot возвращает содержимое хранилища с префиксом как карту ключ -> значение
+	snapshot := func(t *testing.T, store Datastore) map[string]string {
+		t.Helper()
+		entries, errs, err := store.QueryEntries(ctx, ds.NewKey("/"), QueryOptions{})
+		require.NoError(t, err)
+		result := make(map[string]string)
+		for kv := range entries {
+			result[kv.Key.String()] = string(kv.Value)
+		}
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		return result
+	}
+
+	source := createTestDatastore(t)
+	defer source.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, source.Put(ctx, ds.NewKey(fmt.Sprintf("/data/%03d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	// Полная копия
+	var full bytes.Buffer
+	next, err := source.Backup(ctx, &full, 0)
+	require.NoError(t, err)
+	assert.Greater(t, next, uint64(0))
+
+	restored := createTestDatastore(t)
+	defer restored.Close()
+	require.NoError(t, restored.Restore(ctx, &full))
+	assert.Equal(t, snapshot(t, source), snapshot(t, restored))
+	assert.Len(t, snapshot(t, restored), 100)
+
+	t.Run("инкрементальная копия", func(t *testing.T) {
+		require.NoError(t, source.Put(ctx, ds.NewKey("/data/new"), []byte("new")))
+		require.NoError(t, source.Put(ctx, ds.NewKey("/data/000"), []byte("changed")))
+		require.NoError(t, source.Delete(ctx, ds.NewKey("/data/001")))
+
+		var incremental bytes.Buffer
+		after, err := source.Backup(ctx, &incremental, next)
+		require.NoError(t, err)
+		assert.Greater(t, after, next)
+		assert.Less(t, incremental.Len(), full.Cap(), "копируются только изменения")
+
+		require.NoError(t, restored.Restore(ctx, &incremental))
+		got := snapshot(t, restored)
+		assert.Equal(t, snapshot(t, source), got)
+		assert.Equal(t, "changed", got["/data/000"])
+		assert.NotContains(t, got, "/data/001")
+
+		// Без изменений версия не меняется
+		var empty bytes.Buffer
+		same, err := source.Backup(ctx, &empty, after)
+		require.NoError(t, err)
+		assert.Equal(t, after, same)
+	})
+
+	t.Run("пространство имен", func(t *testing.T) {
+		base := createTestDatastore(t)
+		defer base.Close()
+		ns := NewNamespaced(base, "/ns")
+		require.NoError(t, ns.Put(ctx, ds.NewKey("/a"), []byte("a")))
+		require.NoError(t, base.Put(ctx, ds.NewKey("/nsx/b"), []byte("b")))
+		require.NoError(t, base.Put(ctx, ds.NewKey("/other"), []byte("c")))
+
+		var backup bytes.Buffer
+		_, err := ns.Backup(ctx, &backup, 0)
+		require.NoError(t, err)
+
+		target := createTestDatastore(t)
+		defer target.Close()
+		require.NoError(t, NewNamespaced(target, "/ns").Restore(ctx, &backup))
+		assert.Equal(t, map[string]string{"/ns/a": "a"}, snapshot(t, target))
+	})
+
+	t.Run("отмененный контекст", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		var buf bytes.Buffer
+		_, err := source.Backup(canceled, &buf, 0)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// TestNewDatastorageReadOnly проверяет открытие базы только для чтения:
+// данные читаются, а запись отклоняется BadgerDB
+func TestNewDatastorageReadOnly(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	store, err := NewDatastorage(tmpDir, nil)
+	require.NoError(t, err)
+	assert.False(t, store.ReadOnly())
+	require.NoError(t, store.Put(ctx, ds.NewKey("/snapshot/a"), []byte("1")))
+	require.NoError(t, store.Close())
+
+	ro, err := NewDatastorageReadOnly(tmpDir)
+	require.NoError(t, err)
+	defer ro.Close()
+	assert.True(t, ro.ReadOnly())
+	assert.True(t, NewNamespaced(ro, "/snapshot").ReadOnly(), "пространство имен наследует режим")
+
+	value, err := ro.Get(ctx, ds.NewKey("/snapshot/a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.Error(t, ro.Put(ctx, ds.NewKey("/snapshot/b"), []byte("2")))
+	assert.Error(t, ro.Delete(ctx, ds.NewKey("/snapshot/a")))
+	has, err := ro.Has(ctx, ds.NewKey("/snapshot/a"))
+	require.NoError(t, err)
+	assert.True(t, has, "удаление не применено")
+
+	_, err = NewDatastorageReadOnly(t.TempDir() + "/missing")
+	assert.Error(t, err, "несуществующая база не создается")
+}
+
+// TestMetrics проверяет, что Get, Put и Delete передают метрики
+// с правильными метками и в порядке операций
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetrics()
+	store, err := NewDatastorageWithMetrics(t.TempDir(), nil, m)
+	require.NoError(t, err)
+	defer store.Close()
+
+	key := ds.NewKey("/metrics/a")
+	require.NoError(t, store.Put(ctx, key, []byte("1")))
+	_, err = store.Get(ctx, key)
+	require.NoError(t, err)
+	_, err = store.Get(ctx, ds.NewKey("/metrics/missing"))
+	require.ErrorIs(t, err, ds.ErrNotFound)
+	require.NoError(t, store.Delete(ctx, key))
+
+	// Пространство имен передает операции базовому хранилищу
+	_, err = NewNamespaced(store, "/metrics").Get(ctx, ds.NewKey("/missing"))
+	require.ErrorIs(t, err, ds.ErrNotFound)
+
+	var names []string
+	for _, ev := range m.Events() {
+		assert.Equal(t, ComponentDatastore, ev.Component)
+		assert.NoError(t, ev.Err, "отсутствие ключа не ошибка")
+		names = append(names, ev.Name)
+	}
+	assert.Equal(t, []string{
+		MetricPut,
+		MetricHit, MetricGet,
+		MetricMiss, MetricGet,
+		MetricDelete,
+		MetricMiss, MetricGet,
+	}, names)
+	assert.Equal(t, 3, m.Count(ComponentDatastore, MetricGet))
+
+	m.Reset()
+	assert.Empty(t, m.Events())
+
+	t.Run("без метрик", func(t *testing.T) {
+		plain, err := NewDatastorageWithMetrics(t.TempDir(), nil, nil)
+		require.NoError(t, err)
+		defer plain.Close()
+		require.NoError(t, plain.Put(ctx, key, []byte("1")))
+		assert.Empty(t, m.Events())
+	})
+}
+
 // TestClose тестирует корректное закрытие хранилища.
 // Правильное закрытие критично для сохранности данных и освобождения ресурсов.
 func TestClose(t *testing.T) {
@@ -791,6 +1202,98 @@ func TestConcurrency(t *testing.T) {
 	})
 }
 
+// TestNamespaced тестирует изоляцию пространств имен над общим хранилищем.
+// Подсистемы с одинаковыми именами ключей не должны видеть данные друг друга.
+func TestNamespaced(t *testing.T) {
+	store := createTestDatastore(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	heads := NewNamespaced(store, "/heads")
+	blobs := NewNamespaced(store, "blobs")
+	// Пространство с префиксом-продолжением имени не должно пересекаться с /heads.
+	headsX := NewNamespaced(store, "/headsx")
+
+	require.NoError(t, heads.Put(ctx, ds.NewKey("/main"), []byte("head")))
+	require.NoError(t, heads.Put(ctx, ds.NewKey("/dev/feature"), []byte("feature")))
+	require.NoError(t, blobs.Put(ctx, ds.NewKey("/main"), []byte("blob")))
+	require.NoError(t, headsX.Put(ctx, ds.NewKey("/other"), []byte("other")))
+	require.NoError(t, store.Put(ctx, ds.NewKey("/root"), []byte("root")))
+
+	t.Run("ключи с одинаковыми именами не пересекаются", func(t *testing.T) {
+		value, err := heads.Get(ctx, ds.NewKey("/main"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("head"), value)
+
+		value, err = blobs.Get(ctx, ds.NewKey("/main"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("blob"), value)
+
+		exists, err := blobs.Has(ctx, ds.NewKey("/dev/feature"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		// В базовом хранилище ключи лежат под префиксом пространства имен.
+		value, err = store.Get(ctx, ds.NewKey("/heads/main"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("head"), value)
+	})
+
+	t.Run("Keys возвращает ключи пространства без префикса", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"/main", "/dev/feature"}, collectKeys(t, heads, ds.NewKey("/")))
+		assert.ElementsMatch(t, []string{"/dev/feature"}, collectKeys(t, heads, ds.NewKey("/dev")))
+		assert.ElementsMatch(t, []string{"/main"}, collectKeys(t, blobs, ds.NewKey("/")))
+	})
+
+	t.Run("Iterator возвращает значения пространства", func(t *testing.T) {
+		kvChan, errChan, err := blobs.Iterator(ctx, ds.NewKey("/"), false)
+		require.NoError(t, err)
+
+		var got []KeyValue
+		for kv := range kvChan {
+			got = append(got, kv)
+		}
+		require.NoError(t, <-errChan)
+		assert.Equal(t, []KeyValue{{Key: ds.NewKey("/main"), Value: []byte("blob")}}, got)
+	})
+
+	t.Run("пакеты и TTL используют префикс", func(t *testing.T) {
+		batch, err := blobs.Batch(ctx)
+		require.NoError(t, err)
+		require.NoError(t, batch.Put(ctx, ds.NewKey("/batched"), []byte("batched")))
+		require.NoError(t, batch.Commit(ctx))
+
+		exists, err := store.Has(ctx, ds.NewKey("/blobs/batched"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, blobs.PutWithTTL(ctx, ds.NewKey("/session"), []byte("token"), time.Minute))
+		expiration, err := store.GetExpiration(ctx, ds.NewKey("/blobs/session"))
+		require.NoError(t, err)
+		assert.True(t, expiration.After(time.Now()))
+	})
+
+	t.Run("Clear очищает только пространство имен", func(t *testing.T) {
+		require.NoError(t, heads.Clear(ctx))
+
+		assert.Empty(t, collectKeys(t, heads, ds.NewKey("/")))
+		assert.ElementsMatch(t, []string{"/main", "/batched", "/session"}, collectKeys(t, blobs, ds.NewKey("/")))
+		assert.ElementsMatch(t, []string{"/other"}, collectKeys(t, headsX, ds.NewKey("/")))
+
+		exists, err := store.Has(ctx, ds.NewKey("/root"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Close не закрывает базовое хранилище", func(t *testing.T) {
+		require.NoError(t, blobs.Close())
+
+		value, err := store.Get(ctx, ds.NewKey("/root"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("root"), value)
+	})
+}
+
 // createTestDatastore создает временное хранилище для тестов.
 // Эта функция инкапсулирует создание тестового окружения.
 func createTestDatastore(t *testing.T) Datastore {
@@ -803,6 +1306,21 @@ func createTestDatastore(t *testing.T) Datastore {
 	return store
 }
 
+// collectKeys возвращает строковые ключи хранилища с заданным префиксом.
+func collectKeys(t *testing.T, store Datastore, prefix ds.Key) []string {
+	t.Helper()
+
+	keyChan, errChan, err := store.Keys(context.Background(), prefix)
+	require.NoError(t, err)
+
+	var keys []string
+	for k := range keyChan {
+		keys = append(keys, k.String())
+	}
+	require.NoError(t, <-errChan)
+	return keys
+}
+
 // Бенчмарки для оценки производительности различных операций.
 // Бенчмарки важны для выявления узких мест и отслеживания деградации производительности.
 
@@ -0,0 +1,136 @@
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// Компоненты и операции, которые передаются в Metrics
+const (
+	ComponentDatastore  = "datastore"
+	ComponentBlockstore = "blockstore"
+
+	MetricGet    = "get"
+	MetricPut    = "put"
+	MetricDelete = "delete"
+	MetricHit    = "hit"
+	MetricMiss   = "miss"
+)
+
+// Metrics принимает метрики операций хранилищ. Пакет не зависит от
+// конкретной системы мониторинга: реализация интерфейса может
+// передавать значения, например, в счетчики и гистограммы Prometheus.
+//
+// component - ComponentDatastore или ComponentBlockstore, op - MetricGet,
+// MetricPut или MetricDelete. Методы вызываются синхронно из операций
+// хранилища и должны быть быстрыми и потокобезопасными.
+//
+// Пример использования:
+//
+//	type promMetrics struct {
+//	    ops     *prometheus.HistogramVec // метки component, op, status
+//	    lookups *prometheus.CounterVec   // метки component, result
+//	}
+//
+//	func (p *promMetrics) ObserveOp(component, op string, d time.Duration, err error) {
+//	    status := "ok"
+//	    if err != nil {
+//	        status = "error"
+//	    }
+//	    p.ops.WithLabelValues(component, op, status).Observe(d.Seconds())
+//	}
+type Metrics interface {
+	// ObserveOp регистрирует завершенную операцию, ее длительность и ошибку
+	// (nil при успехе). Отсутствие ключа при Get ошибкой не считается.
+	ObserveOp(component, op string, d time.Duration, err error)
+
+	// Hit регистрирует чтение, обслуженное без промаха: для datastore -
+	// найденный ключ, для blockstore - блок из кэша
+	Hit(component string)
+
+	// Miss регистрирует промах: отсутствующий ключ datastore или блок,
+	// не найденный в кэше blockstore
+	Miss(component string)
+}
+
+// NopMetrics - реализация Metrics, которая ничего не делает.
+// Используется, когда метрики не заданы.
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveOp(string, string, time.Duration, error) {}
+func (NopMetrics) Hit(string)                                     {}
+func (NopMetrics) Miss(string)                                    {}
+
+// MetricEvent - событие, записанное MemoryMetrics. Для операций Name
+// совпадает с op, для попаданий и промахов равен MetricHit или MetricMiss.
+type MetricEvent struct {
+	Component string
+	Name      string
+	Duration  time.Duration
+	Err       error
+}
+
+// MemoryMetrics хранит метрики в памяти. Предназначена для тестов
+// и отладки: запоминает все события по порядку.
+//
+// Пример использования:
+//
+//	m := datastore.NewMemoryMetrics()
+//	bs := blockstore.NewBlockstoreWithOptions(store, blockstore.Options{Metrics: m})
+//	bs.Get(ctx, c)
+//	fmt.Println(m.Count(datastore.ComponentBlockstore, datastore.MetricMiss))
+type MemoryMetrics struct {
+	mu     sync.Mutex
+	events []MetricEvent
+}
+
+// NewMemoryMetrics создает пустое хранилище метрик в памяти
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{}
+}
+
+func (m *MemoryMetrics) ObserveOp(component, op string, d time.Duration, err error) {
+	m.record(MetricEvent{Component: component, Name: op, Duration: d, Err: err})
+}
+
+func (m *MemoryMetrics) Hit(component string) {
+	m.record(MetricEvent{Component: component, Name: MetricHit})
+}
+
+func (m *MemoryMetrics) Miss(component string) {
+	m.record(MetricEvent{Component: component, Name: MetricMiss})
+}
+
+func (m *MemoryMetrics) record(ev MetricEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, ev)
+}
+
+// Events возвращает копию записанных событий в порядке поступления
+func (m *MemoryMetrics) Events() []MetricEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MetricEvent(nil), m.events...)
+}
+
+// Count возвращает число событий name компонента component
+func (m *MemoryMetrics) Count(component, name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, ev := range m.events {
+		if ev.Component == component && ev.Name == name {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset удаляет записанные события
+func (m *MemoryMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = nil
+}
@@ -0,0 +1,117 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+)
+
+// Compile-time проверка: пространство имен реализует полный интерфейс Datastore
+var _ Datastore = (*namespaced)(nil)
+
+// namespaced представляет хранилище, изолированное префиксом ключей внутри
+// общего базового хранилища. Базовые операции, пакеты и транзакции
+// преобразуют ключи через keytransform; TTL и расширенные методы
+// реализованы поверх них.
+type namespaced struct {
+	*keytransform.Datastore // Преобразование ключей для операций go-datastore
+
+	base   Datastore                    // Общее базовое хранилище
+	prefix keytransform.PrefixTransform // Префикс пространства имен
+}
+
+// NewNamespaced создает представление хранилища base, в котором все ключи
+// находятся под префиксом prefix. Позволяет нескольким подсистемам
+// (HEAD репозитория, блобы, метаданные индексатора) использовать одно
+// хранилище без конфликтов имен ключей.
+//
+// Префикс прозрачно добавляется к ключам при записи и удаляется при чтении:
+// ключ "/head" пространства "/repo" хранится в base как "/repo/head", а Keys,
+// Iterator и Query возвращают его как "/head". Обход и Clear затрагивают
+// только ключи пространства имен. Пространства имен могут быть вложенными.
+//
+// Close пространства имен не закрывает base: базовым хранилищем владеет
+// создавший его код, и оно может использоваться другими пространствами.
+//
+// Параметры:
+//   - base: базовое хранилище данных
+//   - prefix: префикс ключей пространства имен (например, "/repo" или "repo")
+//
+// Возвращает:
+//   - Datastore: хранилище, ограниченное пространством имен
+//
+// Пример использования:
+//
+//	heads := datastore.NewNamespaced(store, "/heads")
+//	blobs := datastore.NewNamespaced(store, "/blobs")
+//	// Ключи не пересекаются, хотя совпадают по имени
+//	heads.Put(ctx, ds.NewKey("/main"), headData)
+//	blobs.Put(ctx, ds.NewKey("/main"), blobData)
+func NewNamespaced(base Datastore, prefix string) Datastore {
+	pt := keytransform.PrefixTransform{Prefix: ds.NewKey(prefix)}
+	return &namespaced{
+		Datastore: keytransform.Wrap(base, pt),
+		base:      base,
+		prefix:    pt,
+	}
+}
+
+// PutWithTTL сохраняет значение с временем жизни в пространстве имен
+func (n *namespaced) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	return n.base.PutWithTTL(ctx, n.prefix.ConvertKey(key), value, ttl)
+}
+
+// SetTTL обновляет время жизни ключа пространства имен
+func (n *namespaced) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	return n.base.SetTTL(ctx, n.prefix.ConvertKey(key), ttl)
+}
+
+// GetExpiration возвращает время истечения ключа пространства имен
+func (n *namespaced) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	return n.base.GetExpiration(ctx, n.prefix.ConvertKey(key))
+}
+
+// Iterator обходит записи пространства имен с заданным префиксом;
+// ключи возвращаются без префикса пространства имен
+func (n *namespaced) Iterator(ctx context.Context, prefix ds.Key, keysOnly bool) (<-chan KeyValue, <-chan error, error) {
+	return queryEntries(ctx, n.Datastore, prefix, QueryOptions{KeysOnly: keysOnly})
+}
+
+// QueryEntries выбирает записи пространства имен с лимитом и смещением
+func (n *namespaced) QueryEntries(ctx context.Context, prefix ds.Key, opts QueryOptions) (<-chan KeyValue, <-chan error, error) {
+	return queryEntries(ctx, n.Datastore, prefix, opts)
+}
+
+// Merge копирует все записи other в пространство имен
+func (n *namespaced) Merge(ctx context.Context, other Datastore) error {
+	return merge(ctx, n.Datastore, other)
+}
+
+// Clear удаляет все ключи пространства имен, не затрагивая остальные
+// ключи базового хранилища
+func (n *namespaced) Clear(ctx context.Context) error {
+	return clearAll(ctx, n.Datastore)
+}
+
+// Keys обходит ключи пространства имен с заданным префиксом
+func (n *namespaced) Keys(ctx context.Context, prefix ds.Key) (<-chan ds.Key, <-chan error, error) {
+	return keys(ctx, n.Datastore, prefix)
+}
+
+// Compact уплотняет базовое хранилище целиком: файлы BadgerDB общие для всех
+// пространств имен
+func (n *namespaced) Compact(ctx context.Context) error {
+	return n.base.Compact(ctx)
+}
+
+// ReadOnly возвращает режим базового хранилища
+func (n *namespaced) ReadOnly() bool {
+	return n.base.ReadOnly()
+}
+
+// Close ничего не делает: базовое хранилище закрывает его владелец
+func (n *namespaced) Close() error {
+	return nil
+}
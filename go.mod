@@ -4,6 +4,7 @@ go 1.24.2
 
 require (
 	github.com/dgraph-io/badger/v4 v4.5.1
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/google/uuid v1.6.0
 	github.com/hashicorp/golang-lru/v2 v2.0.7
 	github.com/ipfs/boxo v0.34.0
@@ -512,40 +512,43 @@ func (i *Index) collectionRoot(name string) (cid.Cid, bool) {
 //
 // Важно: если коллекция не существует, операция завершается с ошибкой
 func (i *Index) Put(ctx context.Context, collection, rkey string, value cid.Cid) (cid.Cid, error) {
-	// === Получение корня MST коллекции ===
-	// Используем блокировку чтения для получения текущего корня MST
-	i.mu.RLock()
-	root, ok := i.roots[collection]
-	i.mu.RUnlock()
+	for {
+		// === Получение корня MST коллекции ===
+		// Используем блокировку чтения для получения текущего корня MST
+		i.mu.RLock()
+		root, ok := i.roots[collection]
+		i.mu.RUnlock()
 
-	// Проверяем, существует ли указанная коллекция
-	if !ok {
-		// Если коллекция не найдена, возвращаем ошибку без изменений
-		return i.root, fmt.Errorf("collection not found: %s", collection)
-	}
+		// Проверяем, существует ли указанная коллекция
+		if !ok {
+			// Если коллекция не найдена, возвращаем ошибку без изменений
+			return i.root, fmt.Errorf("collection not found: %s", collection)
+		}
 
-	// === Загрузка и обновление MST ===
-	// Создаем новый экземпляр MST дерева для работы с коллекцией
-	tree := mst.NewTree(i.bs)
+		// === Загрузка и обновление MST ===
+		// Создаем новый экземпляр MST дерева для работы с коллекцией
+		tree := mst.NewTree(i.bs)
 
-	// Загружаем текущее состояние MST из корневого CID
-	// Если root равен cid.Undef, загружается пустое дерево
-	if err := tree.Load(ctx, root); err != nil {
-		return i.root, err
-	}
+		// Загружаем текущее состояние MST из корневого CID
+		// Если root равен cid.Undef, загружается пустое дерево
+		if err := tree.Load(ctx, root); err != nil {
+			return i.root, err
+		}
 
-	// Добавляем или обновляем запись в MST дереве
-	// tree.Put создает новую версию дерева с обновленной записью
-	newRoot, err := tree.Put(ctx, rkey, value)
-	if err != nil {
-		return i.root, err
-	}
+		// Добавляем или обновляем запись в MST дереве
+		// tree.Put создает новую версию дерева с обновленной записью
+		newRoot, err := tree.Put(ctx, rkey, value)
+		if err != nil {
+			return i.root, err
+		}
 
-	// === Обновление корня коллекции ===
-	// Блокируем индекс для записи и обновляем корень MST коллекции
-	i.mu.Lock()
-	i.roots[collection] = newRoot
-	i.mu.Unlock()
+		// === Обновление корня коллекции ===
+		// Корень мог измениться конкурентной операцией - тогда повторяем
+		// изменение поверх нового корня, чтобы не потерять чужие записи
+		if i.replaceRoot(collection, root, newRoot) {
+			break
+		}
+	}
 
 	// === Материализация обновленного индекса ===
 	// Создаем новый узел индекса с обновленным корнем коллекции
@@ -575,50 +578,141 @@ func (i *Index) Put(ctx context.Context, collection, rkey string, value cid.Cid)
 //
 // Важно: удаление из MST не удаляет сами данные из blockstore
 func (i *Index) Delete(ctx context.Context, collection, rkey string) (cid.Cid, bool, error) {
-	// === Получение корня MST коллекции ===
-	// Используем блокировку чтения для получения текущего корня MST
-	i.mu.RLock()
-	root, ok := i.roots[collection]
-	i.mu.RUnlock()
+	for {
+		// === Получение корня MST коллекции ===
+		// Используем блокировку чтения для получения текущего корня MST
+		i.mu.RLock()
+		root, ok := i.roots[collection]
+		i.mu.RUnlock()
 
-	// Проверяем, существует ли указанная коллекция
-	if !ok {
-		// Если коллекция не найдена, возвращаем ошибку без изменений
-		return i.root, false, fmt.Errorf("collection not found: %s", collection)
-	}
+		// Проверяем, существует ли указанная коллекция
+		if !ok {
+			// Если коллекция не найдена, возвращаем ошибку без изменений
+			return i.root, false, fmt.Errorf("collection not found: %s", collection)
+		}
 
-	// === Загрузка и обновление MST ===
-	// Создаем новый экземпляр MST дерева для работы с коллекцией
-	tree := mst.NewTree(i.bs)
+		// === Загрузка и обновление MST ===
+		// Создаем новый экземпляр MST дерева для работы с коллекцией
+		tree := mst.NewTree(i.bs)
 
-	// Загружаем текущее состояние MST из корневого CID
-	if err := tree.Load(ctx, root); err != nil {
-		return i.root, false, err
-	}
+		// Загружаем текущее состояние MST из корневого CID
+		if err := tree.Load(ctx, root); err != nil {
+			return i.root, false, err
+		}
 
-	// Удаляем запись из MST дерева
-	// tree.Delete возвращает новый корень и флаг, была ли запись удалена
-	newRoot, removed, err := tree.Delete(ctx, rkey)
-	if err != nil {
-		return i.root, false, err
-	}
+		// Удаляем запись из MST дерева
+		// tree.Delete возвращает новый корень и флаг, была ли запись удалена
+		newRoot, removed, err := tree.Delete(ctx, rkey)
+		if err != nil {
+			return i.root, false, err
+		}
+
+		// === Проверка результата удаления ===
+		// Если запись не была найдена и удалена, возвращаем текущий индекс без изменений
+		if !removed {
+			return i.root, false, nil
+		}
 
-	// === Проверка результата удаления ===
-	// Если запись не была найдена и удалена, возвращаем текущий индекс без изменений
-	if !removed {
-		return i.root, false, nil
+		// === Обновление корня коллекции ===
+		// Как и в Put, при конкурентном изменении корня повторяем удаление
+		if i.replaceRoot(collection, root, newRoot) {
+			break
+		}
 	}
 
-	// === Обновление корня коллекции ===
-	// Блокируем индекс для записи и обновляем корень MST коллекции
+	// === Материализация обновленного индекса ===
+	// Создаем новый узел индекса с обновленным корнем коллекции
+	c, err := i.materialize(ctx)
+	return c, true, err
+}
+
+// replaceRoot заменяет корень коллекции на newRoot, если он все еще равен
+// old, и сообщает, выполнена ли замена
+func (i *Index) replaceRoot(collection string, old, newRoot cid.Cid) bool {
 	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if current, ok := i.roots[collection]; !ok || !current.Equals(old) {
+		return false
+	}
 	i.roots[collection] = newRoot
+	return true
+}
+
+// ErrRootConflict возвращается CompareAndSetCollectionRoots, если корень
+// коллекции изменился после того, как вызывающий код его прочитал
+var ErrRootConflict = errors.New("collection root changed concurrently")
+
+// SetCollectionRoots заменяет корни MST нескольких коллекций и материализует
+// индекс один раз. Используется пакетными изменениями, которые сами строят
+// новые MST коллекций.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - roots: карта имен коллекций на новые корни MST (cid.Undef - пустая коллекция)
+//
+// Возвращает:
+//   - cid.Cid: CID нового материализованного узла индекса
+//   - error: ошибка, если какая-либо коллекция не найдена или материализация не удалась
+//
+// Операция атомарна: при ошибке прежние корни восстанавливаются.
+func (i *Index) SetCollectionRoots(ctx context.Context, roots map[string]cid.Cid) (cid.Cid, error) {
+	return i.CompareAndSetCollectionRoots(ctx, nil, roots)
+}
+
+// CompareAndSetCollectionRoots заменяет корни коллекций, как
+// SetCollectionRoots, только если текущие корни коллекций из expected
+// совпадают с ожидаемыми. Проверка и замена выполняются под одной
+// блокировкой, поэтому изменение, построенное по прочитанным корням,
+// не затирает записи, сделанные другими операциями после чтения.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - expected: корни коллекций, по которым построены новые корни (nil - без проверки)
+//   - roots: карта имен коллекций на новые корни MST
+//
+// Возвращает:
+//   - cid.Cid: CID нового материализованного узла индекса
+//   - error: ErrRootConflict, если корень изменился; ошибка, если коллекция
+//     не найдена или материализация не удалась
+func (i *Index) CompareAndSetCollectionRoots(ctx context.Context, expected, roots map[string]cid.Cid) (cid.Cid, error) {
+	// === Проверка и замена корней ===
+	// Запоминаем прежние корни для отката при ошибке материализации
+	i.mu.Lock()
+	for name := range roots {
+		if _, ok := i.roots[name]; !ok {
+			i.mu.Unlock()
+			return i.root, fmt.Errorf("collection not found: %s", name)
+		}
+	}
+	for name, want := range expected {
+		if current, ok := i.roots[name]; !ok || !current.Equals(want) {
+			i.mu.Unlock()
+			return i.root, fmt.Errorf("%w: %s", ErrRootConflict, name)
+		}
+	}
+	prev := make(map[string]cid.Cid, len(roots))
+	for name, root := range roots {
+		prev[name] = i.roots[name]
+		i.roots[name] = root
+	}
 	i.mu.Unlock()
 
-	// === Материализация обновленного индекса ===
-	// Создаем новый узел индекса с обновленным корнем коллекции
+	// === Материализация ===
 	c, err := i.materialize(ctx)
-	return c, true, err
+	if err != nil {
+		// Откатываем только корни, которые с тех пор не изменились
+		i.mu.Lock()
+		for name, root := range prev {
+			if i.roots[name].Equals(roots[name]) {
+				i.roots[name] = root
+			}
+		}
+		i.mu.Unlock()
+		return cid.Undef, err
+	}
+
+	return c, nil
 }
 
 // Get разрешает CID записи по collection/rkey.
@@ -732,6 +826,44 @@ func (i *Index) ListCollection(ctx context.Context, collection string) ([]mst.En
 	return tree.Range(ctx, "", "")
 }
 
+// Count возвращает количество записей в коллекции.
+// В отличие от ListCollection, не строит список записей: MST хранит размер
+// поддерева в каждом узле, поэтому для текущего формата узлов достаточно
+// прочитать корень.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: имя коллекции
+//
+// Возвращает:
+//   - int: количество записей (0 для пустой коллекции)
+//   - error: ошибка, если коллекция не найдена или MST недоступен
+//
+// Производительность: O(1) для узлов с размером поддерева, иначе O(n)
+func (i *Index) Count(ctx context.Context, collection string) (int, error) {
+	// === Получение корня MST коллекции ===
+	i.mu.RLock()
+	root, ok := i.roots[collection]
+	i.mu.RUnlock()
+
+	if !ok {
+		return 0, fmt.Errorf("collection not found: %s", collection)
+	}
+
+	// Пустая коллекция не имеет MST
+	if !root.Defined() {
+		return 0, nil
+	}
+
+	// === Подсчет по MST ===
+	tree := mst.NewTree(i.bs)
+	if err := tree.Load(ctx, root); err != nil {
+		return 0, err
+	}
+
+	return tree.Count(ctx)
+}
+
 // CollectionRoot возвращает CID корня MST для коллекции (cid.Undef если пустая), ok=false если не найдена.
 // Этот публичный метод предоставляет доступ к корневому CID MST указанной коллекции
 // для внешних компонентов, которым нужен прямой доступ к структуре MST.
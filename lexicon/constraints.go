@@ -0,0 +1,219 @@
+package lexicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// FieldConstraint задает ограничения значения поля сверх его типа.
+// Ограничения объявляются в секции constraints файла схемы по пути поля:
+//
+//	constraints:
+//	  age:
+//	    minimum: 0
+//	    maximum: 150
+//	  name:
+//	    minLength: 1
+//	    pattern: "^[A-Za-z ]+$"
+//	  tags[]:
+//	    enum: [news, tech, sport]
+//
+// Путь записывается как в FieldError.Path, но элементы списков
+// обозначаются "[]" без индекса: ограничение "tags[]" применяется
+// к каждому элементу списка tags.
+//
+// Ограничения проверяются только для значений, прошедших проверку типа:
+//   - minimum/maximum - для чисел (включительно);
+//   - minLength/maxLength - для строк (в символах) и списков (в элементах);
+//   - pattern - для строк; регулярное выражение (синтаксис RE2) ищется
+//     в строке, для полного совпадения используйте ^ и $;
+//   - enum - для строк, чисел и bool; числа сравниваются по значению.
+type FieldConstraint struct {
+	Minimum   *float64      `yaml:"minimum"`   // Минимальное значение числа
+	Maximum   *float64      `yaml:"maximum"`   // Максимальное значение числа
+	MinLength *int          `yaml:"minLength"` // Минимальная длина строки или списка
+	MaxLength *int          `yaml:"maxLength"` // Максимальная длина строки или списка
+	Pattern   string        `yaml:"pattern"`   // Регулярное выражение для строки
+	Enum      []interface{} `yaml:"enum"`      // Допустимые значения
+}
+
+// compiledConstraint - ограничение поля с заранее скомпилированным
+// регулярным выражением
+type compiledConstraint struct {
+	FieldConstraint
+	pattern *regexp.Regexp
+}
+
+// listIndexPattern находит индексы списков в пути поля
+var listIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// constraintPath приводит путь поля к виду ключа ограничений ("tags[2]" -> "tags[]")
+func constraintPath(path string) string {
+	return listIndexPattern.ReplaceAllString(path, "[]")
+}
+
+// compileConstraints проверяет ограничения определения схемы и компилирует
+// их регулярные выражения. Вызывается один раз при загрузке схемы, чтобы
+// повторная валидация не компилировала выражения заново.
+func compileConstraints(constraints map[string]FieldConstraint) (map[string]*compiledConstraint, error) {
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+
+	compiled := make(map[string]*compiledConstraint, len(constraints))
+	for path, c := range constraints {
+		if c.Minimum != nil && c.Maximum != nil && *c.Minimum > *c.Maximum {
+			return nil, fmt.Errorf("constraint %s: minimum %v exceeds maximum %v", path, *c.Minimum, *c.Maximum)
+		}
+		if c.MinLength != nil && *c.MinLength < 0 || c.MaxLength != nil && *c.MaxLength < 0 {
+			return nil, fmt.Errorf("constraint %s: length cannot be negative", path)
+		}
+		if c.MinLength != nil && c.MaxLength != nil && *c.MinLength > *c.MaxLength {
+			return nil, fmt.Errorf("constraint %s: minLength %d exceeds maxLength %d", path, *c.MinLength, *c.MaxLength)
+		}
+
+		cc := &compiledConstraint{FieldConstraint: c}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("constraint %s: invalid pattern: %w", path, err)
+			}
+			cc.pattern = re
+		}
+		compiled[path] = cc
+	}
+	return compiled, nil
+}
+
+// checkConstraints проверяет значение, прошедшее проверку типа,
+// против ограничений его поля
+func (v *validator) checkConstraints(path string, data interface{}) error {
+	length := -1
+	switch d := data.(type) {
+	case string:
+		length = utf8.RuneCountInString(d)
+	case []interface{}:
+		length = len(d)
+	}
+	return v.checkValueConstraints(path, data, length)
+}
+
+// checkValueConstraints проверяет ограничения поля path для значения data
+// длины length (-1, если длина не определена). Для списков, значения которых
+// не переданы (ValidateNode), data равно nil и проверяется только длина.
+func (v *validator) checkValueConstraints(path string, data interface{}, length int) error {
+	c, ok := v.constraints[constraintPath(path)]
+	if !ok {
+		return nil
+	}
+
+	if n, ok := v.number(data); ok {
+		if c.Minimum != nil && n < *c.Minimum {
+			if err := v.fail(FieldError{Path: path, Expected: fmt.Sprintf(">= %v", *c.Minimum), Got: fmt.Sprint(n)}); err != nil {
+				return err
+			}
+		}
+		if c.Maximum != nil && n > *c.Maximum {
+			if err := v.fail(FieldError{Path: path, Expected: fmt.Sprintf("<= %v", *c.Maximum), Got: fmt.Sprint(n)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if d, ok := data.(string); ok && c.pattern != nil && !c.pattern.MatchString(d) {
+		if err := v.fail(FieldError{Path: path, Expected: "match " + c.Pattern, Got: strconv.Quote(d)}); err != nil {
+			return err
+		}
+	}
+
+	if length >= 0 {
+		if c.MinLength != nil && length < *c.MinLength {
+			if err := v.fail(FieldError{Path: path, Expected: fmt.Sprintf("length >= %d", *c.MinLength), Got: fmt.Sprintf("length %d", length)}); err != nil {
+				return err
+			}
+		}
+		if c.MaxLength != nil && length > *c.MaxLength {
+			if err := v.fail(FieldError{Path: path, Expected: fmt.Sprintf("length <= %d", *c.MaxLength), Got: fmt.Sprintf("length %d", length)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(c.Enum) > 0 && isScalar(data) && !v.inEnum(c.Enum, data) {
+		return v.fail(FieldError{Path: path, Expected: fmt.Sprintf("one of %v", c.Enum), Got: fmt.Sprint(data)})
+	}
+	return nil
+}
+
+// isScalar проверяет, является ли значение строкой, числом или bool -
+// к другим значениям enum не применяется
+func isScalar(data interface{}) bool {
+	switch data.(type) {
+	case string, bool:
+		return true
+	}
+	_, ok := (&validator{}).number(data)
+	return ok
+}
+
+// inEnum проверяет, входит ли значение в список допустимых
+func (v *validator) inEnum(enum []interface{}, data interface{}) bool {
+	n, isNumber := v.number(data)
+	for _, allowed := range enum {
+		if isNumber {
+			if m, ok := v.number(allowed); ok && m == n {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(allowed, data) {
+			return true
+		}
+	}
+	return false
+}
+
+// number возвращает числовое значение данных. Строки считаются числами
+// только в режиме CoercionNumericStrings, как и при проверке типа.
+func (v *validator) number(data interface{}) (float64, bool) {
+	switch d := data.(type) {
+	case int:
+		return float64(d), true
+	case int8:
+		return float64(d), true
+	case int16:
+		return float64(d), true
+	case int32:
+		return float64(d), true
+	case int64:
+		return float64(d), true
+	case uint:
+		return float64(d), true
+	case uint8:
+		return float64(d), true
+	case uint16:
+		return float64(d), true
+	case uint32:
+		return float64(d), true
+	case uint64:
+		return float64(d), true
+	case float32:
+		return float64(d), true
+	case float64:
+		return d, true
+	case json.Number:
+		f, err := d.Float64()
+		return f, err == nil
+	case string:
+		if v.coercion == CoercionNumericStrings {
+			f, err := strconv.ParseFloat(d, 64)
+			return f, err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+		}
+	}
+	return 0, false
+}
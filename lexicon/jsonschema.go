@@ -0,0 +1,236 @@
+package lexicon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// jsonSchemaDialect - версия спецификации JSON Schema генерируемых документов
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// ToJSONSchema генерирует JSON Schema (draft 2020-12) последней версии
+// схемы для проверки записей на стороне клиента до отправки.
+//
+// Документ описывает то же, что проверяет ValidateData в режиме
+// CoercionStrict:
+//   - Struct - object с properties и required (обязательные поля);
+//     неизвестные поля, как и в валидаторе, допускаются;
+//   - String - string, Bool - boolean, Int - integer, Float - number;
+//   - List - array с items, Map - object с additionalProperties;
+//   - nullable добавляет null к допустимым значениям;
+//   - остальные виды типов валидатор не проверяет, они экспортируются
+//     как схема без ограничений ({}).
+//
+// Ограничения полей переносятся в minimum/maximum, minLength/maxLength
+// (minItems/maxItems для списков), pattern и enum. Структуры встраиваются
+// по месту использования, чтобы ограничения применялись по пути поля;
+// рекурсивные типы выносятся в $defs, и ограничения внутри рекурсии
+// не экспортируются.
+//
+// Параметры:
+//
+//	id - идентификатор схемы
+//
+// Возвращает:
+//
+//	[]byte - JSON документ с отступами
+//	error - ошибка если схема не найдена или не компилируется
+//
+// Пример использования:
+//
+//	doc, err := registry.ToJSONSchema("com.example.post")
+//	if err != nil {
+//	    return err
+//	}
+//	os.WriteFile("post.schema.json", doc, 0o644)
+func (r *Registry) ToJSONSchema(id string) ([]byte, error) {
+	def, err := r.GetSchema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rootType, v, err := r.validatorFor(id, def.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &jsonSchemaExporter{
+		constraints: v.constraints,
+		defs:        make(map[string]map[string]interface{}),
+		stack:       make(map[schema.TypeName]bool),
+	}
+	doc := e.typeSchema(rootType, "")
+	doc["$schema"] = jsonSchemaDialect
+	doc["$id"] = def.ID
+	if def.Name != "" {
+		doc["title"] = def.Name
+	}
+	if def.Description != "" {
+		doc["description"] = def.Description
+	}
+	if len(e.defs) > 0 {
+		doc["$defs"] = e.defs
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON schema %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// jsonSchemaExporter строит JSON Schema по типам IPLD схемы
+type jsonSchemaExporter struct {
+	constraints map[string]*compiledConstraint
+	defs        map[string]map[string]interface{} // Рекурсивные структуры для $defs
+	stack       map[schema.TypeName]bool          // Структуры на текущем пути обхода
+}
+
+// typeSchema возвращает JSON Schema типа typ, расположенного по пути path
+func (e *jsonSchemaExporter) typeSchema(typ schema.Type, path string) map[string]interface{} {
+	var s map[string]interface{}
+	switch typ.TypeKind() {
+	case schema.TypeKind_Struct:
+		return e.structSchema(typ, path)
+
+	case schema.TypeKind_String:
+		s = map[string]interface{}{"type": "string"}
+
+	case schema.TypeKind_Bool:
+		s = map[string]interface{}{"type": "boolean"}
+
+	case schema.TypeKind_Int:
+		s = map[string]interface{}{"type": "integer"}
+
+	case schema.TypeKind_Float:
+		s = map[string]interface{}{"type": "number"}
+
+	case schema.TypeKind_List:
+		listType := typ.(*schema.TypeList)
+		items := e.typeSchema(listType.ValueType(), path+"[]")
+		if listType.ValueIsNullable() {
+			items = nullableSchema(items)
+		}
+		s = map[string]interface{}{"type": "array", "items": items}
+
+	case schema.TypeKind_Map:
+		// Пути значений карты содержат ключи, поэтому ограничения внутри
+		// значений не экспортируются
+		mapType := typ.(*schema.TypeMap)
+		inner := &jsonSchemaExporter{defs: e.defs, stack: e.stack}
+		values := inner.typeSchema(mapType.ValueType(), "")
+		if mapType.ValueIsNullable() {
+			values = nullableSchema(values)
+		}
+		s = map[string]interface{}{"type": "object", "additionalProperties": values}
+
+	default:
+		return map[string]interface{}{}
+	}
+
+	e.applyConstraints(s, path)
+	return s
+}
+
+// structSchema возвращает JSON Schema структуры; структура, уже
+// встречавшаяся на текущем пути, заменяется ссылкой на $defs
+func (e *jsonSchemaExporter) structSchema(typ schema.Type, path string) map[string]interface{} {
+	name := typ.Name()
+	if e.stack[name] {
+		if _, ok := e.defs[string(name)]; !ok {
+			// Определение для $defs строится без ограничений: ограничения
+			// привязаны к путям, а рекурсивный тип встречается на бесконечном
+			// множестве путей
+			e.defs[string(name)] = nil
+			inner := &jsonSchemaExporter{defs: e.defs, stack: map[schema.TypeName]bool{name: true}}
+			e.defs[string(name)] = inner.structFields(typ.(*schema.TypeStruct), "")
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + string(name)}
+	}
+
+	e.stack[name] = true
+	defer delete(e.stack, name)
+	return e.structFields(typ.(*schema.TypeStruct), path)
+}
+
+// structFields возвращает JSON Schema объекта с полями структуры
+func (e *jsonSchemaExporter) structFields(structType *schema.TypeStruct, path string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for _, field := range structType.Fields() {
+		prop := e.typeSchema(field.Type(), fieldPath(path, field.Name()))
+		if field.IsNullable() {
+			prop = nullableSchema(prop)
+		}
+		properties[field.Name()] = prop
+		if !field.IsOptional() {
+			required = append(required, field.Name())
+		}
+	}
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// applyConstraints переносит ограничения поля path в схему s. Каждое
+// ограничение применяется к тем же значениям, что и в валидаторе:
+// длина - к строкам и спискам, pattern - к строкам, enum - к скалярам.
+func (e *jsonSchemaExporter) applyConstraints(s map[string]interface{}, path string) {
+	c, ok := e.constraints[constraintPath(path)]
+	if !ok {
+		return
+	}
+
+	switch s["type"] {
+	case "integer", "number":
+		if c.Minimum != nil {
+			s["minimum"] = *c.Minimum
+		}
+		if c.Maximum != nil {
+			s["maximum"] = *c.Maximum
+		}
+	case "string":
+		if c.MinLength != nil {
+			s["minLength"] = *c.MinLength
+		}
+		if c.MaxLength != nil {
+			s["maxLength"] = *c.MaxLength
+		}
+		if c.Pattern != "" {
+			s["pattern"] = c.Pattern
+		}
+	case "array":
+		if c.MinLength != nil {
+			s["minItems"] = *c.MinLength
+		}
+		if c.MaxLength != nil {
+			s["maxItems"] = *c.MaxLength
+		}
+	}
+
+	if len(c.Enum) > 0 && s["type"] != "array" && s["type"] != "object" {
+		s["enum"] = append([]interface{}{}, c.Enum...)
+	}
+}
+
+// nullableSchema добавляет null к допустимым значениям схемы
+func nullableSchema(s map[string]interface{}) map[string]interface{} {
+	t, ok := s["type"].(string)
+	if !ok {
+		if len(s) == 0 {
+			return s // Схема без ограничений уже допускает null
+		}
+		return map[string]interface{}{"anyOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+	}
+
+	s["type"] = []string{t, "null"}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		s["enum"] = append(enum, nil)
+	}
+	return s
+}
@@ -14,8 +14,10 @@ import (
 	"context"       // Для контекста операций
 	"fmt"           // Для форматирования строк и ошибок
 	"io/fs"         // Для работы с файловой системой
+	"maps"          // Для перебора ключей карт
 	"os"            // Для чтения файлов
 	"path/filepath" // Для работы с путями к файлам
+	"slices"        // Для сортировки ключей карт
 	"strings"       // Для операций со строками
 	"sync"          // Для синхронизации goroutines
 
@@ -60,6 +62,8 @@ const (
 // description: подробное описание назначения схемы
 // status: состояние схемы (active/draft/deprecated)
 // schema: текст IPLD схемы в DSL формате
+// refs: ID схем, типы которых используются в схеме (см. compileDefinition)
+// constraints: ограничения значений полей (см. FieldConstraint)
 type LexiconDefinition struct {
 	ID          string       `yaml:"id"`          // Уникальный идентификатор схемы
 	Version     string       `yaml:"version"`     // Версия схемы (семантическое версионирование)
@@ -67,6 +71,11 @@ type LexiconDefinition struct {
 	Description string       `yaml:"description"` // Подробное описание схемы
 	Status      SchemaStatus `yaml:"status"`      // Статус: active, draft, deprecated
 	Schema      string       `yaml:"schema"`      // IPLD схема в DSL формате
+
+	Refs        []string                   `yaml:"refs"`        // ID схем, на типы которых ссылается схема
+	Constraints map[string]FieldConstraint `yaml:"constraints"` // Ограничения полей по пути поля
+
+	constraints map[string]*compiledConstraint // Скомпилированные при загрузке ограничения
 }
 
 // Registry управляет лексиконами из файловой системы.
@@ -78,15 +87,21 @@ type LexiconDefinition struct {
 // 4. Управление жизненным циклом схем
 //
 // Архитектура кеширования:
-// - definitions: кеш загруженных YAML определений схем
-// - compiledTypes: кеш скомпилированных IPLD TypeSystem для быстрого доступа
+// - definitions: кеш последних версий загруженных YAML определений схем
+// - versions: все загруженные версии определений по ID схемы
+// - compiledTypes: кеш скомпилированных IPLD TypeSystem (ключ - ID или ID@версия)
+// - files: определения по пути файла схемы (для отслеживания изменений в Watch)
 // - schemasDir: директория с YAML файлами схем
 // - mu: RWMutex для thread-safe операций (читатели могут работать параллельно)
 type Registry struct {
-	mu            sync.RWMutex                  // Мьютекс для thread-safe доступа
-	definitions   map[string]*LexiconDefinition // Кеш загруженных определений схем
-	compiledTypes map[string]*schema.TypeSystem // Кеш скомпилированных IPLD схем
-	schemasDir    string                        // Путь к директории с файлами схем
+	mu            sync.RWMutex                             // Мьютекс для thread-safe доступа
+	definitions   map[string]*LexiconDefinition            // Кеш последних версий определений схем
+	versions      map[string]map[string]*LexiconDefinition // Все версии определений: ID -> версия -> определение
+	compiledTypes map[string]*schema.TypeSystem            // Кеш скомпилированных IPLD схем
+	files         map[string]*LexiconDefinition            // Определения по пути файла (для Watch)
+	schemasDir    string                                   // Путь к директории с файлами схем
+	coercion      CoercionMode                             // Правила приема числовых значений при валидации
+	onReload      func(ReloadEvent)                        // Обработчик событий Watch
 }
 
 // NewRegistry создает новый реестр лексиконов.
@@ -107,9 +122,11 @@ type Registry struct {
 //	err := registry.LoadSchemas(context.Background())
 func NewRegistry(schemasDir string) *Registry {
 	return &Registry{
-		definitions:   make(map[string]*LexiconDefinition), // Инициализируем пустую карту определений
-		compiledTypes: make(map[string]*schema.TypeSystem), // Инициализируем пустую карту компилированных типов
-		schemasDir:    schemasDir,                          // Сохраняем путь к директории схем
+		definitions:   make(map[string]*LexiconDefinition),            // Инициализируем пустую карту определений
+		versions:      make(map[string]map[string]*LexiconDefinition), // Инициализируем пустую карту версий
+		compiledTypes: make(map[string]*schema.TypeSystem),            // Инициализируем пустую карту компилированных типов
+		files:         make(map[string]*LexiconDefinition),            // Инициализируем пустую карту файлов схем
+		schemasDir:    schemasDir,                                     // Сохраняем путь к директории схем
 	}
 }
 
@@ -122,7 +139,11 @@ func NewRegistry(schemasDir string) *Registry {
 // 2. Фильтрация только YAML файлов (.yaml/.yml)
 // 3. Парсинг каждого файла как LexiconDefinition
 // 4. Валидация корректности определения схемы
-// 5. Сохранение в кеш definitions по ID схемы
+// 5. Компиляция ограничений полей (constraints)
+// 6. Сохранение версии в кеш versions; definitions хранит последнюю версию ID
+//
+// Несколько файлов с одинаковым ID и разными версиями загружаются как
+// версии одной схемы (см. GetSchemaVersion, ListVersions).
 //
 // Параметры:
 //
@@ -137,43 +158,80 @@ func (r *Registry) LoadSchemas(ctx context.Context) error {
 	r.mu.Lock()         // Захватываем write lock для изменения кеша
 	defer r.mu.Unlock() // Освобождаем lock при выходе из функции
 
+	return r.loadSchemasLocked()
+}
+
+// loadSchemasLocked загружает все схемы из директории; вызывается под write lock
+func (r *Registry) loadSchemasLocked() error {
 	// Рекурсивно обходим все файлы в директории схем
-	return filepath.WalkDir(r.schemasDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(r.schemasDir, func(path string, d fs.DirEntry, err error) error {
 		// Проверяем ошибки доступа к файлу/директории
 		if err != nil {
 			return err
 		}
 
 		// Пропускаем директории и файлы не являющиеся YAML
-		if d.IsDir() || !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") {
+		if d.IsDir() || !isSchemaFile(path) {
 			return nil // Продолжаем обход
 		}
 
-		// Читаем содержимое YAML файла
-		data, err := os.ReadFile(path)
+		def, err := r.loadFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to read schema file %s: %w", path, err)
-		}
-
-		// Парсим YAML в структуру LexiconDefinition
-		var def LexiconDefinition
-		if err := yaml.Unmarshal(data, &def); err != nil {
-			return fmt.Errorf("failed to parse schema file %s: %w", path, err)
-		}
-
-		// Валидируем корректность определения схемы
-		if err := r.validateDefinition(&def); err != nil {
-			return fmt.Errorf("invalid schema in %s: %w", path, err)
+			return err
 		}
 
-		// Сохраняем определение в кеш по ID схемы
-		r.definitions[def.ID] = &def
+		// Сохраняем версию определения; последняя версия становится основной для ID
+		r.files[path] = def
+		r.addDefinition(def)
 		return nil // Продолжаем обход остальных файлов
 	})
+	if err != nil {
+		return err
+	}
+
+	// Ссылки между схемами проверяем после загрузки всех файлов,
+	// поэтому порядок файлов не важен
+	return r.checkRefs()
+}
+
+// isSchemaFile проверяет, является ли файл файлом схемы (.yaml/.yml)
+func isSchemaFile(path string) bool {
+	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
 }
 
-// GetSchema возвращает определение схемы по ID.
+// loadFile читает, парсит и проверяет файл схемы, не изменяя реестр.
+// Не требует блокировки: обращается только к файловой системе и компилятору схем.
+func (r *Registry) loadFile(path string) (*LexiconDefinition, error) {
+	// Читаем содержимое YAML файла
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+	}
+
+	// Парсим YAML в структуру LexiconDefinition
+	var def LexiconDefinition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to parse schema file %s: %w", path, err)
+	}
+
+	// Валидируем корректность определения схемы
+	if err := r.validateDefinition(&def); err != nil {
+		return nil, fmt.Errorf("invalid schema in %s: %w", path, err)
+	}
+
+	// Компилируем ограничения полей один раз при загрузке
+	constraints, err := compileConstraints(def.Constraints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraints in %s: %w", path, err)
+	}
+	def.constraints = constraints
+
+	return &def, nil
+}
+
+// GetSchema возвращает определение последней версии схемы по ID.
 // Выполняет поиск схемы в кеше загруженных определений.
+// Для конкретной версии используйте GetSchemaVersion.
 //
 // Параметры:
 //
@@ -247,8 +305,8 @@ func (r *Registry) GetCompiledSchema(id string) (*schema.TypeSystem, error) {
 		return nil, fmt.Errorf("schema not found: %s", id)
 	}
 
-	// Компилируем текст схемы в IPLD TypeSystem
-	compiled, err := r.compileSchema(def.Schema)
+	// Компилируем текст схемы (вместе с зависимостями) в IPLD TypeSystem
+	compiled, err := r.compileDefinition(def)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile schema %s: %w", id, err)
 	}
@@ -263,7 +321,7 @@ func (r *Registry) GetCompiledSchema(id string) (*schema.TypeSystem, error) {
 //
 // Процесс валидации:
 // 1. Получение скомпилированной IPLD схемы по ID
-// 2. Извлечение корневого типа из схемы (предполагается единственный основной тип)
+// 2. Извлечение корневого типа из схемы (тип, на который не ссылаются другие типы)
 // 3. Рекурсивная валидация данных против типа схемы
 //
 // Поддерживаемые типы данных:
@@ -272,6 +330,11 @@ func (r *Registry) GetCompiledSchema(id string) (*schema.TypeSystem, error) {
 // - Словари/карты (map[string]interface{})
 // - Примитивные типы (string, bool, int, float)
 //
+// Вложенные структуры (поля с типом другой структуры схемы) и элементы
+// списков и карт проверяются рекурсивно; null допустим только для полей
+// и значений, объявленных nullable. Путь к ошибочному значению
+// (например, "comments[1].author.name") возвращается в FieldError.Path.
+//
 // Параметры:
 //
 //	id - идентификатор схемы для валидации
@@ -279,7 +342,9 @@ func (r *Registry) GetCompiledSchema(id string) (*schema.TypeSystem, error) {
 //
 // Возвращает:
 //
-//	error - ошибка валидации с подробным описанием несоответствия или nil если данные валидны
+//	error - ValidationErrors с описанием несоответствия (путь к полю, ожидаемый
+//	        и фактический тип) или nil если данные валидны; правила приема
+//	        значений задает SetCoercionMode
 //
 // Пример использования:
 //
@@ -288,31 +353,133 @@ func (r *Registry) GetCompiledSchema(id string) (*schema.TypeSystem, error) {
 //	    log.Printf("Validation failed: %v", err)
 //	}
 func (r *Registry) ValidateData(id string, data interface{}) error {
-	// Получаем скомпилированную схему (может включать компиляцию при первом обращении)
-	compiled, err := r.GetCompiledSchema(id)
+	// Получаем основной тип схемы и валидатор с ее ограничениями
+	rootType, v, err := r.validatorFor(id, "")
 	if err != nil {
 		return err
 	}
 
-	// Получаем основной тип схемы (предполагаем что он единственный или первый)
-	// В IPLD схемах обычно есть один главный тип, который описывает структуру данных
-	var rootType schema.Type
-	for _, typ := range compiled.GetTypes() {
-		rootType = typ
-		break // берем первый тип как корневой
+	// Выполняем рекурсивную валидацию данных против корневого типа
+	return v.validate(rootType, data)
+}
+
+// validatorFor возвращает корневой тип версии схемы (пустая версия -
+// последняя) и валидатор с ее ограничениями и текущими настройками реестра
+func (r *Registry) validatorFor(id, version string) (schema.Type, *validator, error) {
+	var (
+		compiled *schema.TypeSystem
+		def      *LexiconDefinition
+		err      error
+	)
+	if version == "" {
+		// Получаем скомпилированную схему (может включать компиляцию при первом обращении)
+		if compiled, err = r.GetCompiledSchema(id); err != nil {
+			return nil, nil, err
+		}
+		def, err = r.GetSchema(id)
+	} else {
+		if compiled, err = r.GetCompiledSchemaVersion(id, version); err != nil {
+			return nil, nil, err
+		}
+		def, err = r.GetSchemaVersion(id, version)
 	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Получаем основной тип схемы; остальные типы описывают вложенные
+	// структуры и проверяются рекурсивно через поля корневого типа
+	rootType := schemaRootType(compiled)
 
 	// Проверяем что в схеме есть хотя бы один тип
 	if rootType == nil {
-		return fmt.Errorf("no types found in schema %s", id)
+		return nil, nil, fmt.Errorf("no types found in schema %s", id)
 	}
 
-	// Выполняем рекурсивную валидацию данных против корневого типа
-	return r.validateAgainstType(rootType, data)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rootType, &validator{coercion: r.coercion, constraints: def.constraints}, nil
+}
+
+// preludeTypes - встроенные типы, которые компилятор IPLD схем добавляет в
+// каждую TypeSystem до типов самой схемы
+var preludeTypes = map[schema.TypeName]bool{
+	"Bool": true, "Int": true, "Float": true, "String": true, "Bytes": true,
+	"Any": true, "Map": true, "List": true, "Link": true,
+}
+
+// schemaRootType возвращает корневой тип схемы - первый объявленный тип,
+// на который не ссылаются другие типы схемы. Вложенные структуры можно
+// объявлять в любом порядке: тип Address, используемый в поле Post,
+// не станет корневым, даже если объявлен первым. Если на все типы есть
+// ссылки (рекурсивные схемы), возвращается первый объявленный тип.
+// Встроенные и анонимные типы пропускаются. GetTypes возвращает карту
+// и не сохраняет порядок, поэтому порядок берется из Names. Возвращает nil,
+// если схема не объявляет типов.
+func schemaRootType(ts *schema.TypeSystem) schema.Type {
+	var declared []schema.Type
+	referenced := make(map[schema.TypeName]bool)
+	for _, name := range ts.Names() {
+		typ := ts.TypeByName(string(name))
+		if preludeTypes[name] {
+			continue
+		}
+		for _, ref := range referencedTypes(typ) {
+			if ref.Name() != typ.Name() {
+				referenced[ref.Name()] = true
+			}
+		}
+		if !isAnonymousType(typ) {
+			declared = append(declared, typ)
+		}
+	}
+
+	for _, typ := range declared {
+		if !referenced[typ.Name()] {
+			return typ
+		}
+	}
+	if len(declared) > 0 {
+		return declared[0]
+	}
+	return nil
+}
+
+// referencedTypes возвращает типы, на которые непосредственно ссылается тип
+func referencedTypes(typ schema.Type) []schema.Type {
+	switch t := typ.(type) {
+	case *schema.TypeStruct:
+		refs := make([]schema.Type, 0, len(t.Fields()))
+		for _, field := range t.Fields() {
+			refs = append(refs, field.Type())
+		}
+		return refs
+	case *schema.TypeList:
+		return []schema.Type{t.ValueType()}
+	case *schema.TypeMap:
+		return []schema.Type{t.KeyType(), t.ValueType()}
+	}
+	return nil
+}
+
+// isAnonymousType проверяет, создан ли тип компилятором для встроенного
+// объявления вида [String] или {String:Int}. Такие типы регистрируются
+// в TypeSystem раньше объявившего их типа под именами List__... и Map__...
+func isAnonymousType(typ schema.Type) bool {
+	name := string(typ.Name())
+	switch typ.TypeKind() {
+	case schema.TypeKind_List:
+		return strings.HasPrefix(name, "List__")
+	case schema.TypeKind_Map:
+		return strings.HasPrefix(name, "Map__")
+	}
+	return false
 }
 
 // ListSchemas возвращает список всех загруженных схем.
 // Полезно для отладки, мониторинга и пользовательских интерфейсов.
+// Схемы упорядочены по зависимостям (refs): каждая схема идет после схем,
+// на которые ссылается, независимые схемы - по алфавиту.
 //
 // Возвращает:
 //
@@ -328,15 +495,8 @@ func (r *Registry) ListSchemas() []string {
 	r.mu.RLock()         // Захватываем read lock для чтения списка
 	defer r.mu.RUnlock() // Освобождаем lock при выходе
 
-	// Создаем срез с предварительно выделенной емкостью для оптимизации
-	schemas := make([]string, 0, len(r.definitions))
-
-	// Извлекаем все ID схем из кеша определений
-	for id := range r.definitions {
-		schemas = append(schemas, id)
-	}
-
-	return schemas
+	// Зависимости идут раньше ссылающихся на них схем
+	return r.dependencyOrder()
 }
 
 // ReloadSchemas перезагружает все схемы из файловой системы.
@@ -344,7 +504,7 @@ func (r *Registry) ListSchemas() []string {
 // Полностью очищает кеши и загружает схемы заново.
 //
 // Процесс перезагрузки:
-// 1. Очистка кеша определений схем (definitions)
+// 1. Очистка кеша определений схем (definitions и versions)
 // 2. Очистка кеша скомпилированных схем (compiledTypes)
 // 3. Повторная загрузка всех схем из файловой системы
 //
@@ -365,12 +525,14 @@ func (r *Registry) ReloadSchemas(ctx context.Context) error {
 
 	// Полностью очищаем кеш определений схем
 	r.definitions = make(map[string]*LexiconDefinition)
+	r.versions = make(map[string]map[string]*LexiconDefinition)
+	r.files = make(map[string]*LexiconDefinition)
 
 	// Полностью очищаем кеш скомпилированных схем
 	r.compiledTypes = make(map[string]*schema.TypeSystem)
 
-	// Повторно загружаем все схемы из файловой системы
-	return r.LoadSchemas(ctx)
+	// Повторно загружаем все схемы из файловой системы (lock уже захвачен)
+	return r.loadSchemasLocked()
 }
 
 // validateDefinition проверяет корректность определения схемы.
@@ -417,6 +579,12 @@ func (r *Registry) validateDefinition(def *LexiconDefinition) error {
 		return fmt.Errorf("invalid status: %s", def.Status)
 	}
 
+	// Схемы со ссылками компилируются вместе с зависимостями после загрузки
+	// всех файлов (см. checkRefs)
+	if len(def.Refs) > 0 {
+		return nil
+	}
+
 	// Проверяем что схема компилируется без ошибок (раннее обнаружение проблем)
 	_, err := r.compileSchema(def.Schema)
 	if err != nil {
@@ -508,63 +676,59 @@ func (r *Registry) compileSchema(schemaText string) (*schema.TypeSystem, error)
 //
 //	typ - IPLD тип для валидации
 //	data - данные для проверки (interface{} для максимальной гибкости)
+//	path - путь к проверяемому значению (пустой для корня)
 //
 // Возвращает:
 //
-//	error - ошибка валидации с подробным описанием несоответствия или nil если данные валидны
+//	error - FieldError с описанием несоответствия или nil если данные валидны
 //
 // Алгоритм:
 // 1. Определение типа данных через typ.TypeKind()
 // 2. Dispatch к специализированному методу валидации (validateStruct, validateList, etc.)
-// 3. Для примитивных типов - прямая проверка типа Go
-func (r *Registry) validateAgainstType(typ schema.Type, data interface{}) error {
+// 3. Для примитивных типов - проверка типа Go по правилам CoercionMode
+// 4. Проверка ограничений поля (FieldConstraint) для значений верного типа
+func (v *validator) validateAgainstType(typ schema.Type, data interface{}, path string) error {
 	// Определяем тип схемы и выбираем соответствующий метод валидации
 	switch typ.TypeKind() {
 	case schema.TypeKind_Struct:
 		// Структуры - сложная валидация с проверкой полей
-		return r.validateStruct(typ, data)
+		return v.validateStruct(typ, data, path)
 
 	case schema.TypeKind_String:
 		// Строки - простая проверка типа
 		if _, ok := data.(string); !ok {
-			return fmt.Errorf("expected string, got %T", data)
+			return v.fail(FieldError{Path: path, Expected: "string", Got: describeValue(data)})
 		}
 
 	case schema.TypeKind_Bool:
-		// Булевые значения - простая проверка типа
+		// Булевые значения - строгая проверка типа без приведения
 		if _, ok := data.(bool); !ok {
-			return fmt.Errorf("expected bool, got %T", data)
+			return v.fail(FieldError{Path: path, Expected: "bool", Got: describeValue(data)})
 		}
 
 	case schema.TypeKind_Int:
-		// Целые числа - проверка всех возможных типов int
-		switch data.(type) {
-		case int, int8, int16, int32, int64:
-			// Все целочисленные типы допустимы
-		default:
-			return fmt.Errorf("expected int, got %T", data)
+		// Целые числа - целые типы Go, json.Number и (в режиме приведения) строки
+		if !v.acceptsInt(data) {
+			return v.fail(FieldError{Path: path, Expected: "int", Got: describeValue(data)})
 		}
 
 	case schema.TypeKind_Float:
-		// Числа с плавающей точкой - проверка float типов
-		switch data.(type) {
-		case float32, float64:
-			// Оба типа float допустимы
-		default:
-			return fmt.Errorf("expected float, got %T", data)
+		// Числа с плавающей точкой - float типы, json.Number и (в режиме приведения) строки
+		if !v.acceptsFloat(data) {
+			return v.fail(FieldError{Path: path, Expected: "float", Got: describeValue(data)})
 		}
 
 	case schema.TypeKind_List:
 		// Списки - рекурсивная валидация элементов
-		return r.validateList(typ, data)
+		return v.validateList(typ, data, path)
 
 	case schema.TypeKind_Map:
 		// Словари - рекурсивная валидация значений
-		return r.validateMap(typ, data)
+		return v.validateMap(typ, data, path)
 	}
 
-	// Если тип поддерживается - валидация прошла успешно
-	return nil
+	// Тип совпал - проверяем ограничения поля
+	return v.checkConstraints(path, data)
 }
 
 // validateStruct валидирует структуру.
@@ -583,6 +747,7 @@ func (r *Registry) validateAgainstType(typ schema.Type, data interface{}) error
 //
 //	typ - IPLD тип структуры для валидации
 //	data - данные для проверки (ожидается map[string]interface{})
+//	path - путь к структуре в данных
 //
 // Возвращает:
 //
@@ -592,11 +757,11 @@ func (r *Registry) validateAgainstType(typ schema.Type, data interface{}) error
 // - Поддерживает опциональные поля (field.IsOptional())
 // - Рекурсивно валидирует вложенные структуры
 // - Предоставляет детальную информацию об ошибках валидации
-func (r *Registry) validateStruct(typ schema.Type, data interface{}) error {
+func (v *validator) validateStruct(typ schema.Type, data interface{}, path string) error {
 	// Проверяем что данные представлены как объект (map)
 	dataMap, ok := data.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("expected map[string]interface{}, got %T", data)
+		return v.fail(FieldError{Path: path, Expected: "struct", Got: describeValue(data)})
 	}
 
 	// Приводим тип схемы к структуре (должен быть указатель на TypeStruct)
@@ -618,13 +783,21 @@ func (r *Registry) validateStruct(typ schema.Type, data interface{}) error {
 
 		// Если поле отсутствует и оно обязательное - это ошибка
 		if !exists && !field.IsOptional() {
-			return fmt.Errorf("required field missing: %s", fieldName)
+			if err := v.fail(FieldError{Path: fieldPath(path, fieldName), Expected: expectedKind(field.Type()), Got: gotMissing}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// null допустим только для nullable полей
+		if exists && value == nil && field.IsNullable() {
+			continue
 		}
 
 		// Если поле присутствует - рекурсивно валидируем его значение
 		if exists {
-			if err := r.validateAgainstType(field.Type(), value); err != nil {
-				return fmt.Errorf("field %s: %w", fieldName, err)
+			if err := v.validateAgainstType(field.Type(), value, fieldPath(path, fieldName)); err != nil {
+				return err
 			}
 		}
 	}
@@ -646,6 +819,7 @@ func (r *Registry) validateStruct(typ schema.Type, data interface{}) error {
 //
 //	typ - IPLD тип списка для валидации
 //	data - данные для проверки (ожидается []interface{})
+//	path - путь к списку в данных
 //
 // Возвращает:
 //
@@ -655,11 +829,11 @@ func (r *Registry) validateStruct(typ schema.Type, data interface{}) error {
 // - Поддерживает любую длину списка (включая пустые списки)
 // - Все элементы должны соответствовать одному типу (valueType)
 // - Предоставляет информацию о номере элемента при ошибке валидации
-func (r *Registry) validateList(typ schema.Type, data interface{}) error {
+func (v *validator) validateList(typ schema.Type, data interface{}, path string) error {
 	// Проверяем что данные представлены как срез/массив
 	slice, ok := data.([]interface{})
 	if !ok {
-		return fmt.Errorf("expected []interface{}, got %T", data)
+		return v.fail(FieldError{Path: path, Expected: "list", Got: describeValue(data)})
 	}
 
 	// Приводим тип схемы к списку (должен быть указатель на TypeList)
@@ -673,13 +847,18 @@ func (r *Registry) validateList(typ schema.Type, data interface{}) error {
 
 	// Валидируем каждый элемент списка против типа элемента
 	for i, item := range slice {
-		if err := r.validateAgainstType(valueType, item); err != nil {
-			// Включаем индекс элемента в сообщение об ошибке для удобства отладки
-			return fmt.Errorf("list item %d: %w", i, err)
+		// null допустим только для списков nullable значений
+		if item == nil && listType.ValueIsNullable() {
+			continue
+		}
+		// Индекс элемента входит в путь ошибки для удобства отладки
+		if err := v.validateAgainstType(valueType, item, indexPath(path, i)); err != nil {
+			return err
 		}
 	}
 
-	return nil // Все элементы списка валидны
+	// Все элементы валидны - проверяем ограничения самого списка
+	return v.checkConstraints(path, slice)
 }
 
 // validateMap валидирует map.
@@ -697,6 +876,7 @@ func (r *Registry) validateList(typ schema.Type, data interface{}) error {
 //
 //	typ - IPLD тип карты для валидации
 //	data - данные для проверки (ожидается map[string]interface{})
+//	path - путь к карте в данных
 //
 // Возвращает:
 //
@@ -707,11 +887,11 @@ func (r *Registry) validateList(typ schema.Type, data interface{}) error {
 // - Все значения должны соответствовать одному типу (valueType)
 // - Ключи всегда строковые (map[string]interface{})
 // - Предоставляет информацию о проблемном ключе при ошибке валидации
-func (r *Registry) validateMap(typ schema.Type, data interface{}) error {
+func (v *validator) validateMap(typ schema.Type, data interface{}, path string) error {
 	// Проверяем что данные представлены как карта/словарь
 	dataMap, ok := data.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("expected map[string]interface{}, got %T", data)
+		return v.fail(FieldError{Path: path, Expected: "map", Got: describeValue(data)})
 	}
 
 	// Приводим тип схемы к карте (должен быть указатель на TypeMap)
@@ -723,11 +903,17 @@ func (r *Registry) validateMap(typ schema.Type, data interface{}) error {
 	// Получаем тип значений карты из определения схемы
 	valueType := mapType.ValueType()
 
-	// Валидируем каждое значение в карте против типа значения
-	for key, value := range dataMap {
-		if err := r.validateAgainstType(valueType, value); err != nil {
-			// Включаем ключ в сообщение об ошибке для удобства отладки
-			return fmt.Errorf("map key %s: %w", key, err)
+	// Валидируем каждое значение в карте против типа значения; ключи
+	// перебираются по порядку, чтобы порядок ошибок был детерминированным
+	for _, key := range slices.Sorted(maps.Keys(dataMap)) {
+		value := dataMap[key]
+		// null допустим только для карт nullable значений
+		if value == nil && mapType.ValueIsNullable() {
+			continue
+		}
+		// Ключ входит в путь ошибки для удобства отладки
+		if err := v.validateAgainstType(valueType, value, fieldPath(path, key)); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,1015 @@
+package lexicon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ========================================
+// ТЕСТЫ ВЕРСИЙ СХЕМ
+// ========================================
+
+// TestSchemaVersions проверяет загрузку нескольких версий одной схемы
+// и валидацию данных против каждой из них.
+func TestSchemaVersions(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{
+		"user.v1.yaml": userLexiconV1,
+		"user.v2.yaml": userLexiconV2,
+	})
+
+	t.Run("список версий", func(t *testing.T) {
+		assert.Equal(t, []string{"1.0.0", "2.0.0"}, registry.ListVersions("com.example.user"))
+		assert.Empty(t, registry.ListVersions("com.example.unknown"))
+		assert.Equal(t, []string{"com.example.user"}, registry.ListSchemas())
+	})
+
+	t.Run("последняя версия", func(t *testing.T) {
+		latest, err := registry.LatestVersion("com.example.user")
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", latest)
+
+		def, err := registry.GetSchema("com.example.user")
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", def.Version)
+
+		_, err = registry.LatestVersion("com.example.unknown")
+		assert.Error(t, err)
+	})
+
+	t.Run("получение конкретной версии", func(t *testing.T) {
+		def, err := registry.GetSchemaVersion("com.example.user", "1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.0", def.Version)
+		assert.Equal(t, SchemaStatusDeprecated, def.Status)
+
+		_, err = registry.GetSchemaVersion("com.example.user", "3.0.0")
+		assert.Error(t, err)
+		_, err = registry.GetSchemaVersion("com.example.unknown", "1.0.0")
+		assert.Error(t, err)
+	})
+
+	t.Run("валидация по версиям", func(t *testing.T) {
+		// Версия 1: только имя
+		oldUser := map[string]interface{}{"name": "Alice"}
+		// Версия 2: имя и обязательный email
+		newUser := map[string]interface{}{"name": "Alice", "email": "alice@example.com"}
+
+		assert.NoError(t, registry.ValidateDataVersion("com.example.user", "1.0.0", oldUser))
+		assert.Error(t, registry.ValidateDataVersion("com.example.user", "2.0.0", oldUser))
+		assert.NoError(t, registry.ValidateDataVersion("com.example.user", "2.0.0", newUser))
+
+		// Без версии - последняя
+		assert.Error(t, registry.ValidateDataVersion("com.example.user", "", oldUser))
+		assert.Error(t, registry.ValidateData("com.example.user", oldUser))
+		assert.NoError(t, registry.ValidateData("com.example.user", newUser))
+
+		assert.Error(t, registry.ValidateDataVersion("com.example.user", "3.0.0", newUser))
+	})
+}
+
+// TestCompareVersions проверяет порядок версий схем
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"2.0.0-beta", "2.0.0", -1},
+		{"2.0.0-alpha", "2.0.0-beta", -1},
+		{"2.0.0-beta", "1.9.9", 1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, compareVersions(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, compareVersions(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+// ========================================
+// ТЕСТЫ ПРИВЕДЕНИЯ ТИПОВ
+// ========================================
+
+// TestValidateDataTypeRules фиксирует правила приема значений для каждого
+// типа схемы в строгом режиме и в режиме приведения числовых строк.
+func TestValidateDataTypeRules(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"profile.yaml": profileLexicon})
+
+	// validProfile возвращает корректный профиль с заменой одного поля
+	validProfile := func(field string, value interface{}) map[string]interface{} {
+		data := map[string]interface{}{
+			"name":   "Alice",
+			"age":    30,
+			"score":  4.5,
+			"active": true,
+		}
+		data[field] = value
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		field    string
+		value    interface{}
+		strict   bool // принимается в строгом режиме
+		numeric  bool // принимается в режиме CoercionNumericStrings
+		expected string
+	}{
+		{"string", "name", "Bob", true, true, "string"},
+		{"число вместо string", "name", 42, false, false, "string"},
+		{"bool", "active", false, true, true, "bool"},
+		{"строка вместо bool", "active", "true", false, false, "bool"},
+		{"число вместо bool", "active", 1, false, false, "bool"},
+		{"int", "age", int64(30), true, true, "int"},
+		{"uint", "age", uint32(30), true, true, "int"},
+		{"uint64 за пределами int64", "age", uint64(math.MaxUint64), false, false, "int"},
+		{"json.Number int", "age", json.Number("30"), true, true, "int"},
+		{"json.Number float вместо int", "age", json.Number("30.5"), false, false, "int"},
+		{"float вместо int", "age", 30.0, false, false, "int"},
+		{"строка с int", "age", "30", false, true, "int"},
+		{"строка с float вместо int", "age", "30.5", false, false, "int"},
+		{"нечисловая строка вместо int", "age", "thirty", false, false, "int"},
+		{"float", "score", float32(4.5), true, true, "float"},
+		{"json.Number float", "score", json.Number("4.5"), true, true, "float"},
+		{"int вместо float", "score", 4, false, false, "float"},
+		{"строка с float", "score", "4.5", false, true, "float"},
+		{"строка NaN вместо float", "score", "NaN", false, false, "float"},
+		{"null вместо string", "name", nil, false, false, "string"},
+	}
+
+	for _, mode := range []CoercionMode{CoercionStrict, CoercionNumericStrings} {
+		registry.SetCoercionMode(mode)
+		for _, tt := range tests {
+			accepted := tt.strict
+			if mode == CoercionNumericStrings {
+				accepted = tt.numeric
+			}
+
+			err := registry.ValidateData("com.example.profile", validProfile(tt.field, tt.value))
+			if accepted {
+				assert.NoError(t, err, "режим %d: %s", mode, tt.name)
+				continue
+			}
+
+			var verrs ValidationErrors
+			if assert.ErrorAs(t, err, &verrs, "режим %d: %s", mode, tt.name) {
+				assert.Equal(t, ValidationErrors{{
+					Path:     tt.field,
+					Expected: tt.expected,
+					Got:      describeValue(tt.value),
+				}}, verrs, "режим %d: %s", mode, tt.name)
+			}
+		}
+	}
+}
+
+// TestValidateDataFieldErrors проверяет пути и описания ошибок полей
+func TestValidateDataFieldErrors(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"profile.yaml": profileLexicon})
+
+	tests := []struct {
+		name string
+		data interface{}
+		want FieldError
+	}{
+		{
+			name: "отсутствует обязательное поле",
+			data: map[string]interface{}{"name": "Alice", "score": 1.0, "active": true},
+			want: FieldError{Path: "age", Expected: "int", Got: "missing"},
+		},
+		{
+			name: "элемент списка",
+			data: map[string]interface{}{
+				"name": "Alice", "age": 30, "score": 1.0, "active": true,
+				"tags": []interface{}{"go", 7},
+			},
+			want: FieldError{Path: "tags[1]", Expected: "string", Got: "int"},
+		},
+		{
+			name: "значение карты",
+			data: map[string]interface{}{
+				"name": "Alice", "age": 30, "score": 1.0, "active": true,
+				"limits": map[string]interface{}{"daily": "many"},
+			},
+			want: FieldError{Path: "limits.daily", Expected: "int", Got: "string"},
+		},
+		{
+			name: "корень не структура",
+			data: []interface{}{"Alice"},
+			want: FieldError{Path: "", Expected: "struct", Got: "list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.ValidateData("com.example.profile", tt.data)
+
+			var verrs ValidationErrors
+			require.ErrorAs(t, err, &verrs)
+			assert.Equal(t, ValidationErrors{tt.want}, verrs)
+		})
+	}
+
+	t.Run("сообщения об ошибках", func(t *testing.T) {
+		assert.Equal(t, "required field missing: age",
+			FieldError{Path: "age", Expected: "int", Got: "missing"}.Error())
+		assert.Equal(t, "field tags[1]: expected string, got int",
+			FieldError{Path: "tags[1]", Expected: "string", Got: "int"}.Error())
+	})
+}
+
+// ========================================
+// ТЕСТЫ СБОРА ВСЕХ ОШИБОК
+// ========================================
+
+// TestValidateDataAll проверяет, что все нарушения сообщаются одновременно
+func TestValidateDataAll(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"profile.yaml": profileLexicon})
+
+	t.Run("несколько нарушений", func(t *testing.T) {
+		data := map[string]interface{}{
+			"name":   42,
+			"score":  "high",
+			"active": true,
+			"tags":   []interface{}{"go", false, "ipld", 3},
+			"limits": map[string]interface{}{"weekly": "x", "daily": 1.5, "monthly": 100},
+		}
+
+		fieldErrs, err := registry.ValidateDataAll("com.example.profile", data)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{
+			{Path: "name", Expected: "string", Got: "int"},
+			{Path: "age", Expected: "int", Got: "missing"},
+			{Path: "score", Expected: "float", Got: "string"},
+			{Path: "tags[1]", Expected: "string", Got: "bool"},
+			{Path: "tags[3]", Expected: "string", Got: "int"},
+			{Path: "limits.daily", Expected: "int", Got: "float"},
+			{Path: "limits.weekly", Expected: "int", Got: "string"},
+		}, fieldErrs)
+
+		// ValidateData по-прежнему сообщает только первое нарушение
+		err = registry.ValidateData("com.example.profile", data)
+		var verrs ValidationErrors
+		require.ErrorAs(t, err, &verrs)
+		assert.Equal(t, ValidationErrors{fieldErrs[0]}, verrs)
+	})
+
+	t.Run("валидные данные", func(t *testing.T) {
+		fieldErrs, err := registry.ValidateDataAll("com.example.profile", map[string]interface{}{
+			"name": "Alice", "age": 30, "score": 4.5, "active": true,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, fieldErrs)
+	})
+
+	t.Run("неизвестная схема", func(t *testing.T) {
+		_, err := registry.ValidateDataAll("com.example.unknown", map[string]interface{}{})
+		assert.Error(t, err)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ОГРАНИЧЕНИЙ ПОЛЕЙ
+// ========================================
+
+// TestValidateDataConstraints проверяет каждое ограничение на допустимых
+// и недопустимых значениях
+func TestValidateDataConstraints(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"account.yaml": accountLexicon})
+
+	// validAccount возвращает корректную учетную запись с заменой одного поля
+	validAccount := func(field string, value interface{}) map[string]interface{} {
+		data := map[string]interface{}{
+			"login": "alice",
+			"age":   30,
+			"score": 5.5,
+			"role":  "user",
+			"level": 1,
+			"tags":  []interface{}{"go"},
+		}
+		data[field] = value
+		return data
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value interface{}
+		want  *FieldError // nil - значение допустимо
+	}{
+		{"minimum на границе", "age", 0, nil},
+		{"maximum на границе", "age", 150, nil},
+		{"меньше minimum", "age", -1, &FieldError{Path: "age", Expected: ">= 0", Got: "-1"}},
+		{"больше maximum", "age", 151, &FieldError{Path: "age", Expected: "<= 150", Got: "151"}},
+		{"float в пределах", "score", 9.99, nil},
+		{"float больше maximum", "score", 10.5, &FieldError{Path: "score", Expected: "<= 10", Got: "10.5"}},
+		{"minLength на границе", "login", "ab", nil},
+		{"maxLength на границе", "login", "abcdefghij", nil},
+		{"короче minLength", "login", "a", &FieldError{Path: "login", Expected: "length >= 2", Got: "length 1"}},
+		{"длиннее maxLength", "login", "abcdefghijk", &FieldError{Path: "login", Expected: "length <= 10", Got: "length 11"}},
+		{"не соответствует pattern", "login", "Alice", &FieldError{Path: "login", Expected: "match ^[a-z]+$", Got: `"Alice"`}},
+		{"строка из enum", "role", "admin", nil},
+		{"строка вне enum", "role", "root", &FieldError{Path: "role", Expected: "one of [admin user]", Got: "root"}},
+		{"число из enum", "level", int64(3), nil},
+		{"число вне enum", "level", 4, &FieldError{Path: "level", Expected: "one of [1 2 3]", Got: "4"}},
+		{"длина списка", "tags", []interface{}{"go", "ipld", "car"}, &FieldError{Path: "tags", Expected: "length <= 2", Got: "length 3"}},
+		{"элемент списка", "tags", []interface{}{"go", "g"}, &FieldError{Path: "tags[1]", Expected: "length >= 2", Got: "length 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.ValidateData("com.example.account", validAccount(tt.field, tt.value))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verrs ValidationErrors
+			require.ErrorAs(t, err, &verrs)
+			assert.Equal(t, ValidationErrors{*tt.want}, verrs)
+		})
+	}
+
+	t.Run("длина строки в символах", func(t *testing.T) {
+		fieldErrs, err := registry.ValidateDataAll("com.example.account", validAccount("login", "абвгдежзий"))
+		require.NoError(t, err)
+		// 10 символов (20 байт) проходят maxLength, но не pattern
+		assert.Equal(t, []FieldError{{Path: "login", Expected: "match ^[a-z]+$", Got: `"абвгдежзий"`}}, fieldErrs)
+	})
+
+	t.Run("неверный тип не проверяется ограничениями", func(t *testing.T) {
+		fieldErrs, err := registry.ValidateDataAll("com.example.account", validAccount("age", "-5"))
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "age", Expected: "int", Got: "string"}}, fieldErrs)
+	})
+
+	t.Run("все нарушения одного поля", func(t *testing.T) {
+		fieldErrs, err := registry.ValidateDataAll("com.example.account", validAccount("login", "A"))
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{
+			{Path: "login", Expected: "match ^[a-z]+$", Got: `"A"`},
+			{Path: "login", Expected: "length >= 2", Got: "length 1"},
+		}, fieldErrs)
+	})
+}
+
+// TestInvalidConstraints проверяет отклонение некорректных ограничений при загрузке
+func TestInvalidConstraints(t *testing.T) {
+	tests := map[string]string{
+		"неверный pattern":       "login:\n    pattern: \"[a-\"",
+		"minimum больше maximum": "age:\n    minimum: 10\n    maximum: 1",
+		"отрицательная длина":    "login:\n    minLength: -1",
+	}
+
+	for name, constraints := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := strings.Replace(accountLexicon, accountConstraints, "constraints:\n  "+constraints+"\n", 1)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "account.yaml"), []byte(content), 0o644))
+
+			err := NewRegistry(dir).LoadSchemas(context.Background())
+			assert.ErrorContains(t, err, "invalid constraints")
+		})
+	}
+}
+
+// ========================================
+// ТЕСТЫ ВЛОЖЕННЫХ СТРУКТУР
+// ========================================
+
+// TestValidateDataNested проверяет рекурсивную валидацию списков
+// и вложенных структур
+func TestValidateDataNested(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"post.yaml": postLexicon})
+
+	// validPost возвращает корректный пост с вложенными объектами
+	validPost := func() map[string]interface{} {
+		return map[string]interface{}{
+			"title":  "Hello",
+			"author": map[string]interface{}{"name": "Alice"},
+			"tags":   []interface{}{"go", "ipld"},
+			"comments": []interface{}{
+				map[string]interface{}{
+					"author": map[string]interface{}{"name": "Bob", "email": "bob@example.com"},
+					"text":   "Nice",
+				},
+			},
+		}
+	}
+
+	t.Run("корневой тип объявлен после вложенных", func(t *testing.T) {
+		assert.NoError(t, registry.ValidateData("com.example.post", validPost()))
+	})
+
+	t.Run("элемент списка неверного типа", func(t *testing.T) {
+		post := validPost()
+		post["tags"] = []interface{}{"go", 42, "ipld"}
+
+		fieldErrs, err := registry.ValidateDataAll("com.example.post", post)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "tags[1]", Expected: "string", Got: "int"}}, fieldErrs)
+	})
+
+	t.Run("во вложенной структуре нет обязательного поля", func(t *testing.T) {
+		post := validPost()
+		post["author"] = map[string]interface{}{"email": "alice@example.com"}
+
+		fieldErrs, err := registry.ValidateDataAll("com.example.post", post)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "author.name", Expected: "string", Got: "missing"}}, fieldErrs)
+	})
+
+	t.Run("структура в элементе списка", func(t *testing.T) {
+		post := validPost()
+		post["comments"] = []interface{}{
+			map[string]interface{}{"author": map[string]interface{}{"name": "Bob"}, "text": "ok"},
+			map[string]interface{}{"author": map[string]interface{}{"name": 7}},
+			"not a comment",
+		}
+
+		fieldErrs, err := registry.ValidateDataAll("com.example.post", post)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{
+			{Path: "comments[1].author.name", Expected: "string", Got: "int"},
+			{Path: "comments[1].text", Expected: "string", Got: "missing"},
+			{Path: "comments[2]", Expected: "struct", Got: "string"},
+		}, fieldErrs)
+	})
+
+	t.Run("рекурсивная структура", func(t *testing.T) {
+		post := validPost()
+		post["comments"] = []interface{}{
+			map[string]interface{}{
+				"author": map[string]interface{}{"name": "Bob"},
+				"text":   "ok",
+				"replies": []interface{}{
+					map[string]interface{}{"author": map[string]interface{}{"name": "Carol"}, "text": true},
+				},
+			},
+		}
+
+		fieldErrs, err := registry.ValidateDataAll("com.example.post", post)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "comments[0].replies[0].text", Expected: "string", Got: "bool"}}, fieldErrs)
+	})
+
+	t.Run("nullable значения", func(t *testing.T) {
+		post := validPost()
+		post["summary"] = nil
+		post["meta"] = map[string]interface{}{"lang": "en", "draft": nil}
+		assert.NoError(t, registry.ValidateData("com.example.post", post))
+
+		// Поле не nullable
+		post["title"] = nil
+		fieldErrs, err := registry.ValidateDataAll("com.example.post", post)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "title", Expected: "string", Got: "null"}}, fieldErrs)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПЕРЕЗАГРУЗКИ СХЕМ
+// ========================================
+
+// TestReloadSchemas проверяет полную перезагрузку схем из директории
+func TestReloadSchemas(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.v1.yaml"), []byte(userLexiconV1), 0o644))
+
+	registry := NewRegistry(dir)
+	require.NoError(t, registry.LoadSchemas(context.Background()))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.v2.yaml"), []byte(userLexiconV2), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "user.v1.yaml")))
+	require.NoError(t, registry.ReloadSchemas(context.Background()))
+
+	assert.Equal(t, []string{"2.0.0"}, registry.ListVersions("com.example.user"))
+}
+
+// TestWatch проверяет применение изменений файлов схем без перезапуска
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	registry := createTestRegistryInDir(t, dir, map[string]string{"user.v1.yaml": userLexiconV1})
+
+	events := make(chan ReloadEvent, 16)
+	registry.SetReloadHandler(func(event ReloadEvent) { events <- event })
+	require.NoError(t, registry.Watch(ctx))
+
+	// waitEvent ожидает следующее событие перезагрузки
+	waitEvent := func(t *testing.T) ReloadEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("reload event not received")
+			return ReloadEvent{}
+		}
+	}
+
+	t.Run("новый файл становится доступен", func(t *testing.T) {
+		path := filepath.Join(dir, "post.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(postLexicon), 0o644))
+
+		event := waitEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, ReloadEvent{Path: path, ID: "com.example.post", Version: "1.0.0"}, event)
+
+		_, err := registry.GetSchema("com.example.post")
+		assert.NoError(t, err)
+	})
+
+	t.Run("новая версия в поддиректории", func(t *testing.T) {
+		sub := filepath.Join(dir, "v2")
+		require.NoError(t, os.Mkdir(sub, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(sub, "user.yaml"), []byte(userLexiconV2), 0o644))
+
+		event := waitEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, "2.0.0", event.Version)
+
+		latest, err := registry.LatestVersion("com.example.user")
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", latest)
+		assert.Error(t, registry.ValidateData("com.example.user", map[string]interface{}{"name": "Alice"}))
+	})
+
+	t.Run("некорректная правка сохраняет последнюю версию", func(t *testing.T) {
+		path := filepath.Join(dir, "post.yaml")
+		broken := strings.Replace(postLexicon, "type Post struct {", "type Post struct", 1)
+		require.NoError(t, os.WriteFile(path, []byte(broken), 0o644))
+
+		event := waitEvent(t)
+		assert.Error(t, event.Err)
+		assert.Equal(t, path, event.Path)
+
+		def, err := registry.GetSchema("com.example.post")
+		require.NoError(t, err)
+		assert.Contains(t, def.Schema, "type Post struct {")
+		_, err = registry.GetCompiledSchema("com.example.post")
+		assert.NoError(t, err)
+	})
+
+	t.Run("удаление файла выгружает версию", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "v2")))
+
+		event := waitEvent(t)
+		require.NoError(t, event.Err)
+		assert.True(t, event.Removed)
+		assert.Equal(t, "2.0.0", event.Version)
+
+		assert.Equal(t, []string{"1.0.0"}, registry.ListVersions("com.example.user"))
+		assert.NoError(t, registry.ValidateData("com.example.user", map[string]interface{}{"name": "Alice"}))
+	})
+}
+
+// ========================================
+// ТЕСТЫ ССЫЛОК НА СХЕМЫ
+// ========================================
+
+// TestSchemaRefs проверяет использование типов другой схемы через refs
+func TestSchemaRefs(t *testing.T) {
+	// article.yaml обходится раньше author.yaml, от которой зависит
+	registry := createTestRegistry(t, map[string]string{
+		"article.yaml": articleLexicon,
+		"author.yaml":  authorLexicon,
+	})
+
+	t.Run("порядок схем по зависимостям", func(t *testing.T) {
+		assert.Equal(t, []string{"com.example.author", "com.example.article"}, registry.ListSchemas())
+	})
+
+	t.Run("валидация через ссылку", func(t *testing.T) {
+		article := map[string]interface{}{
+			"title":  "Hello",
+			"author": map[string]interface{}{"name": "Alice"},
+		}
+		assert.NoError(t, registry.ValidateData("com.example.article", article))
+
+		article["author"] = map[string]interface{}{"email": "alice@example.com"}
+		fieldErrs, err := registry.ValidateDataAll("com.example.article", article)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "author.name", Expected: "string", Got: "missing"}}, fieldErrs)
+
+		// Ограничение схемы article на поле из схемы author
+		article["author"] = map[string]interface{}{"name": ""}
+		fieldErrs, err = registry.ValidateDataAll("com.example.article", article)
+		require.NoError(t, err)
+		assert.Equal(t, []FieldError{{Path: "author.name", Expected: "length >= 1", Got: "length 0"}}, fieldErrs)
+	})
+
+	t.Run("цикл ссылок", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLexicon(t, dir, "a.yaml", refLexicon("com.example.a", "A", "com.example.b", "B"))
+		writeLexicon(t, dir, "b.yaml", refLexicon("com.example.b", "B", "com.example.a", "A"))
+
+		err := NewRegistry(dir).LoadSchemas(context.Background())
+		assert.ErrorContains(t, err, "schema reference cycle: com.example.a -> com.example.b -> com.example.a")
+	})
+
+	t.Run("неизвестная схема", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLexicon(t, dir, "a.yaml", refLexicon("com.example.a", "A", "com.example.missing", "Missing"))
+
+		err := NewRegistry(dir).LoadSchemas(context.Background())
+		assert.ErrorContains(t, err, "schema com.example.a references unknown schema com.example.missing")
+	})
+}
+
+// ========================================
+// ТЕСТЫ ВАЛИДАЦИИ IPLD УЗЛОВ
+// ========================================
+
+// TestValidateNode проверяет валидацию IPLD узлов без преобразования в Go значения
+func TestValidateNode(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{
+		"user.yaml":    userLexiconV2,
+		"profile.yaml": profileLexicon,
+		"account.yaml": accountLexicon,
+	})
+
+	t.Run("валидный пользователь", func(t *testing.T) {
+		node := buildNode(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Alice"))
+			qp.MapEntry(ma, "email", qp.String("alice@example.com"))
+		})
+		assert.NoError(t, registry.ValidateNode("com.example.user", node))
+	})
+
+	t.Run("неверный тип поля", func(t *testing.T) {
+		node := buildNode(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Alice"))
+			qp.MapEntry(ma, "email", qp.Int(42))
+		})
+
+		var verrs ValidationErrors
+		require.ErrorAs(t, registry.ValidateNode("com.example.user", node), &verrs)
+		assert.Equal(t, ValidationErrors{{Path: "email", Expected: "string", Got: "int"}}, verrs)
+	})
+
+	t.Run("нет обязательного поля", func(t *testing.T) {
+		node := buildNode(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Alice"))
+		})
+
+		var verrs ValidationErrors
+		require.ErrorAs(t, registry.ValidateNode("com.example.user", node), &verrs)
+		assert.Equal(t, ValidationErrors{{Path: "email", Expected: "string", Got: "missing"}}, verrs)
+	})
+
+	t.Run("виды узлов", func(t *testing.T) {
+		node := buildNode(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Alice"))
+			qp.MapEntry(ma, "age", qp.Float(30))
+			qp.MapEntry(ma, "score", qp.Int(4))
+			qp.MapEntry(ma, "active", qp.String("true"))
+			qp.MapEntry(ma, "tags", qp.List(-1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.String("go"))
+				qp.ListEntry(la, qp.Null())
+			}))
+			qp.MapEntry(ma, "limits", qp.Map(-1, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, "daily", qp.Int(10))
+			}))
+		})
+
+		rootType, v, err := registry.validatorFor("com.example.profile", "")
+		require.NoError(t, err)
+		v.all = true
+		require.NoError(t, v.validateNode(rootType, node, ""))
+		assert.Equal(t, []FieldError{
+			{Path: "age", Expected: "int", Got: "float"},
+			{Path: "score", Expected: "float", Got: "int"},
+			{Path: "active", Expected: "bool", Got: "string"},
+			{Path: "tags[1]", Expected: "string", Got: "null"},
+		}, v.errs)
+	})
+
+	t.Run("ограничения полей", func(t *testing.T) {
+		node := buildNode(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "login", qp.String("alice"))
+			qp.MapEntry(ma, "age", qp.Int(200))
+			qp.MapEntry(ma, "score", qp.Float(5))
+			qp.MapEntry(ma, "role", qp.String("user"))
+			qp.MapEntry(ma, "level", qp.Int(2))
+			qp.MapEntry(ma, "tags", qp.List(-1, func(la datamodel.ListAssembler) {
+				qp.ListEntry(la, qp.String("go"))
+				qp.ListEntry(la, qp.String("ipld"))
+				qp.ListEntry(la, qp.String("car"))
+			}))
+		})
+
+		rootType, v, err := registry.validatorFor("com.example.account", "")
+		require.NoError(t, err)
+		v.all = true
+		require.NoError(t, v.validateNode(rootType, node, ""))
+		assert.Equal(t, []FieldError{
+			{Path: "age", Expected: "<= 150", Got: "200"},
+			{Path: "tags", Expected: "length <= 2", Got: "length 3"},
+		}, v.errs)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ЭКСПОРТА JSON SCHEMA
+// ========================================
+
+// TestToJSONSchema проверяет JSON Schema, сгенерированную по схеме с
+// вложенными, рекурсивными и nullable типами
+func TestToJSONSchema(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"post.yaml": postLexicon})
+
+	doc, err := registry.ToJSONSchema("com.example.post")
+	require.NoError(t, err)
+
+	author := `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"email": {"type": "string"}
+		},
+		"required": ["name"]
+	}`
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "com.example.post",
+		"title": "Post",
+		"description": "Пост с автором и комментариями",
+		"type": "object",
+		"properties": {
+			"title": {"type": "string"},
+			"summary": {"type": ["string", "null"]},
+			"author": `+author+`,
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"comments": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"author": `+author+`,
+						"text": {"type": "string"},
+						"replies": {"type": "array", "items": {"$ref": "#/$defs/Comment"}}
+					},
+					"required": ["author", "text"]
+				}
+			},
+			"meta": {
+				"type": "object",
+				"additionalProperties": {"type": ["string", "null"]}
+			}
+		},
+		"required": ["title", "author", "tags", "comments"],
+		"$defs": {
+			"Comment": {
+				"type": "object",
+				"properties": {
+					"author": `+author+`,
+					"text": {"type": "string"},
+					"replies": {"type": "array", "items": {"$ref": "#/$defs/Comment"}}
+				},
+				"required": ["author", "text"]
+			}
+		}
+	}`, string(doc))
+
+	t.Run("неизвестная схема", func(t *testing.T) {
+		_, err := registry.ToJSONSchema("com.example.unknown")
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+// TestToJSONSchemaConstraints проверяет перенос ограничений полей в JSON Schema
+func TestToJSONSchemaConstraints(t *testing.T) {
+	registry := createTestRegistry(t, map[string]string{"account.yaml": accountLexicon})
+
+	doc, err := registry.ToJSONSchema("com.example.account")
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(doc, &got))
+	properties := got["properties"].(map[string]interface{})
+
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": 0.0, "maximum": 150.0}, properties["age"])
+	assert.Equal(t, map[string]interface{}{"type": "number", "maximum": 10.0}, properties["score"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "string", "minLength": 2.0, "maxLength": 10.0, "pattern": "^[a-z]+$",
+	}, properties["login"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "enum": []interface{}{"admin", "user"}}, properties["role"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "enum": []interface{}{1.0, 2.0, 3.0}}, properties["level"])
+	assert.Equal(t, map[string]interface{}{
+		"type":     "array",
+		"maxItems": 2.0,
+		"items":    map[string]interface{}{"type": "string", "minLength": 2.0},
+	}, properties["tags"])
+}
+
+// ========================================
+// ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ
+// ========================================
+
+// userLexiconV1 - первая версия лексикона пользователя
+const userLexiconV1 = `id: com.example.user
+version: "1.0.0"
+name: User
+description: Профиль пользователя
+status: deprecated
+schema: |
+  type User struct {
+    name String
+  }
+`
+
+// userLexiconV2 - вторая версия лексикона пользователя с обязательным email
+const userLexiconV2 = `id: com.example.user
+version: "2.0.0"
+name: User
+description: Профиль пользователя
+status: active
+schema: |
+  type User struct {
+    name String
+    email String
+  }
+`
+
+// profileLexicon - лексикон со всеми скалярными типами, списком и картой
+const profileLexicon = `id: com.example.profile
+version: "1.0.0"
+name: Profile
+description: Профиль с полями всех типов
+status: active
+schema: |
+  type Profile struct {
+    name String
+    age Int
+    score Float
+    active Bool
+    tags optional [String]
+    limits optional {String:Int}
+  }
+`
+
+// postLexicon - лексикон поста с вложенными структурами; корневой тип
+// Post объявлен после используемых им типов
+const postLexicon = `id: com.example.post
+version: "1.0.0"
+name: Post
+description: Пост с автором и комментариями
+status: active
+schema: |
+  type Author struct {
+    name String
+    email optional String
+  }
+
+  type Comment struct {
+    author Author
+    text String
+    replies optional [Comment]
+  }
+
+  type Post struct {
+    title String
+    summary optional nullable String
+    author Author
+    tags [String]
+    comments [Comment]
+    meta optional {String:nullable String}
+  }
+`
+
+// authorLexicon - лексикон автора, на который ссылается articleLexicon
+const authorLexicon = `id: com.example.author
+version: "1.0.0"
+name: Author
+description: Автор публикации
+status: active
+schema: |
+  type Author struct {
+    name String
+    email optional String
+  }
+`
+
+// articleLexicon - лексикон статьи, использующий тип Author из com.example.author
+const articleLexicon = `id: com.example.article
+version: "1.0.0"
+name: Article
+description: Статья с автором
+status: active
+refs:
+  - com.example.author
+constraints:
+  author.name:
+    minLength: 1
+schema: |
+  type Article struct {
+    title String
+    author Author
+  }
+`
+
+// refLexicon возвращает лексикон id с типом typeName, поле которого имеет
+// тип refType из схемы refID
+func refLexicon(id, typeName, refID, refType string) string {
+	return fmt.Sprintf(`id: %s
+version: "1.0.0"
+status: active
+refs:
+  - %s
+schema: |
+  type %s struct {
+    other optional %s
+  }
+`, id, refID, typeName, refType)
+}
+
+// accountConstraints - ограничения полей лексикона учетной записи
+const accountConstraints = `constraints:
+  age:
+    minimum: 0
+    maximum: 150
+  score:
+    maximum: 10
+  login:
+    minLength: 2
+    maxLength: 10
+    pattern: "^[a-z]+$"
+  role:
+    enum: [admin, user]
+  level:
+    enum: [1, 2, 3]
+  tags:
+    maxLength: 2
+  tags[]:
+    minLength: 2
+`
+
+// accountLexicon - лексикон учетной записи с ограничениями полей
+const accountLexicon = `id: com.example.account
+version: "1.0.0"
+name: Account
+description: Учетная запись с ограничениями полей
+status: active
+schema: |
+  type Account struct {
+    login String
+    age Int
+    score Float
+    role String
+    level Int
+    tags [String]
+  }
+` + accountConstraints
+
+// createTestRegistry создает реестр из файлов лексиконов во временной
+// директории (имя файла -> содержимое YAML) и загружает схемы
+func createTestRegistry(t *testing.T, lexicons map[string]string) *Registry {
+	t.Helper()
+	return createTestRegistryInDir(t, t.TempDir(), lexicons)
+}
+
+// createTestRegistryInDir создает реестр из файлов лексиконов в директории dir
+func createTestRegistryInDir(t *testing.T, dir string, lexicons map[string]string) *Registry {
+	t.Helper()
+
+	for name, content := range lexicons {
+		writeLexicon(t, dir, name, content)
+	}
+
+	registry := NewRegistry(dir)
+	require.NoError(t, registry.LoadSchemas(context.Background()))
+	return registry
+}
+
+// writeLexicon записывает файл лексикона в директорию dir
+func writeLexicon(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+// buildNode собирает узел-карту basicnode
+func buildNode(t *testing.T, fn func(ma datamodel.MapAssembler)) datamodel.Node {
+	t.Helper()
+	node, err := qp.BuildMap(basicnode.Prototype.Any, -1, fn)
+	require.NoError(t, err)
+	return node
+}
@@ -0,0 +1,255 @@
+package lexicon
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// ValidateNode валидирует IPLD узел против схемы без преобразования
+// в map[string]interface{}. Правила те же, что у ValidateData (включая
+// CoercionMode, ограничения полей и nullable), но проверяются виды узлов
+// модели данных IPLD: Int и Float различаются по виду узла, а не по типу Go,
+// поэтому значения не теряют точность при преобразовании.
+//
+// Параметры:
+//
+//	id - идентификатор схемы для валидации
+//	node - узел записи (обычно карта)
+//
+// Возвращает:
+//
+//	error - ValidationErrors с первым нарушением или nil если узел валиден
+//
+// Пример использования:
+//
+//	if err := registry.ValidateNode("com.example.user", node); err != nil {
+//	    return fmt.Errorf("invalid record: %w", err)
+//	}
+func (r *Registry) ValidateNode(id string, node datamodel.Node) error {
+	rootType, v, err := r.validatorFor(id, "")
+	if err != nil {
+		return err
+	}
+
+	if err := v.validateNode(rootType, node, ""); err != nil {
+		if fe, ok := err.(FieldError); ok {
+			return ValidationErrors{fe}
+		}
+		return err
+	}
+	return nil
+}
+
+// validateNode проверяет узел против типа схемы; аналог validateAgainstType
+func (v *validator) validateNode(typ schema.Type, node datamodel.Node, path string) error {
+	switch typ.TypeKind() {
+	case schema.TypeKind_Struct:
+		return v.validateStructNode(typ, node, path)
+
+	case schema.TypeKind_String:
+		if node.Kind() != datamodel.Kind_String {
+			return v.fail(FieldError{Path: path, Expected: "string", Got: describeNode(node)})
+		}
+
+	case schema.TypeKind_Bool:
+		if node.Kind() != datamodel.Kind_Bool {
+			return v.fail(FieldError{Path: path, Expected: "bool", Got: describeNode(node)})
+		}
+
+	case schema.TypeKind_Int:
+		if !v.nodeAcceptsInt(node) {
+			return v.fail(FieldError{Path: path, Expected: "int", Got: describeNode(node)})
+		}
+
+	case schema.TypeKind_Float:
+		if !v.nodeAcceptsFloat(node) {
+			return v.fail(FieldError{Path: path, Expected: "float", Got: describeNode(node)})
+		}
+
+	case schema.TypeKind_List:
+		return v.validateListNode(typ, node, path)
+
+	case schema.TypeKind_Map:
+		return v.validateMapNode(typ, node, path)
+	}
+
+	// Тип совпал - проверяем ограничения поля на значении узла
+	value, err := nodeScalar(node)
+	if err != nil {
+		return fmt.Errorf("field %s: %w", path, err)
+	}
+	return v.checkConstraints(path, value)
+}
+
+// validateStructNode проверяет узел-карту против структуры схемы
+func (v *validator) validateStructNode(typ schema.Type, node datamodel.Node, path string) error {
+	if node.Kind() != datamodel.Kind_Map {
+		return v.fail(FieldError{Path: path, Expected: "struct", Got: describeNode(node)})
+	}
+
+	structType, ok := typ.(*schema.TypeStruct)
+	if !ok {
+		return fmt.Errorf("expected *schema.TypeStruct, got %T", typ)
+	}
+
+	for _, field := range structType.Fields() {
+		fieldName := field.Name()
+
+		value, err := node.LookupByString(fieldName)
+		if _, notFound := err.(datamodel.ErrNotExists); err != nil && !notFound {
+			return fmt.Errorf("field %s: %w", fieldPath(path, fieldName), err)
+		}
+		if value == nil || value.IsAbsent() {
+			if field.IsOptional() {
+				continue
+			}
+			if err := v.fail(FieldError{Path: fieldPath(path, fieldName), Expected: expectedKind(field.Type()), Got: gotMissing}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if value.IsNull() && field.IsNullable() {
+			continue
+		}
+		if err := v.validateNode(field.Type(), value, fieldPath(path, fieldName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateListNode проверяет узел-список и его элементы
+func (v *validator) validateListNode(typ schema.Type, node datamodel.Node, path string) error {
+	if node.Kind() != datamodel.Kind_List {
+		return v.fail(FieldError{Path: path, Expected: "list", Got: describeNode(node)})
+	}
+
+	listType, ok := typ.(*schema.TypeList)
+	if !ok {
+		return fmt.Errorf("expected *schema.TypeList, got %T", typ)
+	}
+
+	it := node.ListIterator()
+	for !it.Done() {
+		i, item, err := it.Next()
+		if err != nil {
+			return fmt.Errorf("list %s: %w", path, err)
+		}
+		if item.IsNull() && listType.ValueIsNullable() {
+			continue
+		}
+		if err := v.validateNode(listType.ValueType(), item, indexPath(path, int(i))); err != nil {
+			return err
+		}
+	}
+
+	// Все элементы проверены - проверяем ограничения длины списка
+	return v.checkValueConstraints(path, nil, int(node.Length()))
+}
+
+// validateMapNode проверяет узел-карту и ее значения
+func (v *validator) validateMapNode(typ schema.Type, node datamodel.Node, path string) error {
+	if node.Kind() != datamodel.Kind_Map {
+		return v.fail(FieldError{Path: path, Expected: "map", Got: describeNode(node)})
+	}
+
+	mapType, ok := typ.(*schema.TypeMap)
+	if !ok {
+		return fmt.Errorf("expected *schema.TypeMap, got %T", typ)
+	}
+
+	it := node.MapIterator()
+	for !it.Done() {
+		k, value, err := it.Next()
+		if err != nil {
+			return fmt.Errorf("map %s: %w", path, err)
+		}
+		key, err := k.AsString()
+		if err != nil {
+			return fmt.Errorf("map %s: %w", path, err)
+		}
+		if value.IsNull() && mapType.ValueIsNullable() {
+			continue
+		}
+		if err := v.validateNode(mapType.ValueType(), value, fieldPath(path, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeAcceptsInt проверяет, принимается ли узел для типа Int
+func (v *validator) nodeAcceptsInt(node datamodel.Node) bool {
+	switch node.Kind() {
+	case datamodel.Kind_Int:
+		return true
+	case datamodel.Kind_String:
+		if v.coercion == CoercionNumericStrings {
+			s, _ := node.AsString()
+			_, err := strconv.ParseInt(s, 10, 64)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// nodeAcceptsFloat проверяет, принимается ли узел для типа Float
+func (v *validator) nodeAcceptsFloat(node datamodel.Node) bool {
+	switch node.Kind() {
+	case datamodel.Kind_Float:
+		return true
+	case datamodel.Kind_String:
+		if v.coercion == CoercionNumericStrings {
+			s, _ := node.AsString()
+			f, err := strconv.ParseFloat(s, 64)
+			return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+		}
+	}
+	return false
+}
+
+// nodeScalar возвращает значение скалярного узла как значение Go для
+// проверки ограничений; для остальных видов узлов возвращает nil
+func nodeScalar(node datamodel.Node) (interface{}, error) {
+	switch node.Kind() {
+	case datamodel.Kind_String:
+		return node.AsString()
+	case datamodel.Kind_Int:
+		return node.AsInt()
+	case datamodel.Kind_Float:
+		return node.AsFloat()
+	case datamodel.Kind_Bool:
+		return node.AsBool()
+	}
+	return nil, nil
+}
+
+// describeNode возвращает вид узла для FieldError.Got
+func describeNode(node datamodel.Node) string {
+	switch node.Kind() {
+	case datamodel.Kind_Null:
+		return "null"
+	case datamodel.Kind_String:
+		return "string"
+	case datamodel.Kind_Bool:
+		return "bool"
+	case datamodel.Kind_Int:
+		return "int"
+	case datamodel.Kind_Float:
+		return "float"
+	case datamodel.Kind_List:
+		return "list"
+	case datamodel.Kind_Map:
+		return "map"
+	case datamodel.Kind_Bytes:
+		return "bytes"
+	case datamodel.Kind_Link:
+		return "link"
+	}
+	return node.Kind().String()
+}
@@ -0,0 +1,163 @@
+package lexicon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// Ссылки на другие схемы
+//
+// Схема может использовать типы других зарегистрированных схем, перечислив
+// их ID в секции refs:
+//
+//	id: com.example.post
+//	refs:
+//	  - com.example.author
+//	schema: |
+//	  type Post struct {
+//	    title String
+//	    author Author
+//	  }
+//
+// где Author - тип, объявленный в схеме com.example.author. Ссылки
+// разрешаются при компиляции (GetCompiledSchema): к тексту схемы
+// добавляются тексты всех ее зависимостей (транзитивно, каждая один раз,
+// в последних версиях), поэтому порядок загрузки файлов не важен. Имена
+// типов разных схем не должны совпадать. Циклические ссылки считаются
+// ошибкой. Ограничения (constraints) зависимостей не применяются - пути
+// ограничений схемы могут указывать внутрь полей зависимостей
+// (например, "author.name").
+
+// compileDefinition компилирует определение схемы вместе с зависимостями.
+// Вызывается под lock реестра (чтение или запись).
+func (r *Registry) compileDefinition(def *LexiconDefinition) (*schema.TypeSystem, error) {
+	if len(def.Refs) == 0 {
+		return r.compileSchema(def.Schema)
+	}
+
+	text, err := r.resolveSchema(def)
+	if err != nil {
+		return nil, err
+	}
+	return r.compileSchema(text)
+}
+
+// resolveSchema возвращает текст схемы с добавленными текстами всех
+// зависимостей. Текст самой схемы идет первым, чтобы ее корневой тип
+// оставался первым из объявленных (см. schemaRootType).
+func (r *Registry) resolveSchema(def *LexiconDefinition) (string, error) {
+	var (
+		texts   = []string{def.Schema}
+		visited = map[string]bool{def.ID: true}
+		stack   = []string{def.ID}
+		visit   func(d *LexiconDefinition) error
+	)
+
+	visit = func(d *LexiconDefinition) error {
+		for _, ref := range d.Refs {
+			for i, id := range stack {
+				if id == ref {
+					cycle := append(append([]string{}, stack[i:]...), ref)
+					return fmt.Errorf("schema reference cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+			if visited[ref] {
+				continue
+			}
+
+			dep, ok := r.definitions[ref]
+			if !ok {
+				return fmt.Errorf("schema %s references unknown schema %s", d.ID, ref)
+			}
+			visited[ref] = true
+			texts = append(texts, dep.Schema)
+
+			stack = append(stack, ref)
+			if err := visit(dep); err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+		}
+		return nil
+	}
+
+	if err := visit(def); err != nil {
+		return "", err
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// checkRefs компилирует все загруженные схемы со ссылками, чтобы сообщить
+// о неизвестных зависимостях, циклах и ошибках схем сразу после загрузки,
+// когда известны все файлы. Вызывается под write lock.
+func (r *Registry) checkRefs() error {
+	paths := make([]string, 0, len(r.files))
+	for path, def := range r.files {
+		if len(def.Refs) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if _, err := r.compileDefinition(r.files[path]); err != nil {
+			return fmt.Errorf("invalid schema in %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// invalidateRefCaches сбрасывает скомпилированные схемы со ссылками: они
+// включают тексты зависимостей и устаревают при изменении любой из них.
+// Вызывается под write lock.
+func (r *Registry) invalidateRefCaches() {
+	for id, versions := range r.versions {
+		for version, def := range versions {
+			if len(def.Refs) == 0 {
+				continue
+			}
+			delete(r.compiledTypes, versionKey(id, version))
+			if r.definitions[id] == def {
+				delete(r.compiledTypes, id)
+			}
+		}
+	}
+}
+
+// dependencyOrder упорядочивает ID схем так, что зависимости идут раньше
+// зависимых схем; независимые схемы - по алфавиту. Циклические ссылки
+// не прерывают обход: схема из цикла выводится после остальных своих
+// зависимостей. Вызывается под read lock.
+func (r *Registry) dependencyOrder() []string {
+	ids := make([]string, 0, len(r.definitions))
+	for id := range r.definitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	ordered := make([]string, 0, len(ids))
+	state := make(map[string]int) // 0 - не посещена, 1 - в обходе, 2 - выведена
+	var visit func(id string)
+	visit = func(id string) {
+		def, ok := r.definitions[id]
+		if !ok || state[id] != 0 {
+			return
+		}
+		state[id] = 1
+		refs := append([]string{}, def.Refs...)
+		sort.Strings(refs)
+		for _, ref := range refs {
+			visit(ref)
+		}
+		state[id] = 2
+		ordered = append(ordered, id)
+	}
+
+	for _, id := range ids {
+		visit(id)
+	}
+	return ordered
+}
@@ -0,0 +1,248 @@
+package lexicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// CoercionMode определяет, какие значения валидатор принимает для числовых
+// типов схемы помимо чисел Go.
+//
+// Правила приема значений по типам схемы:
+//   - String: только string;
+//   - Bool: только bool, строки "true"/"false" и числа не принимаются
+//     ни в одном режиме;
+//   - Int: целые типы Go (int*, uint*; uint64 - только в пределах int64)
+//     и json.Number с целым значением;
+//   - Float: float32, float64 и json.Number; целые числа Go не принимаются,
+//     так как модель данных IPLD различает Int и Float;
+//   - строки с числом ("30", "1.5") принимаются для Int/Float только
+//     в режиме CoercionNumericStrings.
+//
+// Валидация не изменяет данные: принятая строка остается строкой.
+type CoercionMode int
+
+const (
+	// CoercionStrict - строгий режим (по умолчанию): строки с числами отклоняются
+	CoercionStrict CoercionMode = iota
+
+	// CoercionNumericStrings - строки, содержащие число, принимаются для Int
+	// (целое в десятичной записи) и Float (конечное число)
+	CoercionNumericStrings
+)
+
+// gotMissing - значение FieldError.Got для отсутствующего обязательного поля
+const gotMissing = "missing"
+
+// FieldError описывает нарушение схемы в одном поле данных.
+type FieldError struct {
+	// Path - путь к полю: имена полей через точку и индексы списков
+	// в квадратных скобках (например, "address.city" или "tags[2]").
+	// Пустой путь означает корневое значение.
+	Path string
+
+	// Expected - ожидаемый тип: string, bool, int, float, list, map или struct;
+	// для нарушенного ограничения - его описание (например, ">= 0").
+	Expected string
+
+	// Got - фактический тип значения (string, bool, int, float, number,
+	// list, map, null или тип Go) либо "missing" для отсутствующего поля;
+	// для нарушенного ограничения - само значение или его длина.
+	Got string
+}
+
+// Error реализует интерфейс error
+func (e FieldError) Error() string {
+	if e.Got == gotMissing {
+		return fmt.Sprintf("required field missing: %s", e.Path)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("expected %s, got %s", e.Expected, e.Got)
+	}
+	return fmt.Sprintf("field %s: expected %s, got %s", e.Path, e.Expected, e.Got)
+}
+
+// ValidationErrors - ошибка валидации данных со списком нарушений по полям.
+// Извлекается из ошибки ValidateData через errors.As.
+type ValidationErrors []FieldError
+
+// Error реализует интерфейс error
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SetCoercionMode задает правила приема числовых значений при валидации
+// (см. CoercionMode). Влияет на последующие вызовы ValidateData.
+func (r *Registry) SetCoercionMode(mode CoercionMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.coercion = mode
+}
+
+// ValidateDataAll валидирует данные против схемы и возвращает все найденные
+// нарушения, а не только первое, как ValidateData. Полезно для форм: все
+// ошибки можно показать пользователю сразу.
+//
+// Параметры:
+//
+//	id - идентификатор схемы для валидации
+//	data - данные для проверки
+//
+// Возвращает:
+//
+//	[]FieldError - нарушения в порядке обхода (поля структуры - в порядке
+//	               схемы, ключи карт - по возрастанию); nil если данные валидны
+//	error - ошибка если схема не найдена или не может быть скомпилирована
+//
+// Пример использования:
+//
+//	fieldErrs, err := registry.ValidateDataAll("com.example.user", formData)
+//	for _, fe := range fieldErrs {
+//	    log.Printf("%s: expected %s, got %s", fe.Path, fe.Expected, fe.Got)
+//	}
+func (r *Registry) ValidateDataAll(id string, data interface{}) ([]FieldError, error) {
+	rootType, v, err := r.validatorFor(id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	v.all = true
+	if err := v.validateAgainstType(rootType, data, ""); err != nil {
+		return nil, err
+	}
+	return v.errs, nil
+}
+
+// validator проверяет данные против типов схемы по правилам coercion
+type validator struct {
+	coercion    CoercionMode
+	constraints map[string]*compiledConstraint // Ограничения полей схемы
+	all         bool                           // Собирать все нарушения вместо остановки на первом
+	errs        []FieldError                   // Собранные нарушения (в режиме all)
+}
+
+// fail регистрирует нарушение. В режиме all нарушение сохраняется и обход
+// продолжается (возвращается nil), иначе оно возвращается как ошибка.
+func (v *validator) fail(fe FieldError) error {
+	if !v.all {
+		return fe
+	}
+	v.errs = append(v.errs, fe)
+	return nil
+}
+
+// validate проверяет данные против корневого типа схемы и возвращает
+// первое нарушение как ValidationErrors
+func (v *validator) validate(rootType schema.Type, data interface{}) error {
+	if err := v.validateAgainstType(rootType, data, ""); err != nil {
+		if fe, ok := err.(FieldError); ok {
+			return ValidationErrors{fe}
+		}
+		return err
+	}
+	return nil
+}
+
+// acceptsInt проверяет, принимается ли значение для типа Int
+func (v *validator) acceptsInt(data interface{}) bool {
+	switch d := data.(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return true
+	case uint:
+		return uint64(d) <= math.MaxInt64
+	case uint64:
+		return d <= math.MaxInt64
+	case json.Number:
+		_, err := d.Int64()
+		return err == nil
+	case string:
+		if v.coercion == CoercionNumericStrings {
+			_, err := strconv.ParseInt(d, 10, 64)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// acceptsFloat проверяет, принимается ли значение для типа Float
+func (v *validator) acceptsFloat(data interface{}) bool {
+	switch d := data.(type) {
+	case float32, float64:
+		return true
+	case json.Number:
+		_, err := d.Float64()
+		return err == nil
+	case string:
+		if v.coercion == CoercionNumericStrings {
+			f, err := strconv.ParseFloat(d, 64)
+			return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+		}
+	}
+	return false
+}
+
+// describeValue возвращает тип значения для FieldError.Got
+func describeValue(data interface{}) string {
+	switch data.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+// fieldPath возвращает путь к полю структуры или ключу карты
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// indexPath возвращает путь к элементу списка
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// expectedKind возвращает ожидаемый тип значения для FieldError.Expected
+func expectedKind(typ schema.Type) string {
+	switch typ.TypeKind() {
+	case schema.TypeKind_Struct:
+		return "struct"
+	case schema.TypeKind_String:
+		return "string"
+	case schema.TypeKind_Bool:
+		return "bool"
+	case schema.TypeKind_Int:
+		return "int"
+	case schema.TypeKind_Float:
+		return "float"
+	case schema.TypeKind_List:
+		return "list"
+	case schema.TypeKind_Map:
+		return "map"
+	}
+	return strings.ToLower(typ.TypeKind().String())
+}
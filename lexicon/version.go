@@ -0,0 +1,238 @@
+package lexicon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// Версии схем
+//
+// Один ID схемы может быть загружен в нескольких версиях (например,
+// user.v1.yaml и user.v2.yaml с одинаковым id и разными version). Реестр
+// хранит все версии, а методы без указания версии (GetSchema, ValidateData,
+// IsActive) работают с последней из них. Версии сравниваются как
+// семантические: "1.10.0" новее "1.9.0", префикс "v" допускается,
+// пре-релиз ("2.0.0-beta") старше соответствующего релиза.
+
+// versionKey возвращает ключ кеша скомпилированных схем для конкретной версии
+func versionKey(id, version string) string {
+	return id + "@" + version
+}
+
+// addDefinition регистрирует версию схемы и обновляет последнюю версию ID.
+// Повторная загрузка той же версии заменяет предыдущее определение.
+// Вызывается под write lock.
+func (r *Registry) addDefinition(def *LexiconDefinition) {
+	versions, ok := r.versions[def.ID]
+	if !ok {
+		versions = make(map[string]*LexiconDefinition)
+		r.versions[def.ID] = versions
+	}
+	versions[def.Version] = def
+	delete(r.compiledTypes, versionKey(def.ID, def.Version))
+
+	latest, ok := r.definitions[def.ID]
+	if !ok || latest.Version == def.Version || compareVersions(def.Version, latest.Version) > 0 {
+		r.definitions[def.ID] = def
+		delete(r.compiledTypes, def.ID)
+	}
+
+	// Схемы, ссылающиеся на этот ID, включают его текст
+	r.invalidateRefCaches()
+}
+
+// removeDefinition удаляет версию схемы (например, при удалении ее файла)
+// и назначает последней наибольшую из оставшихся версий. Если версия уже
+// заменена определением из другого файла, ничего не делает.
+// Вызывается под write lock.
+func (r *Registry) removeDefinition(def *LexiconDefinition) {
+	versions := r.versions[def.ID]
+	if versions[def.Version] != def {
+		return
+	}
+	delete(versions, def.Version)
+	delete(r.compiledTypes, versionKey(def.ID, def.Version))
+
+	if r.definitions[def.ID] == def {
+		delete(r.definitions, def.ID)
+		delete(r.compiledTypes, def.ID)
+		for _, other := range versions {
+			if latest, ok := r.definitions[def.ID]; !ok || compareVersions(other.Version, latest.Version) > 0 {
+				r.definitions[def.ID] = other
+			}
+		}
+	}
+	if len(versions) == 0 {
+		delete(r.versions, def.ID)
+	}
+
+	r.invalidateRefCaches()
+}
+
+// GetSchemaVersion возвращает определение конкретной версии схемы.
+//
+// Параметры:
+//
+//	id - уникальный идентификатор схемы
+//	version - версия схемы (как указана в поле version файла схемы)
+//
+// Возвращает:
+//
+//	*LexiconDefinition - определение запрошенной версии
+//	error - ошибка если схема или версия не найдены
+func (r *Registry) GetSchemaVersion(id, version string) (*LexiconDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions, exists := r.versions[id]
+	if !exists {
+		return nil, fmt.Errorf("schema not found: %s", id)
+	}
+	def, exists := versions[version]
+	if !exists {
+		return nil, fmt.Errorf("schema version not found: %s@%s", id, version)
+	}
+	return def, nil
+}
+
+// ListVersions возвращает все загруженные версии схемы от старой к новой.
+// Для неизвестного ID возвращает пустой список.
+func (r *Registry) ListVersions(id string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make([]string, 0, len(r.versions[id]))
+	for version := range r.versions[id] {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions
+}
+
+// LatestVersion возвращает последнюю загруженную версию схемы.
+//
+// Возвращает:
+//
+//	string - номер последней версии
+//	error - ошибка если схема не найдена
+func (r *Registry) LatestVersion(id string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	def, exists := r.definitions[id]
+	if !exists {
+		return "", fmt.Errorf("schema not found: %s", id)
+	}
+	return def.Version, nil
+}
+
+// GetCompiledSchemaVersion возвращает компилированную IPLD схему конкретной
+// версии. Как и GetCompiledSchema, компилирует схему при первом обращении
+// и кеширует результат.
+func (r *Registry) GetCompiledSchemaVersion(id, version string) (*schema.TypeSystem, error) {
+	key := versionKey(id, version)
+
+	r.mu.RLock()
+	compiled, exists := r.compiledTypes[key]
+	r.mu.RUnlock()
+
+	if exists {
+		return compiled, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if compiled, exists := r.compiledTypes[key]; exists {
+		return compiled, nil
+	}
+
+	versions, exists := r.versions[id]
+	if !exists {
+		return nil, fmt.Errorf("schema not found: %s", id)
+	}
+	def, exists := versions[version]
+	if !exists {
+		return nil, fmt.Errorf("schema version not found: %s", key)
+	}
+
+	compiled, err := r.compileDefinition(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", key, err)
+	}
+
+	r.compiledTypes[key] = compiled
+	return compiled, nil
+}
+
+// ValidateDataVersion валидирует данные против конкретной версии схемы.
+// Пустая версия означает последнюю (эквивалентно ValidateData).
+// Полезно при миграции данных между ревизиями схемы: старые записи
+// проверяются по своей версии, новые - по последней.
+//
+// Пример использования:
+//
+//	err := registry.ValidateDataVersion("com.example.user", "1.0.0", oldUser)
+func (r *Registry) ValidateDataVersion(id, version string, data interface{}) error {
+	rootType, v, err := r.validatorFor(id, version)
+	if err != nil {
+		return err
+	}
+	return v.validate(rootType, data)
+}
+
+// compareVersions сравнивает две версии схемы и возвращает -1, 0 или 1.
+// Числовые компоненты сравниваются как числа, недостающие считаются нулем,
+// нечисловые - как строки. Версия с пре-релизом младше той же версии без него.
+func compareVersions(a, b string) int {
+	coreA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	coreB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	partsA := strings.Split(coreA, ".")
+	partsB := strings.Split(coreB, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		pa, pb := "0", "0"
+		if i < len(partsA) {
+			pa = partsA[i]
+		}
+		if i < len(partsB) {
+			pb = partsB[i]
+		}
+		if c := compareVersionPart(pa, pb); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareVersionPart(preA, preB)
+}
+
+// compareVersionPart сравнивает компоненты версии: числа - численно,
+// остальное - лексикографически
+func compareVersionPart(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,228 @@
+package lexicon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce - пауза после последнего изменения файла перед его
+// перезагрузкой. Редакторы часто сохраняют файл несколькими операциями
+// (усечение, запись частями), и промежуточное содержимое не нужно разбирать.
+const watchDebounce = 100 * time.Millisecond
+
+// ReloadEvent описывает результат обработки изменения файла схемы в Watch.
+type ReloadEvent struct {
+	Path    string // Путь к файлу схемы (пустой для ошибок самого наблюдателя)
+	ID      string // ID схемы из файла (пустой, если файл не удалось загрузить)
+	Version string // Версия схемы из файла
+	Removed bool   // Файл удален, его версия схемы выгружена из реестра
+	Err     error  // Ошибка загрузки; последняя корректная версия остается в реестре
+}
+
+// SetReloadHandler задает обработчик событий перезагрузки схем в Watch.
+// Обработчик вызывается последовательно из горутины наблюдателя и не
+// должен блокироваться надолго. nil отключает уведомления.
+func (r *Registry) SetReloadHandler(handler func(ReloadEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = handler
+}
+
+// Watch отслеживает изменения файлов в директории схем (включая
+// поддиректории) и применяет их к реестру без перезапуска приложения:
+//   - добавленный или измененный файл загружается заново, скомпилированные
+//     схемы его ID сбрасываются и компилируются при следующем обращении;
+//   - удаленный файл выгружает свою версию схемы, последней становится
+//     наибольшая из оставшихся версий;
+//   - файл с ошибкой (например, сохраненный посреди правки) не изменяет
+//     реестр: остается последняя корректная версия, а ошибка передается
+//     обработчику событий.
+//
+// Watch не загружает схемы сам - сначала вызывается LoadSchemas. Наблюдение
+// выполняется в фоновой горутине до отмены ctx; возвращается только ошибка
+// запуска наблюдателя. О результатах сообщается через SetReloadHandler.
+func (r *Registry) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	// fsnotify не отслеживает поддиректории, поэтому добавляем каждую
+	err = filepath.WalkDir(r.schemasDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", r.schemasDir, err)
+	}
+
+	go r.watchLoop(ctx, watcher)
+	return nil
+}
+
+// watchLoop обрабатывает события наблюдателя до отмены ctx
+func (r *Registry) watchLoop(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	// Таймеры откладывают обработку пути до окончания серии изменений
+	pending := make(map[string]*time.Timer)
+	ready := make(chan string)
+	defer func() {
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			path := event.Name
+			if timer, exists := pending[path]; exists {
+				timer.Reset(watchDebounce)
+				continue
+			}
+			pending[path] = time.AfterFunc(watchDebounce, func() {
+				select {
+				case ready <- path:
+				case <-ctx.Done():
+				}
+			})
+
+		case path := <-ready:
+			delete(pending, path)
+			r.applyChange(watcher, path)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			r.notify(ReloadEvent{Err: err})
+		}
+	}
+}
+
+// applyChange приводит реестр в соответствие с текущим состоянием пути
+func (r *Registry) applyChange(watcher *fsnotify.Watcher, path string) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Удален файл или директория (вместе со всеми файлами в ней)
+		for _, event := range r.unloadPath(path) {
+			r.notify(event)
+		}
+		return
+	}
+	if err != nil {
+		r.notify(ReloadEvent{Path: path, Err: err})
+		return
+	}
+
+	if info.IsDir() {
+		// Новая директория: отслеживаем ее и загружаем уже созданные в ней файлы
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return watcher.Add(p)
+			}
+			if isSchemaFile(p) {
+				r.reloadFile(p)
+			}
+			return nil
+		})
+		if err != nil {
+			r.notify(ReloadEvent{Path: path, Err: err})
+		}
+		return
+	}
+
+	if isSchemaFile(path) {
+		r.reloadFile(path)
+	}
+}
+
+// reloadFile загружает файл схемы и заменяет в реестре прежнее
+// определение из этого файла; при ошибке реестр не изменяется
+func (r *Registry) reloadFile(path string) {
+	def, err := r.loadFile(path)
+	if err != nil {
+		r.notify(ReloadEvent{Path: path, Err: err})
+		return
+	}
+
+	r.mu.Lock()
+	old, hadOld := r.files[path]
+	if hadOld {
+		r.removeDefinition(old)
+	}
+	r.files[path] = def
+	r.addDefinition(def)
+
+	// Схема со ссылками проверяется вместе с зависимостями; при ошибке
+	// возвращаем прежнее определение файла
+	if len(def.Refs) > 0 {
+		if _, err := r.compileDefinition(def); err != nil {
+			r.removeDefinition(def)
+			delete(r.files, path)
+			if hadOld {
+				r.files[path] = old
+				r.addDefinition(old)
+			}
+			r.mu.Unlock()
+			r.notify(ReloadEvent{Path: path, Err: fmt.Errorf("invalid schema in %s: %w", path, err)})
+			return
+		}
+	}
+	r.mu.Unlock()
+
+	r.notify(ReloadEvent{Path: path, ID: def.ID, Version: def.Version})
+}
+
+// unloadPath выгружает схемы файла path или всех файлов директории path
+func (r *Registry) unloadPath(path string) []ReloadEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []ReloadEvent
+	dirPrefix := path + string(filepath.Separator)
+	for file, def := range r.files {
+		if file != path && !strings.HasPrefix(file, dirPrefix) {
+			continue
+		}
+		delete(r.files, file)
+		r.removeDefinition(def)
+		events = append(events, ReloadEvent{Path: file, ID: def.ID, Version: def.Version, Removed: true})
+	}
+	return events
+}
+
+// notify передает событие обработчику, если он задан
+func (r *Registry) notify(event ReloadEvent) {
+	r.mu.RLock()
+	handler := r.onReload
+	r.mu.RUnlock()
+
+	if handler != nil {
+		handler(event)
+	}
+}
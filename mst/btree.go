@@ -0,0 +1,701 @@
+package mst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// Режим B-дерева.
+//
+// По умолчанию MST - бинарное AVL-дерево: на миллион ключей приходится около
+// 20 уровней, то есть около 20 чтений из blockstore на каждый поиск.
+// С опцией WithFanout(n) при n > 2 каждый узел хранит до n-1 записей и до n
+// детей, что сокращает глубину дерева до log_n(N) и соответственно число
+// чтений блоков. Внешний API (Put, Get, Delete, Range, PutMany, DeleteMany,
+// Diff, Prove) не меняется, пакетные операции так же откладывают запись
+// узлов до конца операции.
+//
+// Узлы B-дерева копируются при записи так же, как узлы AVL-дерева: изменение
+// создаёт новые версии узлов на пути от корня, а неизменённые поддеревья
+// переиспользуются по CID. Поле hash в узлах B-дерева не хранится -
+// целостность обеспечивается адресацией по содержимому. Поэтому VerifyOnRead
+// проверяет упорядоченность записей каждого загружаемого узла, а доказательства
+// (Proof.BPath) содержат узлы пути целиком.
+
+// Option настраивает дерево при создании через NewTree.
+type Option func(*Tree)
+
+// WithFanout задаёт максимальное количество детей узла.
+// Значения меньше 3 оставляют бинарное AVL-дерево (режим по умолчанию).
+// Дерево, созданное с определённым fanout, нужно загружать с тем же значением:
+// форматы узлов бинарного дерева и B-дерева различаются.
+func WithFanout(n int) Option {
+	return func(t *Tree) {
+		t.fanout = n
+	}
+}
+
+// bnode - внутреннее представление узла B-дерева.
+type bnode struct {
+	Entries  []Entry   // Отсортированные по ключу записи узла
+	Children []cid.Cid // Дети: пусто для листа, иначе len(Entries)+1 ссылок
+}
+
+// bnodeCache кэширует узлы B-дерева в рамках одной операции.
+type bnodeCache map[string]*bnode
+
+// btreeMode сообщает, работает ли дерево в режиме B-дерева.
+func (t *Tree) btreeMode() bool {
+	return t.fanout > 2
+}
+
+// maxEntries возвращает максимальное количество записей в узле.
+func (t *Tree) maxEntries() int {
+	return t.fanout - 1
+}
+
+// minEntries возвращает минимальное количество записей в некорневом узле.
+func (t *Tree) minEntries() int {
+	return (t.fanout+1)/2 - 1
+}
+
+// leaf сообщает, является ли узел листом.
+func (n *bnode) leaf() bool {
+	return len(n.Children) == 0
+}
+
+// search возвращает индекс первой записи с ключом >= key и признак точного совпадения.
+func (n *bnode) search(key string) (int, bool) {
+	i := sort.Search(len(n.Entries), func(i int) bool {
+		return n.Entries[i].Key >= key
+	})
+	return i, i < len(n.Entries) && n.Entries[i].Key == key
+}
+
+// cloneBNode делает копию узла с собственными слайсами записей и детей.
+func cloneBNode(n *bnode) *bnode {
+	return &bnode{
+		Entries:  append([]Entry(nil), n.Entries...),
+		Children: append([]cid.Cid(nil), n.Children...),
+	}
+}
+
+// bfind ищет ключ, спускаясь от корня к листу.
+func (t *Tree) bfind(ctx context.Context, cache bnodeCache, root cid.Cid, key string) (cid.Cid, bool, error) {
+	currentCID := root
+	for currentCID.Defined() {
+		current, err := t.loadBNode(ctx, cache, currentCID)
+		if err != nil {
+			return cid.Undef, false, err
+		}
+
+		i, found := current.search(key)
+		if found {
+			return current.Entries[i].Value, true, nil
+		}
+		if current.leaf() {
+			break
+		}
+		currentCID = current.Children[i]
+	}
+
+	return cid.Undef, false, nil
+}
+
+// bput вставляет или обновляет ключ и возвращает новый корневой CID
+// и признак вставки нового ключа. При переполнении корня дерево растёт
+// на один уровень.
+func (t *Tree) bput(ctx context.Context, cache bnodeCache, root cid.Cid, key string, id cid.Cid) (cid.Cid, bool, error) {
+	// Пустое дерево - создаём лист из одной записи
+	if !root.Defined() {
+		c, err := t.storeBNode(ctx, cache, &bnode{Entries: []Entry{{Key: key, Value: id}}})
+		return c, true, err
+	}
+
+	current, err := t.loadBNode(ctx, cache, root)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+
+	left, median, right, inserted, err := t.bputNode(ctx, cache, current, key, id)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+
+	// Корень не разделился
+	if median == nil {
+		c, err := t.storeBNode(ctx, cache, left)
+		return c, inserted, err
+	}
+
+	// Корень разделился - создаём новый корень с медианой
+	leftCID, err := t.storeBNode(ctx, cache, left)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+	rightCID, err := t.storeBNode(ctx, cache, right)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+
+	c, err := t.storeBNode(ctx, cache, &bnode{
+		Entries:  []Entry{*median},
+		Children: []cid.Cid{leftCID, rightCID},
+	})
+	return c, inserted, err
+}
+
+// bputNode вставляет ключ в поддерево узла n.
+// Возвращает изменённую (ещё не сохранённую) копию узла; если узел
+// переполнился, он делится, и возвращаются левая половина, медиана
+// и правая половина.
+func (t *Tree) bputNode(ctx context.Context, cache bnodeCache, n *bnode, key string, id cid.Cid) (*bnode, *Entry, *bnode, bool, error) {
+	cur := cloneBNode(n)
+	i, found := cur.search(key)
+
+	var inserted bool
+	switch {
+	case found:
+		// Ключ уже существует - обновляем значение
+		cur.Entries[i].Value = id
+
+	case cur.leaf():
+		// Вставляем новую запись в лист
+		cur.Entries = slices.Insert(cur.Entries, i, Entry{Key: key, Value: id})
+		inserted = true
+
+	default:
+		// Спускаемся в подходящего ребёнка
+		child, err := t.loadBNode(ctx, cache, cur.Children[i])
+		if err != nil {
+			return nil, nil, nil, false, err
+		}
+
+		left, median, right, ins, err := t.bputNode(ctx, cache, child, key, id)
+		if err != nil {
+			return nil, nil, nil, false, err
+		}
+		inserted = ins
+
+		leftCID, err := t.storeBNode(ctx, cache, left)
+		if err != nil {
+			return nil, nil, nil, false, err
+		}
+		cur.Children[i] = leftCID
+
+		// Ребёнок разделился - поднимаем медиану в текущий узел
+		if median != nil {
+			rightCID, err := t.storeBNode(ctx, cache, right)
+			if err != nil {
+				return nil, nil, nil, false, err
+			}
+			cur.Entries = slices.Insert(cur.Entries, i, *median)
+			cur.Children = slices.Insert(cur.Children, i+1, rightCID)
+		}
+	}
+
+	// Узел не переполнен
+	if len(cur.Entries) <= t.maxEntries() {
+		return cur, nil, nil, inserted, nil
+	}
+
+	// Делим переполненный узел пополам
+	mid := len(cur.Entries) / 2
+	median := cur.Entries[mid]
+	left := &bnode{Entries: append([]Entry(nil), cur.Entries[:mid]...)}
+	right := &bnode{Entries: append([]Entry(nil), cur.Entries[mid+1:]...)}
+	if !cur.leaf() {
+		left.Children = append([]cid.Cid(nil), cur.Children[:mid+1]...)
+		right.Children = append([]cid.Cid(nil), cur.Children[mid+1:]...)
+	}
+
+	return left, &median, right, inserted, nil
+}
+
+// bdelete удаляет ключ и возвращает новый корневой CID и признак удаления.
+// Если корень остался без записей, дерево уменьшается на один уровень.
+func (t *Tree) bdelete(ctx context.Context, cache bnodeCache, root cid.Cid, key string) (cid.Cid, bool, error) {
+	if !root.Defined() {
+		return cid.Undef, false, nil
+	}
+
+	current, err := t.loadBNode(ctx, cache, root)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+
+	updated, removed, err := t.bdeleteNode(ctx, cache, current, key)
+	if err != nil {
+		return cid.Undef, false, err
+	}
+	if !removed {
+		return root, false, nil
+	}
+
+	// Корень опустел
+	if len(updated.Entries) == 0 {
+		if updated.leaf() {
+			return cid.Undef, true, nil
+		}
+		return updated.Children[0], true, nil
+	}
+
+	c, err := t.storeBNode(ctx, cache, updated)
+	return c, true, err
+}
+
+// bdeleteNode удаляет ключ из поддерева узла n и возвращает изменённую
+// (ещё не сохранённую) копию узла. Узел может оказаться недозаполненным -
+// это исправляет родитель в bfixChild.
+func (t *Tree) bdeleteNode(ctx context.Context, cache bnodeCache, n *bnode, key string) (*bnode, bool, error) {
+	i, found := n.search(key)
+
+	// В листе просто удаляем запись
+	if n.leaf() {
+		if !found {
+			return n, false, nil
+		}
+		cur := cloneBNode(n)
+		cur.Entries = slices.Delete(cur.Entries, i, i+1)
+		return cur, true, nil
+	}
+
+	cur := cloneBNode(n)
+	child, err := t.loadBNode(ctx, cache, cur.Children[i])
+	if err != nil {
+		return nil, false, err
+	}
+
+	var updated *bnode
+	if found {
+		// Ключ во внутреннем узле - заменяем его предшественником
+		// (максимальной записью левого поддерева) и удаляем предшественника
+		pred, err := t.bmaxEntry(ctx, cache, cur.Children[i])
+		if err != nil {
+			return nil, false, err
+		}
+		updated, _, err = t.bdeleteNode(ctx, cache, child, pred.Key)
+		if err != nil {
+			return nil, false, err
+		}
+		cur.Entries[i] = pred
+	} else {
+		var removed bool
+		updated, removed, err = t.bdeleteNode(ctx, cache, child, key)
+		if err != nil {
+			return nil, false, err
+		}
+		if !removed {
+			return n, false, nil
+		}
+	}
+
+	if err := t.bfixChild(ctx, cache, cur, i, updated); err != nil {
+		return nil, false, err
+	}
+
+	return cur, true, nil
+}
+
+// bfixChild сохраняет изменённого ребёнка i узла parent, предварительно
+// восстанавливая минимальную заполненность: заимствует запись у соседа
+// или сливает ребёнка с соседом через разделяющую запись родителя.
+func (t *Tree) bfixChild(ctx context.Context, cache bnodeCache, parent *bnode, i int, child *bnode) error {
+	minEntries := t.minEntries()
+
+	// Ребёнок заполнен достаточно - просто сохраняем
+	if len(child.Entries) >= minEntries {
+		c, err := t.storeBNode(ctx, cache, child)
+		if err != nil {
+			return err
+		}
+		parent.Children[i] = c
+		return nil
+	}
+
+	// Заимствуем последнюю запись левого соседа
+	if i > 0 {
+		left, err := t.loadBNode(ctx, cache, parent.Children[i-1])
+		if err != nil {
+			return err
+		}
+		if len(left.Entries) > minEntries {
+			l := cloneBNode(left)
+			last := l.Entries[len(l.Entries)-1]
+			child.Entries = slices.Insert(child.Entries, 0, parent.Entries[i-1])
+			if !l.leaf() {
+				child.Children = slices.Insert(child.Children, 0, l.Children[len(l.Children)-1])
+				l.Children = l.Children[:len(l.Children)-1]
+			}
+			l.Entries = l.Entries[:len(l.Entries)-1]
+			parent.Entries[i-1] = last
+			return t.bstorePair(ctx, cache, parent, i-1, l, child)
+		}
+	}
+
+	// Заимствуем первую запись правого соседа
+	if i < len(parent.Children)-1 {
+		right, err := t.loadBNode(ctx, cache, parent.Children[i+1])
+		if err != nil {
+			return err
+		}
+		if len(right.Entries) > minEntries {
+			r := cloneBNode(right)
+			first := r.Entries[0]
+			child.Entries = append(child.Entries, parent.Entries[i])
+			if !r.leaf() {
+				child.Children = append(child.Children, r.Children[0])
+				r.Children = slices.Delete(r.Children, 0, 1)
+			}
+			r.Entries = slices.Delete(r.Entries, 0, 1)
+			parent.Entries[i] = first
+			return t.bstorePair(ctx, cache, parent, i, child, r)
+		}
+	}
+
+	// Соседи минимальны - сливаем ребёнка с одним из них
+	if i > 0 {
+		left, err := t.loadBNode(ctx, cache, parent.Children[i-1])
+		if err != nil {
+			return err
+		}
+		return t.bmerge(ctx, cache, parent, i-1, left, child)
+	}
+
+	right, err := t.loadBNode(ctx, cache, parent.Children[i+1])
+	if err != nil {
+		return err
+	}
+	return t.bmerge(ctx, cache, parent, i, child, right)
+}
+
+// bstorePair сохраняет двух соседних детей parent с индексами i и i+1.
+func (t *Tree) bstorePair(ctx context.Context, cache bnodeCache, parent *bnode, i int, left, right *bnode) error {
+	leftCID, err := t.storeBNode(ctx, cache, left)
+	if err != nil {
+		return err
+	}
+	rightCID, err := t.storeBNode(ctx, cache, right)
+	if err != nil {
+		return err
+	}
+	parent.Children[i] = leftCID
+	parent.Children[i+1] = rightCID
+	return nil
+}
+
+// bmerge сливает детей i и i+1 узла parent вместе с разделяющей записью i.
+func (t *Tree) bmerge(ctx context.Context, cache bnodeCache, parent *bnode, i int, left, right *bnode) error {
+	merged := &bnode{
+		Entries: slices.Concat(left.Entries, []Entry{parent.Entries[i]}, right.Entries),
+	}
+	if !left.leaf() {
+		merged.Children = slices.Concat(left.Children, right.Children)
+	}
+
+	c, err := t.storeBNode(ctx, cache, merged)
+	if err != nil {
+		return err
+	}
+
+	parent.Children[i] = c
+	parent.Entries = slices.Delete(parent.Entries, i, i+1)
+	parent.Children = slices.Delete(parent.Children, i+1, i+2)
+	return nil
+}
+
+// bmaxEntry возвращает запись с максимальным ключом в поддереве.
+func (t *Tree) bmaxEntry(ctx context.Context, cache bnodeCache, root cid.Cid) (Entry, error) {
+	currentCID := root
+	for {
+		current, err := t.loadBNode(ctx, cache, currentCID)
+		if err != nil {
+			return Entry{}, err
+		}
+		if current.leaf() {
+			if len(current.Entries) == 0 {
+				return Entry{}, errors.New("mst: empty subtree")
+			}
+			return current.Entries[len(current.Entries)-1], nil
+		}
+		currentCID = current.Children[len(current.Children)-1]
+	}
+}
+
+// bcount подсчитывает количество ключей в поддереве обходом.
+func (t *Tree) bcount(ctx context.Context, cache bnodeCache, root cid.Cid) (int, error) {
+	if !root.Defined() {
+		return 0, nil
+	}
+
+	current, err := t.loadBNode(ctx, cache, root)
+	if err != nil {
+		return 0, err
+	}
+
+	total := len(current.Entries)
+	for _, child := range current.Children {
+		n, err := t.bcount(ctx, cache, child)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+// loadBNode загружает узел B-дерева по CID, используя кэш операции.
+func (t *Tree) loadBNode(ctx context.Context, cache bnodeCache, id cid.Cid) (*bnode, error) {
+	if !id.Defined() {
+		return nil, errors.New("mst: undefined cid")
+	}
+
+	if nd, ok := cache[id.String()]; ok {
+		return nd, nil
+	}
+
+	dm, err := t.bs.GetNode(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("mst: load node %s: %w", id, err)
+	}
+
+	nd, err := bnodeFromNode(dm)
+	if err != nil {
+		return nil, err
+	}
+
+	// При включённой проверке сверяем содержимое узла с его CID
+	if t.verifyOnRead {
+		if err := verifyBNode(id, nd); err != nil {
+			return nil, err
+		}
+	}
+
+	cache[id.String()] = nd
+	return nd, nil
+}
+
+// verifyBNode проверяет, что записи узла B-дерева строго отсортированы
+// по ключу. Проверяется только сам узел: дети проверяются так же, когда
+// обход их загружает, а соответствие содержимого блока его CID проверяет
+// blockstore при чтении.
+func verifyBNode(id cid.Cid, n *bnode) error {
+	for i := 1; i < len(n.Entries); i++ {
+		if n.Entries[i-1].Key >= n.Entries[i].Key {
+			return fmt.Errorf("%w: node %s: key %q is out of order", ErrInvalidNode, id, n.Entries[i].Key)
+		}
+	}
+	return nil
+}
+
+// storeBNode сохраняет узел B-дерева в blockstore и кэширует его.
+// Во время пакетной операции узел откладывается в t.stage, как в storeNode.
+func (t *Tree) storeBNode(ctx context.Context, cache bnodeCache, n *bnode) (cid.Cid, error) {
+	dm, err := bnodeToNode(n)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	var c cid.Cid
+	if t.stage != nil {
+		c, err = t.stageNode(dm)
+	} else {
+		c, err = t.bs.PutNode(ctx, dm)
+	}
+	if err != nil {
+		return cid.Undef, fmt.Errorf("mst: store node: %w", err)
+	}
+
+	cache[c.String()] = n
+	return c, nil
+}
+
+// bflushStage записывает отложенные узлы B-дерева, достижимые из root.
+// Аналог flushStage для узлов с несколькими детьми.
+func (t *Tree) bflushStage(ctx context.Context, cache bnodeCache, root cid.Cid) error {
+	return t.flushStaged(ctx, root, func(id cid.Cid) ([]cid.Cid, error) {
+		nd, err := t.loadBNode(ctx, cache, id)
+		if err != nil {
+			return nil, err
+		}
+		return nd.Children, nil
+	})
+}
+
+// bheight возвращает высоту поддерева B-дерева: все листья лежат на одной
+// глубине, поэтому достаточно спуститься по первым детям.
+func (t *Tree) bheight(ctx context.Context, cache bnodeCache, root cid.Cid) (int, error) {
+	height := 0
+	currentCID := root
+	for currentCID.Defined() {
+		current, err := t.loadBNode(ctx, cache, currentCID)
+		if err != nil {
+			return 0, err
+		}
+		height++
+		if current.leaf() {
+			break
+		}
+		currentCID = current.Children[0]
+	}
+	return height, nil
+}
+
+// bnodeToNode преобразует узел B-дерева в datamodel.Node.
+// Формат узла:
+// - entries: список карт {key: строка, value: CID-ссылка}
+// - children: список CID-ссылок (только для внутренних узлов)
+func bnodeToNode(n *bnode) (datamodel.Node, error) {
+	size := int64(1)
+	if !n.leaf() {
+		size++
+	}
+
+	builder := basicnode.Prototype.Map.NewBuilder()
+	ma, err := builder.BeginMap(size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Добавляем записи
+	entry, err := ma.AssembleEntry("entries")
+	if err != nil {
+		return nil, err
+	}
+	la, err := entry.BeginList(int64(len(n.Entries)))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range n.Entries {
+		em, err := la.AssembleValue().BeginMap(2)
+		if err != nil {
+			return nil, err
+		}
+		if err := em.AssembleKey().AssignString("key"); err != nil {
+			return nil, err
+		}
+		if err := em.AssembleValue().AssignString(e.Key); err != nil {
+			return nil, err
+		}
+		if err := em.AssembleKey().AssignString("value"); err != nil {
+			return nil, err
+		}
+		if err := em.AssembleValue().AssignLink(cidlink.Link{Cid: e.Value}); err != nil {
+			return nil, err
+		}
+		if err := em.Finish(); err != nil {
+			return nil, err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return nil, err
+	}
+
+	// Добавляем детей внутреннего узла
+	if !n.leaf() {
+		entry, err := ma.AssembleEntry("children")
+		if err != nil {
+			return nil, err
+		}
+		ca, err := entry.BeginList(int64(len(n.Children)))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range n.Children {
+			if err := ca.AssembleValue().AssignLink(cidlink.Link{Cid: c}); err != nil {
+				return nil, err
+			}
+		}
+		if err := ca.Finish(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+
+	return builder.Build(), nil
+}
+
+// bnodeFromNode преобразует datamodel.Node в узел B-дерева.
+func bnodeFromNode(dm datamodel.Node) (*bnode, error) {
+	entriesNode, err := dm.LookupByString("entries")
+	if err != nil {
+		return nil, fmt.Errorf("mst: node missing entries: %w", err)
+	}
+
+	n := &bnode{}
+	it := entriesNode.ListIterator()
+	if it == nil {
+		return nil, errors.New("mst: entries is not a list")
+	}
+	for !it.Done() {
+		_, en, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		keyNode, err := en.LookupByString("key")
+		if err != nil {
+			return nil, fmt.Errorf("mst: entry missing key: %w", err)
+		}
+		key, err := keyNode.AsString()
+		if err != nil {
+			return nil, fmt.Errorf("mst: invalid key: %w", err)
+		}
+
+		valueNode, err := en.LookupByString("value")
+		if err != nil {
+			return nil, fmt.Errorf("mst: entry missing value: %w", err)
+		}
+		link, err := valueNode.AsLink()
+		if err != nil {
+			return nil, fmt.Errorf("mst: invalid value link: %w", err)
+		}
+		valueLink, ok := link.(cidlink.Link)
+		if !ok {
+			return nil, errors.New("mst: unexpected link type")
+		}
+
+		n.Entries = append(n.Entries, Entry{Key: key, Value: valueLink.Cid})
+	}
+
+	// Дети присутствуют только у внутренних узлов
+	if childrenNode, err := dm.LookupByString("children"); err == nil {
+		it := childrenNode.ListIterator()
+		if it == nil {
+			return nil, errors.New("mst: children is not a list")
+		}
+		for !it.Done() {
+			_, cn, err := it.Next()
+			if err != nil {
+				return nil, err
+			}
+			link, err := cn.AsLink()
+			if err != nil {
+				return nil, fmt.Errorf("mst: invalid child link: %w", err)
+			}
+			lnk, ok := link.(cidlink.Link)
+			if !ok {
+				return nil, errors.New("mst: unexpected link type")
+			}
+			n.Children = append(n.Children, lnk.Cid)
+		}
+
+		if len(n.Children) != len(n.Entries)+1 {
+			return nil, fmt.Errorf("mst: node has %d entries and %d children", len(n.Entries), len(n.Children))
+		}
+	}
+
+	return n, nil
+}
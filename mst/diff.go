@@ -0,0 +1,241 @@
+package mst
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DiffOp описывает вид изменения ключа между двумя версиями дерева.
+type DiffOp int
+
+const (
+	DiffAdded    DiffOp = iota // Ключ появился в новой версии
+	DiffRemoved                // Ключ отсутствует в новой версии
+	DiffModified               // Ключ присутствует в обеих версиях с разными значениями
+)
+
+// String возвращает читаемое имя операции.
+func (op DiffOp) String() string {
+	switch op {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// DiffEntry описывает изменение одного ключа.
+// Для DiffAdded поле Old равно cid.Undef, для DiffRemoved - поле New.
+type DiffEntry struct {
+	Key string  // Изменённый ключ
+	Op  DiffOp  // Вид изменения
+	Old cid.Cid // Значение в старой версии
+	New cid.Cid // Значение в новой версии
+}
+
+// diffItem - элемент очереди обхода при сравнении деревьев:
+// либо ещё не раскрытое поддерево, либо отдельная запись.
+type diffItem struct {
+	subtree cid.Cid // CID нераскрытого поддерева (cid.Undef для записи)
+	entry   Entry   // Запись, если subtree не определён
+}
+
+// Diff вычисляет изменения между двумя версиями дерева, хранящимися в том же
+// blockstore, и возвращает их в порядке возрастания ключей.
+//
+// Оба дерева обходятся параллельно в порядке ключей. Если на вершинах обоих
+// обходов оказываются поддеревья с одинаковым CID, они пропускаются целиком
+// без загрузки: благодаря адресации по содержимому равные CID означают равные
+// поддеревья. Поэтому сравнение почти совпадающих версий затрагивает только
+// изменённые пути.
+//
+// Любой из корней может быть cid.Undef: тогда все ключи другого дерева
+// считаются добавленными или удалёнными. В режиме B-дерева узел раскрывается
+// в последовательность детей и записей, остальной алгоритм тот же.
+func (t *Tree) Diff(ctx context.Context, oldRoot, newRoot cid.Cid) ([]DiffEntry, error) {
+	// Одинаковые корни - изменений нет
+	if oldRoot.Equals(newRoot) {
+		return nil, nil
+	}
+
+	cache := &diffCache{nodes: make(nodeCache), bnodes: make(bnodeCache)}
+
+	// Стеки обхода: вершина стека - наименьший оставшийся элемент
+	var oldStack, newStack []diffItem
+	if oldRoot.Defined() {
+		oldStack = append(oldStack, diffItem{subtree: oldRoot})
+	}
+	if newRoot.Defined() {
+		newStack = append(newStack, diffItem{subtree: newRoot})
+	}
+
+	var out []DiffEntry
+	for len(oldStack) > 0 || len(newStack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Одна из сторон исчерпана - остаток другой целиком добавлен или удалён
+		if len(oldStack) == 0 {
+			var err error
+			if newStack, err = t.diffDrain(ctx, cache, newStack, DiffAdded, &out); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(newStack) == 0 {
+			var err error
+			if oldStack, err = t.diffDrain(ctx, cache, oldStack, DiffRemoved, &out); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		o := oldStack[len(oldStack)-1]
+		n := newStack[len(newStack)-1]
+
+		switch {
+		case o.subtree.Defined() && n.subtree.Defined():
+			// Одинаковые поддеревья пропускаем без загрузки
+			if o.subtree.Equals(n.subtree) {
+				oldStack = oldStack[:len(oldStack)-1]
+				newStack = newStack[:len(newStack)-1]
+				continue
+			}
+
+			// Раскрываем более высокое поддерево, чтобы выровнять уровни;
+			// при равной высоте раскрываем оба
+			oh, err := t.diffHeight(ctx, cache, o.subtree)
+			if err != nil {
+				return nil, err
+			}
+			nh, err := t.diffHeight(ctx, cache, n.subtree)
+			if err != nil {
+				return nil, err
+			}
+			if oh >= nh {
+				if oldStack, err = t.diffExpand(ctx, cache, oldStack); err != nil {
+					return nil, err
+				}
+			}
+			if nh >= oh {
+				if newStack, err = t.diffExpand(ctx, cache, newStack); err != nil {
+					return nil, err
+				}
+			}
+
+		case o.subtree.Defined():
+			// Слева поддерево, справа запись - раскрываем поддерево
+			var err error
+			if oldStack, err = t.diffExpand(ctx, cache, oldStack); err != nil {
+				return nil, err
+			}
+
+		case n.subtree.Defined():
+			var err error
+			if newStack, err = t.diffExpand(ctx, cache, newStack); err != nil {
+				return nil, err
+			}
+
+		default:
+			// Обе вершины - записи: сравниваем ключи
+			switch cmp := strings.Compare(o.entry.Key, n.entry.Key); {
+			case cmp < 0:
+				out = append(out, DiffEntry{Key: o.entry.Key, Op: DiffRemoved, Old: o.entry.Value})
+				oldStack = oldStack[:len(oldStack)-1]
+			case cmp > 0:
+				out = append(out, DiffEntry{Key: n.entry.Key, Op: DiffAdded, New: n.entry.Value})
+				newStack = newStack[:len(newStack)-1]
+			default:
+				if !o.entry.Value.Equals(n.entry.Value) {
+					out = append(out, DiffEntry{Key: o.entry.Key, Op: DiffModified, Old: o.entry.Value, New: n.entry.Value})
+				}
+				oldStack = oldStack[:len(oldStack)-1]
+				newStack = newStack[:len(newStack)-1]
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// diffCache хранит кэши узлов обоих форматов на время одного сравнения.
+type diffCache struct {
+	nodes  nodeCache
+	bnodes bnodeCache
+}
+
+// diffHeight возвращает высоту поддерева в формате текущего режима дерева.
+func (t *Tree) diffHeight(ctx context.Context, cache *diffCache, id cid.Cid) (int, error) {
+	if t.btreeMode() {
+		return t.bheight(ctx, cache.bnodes, id)
+	}
+	return t.childHeight(ctx, cache.nodes, id)
+}
+
+// diffExpand заменяет поддерево на вершине стека его содержимым:
+// левым поддеревом, записью узла и правым поддеревом (в порядке ключей).
+// Узел B-дерева раскрывается в чередующиеся детей и записи.
+func (t *Tree) diffExpand(ctx context.Context, cache *diffCache, stack []diffItem) ([]diffItem, error) {
+	top := stack[len(stack)-1]
+	stack = stack[:len(stack)-1]
+
+	if t.btreeMode() {
+		bn, err := t.loadBNode(ctx, cache.bnodes, top.subtree)
+		if err != nil {
+			return nil, err
+		}
+
+		// Кладём в обратном порядке: последний ребёнок, последняя запись, ...
+		for i := len(bn.Entries); i >= 0; i-- {
+			if !bn.leaf() {
+				stack = append(stack, diffItem{subtree: bn.Children[i]})
+			}
+			if i > 0 {
+				stack = append(stack, diffItem{entry: bn.Entries[i-1]})
+			}
+		}
+		return stack, nil
+	}
+
+	nd, err := t.loadNode(ctx, cache.nodes, top.subtree)
+	if err != nil {
+		return nil, err
+	}
+
+	// Кладём в обратном порядке, чтобы наименьший элемент оказался на вершине
+	if nd.Right.Defined() {
+		stack = append(stack, diffItem{subtree: nd.Right})
+	}
+	stack = append(stack, diffItem{entry: nd.Entry})
+	if nd.Left.Defined() {
+		stack = append(stack, diffItem{subtree: nd.Left})
+	}
+
+	return stack, nil
+}
+
+// diffDrain выдаёт один элемент стека как изменение op, раскрывая поддерево
+// при необходимости. Вызывается, когда вторая сторона сравнения исчерпана.
+func (t *Tree) diffDrain(ctx context.Context, cache *diffCache, stack []diffItem, op DiffOp, out *[]DiffEntry) ([]diffItem, error) {
+	top := stack[len(stack)-1]
+	if top.subtree.Defined() {
+		return t.diffExpand(ctx, cache, stack)
+	}
+
+	d := DiffEntry{Key: top.entry.Key, Op: op}
+	if op == DiffAdded {
+		d.New = top.entry.Value
+	} else {
+		d.Old = top.entry.Value
+	}
+	*out = append(*out, d)
+
+	return stack[:len(stack)-1], nil
+}
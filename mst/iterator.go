@@ -0,0 +1,289 @@
+package mst
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// EntryIterator выполняет ленивый in-order обход MST в заданном диапазоне.
+//
+// Итератор хранит только стек узлов на пути от корня до текущей позиции,
+// поэтому объём памяти ограничен высотой дерева (O(log n) для AVL),
+// а не количеством ключей. Узлы загружаются из blockstore по мере
+// продвижения вызывающего кода.
+//
+// Итератор работает со снимком корня, полученным при создании: последующие
+// изменения дерева не влияют на уже начатый обход, так как узлы иммутабельны.
+// EntryIterator не предназначен для использования из нескольких горутин.
+type EntryIterator struct {
+	t      *Tree           // Дерево, узлы которого загружаются
+	ctx    context.Context // Контекст, проверяемый на каждом шаге
+	start  string          // Нижняя граница диапазона ("" - без ограничения)
+	end    string          // Верхняя граница диапазона ("" - без ограничения)
+	before string          // Исключающая верхняя граница ("" - без ограничения)
+	stack  []*node         // Узлы, ожидающие выдачи (левая граница непройденной части)
+	frames []bframe        // То же для режима B-дерева: узлы и позиции в них
+	err    error           // Первая ошибка, после которой итератор останавливается
+	done   bool            // Признак завершения обхода
+}
+
+// bframe - позиция обхода внутри узла B-дерева.
+type bframe struct {
+	n *bnode // Узел
+	i int    // Индекс следующей записи для выдачи
+}
+
+// RangeIter возвращает итератор по парам ключ-значение в диапазоне [start, end].
+// Семантика границ совпадает с Range: пустая строка означает отсутствие
+// соответствующего ограничения, обе границы включаются.
+func (t *Tree) RangeIter(ctx context.Context, start, end string) (*EntryIterator, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	return t.rangeIterAt(ctx, root, start, end)
+}
+
+// rangeIterAt создаёт итератор по дереву с заданным корнем.
+func (t *Tree) rangeIterAt(ctx context.Context, root cid.Cid, start, end string) (*EntryIterator, error) {
+	it := &EntryIterator{
+		t:     t,
+		ctx:   ctx,
+		start: start,
+		end:   end,
+	}
+
+	// Спускаемся к первому ключу диапазона
+	if err := it.seek(root); err != nil {
+		return nil, err
+	}
+
+	return it, nil
+}
+
+// seek устанавливает итератор на первый ключ диапазона в дереве с корнем root.
+func (it *EntryIterator) seek(root cid.Cid) error {
+	if it.t.btreeMode() {
+		return it.pushLeftB(root)
+	}
+	return it.pushLeft(root)
+}
+
+// Next возвращает следующую запись диапазона.
+// Второе значение равно false, когда записи закончились или произошла ошибка.
+// После ошибки или завершения все последующие вызовы возвращают тот же результат.
+func (it *EntryIterator) Next() (Entry, bool, error) {
+	if it.err != nil {
+		return Entry{}, false, it.err
+	}
+	if it.done {
+		return Entry{}, false, nil
+	}
+
+	// Проверяем отмену контекста перед каждым шагом
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return Entry{}, false, err
+	}
+
+	if it.t.btreeMode() {
+		return it.nextB()
+	}
+
+	// Стек пуст - обход завершён
+	if len(it.stack) == 0 {
+		it.done = true
+		return Entry{}, false, nil
+	}
+
+	// Извлекаем следующий по порядку узел
+	n := it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+
+	// Ключи дальше только возрастают, поэтому выход за end завершает обход
+	if it.pastEnd(n.Key) {
+		it.done = true
+		it.stack = nil
+		return Entry{}, false, nil
+	}
+
+	// Готовим следующую позицию: минимальный ключ правого поддерева
+	if err := it.pushLeft(n.Right); err != nil {
+		it.err = err
+		return Entry{}, false, err
+	}
+
+	return Entry{Key: n.Key, Value: n.Value}, true, nil
+}
+
+// pastEnd сообщает, вышел ли ключ за верхние границы диапазона.
+func (it *EntryIterator) pastEnd(key string) bool {
+	if it.end != "" && strings.Compare(key, it.end) > 0 {
+		return true
+	}
+	return it.before != "" && strings.Compare(key, it.before) >= 0
+}
+
+// pushLeft спускается от id к минимальному ключу, не меньшему start,
+// складывая в стек узлы, которые ещё предстоит выдать.
+// Узлы с ключами меньше start пропускаются вместе с левыми поддеревьями.
+func (it *EntryIterator) pushLeft(id cid.Cid) error {
+	for id.Defined() {
+		if err := it.ctx.Err(); err != nil {
+			return err
+		}
+
+		// Кэш не переиспользуется между шагами, чтобы память оставалась ограниченной
+		n, err := it.t.loadNode(it.ctx, make(nodeCache), id)
+		if err != nil {
+			return err
+		}
+
+		// Весь узел и его левое поддерево меньше start - идём вправо
+		if it.start != "" && strings.Compare(n.Key, it.start) < 0 {
+			id = n.Right
+			continue
+		}
+
+		it.stack = append(it.stack, n)
+		id = n.Left
+	}
+
+	return nil
+}
+
+// nextB выполняет шаг обхода в режиме B-дерева.
+func (it *EntryIterator) nextB() (Entry, bool, error) {
+	for len(it.frames) > 0 {
+		top := &it.frames[len(it.frames)-1]
+
+		// Записи узла исчерпаны - возвращаемся к родителю
+		if top.i >= len(top.n.Entries) {
+			it.frames = it.frames[:len(it.frames)-1]
+			continue
+		}
+
+		e := top.n.Entries[top.i]
+		top.i++
+
+		// Ключи дальше только возрастают, поэтому выход за end завершает обход
+		if it.pastEnd(e.Key) {
+			it.done = true
+			it.frames = nil
+			return Entry{}, false, nil
+		}
+
+		// Перед следующей записью узла нужно обойти поддерево между ними
+		if !top.n.leaf() {
+			if err := it.pushLeftB(top.n.Children[top.i]); err != nil {
+				it.err = err
+				return Entry{}, false, err
+			}
+		}
+
+		return e, true, nil
+	}
+
+	it.done = true
+	return Entry{}, false, nil
+}
+
+// pushLeftB спускается от id к минимальному ключу, не меньшему start,
+// запоминая в каждом узле позицию первой подходящей записи.
+func (it *EntryIterator) pushLeftB(id cid.Cid) error {
+	for id.Defined() {
+		if err := it.ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := it.t.loadBNode(it.ctx, make(bnodeCache), id)
+		if err != nil {
+			return err
+		}
+
+		// Пропускаем записи меньше start вместе с поддеревьями слева от них
+		i := 0
+		if it.start != "" {
+			i, _ = n.search(it.start)
+		}
+
+		it.frames = append(it.frames, bframe{n: n, i: i})
+		if n.leaf() {
+			break
+		}
+		id = n.Children[i]
+	}
+
+	return nil
+}
+
+// RangePrefix возвращает все записи, ключи которых начинаются с prefix.
+// Пустой префикс соответствует всему дереву.
+func (t *Tree) RangePrefix(ctx context.Context, prefix string) ([]Entry, error) {
+	it, err := t.RangePrefixIter(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectEntries(it)
+}
+
+// RangePrefixIter возвращает ленивый итератор по записям с префиксом prefix.
+//
+// Эмуляция через Range(prefix, prefix+"\xff") ненадёжна: ключ может
+// продолжаться байтами больше 0xFF-последовательности или многобайтовыми
+// символами UTF-8. Здесь используется точная исключающая верхняя граница,
+// вычисляемая prefixUpperBound.
+func (t *Tree) RangePrefixIter(ctx context.Context, prefix string) (*EntryIterator, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	it := &EntryIterator{
+		t:      t,
+		ctx:    ctx,
+		start:  prefix,
+		before: prefixUpperBound(prefix),
+	}
+
+	// Спускаемся к первому ключу с префиксом
+	if err := it.seek(root); err != nil {
+		return nil, err
+	}
+
+	return it, nil
+}
+
+// prefixUpperBound возвращает наименьшую строку, которая больше всех строк
+// с префиксом prefix: последний байт, меньший 0xFF, увеличивается на единицу,
+// а следующие за ним байты 0xFF отбрасываются. Если префикс пуст или состоит
+// только из байтов 0xFF, верхней границы нет и возвращается пустая строка.
+func prefixUpperBound(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// collectEntries вычитывает все оставшиеся записи итератора в слайс.
+func collectEntries(it *EntryIterator) ([]Entry, error) {
+	var out []Entry
+	for {
+		e, ok, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return out, nil
+		}
+		out = append(out, e)
+	}
+}
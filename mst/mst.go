@@ -1,6 +1,7 @@
 package mst
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"sync"
 	"ues/blockstore"
 
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
@@ -26,8 +29,45 @@ type Tree struct {
 	bs      blockstore.Blockstore // Интерфейс для работы с блочным хранилищем IPFS
 	rootCID cid.Cid               // CID (Content Identifier) корневого узла дерева
 	mu      sync.RWMutex          // Мьютекс для безопасного многопоточного доступа
+
+	// verifyOnRead включает пересчёт хеша каждого узла, загруженного
+	// из blockstore, и сравнение его с сохранённым значением.
+	verifyOnRead bool
+
+	// fanout - максимальное количество детей узла. Значения больше 2
+	// включают режим B-дерева (см. WithFanout), иначе используется AVL-дерево.
+	fanout int
+
+	// stage накапливает блоки, созданные во время пакетной операции
+	// (PutMany/DeleteMany). Вне пакетной операции равен nil, и узлы
+	// записываются в blockstore сразу.
+	stage map[string]blocks.Block
+}
+
+// Options задаёт необязательные параметры дерева.
+type Options struct {
+	// VerifyOnRead включает проверку целостности узлов при чтении:
+	// хеш каждого загруженного узла пересчитывается по его ключу, значению
+	// и хешам детей и сравнивается с сохранённым полем hash. Это позволяет
+	// обнаружить незаметное повреждение данных в blockstore ценой
+	// дополнительного чтения дочерних узлов.
+	VerifyOnRead bool
+
+	// Fanout задаёт максимальное количество детей узла, как WithFanout.
+	// Значения больше 2 включают режим B-дерева. Поля hash у узлов B-дерева
+	// нет, поэтому в этом режиме VerifyOnRead проверяет упорядоченность
+	// записей каждого загружаемого узла (ErrInvalidNode).
+	Fanout int
 }
 
+// ErrHashMismatch возвращается, если сохранённый хеш узла не совпадает
+// с пересчитанным при включённой проверке VerifyOnRead.
+var ErrHashMismatch = errors.New("mst: node hash mismatch")
+
+// ErrInvalidNode возвращается, если записи узла B-дерева нарушают порядок
+// ключей при включённой проверке VerifyOnRead.
+var ErrInvalidNode = errors.New("mst: invalid node")
+
 // Entry описывает пару ключ-значение, возвращаемую из MST.
 // Это базовая единица данных, хранимая в дереве.
 type Entry struct {
@@ -39,13 +79,21 @@ type Entry struct {
 // Содержит всю информацию, необходимую для работы AVL-дерева:
 // данные узла, ссылки на детей, метаданные для балансировки.
 type node struct {
-	Entry              // Встроенная структура с ключом и значением
-	Left   cid.Cid     // CID левого дочернего узла (ключи меньше текущего)
-	Right  cid.Cid     // CID правого дочернего узла (ключи больше текущего)  
-	Height int         // Высота поддерева с корнем в данном узле (для AVL-балансировки)
-	Hash   []byte      // Криптографический хеш узла для обеспечения целостности
+	Entry               // Встроенная структура с ключом и значением
+	Left    cid.Cid     // CID левого дочернего узла (ключи меньше текущего)
+	Right   cid.Cid     // CID правого дочернего узла (ключи больше текущего)  
+	Height  int         // Высота поддерева с корнем в данном узле (для AVL-балансировки)
+	Hash    []byte      // Криптографический хеш узла для обеспечения целостности
+	Size    int         // Количество ключей в поддереве (0 - узел старого формата без size)
+	Version int         // Версия формата узла (0 - старый формат без манифеста)
 }
 
+// nodeFormatVersion - текущая версия формата узла AVL-дерева.
+// Узлы этой версии содержат манифест поддерева: количество ключей (size)
+// и высоту, что позволяет получать статистику дерева по одному корню.
+// Узлы старого формата (без полей size и version) по-прежнему читаются.
+const nodeFormatVersion = 1
+
 // nodeCache кэширует узлы, считанные из blockstore, в рамках одной операции.
 // Это критично для производительности, так как предотвращает множественные
 // обращения к медленному блочному хранилищу для одних и тех же узлов
@@ -54,12 +102,27 @@ type nodeCache map[string]*node
 
 // NewTree создаёт пустое дерево поверх предоставленного Blockstore.
 // Возвращает указатель на новую структуру Tree с неопределённым корневым CID,
-// что означает пустое дерево.
-func NewTree(bs blockstore.Blockstore) *Tree {
-	return &Tree{
+// что означает пустое дерево. Необязательные opts настраивают дерево,
+// например WithFanout.
+func NewTree(bs blockstore.Blockstore, opts ...Option) *Tree {
+	t := &Tree{
 		bs: bs, // Сохраняем ссылку на блочное хранилище
 		// rootCID остаётся cid.Undef (неопределённым), что означает пустое дерево
 	}
+
+	// Применяем необязательные параметры
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// NewTreeWithOptions создаёт пустое дерево с заданными параметрами.
+func NewTreeWithOptions(bs blockstore.Blockstore, opts Options) *Tree {
+	t := NewTree(bs, WithFanout(opts.Fanout))
+	t.verifyOnRead = opts.VerifyOnRead
+	return t
 }
 
 // Root возвращает CID текущего корня (cid.Undef для пустого дерева).
@@ -87,7 +150,11 @@ func (t *Tree) Load(ctx context.Context, root cid.Cid) error {
 	}
 
 	// Пытаемся загрузить корневой узел для проверки его существования и корректности
-	if _, err := t.loadNode(ctx, make(nodeCache), root); err != nil {
+	if t.btreeMode() {
+		if _, err := t.loadBNode(ctx, make(bnodeCache), root); err != nil {
+			return err
+		}
+	} else if _, err := t.loadNode(ctx, make(nodeCache), root); err != nil {
 		return err
 	}
 
@@ -101,32 +168,54 @@ func (t *Tree) Load(ctx context.Context, root cid.Cid) error {
 // Это основная операция модификации дерева. Из-за иммутабельности узлов в IPLD,
 // любое изменение создаёт новые версии всех узлов на пути от корня до изменяемого узла.
 func (t *Tree) Put(ctx context.Context, key string, id cid.Cid) (cid.Cid, error) {
+	root, _, _, err := t.PutWithPrev(ctx, key, id)
+	return root, err
+}
+
+// PutWithPrev работает как Put, но дополнительно возвращает предыдущее
+// значение ключа и признак того, что ключ уже существовал. Для нового
+// ключа prev равен cid.Undef, а existed - false.
+//
+// Предыдущее значение находится тем же спуском по дереву, что и вставка:
+// узлы пути попадают в кэш операции, поэтому отдельного обращения
+// к blockstore, как при вызове Get перед Put, не требуется.
+func (t *Tree) PutWithPrev(ctx context.Context, key string, id cid.Cid) (root cid.Cid, prev cid.Cid, existed bool, err error) {
 	// Проверяем корректность входных параметров
 	if key == "" {
-		return cid.Undef, errors.New("mst: empty key")
+		return cid.Undef, cid.Undef, false, errors.New("mst: empty key")
 	}
 
 	if !id.Defined() {
-		return cid.Undef, errors.New("mst: undefined value CID")
+		return cid.Undef, cid.Undef, false, errors.New("mst: undefined value CID")
 	}
 
 	// Получаем полную блокировку для модификации
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Создаём новый кэш для этой операции
-	cache := make(nodeCache)
-
-	// Выполняем рекурсивную вставку, начиная с корня
-	newRoot, _, err := t.putNode(ctx, cache, t.rootCID, key, id)
+	// Находим предыдущее значение и выполняем рекурсивную вставку, начиная с корня
+	var newRoot cid.Cid
+	if t.btreeMode() {
+		cache := make(bnodeCache)
+		if prev, existed, err = t.bfind(ctx, cache, t.rootCID, key); err != nil {
+			return cid.Undef, cid.Undef, false, err
+		}
+		newRoot, _, err = t.bput(ctx, cache, t.rootCID, key, id)
+	} else {
+		cache := make(nodeCache)
+		if prev, existed, err = t.find(ctx, cache, t.rootCID, key); err != nil {
+			return cid.Undef, cid.Undef, false, err
+		}
+		newRoot, _, err = t.putNode(ctx, cache, t.rootCID, key, id)
+	}
 	if err != nil {
-		return cid.Undef, err
+		return cid.Undef, cid.Undef, false, err
 	}
 
 	// Обновляем корень дерева на новый
 	t.rootCID = newRoot
 
-	return newRoot, nil
+	return newRoot, prev, existed, nil
 }
 
 // Delete удаляет значение по ключу и возвращает новый корневой CID и признак удаления.
@@ -141,11 +230,15 @@ func (t *Tree) Delete(ctx context.Context, key string) (cid.Cid, bool, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Создаём новый кэш для этой операции
-	cache := make(nodeCache)
-
 	// Выполняем рекурсивное удаление
-	newRoot, removed, err := t.deleteNode(ctx, cache, t.rootCID, key)
+	var newRoot cid.Cid
+	var removed bool
+	var err error
+	if t.btreeMode() {
+		newRoot, removed, err = t.bdelete(ctx, make(bnodeCache), t.rootCID, key)
+	} else {
+		newRoot, removed, err = t.deleteNode(ctx, make(nodeCache), t.rootCID, key)
+	}
 	if err != nil {
 		return cid.Undef, false, err
 	}
@@ -161,6 +254,165 @@ func (t *Tree) Delete(ctx context.Context, key string) (cid.Cid, bool, error) {
 	return newRoot, true, nil
 }
 
+// PutMany вставляет или обновляет набор пар ключ-значение за одну операцию
+// и возвращает итоговый корневой CID.
+//
+// В отличие от последовательных вызовов Put, промежуточные узлы не
+// записываются в blockstore после каждой вставки: все изменения применяются
+// в памяти, а в хранилище одним пакетом попадают только узлы, достижимые
+// из итогового корня. Баланс AVL поддерживается так же, как в Put.
+//
+// Операция транзакционна: при любой ошибке корень дерева не меняется,
+// а накопленные узлы отбрасываются. Если ключ встречается в entries
+// несколько раз, побеждает последнее значение.
+func (t *Tree) PutMany(ctx context.Context, entries []Entry) (cid.Cid, error) {
+	// Проверяем все записи до начала модификации, чтобы не делать лишнюю работу
+	for _, e := range entries {
+		if e.Key == "" {
+			return cid.Undef, errors.New("mst: empty key")
+		}
+		if !e.Value.Defined() {
+			return cid.Undef, fmt.Errorf("mst: undefined value CID for key %q", e.Key)
+		}
+	}
+
+	// Получаем полную блокировку для модификации
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Пустой набор не меняет дерево
+	if len(entries) == 0 {
+		return t.rootCID, nil
+	}
+
+	// Включаем режим отложенной записи на время операции
+	t.stage = make(map[string]blocks.Block)
+	defer func() { t.stage = nil }()
+
+	// В режиме B-дерева узлы так же откладываются в stage
+	if t.btreeMode() {
+		cache := make(bnodeCache)
+		root := t.rootCID
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return cid.Undef, err
+			}
+			newRoot, _, err := t.bput(ctx, cache, root, e.Key, e.Value)
+			if err != nil {
+				return cid.Undef, err
+			}
+			root = newRoot
+		}
+		if err := t.bflushStage(ctx, cache, root); err != nil {
+			return cid.Undef, err
+		}
+		t.rootCID = root
+		return root, nil
+	}
+
+	cache := make(nodeCache)
+
+	// Применяем все вставки к рабочей копии корня
+	root := t.rootCID
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return cid.Undef, err
+		}
+
+		newRoot, _, err := t.putNode(ctx, cache, root, e.Key, e.Value)
+		if err != nil {
+			return cid.Undef, err
+		}
+		root = newRoot
+	}
+
+	// Записываем изменённые узлы одним пакетом
+	if err := t.flushStage(ctx, cache, root); err != nil {
+		return cid.Undef, err
+	}
+
+	// Только после успешной записи публикуем новый корень
+	t.rootCID = root
+
+	return root, nil
+}
+
+// DeleteMany удаляет набор ключей за одну операцию и возвращает итоговый
+// корневой CID. Отсутствующие ключи пропускаются.
+//
+// Как и PutMany, применяет все изменения в памяти и записывает в blockstore
+// только узлы итогового дерева. При ошибке корень дерева не меняется.
+func (t *Tree) DeleteMany(ctx context.Context, keys []string) (cid.Cid, error) {
+	// Проверяем ключи до начала модификации
+	for _, key := range keys {
+		if key == "" {
+			return cid.Undef, errors.New("mst: empty key")
+		}
+	}
+
+	// Получаем полную блокировку для модификации
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Пустой набор не меняет дерево
+	if len(keys) == 0 {
+		return t.rootCID, nil
+	}
+
+	// Включаем режим отложенной записи на время операции
+	t.stage = make(map[string]blocks.Block)
+	defer func() { t.stage = nil }()
+
+	// В режиме B-дерева узлы так же откладываются в stage
+	if t.btreeMode() {
+		cache := make(bnodeCache)
+		root := t.rootCID
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return cid.Undef, err
+			}
+			newRoot, _, err := t.bdelete(ctx, cache, root, key)
+			if err != nil {
+				return cid.Undef, err
+			}
+			root = newRoot
+		}
+		if err := t.bflushStage(ctx, cache, root); err != nil {
+			return cid.Undef, err
+		}
+		t.rootCID = root
+		return root, nil
+	}
+
+	cache := make(nodeCache)
+
+	// Применяем все удаления к рабочей копии корня
+	root := t.rootCID
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return cid.Undef, err
+		}
+
+		newRoot, removed, err := t.deleteNode(ctx, cache, root, key)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if removed {
+			root = newRoot
+		}
+	}
+
+	// Записываем изменённые узлы одним пакетом
+	if err := t.flushStage(ctx, cache, root); err != nil {
+		return cid.Undef, err
+	}
+
+	// Только после успешной записи публикуем новый корень
+	t.rootCID = root
+
+	return root, nil
+}
+
 // Get возвращает значение по ключу, признак наличия ключа и ошибку.
 // Это операция только для чтения, поэтому используется только блокировка чтения.
 // Поиск выполняется итеративно для оптимизации стека вызовов.
@@ -170,34 +422,109 @@ func (t *Tree) Get(ctx context.Context, key string) (cid.Cid, bool, error) {
 	root := t.rootCID
 	t.mu.RUnlock()
 
-	// Создаём кэш для этой операции поиска
-	cache := make(nodeCache)
-
 	// Выполняем поиск
-	return t.find(ctx, cache, root, key)
+	return t.getAt(ctx, root, key)
 }
 
-// Range возвращает все пары ключ-значение в диапазоне [start, end].
-// Выполняет обход дерева в порядке сортировки ключей (in-order traversal).
-// Если start или end пустые, то соответствующая граница не учитывается.
-func (t *Tree) Range(ctx context.Context, start, end string) ([]Entry, error) {
+// getAt ищет ключ в дереве с заданным корнем.
+func (t *Tree) getAt(ctx context.Context, root cid.Cid, key string) (cid.Cid, bool, error) {
+	if t.btreeMode() {
+		return t.bfind(ctx, make(bnodeCache), root, key)
+	}
+	return t.find(ctx, make(nodeCache), root, key)
+}
+
+// Count возвращает количество ключей в дереве.
+// Каждый узел хранит размер своего поддерева, поэтому для деревьев,
+// созданных текущей версией, операция выполняется за O(1) по корню.
+// Для узлов старого формата без поля size и в режиме B-дерева
+// размер вычисляется обходом.
+func (t *Tree) Count(ctx context.Context) (int, error) {
 	// Получаем снимок текущего корня под блокировкой чтения
 	t.mu.RLock()
 	root := t.rootCID
 	t.mu.RUnlock()
 
-	// Создаём кэш для этой операции
-	cache := make(nodeCache)
+	if t.btreeMode() {
+		return t.bcount(ctx, make(bnodeCache), root)
+	}
+	return t.subtreeSize(ctx, make(nodeCache), root)
+}
 
-	// Создаём слайс для сбора результатов
-	var out []Entry
-	if err := t.collectRange(ctx, cache, root, start, end, &out); err != nil {
-		return nil, err
+// ReachableCIDs возвращает множество CID всех узлов, достижимых из текущего
+// корня. После серии Put/Delete в blockstore остаются узлы прежних версий
+// дерева; сравнив это множество с AllKeysChan, вызывающий код может удалить
+// недостижимые блоки. Значения (CID записей) в множество не входят -
+// только узлы самого дерева. Общие поддеревья посещаются один раз.
+func (t *Tree) ReachableCIDs(ctx context.Context) (map[cid.Cid]struct{}, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	out := make(map[cid.Cid]struct{})
+	if !root.Defined() {
+		return out, nil
+	}
+
+	// Обходим дерево в глубину без рекурсии
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Пропускаем уже посещённые узлы
+		if _, seen := out[id]; seen {
+			continue
+		}
+		out[id] = struct{}{}
+
+		// Загружаем узел и добавляем его детей; кэш не нужен,
+		// так как каждый узел загружается не более одного раза
+		if t.btreeMode() {
+			n, err := t.loadBNode(ctx, make(bnodeCache), id)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, n.Children...)
+			continue
+		}
+
+		n, err := t.loadNode(ctx, make(nodeCache), id)
+		if err != nil {
+			return nil, err
+		}
+		if n.Left.Defined() {
+			stack = append(stack, n.Left)
+		}
+		if n.Right.Defined() {
+			stack = append(stack, n.Right)
+		}
 	}
 
 	return out, nil
 }
 
+// Range возвращает все пары ключ-значение в диапазоне [start, end].
+// Выполняет обход дерева в порядке сортировки ключей (in-order traversal).
+// Если start или end пустые, то соответствующая граница не учитывается.
+// Для больших деревьев предпочтительнее RangeIter, который не материализует
+// весь результат в памяти.
+func (t *Tree) Range(ctx context.Context, start, end string) ([]Entry, error) {
+	// Создаём итератор по снимку текущего корня
+	it, err := t.RangeIter(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Собираем все записи в слайс
+	return collectEntries(it)
+}
+
 // BuildSelector строит селектор для обхода всего дерева.
 // Селектор используется IPLD для определения того, какие части данных
 // нужно обойти при операциях синхронизации или репликации.
@@ -413,43 +740,6 @@ func (t *Tree) find(ctx context.Context, cache nodeCache, root cid.Cid, key stri
 	return cid.Undef, false, nil
 }
 
-// collectRange собирает все пары ключ-значение в диапазоне [start, end] в поддереве с корнем root.
-// Использует in-order traversal для получения ключей в отсортированном порядке.
-// Пустые границы start или end означают отсутствие соответствующего ограничения.
-func (t *Tree) collectRange(ctx context.Context, cache nodeCache, root cid.Cid, start, end string, out *[]Entry) error {
-	// Базовый случай: пустое поддерево
-	if !root.Defined() {
-		return nil
-	}
-
-	// Загружаем текущий узел
-	current, err := t.loadNode(ctx, cache, root)
-	if err != nil {
-		return err
-	}
-
-	// Рекурсивно обходим левое поддерево, если текущий ключ больше start
-	if start == "" || strings.Compare(start, current.Key) <= 0 {
-		if err := t.collectRange(ctx, cache, current.Left, start, end, out); err != nil {
-			return err
-		}
-	}
-
-	// Добавляем текущий узел, если он попадает в диапазон
-	if (start == "" || strings.Compare(start, current.Key) <= 0) && (end == "" || strings.Compare(current.Key, end) <= 0) {
-		*out = append(*out, Entry{Key: current.Key, Value: current.Value})
-	}
-
-	// Рекурсивно обходим правое поддерево, если текущий ключ меньше end
-	if end == "" || strings.Compare(current.Key, end) < 0 {
-		if err := t.collectRange(ctx, cache, current.Right, start, end, out); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 // balanceNode балансирует узел и возвращает новый сбалансированный узел и его CID.
 // Это ключевая функция для поддержания свойств AVL-дерева.
 // Выполняет необходимые ротации, если баланс-фактор нарушен.
@@ -725,15 +1015,16 @@ func (t *Tree) loadNode(ctx context.Context, cache nodeCache, id cid.Cid) (*node
 	}
 
 	// Если в кэше нет, загружаем из blockstore
-	dm, err := t.bs.GetNode(ctx, id)
+	nd, err := t.fetchNode(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("mst: load node %s: %w", id, err)
+		return nil, err
 	}
 
-	// Преобразуем из IPLD datamodel в наш внутренний формат
-	nd, err := t.nodeFromNode(dm)
-	if err != nil {
-		return nil, err
+	// При включённой проверке сверяем сохранённый хеш с пересчитанным
+	if t.verifyOnRead {
+		if err := t.verifyNode(ctx, id, nd); err != nil {
+			return nil, err
+		}
 	}
 
 	// Кэшируем загруженный узел для последующего использования
@@ -742,6 +1033,48 @@ func (t *Tree) loadNode(ctx context.Context, cache nodeCache, id cid.Cid) (*node
 	return nd, nil
 }
 
+// fetchNode читает и декодирует узел из blockstore без кэширования и проверок.
+func (t *Tree) fetchNode(ctx context.Context, id cid.Cid) (*node, error) {
+	dm, err := t.bs.GetNode(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("mst: load node %s: %w", id, err)
+	}
+
+	// Преобразуем из IPLD datamodel в наш внутренний формат
+	return t.nodeFromNode(dm)
+}
+
+// verifyNode пересчитывает хеш узла по его ключу, значению и хешам детей
+// и сравнивает с сохранённым. Дети читаются через fetchNode и не попадают
+// в кэш, поэтому сами будут проверены, когда обход до них дойдёт,
+// а проверка одного узла не приводит к загрузке всего поддерева.
+func (t *Tree) verifyNode(ctx context.Context, id cid.Cid, nd *node) error {
+	var leftHash, rightHash []byte
+
+	if nd.Left.Defined() {
+		left, err := t.fetchNode(ctx, nd.Left)
+		if err != nil {
+			return fmt.Errorf("mst: verify node %s: left child: %w", id, err)
+		}
+		leftHash = left.Hash
+	}
+
+	if nd.Right.Defined() {
+		right, err := t.fetchNode(ctx, nd.Right)
+		if err != nil {
+			return fmt.Errorf("mst: verify node %s: right child: %w", id, err)
+		}
+		rightHash = right.Hash
+	}
+
+	computed := nodeHash(nd.Key, nd.Value, leftHash, rightHash)
+	if !bytes.Equal(computed, nd.Hash) {
+		return fmt.Errorf("%w: node %s (key %q): stored %x, computed %x", ErrHashMismatch, id, nd.Key, nd.Hash, computed)
+	}
+
+	return nil
+}
+
 // storeNode сохраняет узел в blockstore и возвращает его CID и клонированный узел.
 // Перед сохранением обновляет метаданные узла (высоту и хеш).
 // Из-за иммутабельности IPLD, каждое сохранение создаёт новый блок.
@@ -757,8 +1090,13 @@ func (t *Tree) storeNode(ctx context.Context, cache nodeCache, n *node) (cid.Cid
 		return cid.Undef, nil, err
 	}
 
-	// Сохраняем в blockstore
-	c, err := t.bs.PutNode(ctx, dm)
+	// Сохраняем в blockstore, либо откладываем запись до конца пакетной операции
+	var c cid.Cid
+	if t.stage != nil {
+		c, err = t.stageNode(dm)
+	} else {
+		c, err = t.bs.PutNode(ctx, dm)
+	}
 	if err != nil {
 		return cid.Undef, nil, fmt.Errorf("mst: store node: %w", err)
 	}
@@ -772,6 +1110,99 @@ func (t *Tree) storeNode(ctx context.Context, cache nodeCache, n *node) (cid.Cid
 	return c, stored, nil
 }
 
+// stageNode кодирует узел и вычисляет его CID без записи в blockstore.
+// Блок сохраняется в t.stage и будет записан в flushStage, если окажется
+// достижим из итогового корня. CID совпадает с тем, что вернул бы PutNode,
+// так как используется тот же прототип ссылки (DAG-CBOR + BLAKE3).
+func (t *Tree) stageNode(dm datamodel.Node) (cid.Cid, error) {
+	data, c, err := encodeNode(dm)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	t.stage[c.String()] = blk
+
+	return c, nil
+}
+
+// encodeNode кодирует узел в DAG-CBOR и вычисляет его CID по тому же
+// префиксу, что использует blockstore (ComputeCID), не обращаясь к хранилищу.
+func encodeNode(dm datamodel.Node) ([]byte, cid.Cid, error) {
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(dm, &buf); err != nil {
+		return nil, cid.Undef, err
+	}
+
+	c, err := blockstore.ComputeCID(buf.Bytes(), cid.DagCBOR)
+	if err != nil {
+		return nil, cid.Undef, err
+	}
+
+	return buf.Bytes(), c, nil
+}
+
+// flushStage записывает в blockstore отложенные блоки, достижимые из root.
+// Промежуточные версии узлов, которые были перезаписаны в ходе пакетной
+// операции, недостижимы из итогового корня и в хранилище не попадают.
+// Обход останавливается на узлах, которых нет в t.stage, - они уже сохранены.
+func (t *Tree) flushStage(ctx context.Context, cache nodeCache, root cid.Cid) error {
+	return t.flushStaged(ctx, root, func(id cid.Cid) ([]cid.Cid, error) {
+		nd, err := t.loadNode(ctx, cache, id)
+		if err != nil {
+			return nil, err
+		}
+		return []cid.Cid{nd.Left, nd.Right}, nil
+	})
+}
+
+// flushStaged обходит новые узлы итогового дерева от root, получая ссылки
+// на детей через children, и записывает найденные отложенные блоки одним
+// пакетом. Общая часть flushStage и bflushStage.
+func (t *Tree) flushStaged(ctx context.Context, root cid.Cid, children func(cid.Cid) ([]cid.Cid, error)) error {
+	var pending []blocks.Block
+
+	// Обходим только новые узлы итогового дерева
+	stack := []cid.Cid{root}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !id.Defined() {
+			continue
+		}
+
+		blk, ok := t.stage[id.String()]
+		if !ok {
+			continue
+		}
+		// Удаляем из stage, чтобы не записать блок дважды при повторной встрече
+		delete(t.stage, id.String())
+		pending = append(pending, blk)
+
+		next, err := children(id)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, next...)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Записываем все блоки одним пакетом
+	if err := t.bs.PutMany(ctx, pending); err != nil {
+		return fmt.Errorf("mst: flush staged nodes: %w", err)
+	}
+
+	return nil
+}
+
 // updateNodeMetadata обновляет высоту и хеш узла на основе его детей.
 // Высота узла = 1 + максимум высот детей (для AVL-балансировки).
 // Хеш вычисляется от ключа, значения и хешей детей (для целостности Merkle-дерева).
@@ -790,23 +1221,42 @@ func (t *Tree) updateNodeMetadata(ctx context.Context, cache nodeCache, n *node)
 	// Обновляем высоту: 1 + максимум высот детей
 	n.Height = 1 + max(leftHeight, rightHeight)
 
-	// Вычисляем криптографический хеш узла с использованием BLAKE3
-	h := blake3.New(32, nil)
-	h.Write([]byte(n.Key))          // Включаем ключ
-	h.Write(n.Value.Bytes())        // Включаем байты CID значения
-	if len(leftHash) > 0 {
-		h.Write(leftHash)           // Включаем хеш левого ребёнка, если он есть
+	// Обновляем размер поддерева: сам узел + размеры детей
+	leftSize, err := t.subtreeSize(ctx, cache, n.Left)
+	if err != nil {
+		return err
 	}
-	if len(rightHash) > 0 {
-		h.Write(rightHash)          // Включаем хеш правого ребёнка, если он есть
+	rightSize, err := t.subtreeSize(ctx, cache, n.Right)
+	if err != nil {
+		return err
 	}
+	n.Size = 1 + leftSize + rightSize
+
+	// Перезаписанный узел всегда сохраняется в текущем формате
+	n.Version = nodeFormatVersion
 
-	// Сохраняем финальный хеш
-	n.Hash = h.Sum(nil)
+	// Вычисляем и сохраняем криптографический хеш узла
+	n.Hash = nodeHash(n.Key, n.Value, leftHash, rightHash)
 
 	return nil
 }
 
+// nodeHash вычисляет хеш узла с использованием BLAKE3 от ключа, значения
+// и хешей детей. Вынесена отдельно, чтобы проверка доказательств
+// пересчитывала хеши тем же способом, что и построение дерева.
+func nodeHash(key string, value cid.Cid, leftHash, rightHash []byte) []byte {
+	h := blake3.New(32, nil)
+	h.Write([]byte(key))   // Включаем ключ
+	h.Write(value.Bytes()) // Включаем байты CID значения
+	if len(leftHash) > 0 {
+		h.Write(leftHash) // Включаем хеш левого ребёнка, если он есть
+	}
+	if len(rightHash) > 0 {
+		h.Write(rightHash) // Включаем хеш правого ребёнка, если он есть
+	}
+	return h.Sum(nil)
+}
+
 // childHeightAndHash возвращает высоту и хеш дочернего узла по его CID.
 // For несуществующих детей возвращает (0, nil, nil).
 func (t *Tree) childHeightAndHash(ctx context.Context, cache nodeCache, id cid.Cid) (int, []byte, error) {
@@ -825,6 +1275,38 @@ func (t *Tree) childHeightAndHash(ctx context.Context, cache nodeCache, id cid.C
 	return nd.Height, nd.Hash, nil
 }
 
+// subtreeSize возвращает количество ключей в поддереве с корнем id.
+// Использует сохранённое поле Size, а для узлов старого формата
+// (Size == 0) подсчитывает ключи рекурсивным обходом.
+func (t *Tree) subtreeSize(ctx context.Context, cache nodeCache, id cid.Cid) (int, error) {
+	// Пустое поддерево не содержит ключей
+	if !id.Defined() {
+		return 0, nil
+	}
+
+	nd, err := t.loadNode(ctx, cache, id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Размер уже известен
+	if nd.Size > 0 {
+		return nd.Size, nil
+	}
+
+	// Узел старого формата - считаем детей
+	leftSize, err := t.subtreeSize(ctx, cache, nd.Left)
+	if err != nil {
+		return 0, err
+	}
+	rightSize, err := t.subtreeSize(ctx, cache, nd.Right)
+	if err != nil {
+		return 0, err
+	}
+
+	return 1 + leftSize + rightSize, nil
+}
+
 // nodeToNode преобразует внутреннее представление узла в datamodel.Node.
 // Создаёт структуру данных, совместимую с IPLD, для сохранения в blockstore.
 // Поля сериализуются в следующем формате:
@@ -832,11 +1314,19 @@ func (t *Tree) childHeightAndHash(ctx context.Context, cache nodeCache, id cid.C
 // - value: CID-ссылка на данные
 // - height: целое число (для AVL-балансировки)
 // - hash: байтовый массив (для целостности)
+// - size: количество ключей в поддереве (опционально, с версии 1)
+// - version: версия формата узла (опционально, с версии 1)
 // - left: CID-ссылка на левого ребёнка (опционально)
 // - right: CID-ссылка на правого ребёнка (опционально)
 func (t *Tree) nodeToNode(n *node) (datamodel.Node, error) {
 	// Вычисляем размер карты (обязательные поля + опциональные дети)
 	size := int64(4) // key, value, height, hash - всегда присутствуют
+	if n.Size > 0 {
+		size++
+	}
+	if n.Version > 0 {
+		size++
+	}
 	if n.Left.Defined() {
 		size++
 	}
@@ -887,6 +1377,29 @@ func (t *Tree) nodeToNode(n *node) (datamodel.Node, error) {
 		return nil, err
 	}
 
+	// Добавляем размер поддерева; узлы старого формата сериализуются без него,
+	// чтобы повторное кодирование давало тот же CID
+	if n.Size > 0 {
+		entry, err := ma.AssembleEntry("size")
+		if err != nil {
+			return nil, err
+		}
+		if err := entry.AssignInt(int64(n.Size)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Добавляем версию формата
+	if n.Version > 0 {
+		entry, err := ma.AssembleEntry("version")
+		if err != nil {
+			return nil, err
+		}
+		if err := entry.AssignInt(int64(n.Version)); err != nil {
+			return nil, err
+		}
+	}
+
 	// Добавляем левого ребёнка, если он есть
 	if n.Left.Defined() {
 		entry, err := ma.AssembleEntry("left")
@@ -965,6 +1478,24 @@ func (t *Tree) nodeFromNode(dm datamodel.Node) (*node, error) {
 		return nil, fmt.Errorf("mst: invalid hash: %w", err)
 	}
 
+	// Извлекаем размер поддерева (отсутствует в узлах старого формата)
+	var sizeVal int64
+	if sizeNode, err := dm.LookupByString("size"); err == nil {
+		sizeVal, err = sizeNode.AsInt()
+		if err != nil {
+			return nil, fmt.Errorf("mst: invalid size: %w", err)
+		}
+	}
+
+	// Извлекаем версию формата (отсутствует в узлах старого формата)
+	var versionVal int64
+	if versionNode, err := dm.LookupByString("version"); err == nil {
+		versionVal, err = versionNode.AsInt()
+		if err != nil {
+			return nil, fmt.Errorf("mst: invalid version: %w", err)
+		}
+	}
+
 	// Извлекаем CID левого ребёнка (опциональное поле)
 	leftCID := cid.Undef
 	if leftNode, err := dm.LookupByString("left"); err == nil {
@@ -993,10 +1524,12 @@ func (t *Tree) nodeFromNode(dm datamodel.Node) (*node, error) {
 			Key:   key,
 			Value: valueLink.Cid,
 		},
-		Left:   leftCID,
-		Right:  rightCID,
-		Height: int(heightVal),
-		Hash:   append([]byte(nil), hashBytes...), // Создаём копию слайса
+		Left:    leftCID,
+		Right:   rightCID,
+		Height:  int(heightVal),
+		Hash:    append([]byte(nil), hashBytes...), // Создаём копию слайса
+		Size:    int(sizeVal),
+		Version: int(versionVal),
 	}, nil
 }
 
@@ -1017,11 +1550,13 @@ func cloneNode(n *node) *node {
 
 	// Создаём новый узел с теми же данными
 	return &node{
-		Entry:  n.Entry,  // Entry содержит простые типы, поэтому копируется по значению
-		Left:   n.Left,   // CID - неизменяемый тип
-		Right:  n.Right,  // CID - неизменяемый тип
-		Height: n.Height, // Простое значение
-		Hash:   hashCopy, // Копия слайса байт
+		Entry:   n.Entry,   // Entry содержит простые типы, поэтому копируется по значению
+		Left:    n.Left,    // CID - неизменяемый тип
+		Right:   n.Right,   // CID - неизменяемый тип
+		Height:  n.Height,  // Простое значение
+		Hash:    hashCopy,  // Копия слайса байт
+		Size:    n.Size,    // Простое значение
+		Version: n.Version, // Простое значение
 	}
 }
 
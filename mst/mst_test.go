@@ -0,0 +1,1270 @@
+package mst
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"ues/blockstore"
+	s "ues/datastore"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ========================================
+// ТЕСТЫ ПАКЕТНЫХ ОПЕРАЦИЙ
+// ========================================
+
+// TestPutMany проверяет, что пакетная вставка строит то же дерево,
+// что и последовательность одиночных Put.
+func TestPutMany(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("совпадает с последовательным Put", func(t *testing.T) {
+		entries := makeEntries(t, 200)
+
+		single := createTestTree(t)
+		var singleRoot cid.Cid
+		for _, e := range entries {
+			root, err := single.Put(ctx, e.Key, e.Value)
+			require.NoError(t, err)
+			singleRoot = root
+		}
+
+		batch := createTestTree(t)
+		batchRoot, err := batch.PutMany(ctx, entries)
+		require.NoError(t, err)
+
+		// AVL-дерево детерминировано для одинакового порядка вставки
+		assert.Equal(t, singleRoot, batchRoot)
+		assert.Equal(t, batchRoot, batch.Root())
+
+		// Дерево должно читаться после повторной загрузки из blockstore
+		reloaded := NewTree(batch.bs)
+		require.NoError(t, reloaded.Load(ctx, batchRoot))
+		got, err := reloaded.Range(ctx, "", "")
+		require.NoError(t, err)
+		assert.Len(t, got, len(entries))
+	})
+
+	t.Run("пустой набор не меняет корень", func(t *testing.T) {
+		tree := createTestTree(t)
+		root, err := tree.PutMany(ctx, makeEntries(t, 3))
+		require.NoError(t, err)
+
+		same, err := tree.PutMany(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, root, same)
+	})
+
+	t.Run("ошибка оставляет корень без изменений", func(t *testing.T) {
+		tree := createTestTree(t)
+		root, err := tree.PutMany(ctx, makeEntries(t, 10))
+		require.NoError(t, err)
+
+		bad := append(makeEntries(t, 5), Entry{Key: "", Value: testCID(t, "x")})
+		_, err = tree.PutMany(ctx, bad)
+		require.Error(t, err)
+		assert.Equal(t, root, tree.Root())
+
+		// Отменённый контекст прерывает операцию до публикации корня
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = tree.PutMany(cctx, makeEntries(t, 20))
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, root, tree.Root())
+	})
+}
+
+// TestDeleteMany проверяет пакетное удаление ключей.
+func TestDeleteMany(t *testing.T) {
+	ctx := context.Background()
+	entries := makeEntries(t, 100)
+
+	tree := createTestTree(t)
+	_, err := tree.PutMany(ctx, entries)
+	require.NoError(t, err)
+
+	// Удаляем каждый второй ключ и один отсутствующий
+	var keys []string
+	for i := 0; i < len(entries); i += 2 {
+		keys = append(keys, entries[i].Key)
+	}
+	keys = append(keys, "missing")
+
+	root, err := tree.DeleteMany(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, root, tree.Root())
+
+	got, err := tree.Range(ctx, "", "")
+	require.NoError(t, err)
+	assert.Len(t, got, len(entries)/2)
+
+	for i, e := range entries {
+		_, found, err := tree.Get(ctx, e.Key)
+		require.NoError(t, err)
+		assert.Equal(t, i%2 == 1, found, "ключ %s", e.Key)
+	}
+
+	// Пустой ключ отклоняется без изменения дерева
+	_, err = tree.DeleteMany(ctx, []string{entries[1].Key, ""})
+	require.Error(t, err)
+	assert.Equal(t, root, tree.Root())
+}
+
+// TestPutWithPrev проверяет возврат предыдущего значения при вставке.
+func TestPutWithPrev(t *testing.T) {
+	ctx := context.Background()
+
+	for _, fanout := range []int{2, 4} {
+		t.Run(fmt.Sprintf("fanout=%d", fanout), func(t *testing.T) {
+			tree := NewTree(createTestTree(t).bs, WithFanout(fanout))
+			_, err := tree.PutMany(ctx, makeEntries(t, 20))
+			require.NoError(t, err)
+
+			// Новый ключ
+			root, prev, existed, err := tree.PutWithPrev(ctx, "key-new", testCID(t, "v1"))
+			require.NoError(t, err)
+			assert.False(t, existed)
+			assert.Equal(t, cid.Undef, prev)
+			assert.Equal(t, tree.Root(), root)
+
+			// Перезапись возвращает прежнее значение
+			_, prev, existed, err = tree.PutWithPrev(ctx, "key-new", testCID(t, "v2"))
+			require.NoError(t, err)
+			assert.True(t, existed)
+			assert.Equal(t, testCID(t, "v1"), prev)
+
+			_, prev, existed, err = tree.PutWithPrev(ctx, "key-000005", testCID(t, "v3"))
+			require.NoError(t, err)
+			assert.True(t, existed)
+			assert.Equal(t, testCID(t, "key-000005"), prev)
+
+			value, found, err := tree.Get(ctx, "key-000005")
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, testCID(t, "v3"), value)
+		})
+	}
+}
+
+// TestNavigation проверяет FirstKey, LastKey, Ceiling и Floor.
+func TestNavigation(t *testing.T) {
+	ctx := context.Background()
+
+	for _, fanout := range []int{2, 4} {
+		t.Run(fmt.Sprintf("fanout=%d", fanout), func(t *testing.T) {
+			tree := NewTree(createTestTree(t).bs, WithFanout(fanout))
+
+			// Пустое дерево
+			_, found, err := tree.FirstKey(ctx)
+			require.NoError(t, err)
+			assert.False(t, found)
+			_, found, err = tree.LastKey(ctx)
+			require.NoError(t, err)
+			assert.False(t, found)
+			_, found, err = tree.Ceiling(ctx, "a")
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			// Ключи key-000000 ... key-000098 с шагом 2
+			var entries []Entry
+			for i := 0; i < 100; i += 2 {
+				key := fmt.Sprintf("key-%06d", i)
+				entries = append(entries, Entry{Key: key, Value: testCID(t, key)})
+			}
+			_, err = tree.PutMany(ctx, entries)
+			require.NoError(t, err)
+
+			first, found, err := tree.FirstKey(ctx)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, entries[0], first)
+
+			last, found, err := tree.LastKey(ctx)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, entries[len(entries)-1], last)
+
+			cases := []struct {
+				key     string
+				ceiling string // "" - не найден
+				floor   string
+			}{
+				{"key-000010", "key-000010", "key-000010"}, // точное совпадение
+				{"key-000011", "key-000012", "key-000010"}, // между записями
+				{"key-000010a", "key-000012", "key-000010"},
+				{"a", "key-000000", ""}, // ниже всего диапазона
+				{"z", "", "key-000098"}, // выше всего диапазона
+				{"key-000098", "key-000098", "key-000098"},
+			}
+
+			for _, tc := range cases {
+				e, found, err := tree.Ceiling(ctx, tc.key)
+				require.NoError(t, err)
+				assert.Equal(t, tc.ceiling != "", found, "ceiling %s", tc.key)
+				assert.Equal(t, tc.ceiling, e.Key, "ceiling %s", tc.key)
+
+				e, found, err = tree.Floor(ctx, tc.key)
+				require.NoError(t, err)
+				assert.Equal(t, tc.floor != "", found, "floor %s", tc.key)
+				assert.Equal(t, tc.floor, e.Key, "floor %s", tc.key)
+			}
+		})
+	}
+}
+
+// TestRangePrefix проверяет выборку по префиксу, включая префиксы
+// с общим началом и граничные байты 0xFF.
+func TestRangePrefix(t *testing.T) {
+	ctx := context.Background()
+
+	keys := []string{
+		"pos", "post", "post/1", "post/2", "postal", "posts", "posts/1", "posu",
+		"\xff", "\xff\xff", "\xff\xffa", "a\xff", "a\xff\x00", "b",
+	}
+
+	for _, fanout := range []int{2, 4} {
+		t.Run(fmt.Sprintf("fanout=%d", fanout), func(t *testing.T) {
+			tree := NewTree(createTestTree(t).bs, WithFanout(fanout))
+			var entries []Entry
+			for _, key := range keys {
+				entries = append(entries, Entry{Key: key, Value: testCID(t, key)})
+			}
+			_, err := tree.PutMany(ctx, entries)
+			require.NoError(t, err)
+
+			cases := map[string][]string{
+				"post":     {"post", "post/1", "post/2", "postal", "posts", "posts/1"},
+				"posts":    {"posts", "posts/1"},
+				"post/":    {"post/1", "post/2"},
+				"posu":     {"posu"},
+				"q":        nil,
+				"\xff":     {"\xff", "\xff\xff", "\xff\xffa"},
+				"\xff\xff": {"\xff\xff", "\xff\xffa"},
+				"a\xff":    {"a\xff", "a\xff\x00"},
+			}
+
+			for prefix, expected := range cases {
+				got, err := tree.RangePrefix(ctx, prefix)
+				require.NoError(t, err)
+
+				var gotKeys []string
+				for _, e := range got {
+					gotKeys = append(gotKeys, e.Key)
+				}
+				assert.Equal(t, expected, gotKeys, "префикс %q", prefix)
+			}
+
+			// Пустой префикс возвращает всё дерево
+			all, err := tree.RangePrefix(ctx, "")
+			require.NoError(t, err)
+			assert.Len(t, all, len(keys))
+		})
+	}
+
+	assert.Equal(t, "posu", prefixUpperBound("post"))
+	assert.Equal(t, "b", prefixUpperBound("a\xff\xff"))
+	assert.Equal(t, "", prefixUpperBound("\xff\xff"))
+	assert.Equal(t, "", prefixUpperBound(""))
+}
+
+// ========================================
+// ТЕСТЫ РАЗМЕРА ДЕРЕВА
+// ========================================
+
+// TestCount проверяет, что размер поддеревьев корректно поддерживается
+// при случайных вставках, удалениях и ротациях.
+func TestCount(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+
+	count, err := tree.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	rng := rand.New(rand.NewSource(42))
+	present := make(map[string]bool)
+
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key-%03d", rng.Intn(150))
+
+		if rng.Intn(3) == 0 {
+			_, _, err := tree.Delete(ctx, key)
+			require.NoError(t, err)
+			delete(present, key)
+		} else {
+			_, err := tree.Put(ctx, key, testCID(t, key))
+			require.NoError(t, err)
+			present[key] = true
+		}
+
+		count, err := tree.Count(ctx)
+		require.NoError(t, err)
+		require.Equal(t, len(present), count, "шаг %d", i)
+	}
+
+	// Размер сохраняется в узлах и доступен после повторной загрузки
+	reloaded := NewTree(tree.bs)
+	require.NoError(t, reloaded.Load(ctx, tree.Root()))
+	count, err = reloaded.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(present), count)
+
+	all, err := reloaded.Range(ctx, "", "")
+	require.NoError(t, err)
+	assert.Len(t, all, count)
+}
+
+// TestStats проверяет чтение статистики из манифеста и обходом
+// для дерева старого формата.
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("манифест текущего формата", func(t *testing.T) {
+		tree := createTestTree(t)
+		stats, err := tree.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, TreeStats{}, stats)
+
+		_, err = tree.PutMany(ctx, makeEntries(t, 100))
+		require.NoError(t, err)
+
+		stats, err = tree.Stats(ctx)
+		require.NoError(t, err)
+		assert.True(t, stats.FromManifest)
+		assert.Equal(t, 100, stats.Count)
+		assert.Equal(t, nodeFormatVersion, stats.Version)
+
+		// Высота AVL-дерева из 100 ключей ограничена 1.44*log2(n)
+		assert.GreaterOrEqual(t, stats.Height, 7)
+		assert.LessOrEqual(t, stats.Height, 9)
+	})
+
+	t.Run("узлы старого формата", func(t *testing.T) {
+		tree := createTestTree(t)
+
+		// Строим вручную дерево из трёх узлов без полей size и version
+		leaf := func(key string) cid.Cid {
+			n := &node{Entry: Entry{Key: key, Value: testCID(t, key)}, Height: 1}
+			n.Hash = nodeHash(n.Key, n.Value, nil, nil)
+			dm, err := tree.nodeToNode(n)
+			require.NoError(t, err)
+			c, err := tree.bs.PutNode(ctx, dm)
+			require.NoError(t, err)
+			return c
+		}
+		left, right := leaf("a"), leaf("c")
+		leftNode, err := tree.loadNode(ctx, make(nodeCache), left)
+		require.NoError(t, err)
+		rightNode, err := tree.loadNode(ctx, make(nodeCache), right)
+		require.NoError(t, err)
+		assert.Equal(t, 0, leftNode.Version)
+		assert.Equal(t, 0, leftNode.Size)
+
+		root := &node{Entry: Entry{Key: "b", Value: testCID(t, "b")}, Left: left, Right: right, Height: 2}
+		root.Hash = nodeHash(root.Key, root.Value, leftNode.Hash, rightNode.Hash)
+		dm, err := tree.nodeToNode(root)
+		require.NoError(t, err)
+		_, err = dm.LookupByString("size")
+		require.Error(t, err, "узел старого формата не должен содержать size")
+		rootCID, err := tree.bs.PutNode(ctx, dm)
+		require.NoError(t, err)
+
+		require.NoError(t, tree.Load(ctx, rootCID))
+		stats, err := tree.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, TreeStats{Count: 3, Height: 2}, stats)
+
+		count, err := tree.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+
+		// Доказательства работают и для узлов старого формата
+		proof, err := tree.Prove(ctx, "c")
+		require.NoError(t, err)
+		ok, err := VerifyProof(rootCID, "c", testCID(t, "c"), proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// После изменения корень переписывается в текущем формате
+		_, err = tree.Put(ctx, "d", testCID(t, "d"))
+		require.NoError(t, err)
+		stats, err = tree.Stats(ctx)
+		require.NoError(t, err)
+		assert.True(t, stats.FromManifest)
+		assert.Equal(t, 4, stats.Count)
+		assert.Equal(t, 3, stats.Height)
+	})
+}
+
+// TestReachableCIDs проверяет, что множество достижимых узлов не включает
+// узлы, вытесненные последующими изменениями.
+func TestReachableCIDs(t *testing.T) {
+	ctx := context.Background()
+
+	for _, fanout := range []int{2, 4} {
+		t.Run(fmt.Sprintf("fanout=%d", fanout), func(t *testing.T) {
+			tree := NewTree(createTestTree(t).bs, WithFanout(fanout))
+
+			empty, err := tree.ReachableCIDs(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, empty)
+
+			oldRoot, err := tree.PutMany(ctx, makeEntries(t, 60))
+			require.NoError(t, err)
+			before, err := tree.ReachableCIDs(ctx)
+			require.NoError(t, err)
+			assert.Contains(t, before, oldRoot)
+
+			// Изменяем дерево: старый корень и узлы на изменённых путях вытесняются
+			_, err = tree.Put(ctx, "key-000030", testCID(t, "changed"))
+			require.NoError(t, err)
+			_, _, err = tree.Delete(ctx, "key-000010")
+			require.NoError(t, err)
+
+			after, err := tree.ReachableCIDs(ctx)
+			require.NoError(t, err)
+			assert.Contains(t, after, tree.Root())
+			assert.NotContains(t, after, oldRoot)
+
+			// Нетронутые поддеревья остаются общими для обеих версий
+			shared := 0
+			for c := range after {
+				if _, ok := before[c]; ok {
+					shared++
+				}
+			}
+			assert.Greater(t, shared, 0)
+			assert.Less(t, shared, len(after))
+
+			if fanout == 2 {
+				// В AVL-дереве каждый ключ хранится в отдельном узле
+				assert.Len(t, after, 59)
+			}
+		})
+	}
+}
+
+// ========================================
+// ТЕСТЫ ИТЕРАТОРА
+// ========================================
+
+// TestRangeIter проверяет порядок, границы и отмену контекста при ленивом обходе.
+func TestRangeIter(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	_, err := tree.PutMany(ctx, makeEntries(t, 300))
+	require.NoError(t, err)
+
+	t.Run("порядок и границы", func(t *testing.T) {
+		cases := []struct{ start, end string }{
+			{"", ""},
+			{"key-000100", ""},
+			{"", "key-000050"},
+			{"key-000010", "key-000020"},
+			{"key-000010x", "key-000020x"},
+			{"zzz", ""},
+		}
+
+		for _, tc := range cases {
+			it, err := tree.RangeIter(ctx, tc.start, tc.end)
+			require.NoError(t, err)
+
+			var keys []string
+			for {
+				e, ok, err := it.Next()
+				require.NoError(t, err)
+				if !ok {
+					break
+				}
+				keys = append(keys, e.Key)
+			}
+
+			// Результат должен совпадать с Range и быть строго отсортирован
+			expected, err := tree.Range(ctx, tc.start, tc.end)
+			require.NoError(t, err)
+			require.Len(t, keys, len(expected))
+			for i := range keys {
+				assert.Equal(t, expected[i].Key, keys[i])
+				if i > 0 {
+					assert.Less(t, keys[i-1], keys[i])
+				}
+				if tc.start != "" {
+					assert.GreaterOrEqual(t, keys[i], tc.start)
+				}
+				if tc.end != "" {
+					assert.LessOrEqual(t, keys[i], tc.end)
+				}
+			}
+		}
+
+		all, err := tree.Range(ctx, "", "")
+		require.NoError(t, err)
+		assert.Len(t, all, 300)
+	})
+
+	t.Run("отмена контекста", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		it, err := tree.RangeIter(cctx, "", "")
+		require.NoError(t, err)
+
+		_, ok, err := it.Next()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		cancel()
+		_, ok, err = it.Next()
+		assert.False(t, ok)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// ========================================
+// ТЕСТЫ СРАВНЕНИЯ ВЕРСИЙ
+// ========================================
+
+// TestDiff проверяет вычисление изменений между двумя корнями.
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	entries := makeEntries(t, 200)
+
+	oldRoot, err := tree.PutMany(ctx, entries)
+	require.NoError(t, err)
+
+	// Вносим изменения всех трёх видов
+	_, err = tree.Put(ctx, "key-000010", testCID(t, "changed"))
+	require.NoError(t, err)
+	_, err = tree.Put(ctx, "key-000050a", testCID(t, "new"))
+	require.NoError(t, err)
+	_, _, err = tree.Delete(ctx, "key-000150")
+	require.NoError(t, err)
+	newRoot := tree.Root()
+
+	t.Run("изменения между версиями", func(t *testing.T) {
+		diff, err := tree.Diff(ctx, oldRoot, newRoot)
+		require.NoError(t, err)
+		require.Len(t, diff, 3)
+
+		assert.Equal(t, DiffEntry{Key: "key-000010", Op: DiffModified, Old: testCID(t, "key-000010"), New: testCID(t, "changed")}, diff[0])
+		assert.Equal(t, DiffEntry{Key: "key-000050a", Op: DiffAdded, New: testCID(t, "new")}, diff[1])
+		assert.Equal(t, DiffEntry{Key: "key-000150", Op: DiffRemoved, Old: testCID(t, "key-000150")}, diff[2])
+
+		// Обратное сравнение меняет направление операций
+		reverse, err := tree.Diff(ctx, newRoot, oldRoot)
+		require.NoError(t, err)
+		require.Len(t, reverse, 3)
+		assert.Equal(t, DiffRemoved, reverse[1].Op)
+		assert.Equal(t, DiffAdded, reverse[2].Op)
+	})
+
+	t.Run("одинаковые и пустые корни", func(t *testing.T) {
+		diff, err := tree.Diff(ctx, newRoot, newRoot)
+		require.NoError(t, err)
+		assert.Empty(t, diff)
+
+		added, err := tree.Diff(ctx, cid.Undef, oldRoot)
+		require.NoError(t, err)
+		require.Len(t, added, len(entries))
+		for i, d := range added {
+			assert.Equal(t, DiffAdded, d.Op)
+			if i > 0 {
+				assert.Less(t, added[i-1].Key, d.Key)
+			}
+		}
+
+		removed, err := tree.Diff(ctx, oldRoot, cid.Undef)
+		require.NoError(t, err)
+		require.Len(t, removed, len(entries))
+		assert.Equal(t, DiffRemoved, removed[0].Op)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ДОКАЗАТЕЛЬСТВ
+// ========================================
+
+// TestProveAndVerify проверяет доказательства включения и отсутствия ключей.
+func TestProveAndVerify(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	root, err := tree.PutMany(ctx, makeEntries(t, 100))
+	require.NoError(t, err)
+
+	t.Run("ключ присутствует", func(t *testing.T) {
+		key := "key-000042"
+		proof, err := tree.Prove(ctx, key)
+		require.NoError(t, err)
+		require.True(t, proof.Found)
+		assert.Equal(t, testCID(t, key), proof.Value)
+
+		ok, err := VerifyProof(root, key, testCID(t, key), proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Неверное значение не проходит проверку
+		ok, err = VerifyProof(root, key, testCID(t, "other"), proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// Доказательство включения не доказывает отсутствие
+		ok, err = VerifyProof(root, key, cid.Undef, proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("ключ отсутствует", func(t *testing.T) {
+		key := "key-000042a"
+		proof, err := tree.Prove(ctx, key)
+		require.NoError(t, err)
+		require.False(t, proof.Found)
+		require.NotEmpty(t, proof.Path)
+
+		ok, err := VerifyProof(root, key, cid.Undef, proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = VerifyProof(root, key, testCID(t, key), proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("подделанное доказательство", func(t *testing.T) {
+		key := "key-000007"
+		proof, err := tree.Prove(ctx, key)
+		require.NoError(t, err)
+		require.Greater(t, len(proof.Path), 1)
+
+		// Другой корень
+		ok, err := VerifyProof(testCID(t, "root"), key, testCID(t, key), proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// Искажённый хеш соседнего поддерева
+		tampered := *proof
+		tampered.Path = append([]ProofNode(nil), proof.Path...)
+		for i := range tampered.Path {
+			if len(tampered.Path[i].LeftHash) > 0 {
+				h := append([]byte(nil), tampered.Path[i].LeftHash...)
+				h[0] ^= 0xff
+				tampered.Path[i].LeftHash = h
+				break
+			}
+		}
+		ok, err = VerifyProof(root, key, testCID(t, key), &tampered)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = VerifyProof(root, "другой", testCID(t, key), proof)
+		assert.Error(t, err)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПРОВЕРКИ ЦЕЛОСТНОСТИ
+// ========================================
+
+// TestVerifyOnRead проверяет обнаружение повреждённой ссылки на ребёнка.
+func TestVerifyOnRead(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	root, err := tree.PutMany(ctx, makeEntries(t, 50))
+	require.NoError(t, err)
+
+	// Корректное дерево проходит проверку
+	verified := NewTreeWithOptions(tree.bs, Options{VerifyOnRead: true})
+	require.NoError(t, verified.Load(ctx, root))
+	all, err := verified.Range(ctx, "", "")
+	require.NoError(t, err)
+	assert.Len(t, all, 50)
+
+	// Подменяем ссылку на левого ребёнка корня, сохраняя старый хеш
+	dm, err := tree.bs.GetNode(ctx, root)
+	require.NoError(t, err)
+	rootNode, err := tree.nodeFromNode(dm)
+	require.NoError(t, err)
+	require.True(t, rootNode.Left.Defined())
+	require.True(t, rootNode.Right.Defined())
+
+	corrupted := cloneNode(rootNode)
+	corrupted.Left = rootNode.Right
+	corruptedDM, err := tree.nodeToNode(corrupted)
+	require.NoError(t, err)
+	corruptedRoot, err := tree.bs.PutNode(ctx, corruptedDM)
+	require.NoError(t, err)
+
+	// Без проверки повреждение не замечается
+	plain := NewTree(tree.bs)
+	require.NoError(t, plain.Load(ctx, corruptedRoot))
+
+	// С проверкой загрузка возвращает описательную ошибку
+	strict := NewTreeWithOptions(tree.bs, Options{VerifyOnRead: true})
+	err = strict.Load(ctx, corruptedRoot)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	assert.Contains(t, err.Error(), corruptedRoot.String())
+	assert.Equal(t, cid.Undef, strict.Root())
+}
+
+// ========================================
+// ТЕСТЫ РЕЖИМА B-ДЕРЕВА
+// ========================================
+
+// TestFanout сверяет B-дерево с эталонной картой на случайной
+// последовательности вставок и удалений для разных значений fanout.
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+
+	for _, fanout := range []int{3, 4, 16} {
+		t.Run(fmt.Sprintf("fanout=%d", fanout), func(t *testing.T) {
+			base := createTestTree(t)
+			tree := NewTree(base.bs, WithFanout(fanout))
+
+			rng := rand.New(rand.NewSource(int64(fanout)))
+			present := make(map[string]cid.Cid)
+
+			for i := 0; i < 1500; i++ {
+				key := fmt.Sprintf("key-%04d", rng.Intn(400))
+
+				if rng.Intn(3) == 0 {
+					_, removed, err := tree.Delete(ctx, key)
+					require.NoError(t, err)
+					_, existed := present[key]
+					require.Equal(t, existed, removed, "ключ %s", key)
+					delete(present, key)
+				} else {
+					value := testCID(t, fmt.Sprintf("%s-%d", key, i))
+					_, err := tree.Put(ctx, key, value)
+					require.NoError(t, err)
+					present[key] = value
+				}
+			}
+
+			// Все ключи читаются и совпадают с эталоном
+			for key, value := range present {
+				got, found, err := tree.Get(ctx, key)
+				require.NoError(t, err)
+				require.True(t, found, "ключ %s", key)
+				assert.Equal(t, value, got)
+			}
+
+			// Обход возвращает ключи по порядку и с учётом границ
+			all, err := tree.Range(ctx, "", "")
+			require.NoError(t, err)
+			require.Len(t, all, len(present))
+			for i := 1; i < len(all); i++ {
+				require.Less(t, all[i-1].Key, all[i].Key)
+			}
+
+			part, err := tree.Range(ctx, "key-0100", "key-0200")
+			require.NoError(t, err)
+			for _, e := range part {
+				assert.GreaterOrEqual(t, e.Key, "key-0100")
+				assert.LessOrEqual(t, e.Key, "key-0200")
+			}
+
+			count, err := tree.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, len(present), count)
+
+			// Дерево загружается с тем же fanout
+			reloaded := NewTree(base.bs, WithFanout(fanout))
+			require.NoError(t, reloaded.Load(ctx, tree.Root()))
+			again, err := reloaded.Range(ctx, "", "")
+			require.NoError(t, err)
+			assert.Equal(t, all, again)
+
+			// Удаление всех ключей возвращает пустое дерево
+			var keys []string
+			for key := range present {
+				keys = append(keys, key)
+			}
+			root, err := tree.DeleteMany(ctx, keys)
+			require.NoError(t, err)
+			assert.Equal(t, cid.Undef, root)
+		})
+	}
+}
+
+// TestBTreeParity проверяет пакетную запись, сравнение версий,
+// доказательства и проверку целостности в режиме B-дерева.
+func TestBTreeParity(t *testing.T) {
+	ctx := context.Background()
+	entries := makeEntries(t, 300)
+
+	// nodeHashes оставляет мультихеши узлов дерева, без значений записей:
+	// blockstore перечисляет блоки по мультихешу, без исходного кодека
+	nodeHashes := func(all map[cid.Cid]struct{}) map[string]struct{} {
+		nodes := make(map[string]struct{})
+		for c := range all {
+			if c.Prefix().Codec == cid.DagCBOR {
+				nodes[c.Hash().String()] = struct{}{}
+			}
+		}
+		return nodes
+	}
+
+	t.Run("пакетная запись без промежуточных узлов", func(t *testing.T) {
+		tree := NewTreeWithOptions(createTestTree(t).bs, Options{Fanout: 4})
+		require.True(t, tree.btreeMode())
+
+		storedBlocks := func() map[string]struct{} {
+			keys, err := tree.bs.AllKeysChan(ctx)
+			require.NoError(t, err)
+			stored := make(map[string]struct{})
+			for c := range keys {
+				stored[c.Hash().String()] = struct{}{}
+			}
+			return stored
+		}
+
+		// После вставки в хранилище только узлы итогового дерева
+		_, err := tree.PutMany(ctx, entries)
+		require.NoError(t, err)
+		before, err := tree.ReachableCIDs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, nodeHashes(before), storedBlocks())
+
+		// Удаление добавляет только новые узлы итогового дерева
+		_, err = tree.DeleteMany(ctx, []string{"key-000001", "key-000100", "key-000200"})
+		require.NoError(t, err)
+		after, err := tree.ReachableCIDs(ctx)
+		require.NoError(t, err)
+		expected := nodeHashes(before)
+		for c := range nodeHashes(after) {
+			expected[c] = struct{}{}
+		}
+		assert.Equal(t, expected, storedBlocks())
+
+		count, err := tree.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, len(entries)-3, count)
+	})
+
+	tree := NewTree(createTestTree(t).bs, WithFanout(4))
+	oldRoot, err := tree.PutMany(ctx, entries)
+	require.NoError(t, err)
+
+	t.Run("сравнение версий", func(t *testing.T) {
+		_, err := tree.Put(ctx, "key-000010", testCID(t, "changed"))
+		require.NoError(t, err)
+		_, err = tree.Put(ctx, "key-000050a", testCID(t, "new"))
+		require.NoError(t, err)
+		_, _, err = tree.Delete(ctx, "key-000150")
+		require.NoError(t, err)
+
+		diff, err := tree.Diff(ctx, oldRoot, tree.Root())
+		require.NoError(t, err)
+		assert.Equal(t, []DiffEntry{
+			{Key: "key-000010", Op: DiffModified, Old: testCID(t, "key-000010"), New: testCID(t, "changed")},
+			{Key: "key-000050a", Op: DiffAdded, New: testCID(t, "new")},
+			{Key: "key-000150", Op: DiffRemoved, Old: testCID(t, "key-000150")},
+		}, diff)
+
+		added, err := tree.Diff(ctx, cid.Undef, oldRoot)
+		require.NoError(t, err)
+		require.Len(t, added, len(entries))
+		for i := 1; i < len(added); i++ {
+			assert.Less(t, added[i-1].Key, added[i].Key)
+		}
+	})
+
+	t.Run("доказательства", func(t *testing.T) {
+		root := tree.Root()
+
+		key := "key-000042"
+		proof, err := tree.Prove(ctx, key)
+		require.NoError(t, err)
+		require.True(t, proof.Found)
+		require.Empty(t, proof.Path)
+		require.Greater(t, len(proof.BPath), 1)
+
+		ok, err := VerifyProof(root, key, testCID(t, key), proof)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = VerifyProof(root, key, cid.Undef, proof)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		absent, err := tree.Prove(ctx, "key-000042a")
+		require.NoError(t, err)
+		require.False(t, absent.Found)
+		ok, err = VerifyProof(root, "key-000042a", cid.Undef, absent)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// Искажённая запись корневого узла не проходит проверку
+		tampered := *proof
+		tampered.BPath = append([]ProofBNode(nil), proof.BPath...)
+		first := append([]Entry(nil), tampered.BPath[0].Entries...)
+		first[0].Value = testCID(t, "forged")
+		tampered.BPath[0].Entries = first
+		ok, err = VerifyProof(root, key, testCID(t, key), &tampered)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("проверка целостности при чтении", func(t *testing.T) {
+		strict := NewTreeWithOptions(tree.bs, Options{Fanout: 4, VerifyOnRead: true})
+		require.NoError(t, strict.Load(ctx, tree.Root()))
+		all, err := strict.Range(ctx, "", "")
+		require.NoError(t, err)
+		assert.Len(t, all, len(entries))
+
+		// Узел с нарушенным порядком записей
+		unordered, err := bnodeToNode(&bnode{Entries: []Entry{
+			{Key: "b", Value: testCID(t, "b")},
+			{Key: "a", Value: testCID(t, "a")},
+		}})
+		require.NoError(t, err)
+		unorderedRoot, err := tree.bs.PutNode(ctx, unordered)
+		require.NoError(t, err)
+		plain := NewTree(tree.bs, WithFanout(4))
+		require.NoError(t, plain.Load(ctx, unorderedRoot))
+		err = strict.Load(ctx, unorderedRoot)
+		assert.ErrorIs(t, err, ErrInvalidNode)
+		assert.NotErrorIs(t, err, ErrHashMismatch)
+		assert.Contains(t, err.Error(), unorderedRoot.String())
+
+		// Узел внутри дерева проверяется, когда обход его загружает
+		dm, err := tree.bs.GetNode(ctx, tree.Root())
+		require.NoError(t, err)
+		rootNode, err := bnodeFromNode(dm)
+		require.NoError(t, err)
+		require.Greater(t, len(rootNode.Children), 1)
+
+		withUnordered := cloneBNode(rootNode)
+		withUnordered.Children[0] = unorderedRoot
+		withUnorderedDM, err := bnodeToNode(withUnordered)
+		require.NoError(t, err)
+		withUnorderedRoot, err := tree.bs.PutNode(ctx, withUnorderedDM)
+		require.NoError(t, err)
+
+		require.NoError(t, strict.Load(ctx, withUnorderedRoot))
+		_, err = strict.Range(ctx, "", "")
+		assert.ErrorIs(t, err, ErrInvalidNode)
+	})
+}
+
+// ========================================
+// ТЕСТЫ СНИМКОВ
+// ========================================
+
+// TestSnapshot проверяет, что читатель снимка видит стабильный набор ключей,
+// пока другие горутины изменяют дерево.
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	entries := makeEntries(t, 100)
+	_, err := tree.PutMany(ctx, entries)
+	require.NoError(t, err)
+
+	snap := tree.Snapshot()
+	assert.Equal(t, tree.Root(), snap.Root())
+
+	expected, err := snap.Range(ctx, "", "")
+	require.NoError(t, err)
+	require.Len(t, expected, len(entries))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	// Писатели добавляют новые и удаляют существующие ключи
+	for w := 0; w < 3; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				key := fmt.Sprintf("new-%d-%03d", w, i)
+				if _, err := tree.Put(ctx, key, testCID(t, key)); err != nil {
+					errs <- err
+					return
+				}
+				if _, _, err := tree.Delete(ctx, entries[(w*30+i)%len(entries)].Key); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Читатель снимка многократно сверяет содержимое с исходным
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			got, err := snap.Range(ctx, "", "")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !assert.Equal(t, expected, got) {
+				return
+			}
+
+			value, found, err := snap.Get(ctx, entries[i].Key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			assert.True(t, found)
+			assert.Equal(t, entries[i].Value, value)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Само дерево изменилось, а снимок - нет
+	assert.NotEqual(t, snap.Root(), tree.Root())
+	_, found, err := snap.Get(ctx, "new-0-000")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// ========================================
+// ТЕСТЫ СБОРКИ МУСОРА
+// ========================================
+
+// TestBlockstoreGC проверяет, что сборка мусора удаляет узлы и значения,
+// вытесненные перезаписью ключей, и сохраняет текущую версию дерева.
+func TestBlockstoreGC(t *testing.T) {
+	ctx := context.Background()
+	tree := createTestTree(t)
+	bs := tree.bs
+
+	// Значения сохраняются в blockstore, чтобы граф дерева был полным
+	storeValue := func(data string) cid.Cid {
+		nb := basicnode.Prototype.String.NewBuilder()
+		require.NoError(t, nb.AssignString(data))
+		c, err := bs.PutNode(ctx, nb.Build())
+		require.NoError(t, err)
+		return c
+	}
+
+	var entries []Entry
+	for i := 0; i < 40; i++ {
+		key := fmt.Sprintf("key-%06d", i)
+		entries = append(entries, Entry{Key: key, Value: storeValue("v1-" + key)})
+	}
+	oldRoot, err := tree.PutMany(ctx, entries)
+	require.NoError(t, err)
+	oldNodes, err := tree.ReachableCIDs(ctx)
+	require.NoError(t, err)
+
+	// Перезапись ключей оставляет старые значения и узлы на путях без ссылок
+	overwritten := map[string]cid.Cid{}
+	for _, i := range []int{3, 17, 31} {
+		key := fmt.Sprintf("key-%06d", i)
+		old, found, err := tree.Get(ctx, key)
+		require.NoError(t, err)
+		require.True(t, found)
+		overwritten[key] = old
+
+		_, err = tree.Put(ctx, key, storeValue("v2-"+key))
+		require.NoError(t, err)
+	}
+	newNodes, err := tree.ReachableCIDs(ctx)
+	require.NoError(t, err)
+
+	var orphanNodes []cid.Cid
+	for c := range oldNodes {
+		if _, ok := newNodes[c]; !ok {
+			orphanNodes = append(orphanNodes, c)
+		}
+	}
+	require.Contains(t, orphanNodes, oldRoot)
+
+	countBlocks := func() int {
+		keys, err := bs.AllKeysChan(ctx)
+		require.NoError(t, err)
+		n := 0
+		for range keys {
+			n++
+		}
+		return n
+	}
+
+	// Живы только узлы текущей версии и по одному значению на ключ;
+	// мусором стали и узлы промежуточных версий между перезаписями
+	total := countBlocks()
+	live := len(newNodes) + len(entries)
+	deleted, err := bs.GC(ctx, []cid.Cid{tree.Root()})
+	require.NoError(t, err)
+	assert.Equal(t, total-live, deleted)
+	assert.GreaterOrEqual(t, deleted, len(orphanNodes)+len(overwritten))
+	assert.Equal(t, live, countBlocks())
+
+	for _, c := range orphanNodes {
+		has, err := bs.Has(ctx, c)
+		require.NoError(t, err)
+		assert.False(t, has, "вытесненный узел %s должен быть удален", c)
+	}
+	for key, c := range overwritten {
+		has, err := bs.Has(ctx, c)
+		require.NoError(t, err)
+		assert.False(t, has, "старое значение %s должно быть удалено", key)
+	}
+
+	// Текущая версия дерева полностью читается после сборки
+	reloaded := NewTree(bs)
+	require.NoError(t, reloaded.Load(ctx, tree.Root()))
+	got, err := reloaded.Range(ctx, "", "")
+	require.NoError(t, err)
+	require.Len(t, got, len(entries))
+	for _, e := range got {
+		_, err := bs.GetNode(ctx, e.Value)
+		assert.NoError(t, err, "значение %s должно сохраниться", e.Key)
+	}
+}
+
+// =====================================
+// БЕНЧМАРКИ
+// =====================================
+
+// BenchmarkPutLoop измеряет вставку набора ключей последовательными Put.
+func BenchmarkPutLoop(b *testing.B) {
+	ctx := context.Background()
+	entries := makeEntries(b, 500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := createBenchTree(b)
+		b.StartTimer()
+
+		for _, e := range entries {
+			if _, err := tree.Put(ctx, e.Key, e.Value); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkPutMany измеряет вставку того же набора ключей одним PutMany.
+func BenchmarkPutMany(b *testing.B) {
+	ctx := context.Background()
+	entries := makeEntries(b, 500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tree := createBenchTree(b)
+		b.StartTimer()
+
+		if _, err := tree.PutMany(ctx, entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLookupReads сравнивает количество чтений блоков на поиск
+// для бинарного дерева (fanout 2) и B-дерева (fanout 16 и 64).
+func BenchmarkLookupReads(b *testing.B) {
+	ctx := context.Background()
+	entries := makeEntries(b, 5000)
+
+	for _, fanout := range []int{2, 16, 64} {
+		b.Run(fmt.Sprintf("fanout=%d", fanout), func(b *testing.B) {
+			base := createBenchTree(b)
+			counting := &countingBlockstore{Blockstore: base.bs}
+			tree := NewTree(counting, WithFanout(fanout))
+			if _, err := tree.PutMany(ctx, entries); err != nil {
+				b.Fatal(err)
+			}
+
+			atomic.StoreInt64(&counting.reads, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e := entries[i%len(entries)]
+				if _, found, err := tree.Get(ctx, e.Key); err != nil || !found {
+					b.Fatalf("ключ %s: found=%v err=%v", e.Key, found, err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&counting.reads))/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// =====================================
+// ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ
+// =====================================
+
+// createTestTree создает пустое дерево поверх временного хранилища.
+func createTestTree(t testing.TB) *Tree {
+	tmpDir := t.TempDir()
+
+	ds, err := s.NewDatastorage(tmpDir, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		ds.Close()
+	})
+
+	return NewTree(blockstore.NewBlockstore(ds))
+}
+
+// createBenchTree создает дерево для бенчмарков.
+func createBenchTree(b *testing.B) *Tree {
+	tmpDir, err := os.MkdirTemp("", "mst_bench_*")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	ds, err := s.NewDatastorage(tmpDir, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() {
+		ds.Close()
+	})
+
+	return NewTree(blockstore.NewBlockstore(ds))
+}
+
+// testCID возвращает детерминированный CID для произвольной строки.
+func testCID(t testing.TB, data string) cid.Cid {
+	c, err := blockstore.DefaultLP.Sum([]byte(data))
+	require.NoError(t, err)
+	return c
+}
+
+// makeEntries создает n записей с ключами в неупорядоченном порядке вставки.
+func makeEntries(t testing.TB, n int) []Entry {
+	entries := make([]Entry, 0, n)
+	for i := 0; i < n; i++ {
+		// Перемешиваем порядок, чтобы задействовать все виды ротаций
+		k := (i * 7919) % n
+		key := fmt.Sprintf("key-%06d", k)
+		entries = append(entries, Entry{Key: key, Value: testCID(t, key)})
+	}
+	return entries
+}
+
+// countingBlockstore считает чтения узлов для оценки глубины дерева.
+type countingBlockstore struct {
+	blockstore.Blockstore
+	reads int64
+}
+
+// GetNode увеличивает счётчик чтений и делегирует вызов.
+func (c *countingBlockstore) GetNode(ctx context.Context, id cid.Cid) (datamodel.Node, error) {
+	atomic.AddInt64(&c.reads, 1)
+	return c.Blockstore.GetNode(ctx, id)
+}
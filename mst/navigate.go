@@ -0,0 +1,158 @@
+package mst
+
+import (
+	"context"
+	"strings"
+)
+
+// FirstKey возвращает запись с наименьшим ключом.
+// Для пустого дерева второе значение равно false.
+func (t *Tree) FirstKey(ctx context.Context) (Entry, bool, error) {
+	return t.edge(ctx, true)
+}
+
+// LastKey возвращает запись с наибольшим ключом.
+// Для пустого дерева второе значение равно false.
+func (t *Tree) LastKey(ctx context.Context) (Entry, bool, error) {
+	return t.edge(ctx, false)
+}
+
+// Ceiling возвращает запись с наименьшим ключом, большим или равным key.
+// Удобна для постраничного обхода по курсору: следующая страница начинается
+// с Ceiling(последний ключ + "\x00"). Если такого ключа нет, второе значение
+// равно false.
+func (t *Tree) Ceiling(ctx context.Context, key string) (Entry, bool, error) {
+	return t.bound(ctx, key, true)
+}
+
+// Floor возвращает запись с наибольшим ключом, меньшим или равным key.
+// Если такого ключа нет, второе значение равно false.
+func (t *Tree) Floor(ctx context.Context, key string) (Entry, bool, error) {
+	return t.bound(ctx, key, false)
+}
+
+// edge спускается по крайней левой (first == true) или правой ветви дерева.
+func (t *Tree) edge(ctx context.Context, first bool) (Entry, bool, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	if !root.Defined() {
+		return Entry{}, false, nil
+	}
+
+	if t.btreeMode() {
+		cache := make(bnodeCache)
+		currentCID := root
+		for {
+			current, err := t.loadBNode(ctx, cache, currentCID)
+			if err != nil {
+				return Entry{}, false, err
+			}
+			if current.leaf() {
+				if len(current.Entries) == 0 {
+					return Entry{}, false, nil
+				}
+				if first {
+					return current.Entries[0], true, nil
+				}
+				return current.Entries[len(current.Entries)-1], true, nil
+			}
+			if first {
+				currentCID = current.Children[0]
+			} else {
+				currentCID = current.Children[len(current.Children)-1]
+			}
+		}
+	}
+
+	cache := make(nodeCache)
+	currentCID := root
+	for {
+		current, err := t.loadNode(ctx, cache, currentCID)
+		if err != nil {
+			return Entry{}, false, err
+		}
+
+		next := current.Right
+		if first {
+			next = current.Left
+		}
+		if !next.Defined() {
+			return current.Entry, true, nil
+		}
+		currentCID = next
+	}
+}
+
+// bound ищет ближайший ключ к key сверху (ceiling == true) или снизу,
+// используя упорядоченность дерева: проходит только один путь от корня.
+func (t *Tree) bound(ctx context.Context, key string, ceiling bool) (Entry, bool, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	var best Entry
+	var found bool
+
+	if t.btreeMode() {
+		cache := make(bnodeCache)
+		currentCID := root
+		for currentCID.Defined() {
+			current, err := t.loadBNode(ctx, cache, currentCID)
+			if err != nil {
+				return Entry{}, false, err
+			}
+
+			i, exact := current.search(key)
+			if exact {
+				return current.Entries[i], true, nil
+			}
+
+			// Ближайшие кандидаты в узле - соседние записи позиции i
+			if ceiling && i < len(current.Entries) {
+				best, found = current.Entries[i], true
+			}
+			if !ceiling && i > 0 {
+				best, found = current.Entries[i-1], true
+			}
+
+			if current.leaf() {
+				break
+			}
+			currentCID = current.Children[i]
+		}
+		return best, found, nil
+	}
+
+	cache := make(nodeCache)
+	currentCID := root
+	for currentCID.Defined() {
+		current, err := t.loadNode(ctx, cache, currentCID)
+		if err != nil {
+			return Entry{}, false, err
+		}
+
+		cmp := strings.Compare(key, current.Key)
+		switch {
+		case cmp == 0:
+			return current.Entry, true, nil
+		case cmp < 0:
+			// Текущий ключ больше искомого - кандидат для ceiling
+			if ceiling {
+				best, found = current.Entry, true
+			}
+			currentCID = current.Left
+		default:
+			// Текущий ключ меньше искомого - кандидат для floor
+			if !ceiling {
+				best, found = current.Entry, true
+			}
+			currentCID = current.Right
+		}
+	}
+
+	return best, found, nil
+}
@@ -0,0 +1,271 @@
+package mst
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// ProofNode - узел на пути от корня к искомому ключу.
+// Содержит все поля, из которых строится блок узла, поэтому проверяющая
+// сторона может заново закодировать узел и сравнить его CID со ссылкой
+// родителя. Хеши детей (включая соседние поддеревья вне пути) нужны для
+// пересчёта хеша узла.
+type ProofNode struct {
+	Key       string  // Ключ узла
+	Value     cid.Cid // Значение узла
+	Left      cid.Cid // CID левого ребёнка
+	Right     cid.Cid // CID правого ребёнка
+	Height    int     // Высота поддерева
+	Size      int     // Количество ключей в поддереве
+	Version   int     // Версия формата узла
+	LeftHash  []byte  // Хеш левого ребёнка (nil, если его нет)
+	RightHash []byte  // Хеш правого ребёнка (nil, если его нет)
+}
+
+// ProofBNode - узел B-дерева на пути от корня к искомому ключу.
+// Хранит все записи и ссылки на детей узла: из них проверяющая сторона
+// заново кодирует узел и сравнивает его CID со ссылкой родителя.
+type ProofBNode struct {
+	Entries  []Entry   // Записи узла в порядке ключей
+	Children []cid.Cid // Дети узла (пусто для листа)
+}
+
+// Proof - доказательство включения или отсутствия ключа в дереве.
+// Path (для AVL-дерева) или BPath (для B-дерева) упорядочен от корня
+// к последнему посещённому узлу; заполняется только один из них.
+type Proof struct {
+	Key   string       // Ключ, для которого построено доказательство
+	Found bool         // Признак наличия ключа
+	Value cid.Cid      // Значение ключа (cid.Undef, если ключ отсутствует)
+	Path  []ProofNode  // Узлы AVL-дерева на пути поиска
+	BPath []ProofBNode // Узлы B-дерева на пути поиска
+}
+
+// Prove строит доказательство для ключа относительно текущего корня.
+// Если ключ присутствует, последний узел пути содержит его значение.
+// Если отсутствует, путь заканчивается узлом, у которого нет ребёнка
+// в направлении ключа, что и доказывает отсутствие. В режиме B-дерева
+// путь записывается в BPath и заканчивается узлом с ключом или листом.
+func (t *Tree) Prove(ctx context.Context, key string) (*Proof, error) {
+	if key == "" {
+		return nil, errors.New("mst: empty key")
+	}
+
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	if t.btreeMode() {
+		return t.bprove(ctx, root, key)
+	}
+
+	cache := make(nodeCache)
+	proof := &Proof{Key: key}
+
+	// Спускаемся по пути поиска, собирая узлы и хеши их детей
+	currentCID := root
+	for currentCID.Defined() {
+		current, err := t.loadNode(ctx, cache, currentCID)
+		if err != nil {
+			return nil, err
+		}
+
+		_, leftHash, err := t.childHeightAndHash(ctx, cache, current.Left)
+		if err != nil {
+			return nil, err
+		}
+		_, rightHash, err := t.childHeightAndHash(ctx, cache, current.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		proof.Path = append(proof.Path, ProofNode{
+			Key:       current.Key,
+			Value:     current.Value,
+			Left:      current.Left,
+			Right:     current.Right,
+			Height:    current.Height,
+			Size:      current.Size,
+			Version:   current.Version,
+			LeftHash:  leftHash,
+			RightHash: rightHash,
+		})
+
+		switch cmp := strings.Compare(key, current.Key); {
+		case cmp == 0:
+			proof.Found = true
+			proof.Value = current.Value
+			return proof, nil
+		case cmp < 0:
+			currentCID = current.Left
+		default:
+			currentCID = current.Right
+		}
+	}
+
+	return proof, nil
+}
+
+// VerifyProof проверяет доказательство без доступа к дереву.
+//
+// Для каждого узла пути заново вычисляется хеш из ключа, значения и хешей
+// детей, затем узел кодируется и его CID сравнивается с ожидаемым: для
+// первого узла - с root, для остальных - со ссылкой родителя. Хеш каждого
+// следующего узла должен совпадать с хешем, заявленным родителем.
+//
+// Если value определён, проверяется включение пары key/value; если value
+// равен cid.Undef, проверяется отсутствие key. Возвращает false при
+// несовпадении и ошибку при некорректных входных данных.
+//
+// Доказательство B-дерева (BPath) проверяется так же, но узел кодируется
+// из всех его записей и детей, а следующий шаг выбирается поиском ключа
+// среди записей узла.
+func VerifyProof(root cid.Cid, key string, value cid.Cid, proof *Proof) (bool, error) {
+	if proof == nil {
+		return false, errors.New("mst: nil proof")
+	}
+	if proof.Key != key {
+		return false, errors.New("mst: proof key mismatch")
+	}
+	if len(proof.Path) > 0 && len(proof.BPath) > 0 {
+		return false, errors.New("mst: proof has both binary and B-tree paths")
+	}
+
+	// Пустое дерево не содержит ни одного ключа
+	if !root.Defined() {
+		return len(proof.Path) == 0 && len(proof.BPath) == 0 && !value.Defined(), nil
+	}
+
+	if len(proof.BPath) > 0 {
+		return verifyBProof(root, key, value, proof.BPath)
+	}
+
+	expected := root
+	var expectedHash []byte
+	for i, pn := range proof.Path {
+		// Пересчитываем хеш узла и сверяем его с заявленным родителем
+		nd := &node{
+			Entry:   Entry{Key: pn.Key, Value: pn.Value},
+			Left:    pn.Left,
+			Right:   pn.Right,
+			Height:  pn.Height,
+			Size:    pn.Size,
+			Version: pn.Version,
+			Hash:    nodeHash(pn.Key, pn.Value, pn.LeftHash, pn.RightHash),
+		}
+		if i > 0 && !bytes.Equal(nd.Hash, expectedHash) {
+			return false, nil
+		}
+
+		// Кодируем узел и сверяем CID со ссылкой родителя (или корнем)
+		dm, err := new(Tree).nodeToNode(nd)
+		if err != nil {
+			return false, err
+		}
+		_, c, err := encodeNode(dm)
+		if err != nil {
+			return false, err
+		}
+		if !c.Equals(expected) {
+			return false, nil
+		}
+
+		last := i == len(proof.Path)-1
+
+		// Определяем следующий шаг так же, как поиск в дереве
+		switch cmp := strings.Compare(key, pn.Key); {
+		case cmp == 0:
+			return last && value.Defined() && pn.Value.Equals(value), nil
+		case cmp < 0:
+			expected, expectedHash = pn.Left, pn.LeftHash
+		default:
+			expected, expectedHash = pn.Right, pn.RightHash
+		}
+
+		// Нет ребёнка в направлении ключа - ключ отсутствует
+		if !expected.Defined() {
+			return last && !value.Defined(), nil
+		}
+	}
+
+	// Путь оборвался раньше, чем завершился поиск
+	return false, nil
+}
+
+// bprove строит доказательство для ключа в режиме B-дерева.
+func (t *Tree) bprove(ctx context.Context, root cid.Cid, key string) (*Proof, error) {
+	cache := make(bnodeCache)
+	proof := &Proof{Key: key}
+
+	currentCID := root
+	for currentCID.Defined() {
+		current, err := t.loadBNode(ctx, cache, currentCID)
+		if err != nil {
+			return nil, err
+		}
+
+		proof.BPath = append(proof.BPath, ProofBNode{
+			Entries:  append([]Entry(nil), current.Entries...),
+			Children: append([]cid.Cid(nil), current.Children...),
+		})
+
+		i, found := current.search(key)
+		if found {
+			proof.Found = true
+			proof.Value = current.Entries[i].Value
+			return proof, nil
+		}
+		if current.leaf() {
+			break
+		}
+		currentCID = current.Children[i]
+	}
+
+	return proof, nil
+}
+
+// verifyBProof проверяет путь доказательства B-дерева от корня root.
+func verifyBProof(root cid.Cid, key string, value cid.Cid, path []ProofBNode) (bool, error) {
+	expected := root
+	for i, pn := range path {
+		nd := &bnode{Entries: pn.Entries, Children: pn.Children}
+		if !nd.leaf() && len(nd.Children) != len(nd.Entries)+1 {
+			return false, nil
+		}
+
+		// Кодируем узел и сверяем CID со ссылкой родителя (или корнем)
+		dm, err := bnodeToNode(nd)
+		if err != nil {
+			return false, err
+		}
+		_, c, err := encodeNode(dm)
+		if err != nil {
+			return false, err
+		}
+		if !c.Equals(expected) {
+			return false, nil
+		}
+
+		last := i == len(path)-1
+
+		// Определяем следующий шаг так же, как поиск в дереве
+		idx, found := nd.search(key)
+		if found {
+			return last && value.Defined() && nd.Entries[idx].Value.Equals(value), nil
+		}
+
+		// Лист без ключа - ключ отсутствует
+		if nd.leaf() {
+			return last && !value.Defined(), nil
+		}
+		expected = nd.Children[idx]
+	}
+
+	// Путь оборвался раньше, чем завершился поиск
+	return false, nil
+}
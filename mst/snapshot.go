@@ -0,0 +1,54 @@
+package mst
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+)
+
+// TreeSnapshot - неизменяемое представление дерева на момент создания.
+//
+// Узлы MST иммутабельны и адресуются по содержимому, поэтому для снимка
+// достаточно зафиксировать CID корня: последующие Put и Delete создают новые
+// узлы и меняют корень Tree, но не затрагивают узлы, достижимые из снимка.
+// Это позволяет выполнять долгие чтения (например, экспорт через Range)
+// параллельно с записью и видеть согласованный набор ключей.
+type TreeSnapshot struct {
+	t    *Tree   // Дерево, через которое загружаются узлы
+	root cid.Cid // Зафиксированный корень
+}
+
+// Snapshot фиксирует текущий корень дерева и возвращает снимок для чтения.
+func (t *Tree) Snapshot() *TreeSnapshot {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return &TreeSnapshot{t: t, root: t.rootCID}
+}
+
+// Root возвращает зафиксированный CID корня (cid.Undef для пустого дерева).
+func (s *TreeSnapshot) Root() cid.Cid {
+	return s.root
+}
+
+// Get возвращает значение по ключу на момент создания снимка.
+func (s *TreeSnapshot) Get(ctx context.Context, key string) (cid.Cid, bool, error) {
+	return s.t.getAt(ctx, s.root, key)
+}
+
+// Range возвращает пары ключ-значение в диапазоне [start, end] на момент
+// создания снимка. Семантика границ совпадает с Tree.Range.
+func (s *TreeSnapshot) Range(ctx context.Context, start, end string) ([]Entry, error) {
+	it, err := s.RangeIter(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectEntries(it)
+}
+
+// RangeIter возвращает ленивый итератор по диапазону [start, end] снимка.
+func (s *TreeSnapshot) RangeIter(ctx context.Context, start, end string) (*EntryIterator, error) {
+	return s.t.rangeIterAt(ctx, s.root, start, end)
+}
@@ -0,0 +1,117 @@
+package mst
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+)
+
+// TreeStats - сводные характеристики дерева для быстрых проверок состояния.
+type TreeStats struct {
+	Count        int  // Количество ключей
+	Height       int  // Высота дерева (0 для пустого дерева)
+	Version      int  // Версия формата корневого узла (0 - старый формат)
+	FromManifest bool // Получены ли значения из манифеста корня без обхода
+}
+
+// Stats возвращает количество ключей, высоту и версию формата дерева.
+//
+// Корневой узел текущего формата содержит манифест (size и height), поэтому
+// статистика читается из одного блока. Для деревьев старого формата,
+// а также в режиме B-дерева значения вычисляются обходом.
+func (t *Tree) Stats(ctx context.Context) (TreeStats, error) {
+	// Получаем снимок текущего корня под блокировкой чтения
+	t.mu.RLock()
+	root := t.rootCID
+	t.mu.RUnlock()
+
+	if !root.Defined() {
+		return TreeStats{}, nil
+	}
+
+	if t.btreeMode() {
+		return t.bstats(ctx, root)
+	}
+
+	cache := make(nodeCache)
+	rootNode, err := t.loadNode(ctx, cache, root)
+	if err != nil {
+		return TreeStats{}, err
+	}
+
+	// Манифест присутствует - обход не нужен
+	if rootNode.Version >= nodeFormatVersion && rootNode.Size > 0 {
+		return TreeStats{
+			Count:        rootNode.Size,
+			Height:       rootNode.Height,
+			Version:      rootNode.Version,
+			FromManifest: true,
+		}, nil
+	}
+
+	// Старый формат - вычисляем обходом
+	count, height, err := t.walkStats(ctx, cache, root)
+	if err != nil {
+		return TreeStats{}, err
+	}
+
+	return TreeStats{
+		Count:   count,
+		Height:  height,
+		Version: rootNode.Version,
+	}, nil
+}
+
+// walkStats подсчитывает количество ключей и фактическую высоту поддерева
+// полным обходом, не полагаясь на сохранённые в узлах значения.
+func (t *Tree) walkStats(ctx context.Context, cache nodeCache, id cid.Cid) (int, int, error) {
+	if !id.Defined() {
+		return 0, 0, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	nd, err := t.loadNode(ctx, cache, id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	leftCount, leftHeight, err := t.walkStats(ctx, cache, nd.Left)
+	if err != nil {
+		return 0, 0, err
+	}
+	rightCount, rightHeight, err := t.walkStats(ctx, cache, nd.Right)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 1 + leftCount + rightCount, 1 + max(leftHeight, rightHeight), nil
+}
+
+// bstats вычисляет статистику B-дерева: все листья находятся на одной
+// глубине, поэтому высота определяется по левой ветви.
+func (t *Tree) bstats(ctx context.Context, root cid.Cid) (TreeStats, error) {
+	cache := make(bnodeCache)
+
+	count, err := t.bcount(ctx, cache, root)
+	if err != nil {
+		return TreeStats{}, err
+	}
+
+	height := 0
+	for id := root; id.Defined(); {
+		n, err := t.loadBNode(ctx, cache, id)
+		if err != nil {
+			return TreeStats{}, err
+		}
+		height++
+		if n.leaf() {
+			break
+		}
+		id = n.Children[0]
+	}
+
+	return TreeStats{Count: count, Height: height}, nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"ues/mst"
+	"ues/sqliteindexer"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+)
+
+// RepoBatch накапливает изменения записей в нескольких коллекциях и
+// применяет их одним коммитом.
+//
+// Put и Delete только запоминают операции; репозиторий не меняется до
+// вызова Commit. Commit строит новые MST всех затронутых коллекций,
+// один раз материализует индекс и создает один коммит. При ошибке
+// изменения не становятся видимы, а накопленные операции сохраняются
+// для повторной попытки.
+//
+// Использование:
+//
+//	batch := repo.Batch()
+//	batch.Put("posts", "p1", post1)
+//	batch.Put("users", "alice", user)
+//	batch.Delete("posts", "old")
+//	if err := batch.Commit(ctx); err != nil {
+//	    return fmt.Errorf("ошибка пакетной записи: %w", err)
+//	}
+type RepoBatch struct {
+	repo *Repository
+	mu   sync.Mutex
+	ops  []batchOp
+}
+
+// batchOp - накопленная операция пакета; node == nil означает удаление
+type batchOp struct {
+	collection string
+	rkey       string
+	node       datamodel.Node
+}
+
+// Batch создает пустой пакет изменений репозитория
+func (r *Repository) Batch() *RepoBatch {
+	return &RepoBatch{repo: r}
+}
+
+// Put добавляет в пакет запись (или замену) узла записи
+func (b *RepoBatch) Put(collection, rkey string, node datamodel.Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ops = append(b.ops, batchOp{collection: collection, rkey: rkey, node: node})
+}
+
+// Delete добавляет в пакет удаление записи; отсутствующие записи пропускаются
+func (b *RepoBatch) Delete(collection, rkey string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ops = append(b.ops, batchOp{collection: collection, rkey: rkey})
+}
+
+// Len возвращает количество накопленных операций
+func (b *RepoBatch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.ops)
+}
+
+// collectionChanges - итоговые изменения одной коллекции
+type collectionChanges struct {
+	puts    []mst.Entry
+	deletes []string
+}
+
+// Commit применяет накопленные операции одним коммитом.
+//
+// Если ключ встречается в пакете несколько раз, побеждает последняя
+// операция. Все коллекции должны существовать. Пустой пакет не создает
+// коммит. После успешного применения пакет очищается, а подписчики
+// (см. Subscribe) получают события записей и затем событие коммита.
+//
+// Если коллекцию пакета изменила другая операция, пока строились новые
+// MST, пакет не применяется и возвращается ошибка с indexer.ErrRootConflict.
+// Операции пакета при этом сохраняются, и Commit можно повторить.
+func (b *RepoBatch) Commit(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.ops) == 0 {
+		return nil
+	}
+	r := b.repo
+
+	// === Итоговая операция для каждого ключа ===
+	final := make(map[string]map[string]datamodel.Node)
+	for _, op := range b.ops {
+		if final[op.collection] == nil {
+			final[op.collection] = make(map[string]datamodel.Node)
+		}
+		final[op.collection][op.rkey] = op.node
+	}
+
+	// === Валидация и сохранение узлов записей ===
+	// Узлы в blockstore не видны, пока на них не ссылается индекс
+	changes := make(map[string]*collectionChanges, len(final))
+	var indexed []sqliteindexer.IndexedRecord
+	for collection, records := range final {
+		if !r.index.HasCollection(collection) {
+			return fmt.Errorf("collection not found: %s", collection)
+		}
+
+		ch := &collectionChanges{}
+		for rkey, node := range records {
+			if node == nil {
+				ch.deletes = append(ch.deletes, rkey)
+				continue
+			}
+
+			if r.lexicon != nil {
+				if err := r.validateRecordWithLexicon(ctx, collection, node); err != nil {
+					return fmt.Errorf("lexicon validation failed for %s/%s: %w", collection, rkey, err)
+				}
+			}
+			if err := r.checkRecordSize(node); err != nil {
+				return fmt.Errorf("record %s/%s: %w", collection, rkey, err)
+			}
+			c, err := r.bs.PutNode(ctx, node)
+			if err != nil {
+				return fmt.Errorf("store record node %s/%s: %w", collection, rkey, err)
+			}
+			ch.puts = append(ch.puts, mst.Entry{Key: rkey, Value: c})
+
+			if r.sqliteIndex != nil {
+				if data, err := extractDataFromNode(node); err == nil {
+					indexed = append(indexed, sqliteindexer.IndexedRecord{
+						CID: c,
+						Metadata: sqliteindexer.IndexMetadata{
+							Collection: collection,
+							RKey:       rkey,
+							RecordType: inferRecordType(collection, data),
+							Data:       data,
+							SearchText: generateSearchText(data),
+							CreatedAt:  time.Now(),
+							UpdatedAt:  time.Now(),
+						},
+					})
+				}
+			}
+		}
+		// Порядок ключей детерминирует форму итогового дерева
+		sort.Slice(ch.puts, func(i, j int) bool { return ch.puts[i].Key < ch.puts[j].Key })
+		sort.Strings(ch.deletes)
+		changes[collection] = ch
+	}
+
+	// === Построение новых MST коллекций ===
+	newRoots := make(map[string]cid.Cid, len(changes))
+	oldRoots := make(map[string]cid.Cid, len(changes))
+	var deleted []RepoEvent
+	var events []RepoEvent
+	for collection, ch := range changes {
+		root, _ := r.index.CollectionRoot(collection)
+		oldRoots[collection] = root
+
+		tree := mst.NewTree(r.bs)
+		if err := tree.Load(ctx, root); err != nil {
+			return fmt.Errorf("load collection %s: %w", collection, err)
+		}
+		for _, rkey := range ch.deletes {
+			old, found, err := tree.Get(ctx, rkey)
+			if err != nil {
+				return fmt.Errorf("lookup %s/%s: %w", collection, rkey, err)
+			}
+			if found {
+				ev := RepoEvent{Op: OpDelete, Collection: collection, RKey: rkey, CID: old}
+				deleted = append(deleted, ev)
+				events = append(events, ev)
+			}
+		}
+		if _, err := tree.PutMany(ctx, ch.puts); err != nil {
+			return fmt.Errorf("update collection %s: %w", collection, err)
+		}
+		if _, err := tree.DeleteMany(ctx, ch.deletes); err != nil {
+			return fmt.Errorf("update collection %s: %w", collection, err)
+		}
+		newRoots[collection] = tree.Root()
+		for _, e := range ch.puts {
+			events = append(events, RepoEvent{Op: OpPut, Collection: collection, RKey: e.Key, CID: e.Value})
+		}
+	}
+
+	// === Публикация: индекс и коммит ===
+	head, err := r.commitRoots(ctx, newRoots, oldRoots)
+	if err != nil {
+		return err
+	}
+
+	b.ops = nil
+	r.publish(append(events, RepoEvent{Op: OpCommit, CID: head})...)
+
+	// === Индексирование в SQLite (если включено) ===
+	// Как и в PutRecord, ошибки SQLite не отменяют примененные изменения
+	if r.sqliteIndex != nil {
+		for _, ev := range deleted {
+			if err := r.sqliteIndex.DeleteRecordByKey(ctx, ev.Collection, ev.RKey); err != nil {
+				fmt.Printf("Warning: SQLite deletion failed for %s/%s: %v\n", ev.Collection, ev.RKey, err)
+			}
+		}
+		if err := r.sqliteIndex.BatchIndexRecords(ctx, indexed); err != nil {
+			fmt.Printf("Warning: SQLite batch indexing failed: %v\n", err)
+		}
+	}
+
+	return r.saveHead(ctx)
+}
+
+// commitRoots переключает корни коллекций с oldRoots на newRoots и создает
+// коммит. newRoots построены по прочитанным ранее oldRoots, поэтому если
+// корень коллекции с тех пор изменился (например, конкурентным PutRecord),
+// замена не выполняется и возвращается ошибка с indexer.ErrRootConflict -
+// иначе чужое изменение было бы потеряно. Если коммит не удался,
+// возвращаются прежние корни oldRoots, чтобы изменения не стали видимы.
+// Возвращает CID нового коммита; HEAD в headStorage сохраняет вызывающий код.
+func (r *Repository) commitRoots(ctx context.Context, newRoots, oldRoots map[string]cid.Cid) (cid.Cid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.index.CompareAndSetCollectionRoots(ctx, oldRoots, newRoots); err != nil {
+		return cid.Undef, fmt.Errorf("update index: %w", err)
+	}
+	if err := r.commitLocked(ctx); err != nil {
+		if _, restoreErr := r.index.CompareAndSetCollectionRoots(ctx, newRoots, oldRoots); restoreErr != nil {
+			err = fmt.Errorf("%w (restore index: %v)", err, restoreErr)
+		}
+		return cid.Undef, err
+	}
+	return r.Head, nil
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// NodeFromGo конвертирует значение Go в IPLD узел (обратное NodeToGo).
+//
+// Соответствие типов:
+//   - nil - Null, string - String, bool - Bool
+//   - int, int8..int64, uint, uint8..uint64 - Int (беззнаковые значения
+//     больше math.MaxInt64 отклоняются)
+//   - float32, float64 - Float
+//   - json.Number - Int для целого литерала ("42"), иначе Float ("42.5", "42.0", "1e3")
+//   - []byte - Bytes, cid.Cid и datamodel.Link - Link
+//   - срезы и массивы - List, карты со строковыми ключами - Map
+//   - datamodel.Node вставляется как есть
+//
+// Ключи карт сортируются, чтобы одинаковые данные давали одинаковый CID.
+//
+// Параметры:
+//   - value: значение Go (обычно map[string]interface{} из JSON)
+//
+// Возвращает:
+//   - datamodel.Node: узел на basicnode
+//   - error: ошибка с путем к значению неподдерживаемого типа
+//
+// Пример использования:
+//
+//	node, err := repository.NodeFromGo(map[string]interface{}{
+//	    "text":  "привет",
+//	    "likes": 42,
+//	    "tags":  []string{"go", "ipld"},
+//	})
+func NodeFromGo(value interface{}) (datamodel.Node, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := assignGoValue(nb, value); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// NodeFromJSON разбирает JSON документ в IPLD узел, сохраняя различие
+// целых и дробных чисел: 42 становится Int, а 42.5 и 42.0 - Float.
+// Обычный json.Unmarshal приводит все числа к float64, и целые поля
+// после сохранения не проходили бы проверку схемы с типом Int.
+//
+// Параметры:
+//   - data: JSON документ
+//
+// Возвращает:
+//   - datamodel.Node: узел на basicnode
+//   - error: ошибка разбора JSON или значение вне диапазона int64
+//
+// Пример использования:
+//
+//	node, err := repository.NodeFromJSON([]byte(`{"text": "привет", "likes": 42}`))
+//	if err != nil {
+//	    return err
+//	}
+//	repo.PutRecord(ctx, "posts", "post1", node)
+func NodeFromJSON(data []byte) (datamodel.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("decode JSON: unexpected data after top-level value")
+	}
+	return NodeFromGo(value)
+}
+
+// NodeToGo конвертирует IPLD узел в значение Go (обратное NodeFromGo).
+//
+// Соответствие видов узлов:
+//   - Null - nil, String - string, Bool - bool
+//   - Int - int64, Float - float64 (целые и дробные числа не смешиваются)
+//   - Bytes - []byte, Link - cid.Cid
+//   - List - []interface{}, Map - map[string]interface{}
+//
+// Результат NodeToGo, переданный в NodeFromGo, дает узел с тем же CID.
+//
+// Параметры:
+//   - node: IPLD узел
+//
+// Возвращает:
+//   - interface{}: значение Go
+//   - error: ошибка с путем к значению, которое не удалось прочитать
+//
+// Пример использования:
+//
+//	value, err := repository.NodeToGo(node)
+//	data, ok := value.(map[string]interface{})
+func NodeToGo(node datamodel.Node) (interface{}, error) {
+	switch node.Kind() {
+	case datamodel.Kind_Null:
+		return nil, nil
+
+	case datamodel.Kind_String:
+		return node.AsString()
+
+	case datamodel.Kind_Bool:
+		return node.AsBool()
+
+	case datamodel.Kind_Int:
+		return node.AsInt()
+
+	case datamodel.Kind_Float:
+		return node.AsFloat()
+
+	case datamodel.Kind_Bytes:
+		return node.AsBytes()
+
+	case datamodel.Kind_Link:
+		link, err := node.AsLink()
+		if err != nil {
+			return nil, err
+		}
+		cl, ok := link.(cidlink.Link)
+		if !ok {
+			return nil, fmt.Errorf("unsupported link type %T", link)
+		}
+		return cl.Cid, nil
+
+	case datamodel.Kind_List:
+		result := make([]interface{}, 0, node.Length())
+		iterator := node.ListIterator()
+		for !iterator.Done() {
+			i, value, err := iterator.Next()
+			if err != nil {
+				return nil, err
+			}
+			goValue, err := NodeToGo(value)
+			if err != nil {
+				return nil, fmt.Errorf("list item %d: %w", i, err)
+			}
+			result = append(result, goValue)
+		}
+		return result, nil
+
+	case datamodel.Kind_Map:
+		result := make(map[string]interface{}, node.Length())
+		iterator := node.MapIterator()
+		for !iterator.Done() {
+			key, value, err := iterator.Next()
+			if err != nil {
+				return nil, err
+			}
+			keyStr, err := key.AsString()
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			goValue, err := NodeToGo(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", keyStr, err)
+			}
+			result[keyStr] = goValue
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported node kind %s", node.Kind())
+	}
+}
+
+// assignGoValue записывает Go значение в сборщик IPLD узла
+func assignGoValue(na datamodel.NodeAssembler, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return na.AssignNull()
+	case string:
+		return na.AssignString(v)
+	case bool:
+		return na.AssignBool(v)
+	case int:
+		return na.AssignInt(int64(v))
+	case int8:
+		return na.AssignInt(int64(v))
+	case int16:
+		return na.AssignInt(int64(v))
+	case int32:
+		return na.AssignInt(int64(v))
+	case int64:
+		return na.AssignInt(v)
+	case uint:
+		return assignUint(na, uint64(v))
+	case uint8:
+		return na.AssignInt(int64(v))
+	case uint16:
+		return na.AssignInt(int64(v))
+	case uint32:
+		return na.AssignInt(int64(v))
+	case uint64:
+		return assignUint(na, v)
+	case float32:
+		return na.AssignFloat(float64(v))
+	case float64:
+		return na.AssignFloat(v)
+	case json.Number:
+		return assignNumber(na, v)
+	case []byte:
+		return na.AssignBytes(v)
+	case cid.Cid:
+		return na.AssignLink(cidlink.Link{Cid: v})
+	case datamodel.Link:
+		return na.AssignLink(v)
+	case datamodel.Node:
+		return na.AssignNode(v)
+	case []interface{}:
+		la, err := na.BeginList(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for i, item := range v {
+			if err := assignGoValue(la.AssembleValue(), item); err != nil {
+				return fmt.Errorf("list item %d: %w", i, err)
+			}
+		}
+		return la.Finish()
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		ma, err := na.BeginMap(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			entry, err := ma.AssembleEntry(k)
+			if err != nil {
+				return err
+			}
+			if err := assignGoValue(entry, v[k]); err != nil {
+				return fmt.Errorf("field %s: %w", k, err)
+			}
+		}
+		return ma.Finish()
+	default:
+		return assignReflectValue(na, reflect.ValueOf(value))
+	}
+}
+
+// assignNumber записывает число JSON, сохраняя различие целых и дробных:
+// литерал без дробной части и экспоненты становится Int, остальные - Float
+func assignNumber(na datamodel.NodeAssembler, n json.Number) error {
+	i, err := strconv.ParseInt(n.String(), 10, 64)
+	if err == nil {
+		return na.AssignInt(i)
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("integer %s overflows int64", n)
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("invalid number %q: %w", n, err)
+	}
+	return na.AssignFloat(f)
+}
+
+// assignUint записывает беззнаковое целое, проверяя диапазон Int
+func assignUint(na datamodel.NodeAssembler, v uint64) error {
+	if v > math.MaxInt64 {
+		return fmt.Errorf("integer %d overflows int64", v)
+	}
+	return na.AssignInt(int64(v))
+}
+
+// assignReflectValue записывает типизированные срезы ([]string, []int, ...)
+// и карты (map[string]string, ...), сводя их к []interface{} и
+// map[string]interface{}
+func assignReflectValue(na datamodel.NodeAssembler, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return na.AssignBytes(rv.Bytes())
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		return assignGoValue(na, items)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		fields := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			fields[iter.Key().String()] = iter.Value().Interface()
+		}
+		return assignGoValue(na, fields)
+	}
+	return fmt.Errorf("unsupported value type %s", rv.Type())
+}
@@ -0,0 +1,557 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"ues/blockstore"
+	"ues/indexer"
+	"ues/mst"
+	"ues/sqliteindexer"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// commitVersion - версия формата узла коммита
+const commitVersion = 1
+
+// Узел коммита сохраняется в blockstore как DAG-CBOR карта:
+//
+//	{
+//	  "version": 1,
+//	  "data":    <ссылка на узел индекса коллекций> или null,
+//	  "prev":    <ссылка на родительский коммит> или null,
+//	  "time":    "2024-01-01T00:00:00.000000000Z"
+//	}
+//
+// Ссылка data делает коммит корнем всего состояния репозитория: от него
+// достижимы индекс коллекций, MST каждой коллекции и узлы записей.
+// Ссылки prev образуют цепочку истории; у первого коммита prev равен null.
+// Поле prev необязательно: коммиты, созданные до его появления, читаются
+// как коммиты без родителя.
+type commit struct {
+	Index cid.Cid   // Корень индекса коллекций (cid.Undef для пустого репозитория)
+	Prev  cid.Cid   // Родительский коммит (cid.Undef для первого коммита)
+	Time  time.Time // Время создания коммита
+}
+
+// CommitInfo описывает коммит в истории репозитория
+type CommitInfo struct {
+	CID  cid.Cid   // CID узла коммита
+	Time time.Time // Время создания коммита
+	Prev cid.Cid   // Родительский коммит (cid.Undef для первого коммита)
+}
+
+// ErrNoCommits возвращается операциями, требующими хотя бы одного коммита.
+var ErrNoCommits = errors.New("repository has no commits")
+
+// ErrHeadConflict возвращается Revert, если HEAD или индекс коллекций
+// изменила другая операция, пока готовилось новое состояние.
+var ErrHeadConflict = errors.New("repository head changed concurrently")
+
+// buildCommitNode строит IPLD узел коммита
+func buildCommitNode(c commit) (datamodel.Node, error) {
+	b := basicnode.Prototype.Map.NewBuilder()
+	ma, err := b.BeginMap(4)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := ma.AssembleEntry("version")
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.AssignInt(commitVersion); err != nil {
+		return nil, err
+	}
+
+	entry, err = ma.AssembleEntry("data")
+	if err != nil {
+		return nil, err
+	}
+	if err := assignLinkOrNull(entry, c.Index); err != nil {
+		return nil, err
+	}
+
+	entry, err = ma.AssembleEntry("prev")
+	if err != nil {
+		return nil, err
+	}
+	if err := assignLinkOrNull(entry, c.Prev); err != nil {
+		return nil, err
+	}
+
+	entry, err = ma.AssembleEntry("time")
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.AssignString(c.Time.UTC().Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+
+	return b.Build(), nil
+}
+
+// parseCommitNode разбирает узел коммита и проверяет его формат
+func parseCommitNode(n datamodel.Node) (commit, error) {
+	var c commit
+
+	if n.Kind() != datamodel.Kind_Map {
+		return c, errors.New("commit: node is not a map")
+	}
+
+	versionNode, err := n.LookupByString("version")
+	if err != nil {
+		return c, fmt.Errorf("commit: missing version: %w", err)
+	}
+	version, err := versionNode.AsInt()
+	if err != nil {
+		return c, fmt.Errorf("commit: invalid version: %w", err)
+	}
+	if version != commitVersion {
+		return c, fmt.Errorf("commit: unsupported version %d", version)
+	}
+
+	dataNode, err := n.LookupByString("data")
+	if err != nil {
+		return c, fmt.Errorf("commit: missing data: %w", err)
+	}
+	if c.Index, err = linkOrNull(dataNode); err != nil {
+		return c, fmt.Errorf("commit: invalid data: %w", err)
+	}
+
+	prevNode, err := n.LookupByString("prev")
+	if err == nil {
+		if c.Prev, err = linkOrNull(prevNode); err != nil {
+			return c, fmt.Errorf("commit: invalid prev: %w", err)
+		}
+	} else if !errors.As(err, new(datamodel.ErrNotExists)) {
+		return c, fmt.Errorf("commit: invalid prev: %w", err)
+	}
+
+	timeNode, err := n.LookupByString("time")
+	if err != nil {
+		return c, fmt.Errorf("commit: missing time: %w", err)
+	}
+	ts, err := timeNode.AsString()
+	if err != nil {
+		return c, fmt.Errorf("commit: invalid time: %w", err)
+	}
+	if c.Time, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+		return c, fmt.Errorf("commit: invalid time: %w", err)
+	}
+
+	return c, nil
+}
+
+// assignLinkOrNull записывает ссылку или null для cid.Undef
+func assignLinkOrNull(na datamodel.NodeAssembler, c cid.Cid) error {
+	if c.Defined() {
+		return na.AssignLink(cidlink.Link{Cid: c})
+	}
+	return na.AssignNull()
+}
+
+// linkOrNull читает ссылку; null читается как cid.Undef
+func linkOrNull(n datamodel.Node) (cid.Cid, error) {
+	if n.IsNull() {
+		return cid.Undef, nil
+	}
+	lnk, err := n.AsLink()
+	if err != nil {
+		return cid.Undef, err
+	}
+	cl, ok := lnk.(cidlink.Link)
+	if !ok {
+		return cid.Undef, errors.New("unexpected link type")
+	}
+	return cl.Cid, nil
+}
+
+// loadCommit загружает и разбирает узел коммита из blockstore
+func (r *Repository) loadCommit(ctx context.Context, head cid.Cid) (commit, error) {
+	n, err := r.bs.GetNode(ctx, head)
+	if err != nil {
+		return commit{}, fmt.Errorf("load commit %s: %w", head, err)
+	}
+	return parseCommitNode(n)
+}
+
+// LoadHead переключает репозиторий на состояние указанного коммита.
+//
+// Индекс коллекций загружается из коммита, HEAD сохраняется в headStorage,
+// а SQLite индекс (если включен) перестраивается по записям нового состояния.
+// Все блоки коммита должны уже находиться в blockstore.
+//
+// Перед переключением читаются все узлы MST и записей коммита: если какого-то
+// блока не хватает, возвращается ошибка и репозиторий остается в прежнем
+// состоянии.
+//
+// Использование:
+//
+//	if err := repo.LoadHead(ctx, commitCID); err != nil {
+//	    return fmt.Errorf("не удалось загрузить коммит: %w", err)
+//	}
+func (r *Repository) LoadHead(ctx context.Context, head cid.Cid) error {
+	c, err := r.loadCommit(ctx, head)
+	if err != nil {
+		return err
+	}
+
+	index, err := r.prepareIndex(ctx, c.Index)
+	if err != nil {
+		return fmt.Errorf("commit %s: %w", head, err)
+	}
+
+	r.mu.Lock()
+	r.index = index
+	r.Head = head
+	r.Prev = c.Prev
+	r.mu.Unlock()
+
+	return r.saveHead(ctx)
+}
+
+// Checkout откатывает репозиторий к коммиту из истории: MST всех коллекций
+// загружаются из этого коммита, и он становится HEAD.
+//
+// Более поздние коммиты не удаляются из blockstore и по-прежнему доступны
+// по CID, но пропадают из Log, так как история теперь начинается с
+// commitCID. Чтобы отменить изменения, сохранив историю, используйте Revert.
+//
+// Использование:
+//
+//	commits, _ := repo.Log(ctx, 2)
+//	if err := repo.Checkout(ctx, commits[1].CID); err != nil {
+//	    return fmt.Errorf("ошибка отката: %w", err)
+//	}
+func (r *Repository) Checkout(ctx context.Context, commitCID cid.Cid) error {
+	return r.LoadHead(ctx, commitCID)
+}
+
+// Revert создает новый коммит, отменяющий изменения последнего коммита,
+// и возвращает его CID.
+//
+// Состояние нового коммита совпадает с состоянием родителя HEAD, а его
+// родителем становится текущий HEAD, поэтому отмененный коммит остается
+// в истории. Отмена первого коммита возвращает репозиторий к пустому
+// состоянию. Для репозитория без коммитов возвращается ErrNoCommits.
+//
+// Состояние родителя загружается без блокировки. Если за это время
+// репозиторий изменила другая операция (PutRecord, пакет и т.п.),
+// возвращается ошибка с ErrHeadConflict и ничего не меняется - иначе
+// отмена затерла бы и это изменение.
+//
+// Использование:
+//
+//	reverted, err := repo.Revert(ctx)
+//	if err != nil {
+//	    return fmt.Errorf("ошибка отмены коммита: %w", err)
+//	}
+func (r *Repository) Revert(ctx context.Context) (cid.Cid, error) {
+	st, err := r.prepareRevert(ctx)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return r.commitRevert(ctx, st)
+}
+
+// revertState - состояние, подготовленное Revert без блокировки
+type revertState struct {
+	head    cid.Cid        // HEAD, изменения которого отменяются
+	root    cid.Cid        // Корень индекса коллекций на момент чтения HEAD
+	index   *indexer.Index // Индекс коллекций родителя HEAD
+	records []storedRecord // Записи родителя для перестроения SQLite индекса
+}
+
+// prepareRevert читает HEAD и загружает состояние его родителя
+func (r *Repository) prepareRevert(ctx context.Context) (revertState, error) {
+	r.mu.RLock()
+	st := revertState{head: r.Head, root: r.index.Root()}
+	r.mu.RUnlock()
+
+	if !st.head.Defined() {
+		return st, ErrNoCommits
+	}
+
+	last, err := r.loadCommit(ctx, st.head)
+	if err != nil {
+		return st, err
+	}
+
+	var root cid.Cid
+	if last.Prev.Defined() {
+		parent, err := r.loadCommit(ctx, last.Prev)
+		if err != nil {
+			return st, err
+		}
+		root = parent.Index
+	}
+
+	if st.index, st.records, err = r.loadState(ctx, root); err != nil {
+		return st, fmt.Errorf("commit %s: %w", last.Prev, err)
+	}
+	return st, nil
+}
+
+// commitRevert переключает индекс на подготовленное состояние и создает
+// коммит под одной блокировкой. Если HEAD или индекс изменились после
+// prepareRevert, возвращается ошибка с ErrHeadConflict. Если коммит не
+// удался, прежний индекс (и SQLite индекс) восстанавливается.
+func (r *Repository) commitRevert(ctx context.Context, st revertState) (cid.Cid, error) {
+	r.mu.Lock()
+	if r.Head != st.head || r.index.Root() != st.root {
+		r.mu.Unlock()
+		return cid.Undef, fmt.Errorf("revert %s: %w", st.head, ErrHeadConflict)
+	}
+
+	if r.sqliteIndex != nil {
+		if err := r.reindexSQLite(ctx, st.records); err != nil {
+			r.mu.Unlock()
+			return cid.Undef, fmt.Errorf("rebuild SQLite index: %w", err)
+		}
+	}
+
+	prev := r.index
+	r.index = st.index
+	if err := r.commitLocked(ctx); err != nil {
+		r.index = prev
+		if r.sqliteIndex != nil {
+			if restoreErr := r.restoreSQLite(ctx, prev); restoreErr != nil {
+				err = fmt.Errorf("%w (restore SQLite index: %v)", err, restoreErr)
+			}
+		}
+		r.mu.Unlock()
+		return cid.Undef, err
+	}
+	head := r.Head
+	r.mu.Unlock()
+
+	r.publish(RepoEvent{Op: OpCommit, CID: head})
+	return head, r.saveHead(ctx)
+}
+
+// restoreSQLite перестраивает SQLite индекс по записям индекса index
+func (r *Repository) restoreSQLite(ctx context.Context, index *indexer.Index) error {
+	records, err := r.collectRecords(ctx, index)
+	if err != nil {
+		return err
+	}
+	return r.reindexSQLite(ctx, records)
+}
+
+// prepareIndex загружает индекс коллекций с корнем root и перестраивает по
+// нему SQLite индекс (если включен).
+//
+// Перед возвратом читаются все узлы MST и записей: если какого-то блока не
+// хватает, возвращается ошибка. SQLite индекс перестраивается в одной
+// транзакции, поэтому ошибка не оставляет репозиторий наполовину
+// загруженным - вызывающий код переключает индекс только после успеха.
+func (r *Repository) prepareIndex(ctx context.Context, root cid.Cid) (*indexer.Index, error) {
+	index, records, err := r.loadState(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.sqliteIndex != nil {
+		if err := r.reindexSQLite(ctx, records); err != nil {
+			return nil, fmt.Errorf("rebuild SQLite index: %w", err)
+		}
+	}
+
+	return index, nil
+}
+
+// loadState загружает индекс коллекций с корнем root и все его записи,
+// проверяя, что нужные блоки присутствуют в blockstore
+func (r *Repository) loadState(ctx context.Context, root cid.Cid) (*indexer.Index, []storedRecord, error) {
+	index := indexer.NewIndex(r.bs, root)
+	if err := index.Load(ctx); err != nil {
+		return nil, nil, fmt.Errorf("load index: %w", err)
+	}
+
+	records, err := r.collectRecords(ctx, index)
+	if err != nil {
+		return nil, nil, fmt.Errorf("state is incomplete: %w", err)
+	}
+	return index, records, nil
+}
+
+// Log возвращает историю коммитов, начиная с HEAD и двигаясь по ссылкам prev.
+// limit ограничивает количество коммитов; limit <= 0 возвращает всю историю.
+// Для репозитория без коммитов возвращается пустой список.
+//
+// Использование:
+//
+//	commits, err := repo.Log(ctx, 10)
+//	if err != nil {
+//	    return fmt.Errorf("ошибка чтения истории: %w", err)
+//	}
+//	for _, c := range commits {
+//	    fmt.Printf("%s %s\n", c.CID, c.Time.Format(time.RFC3339))
+//	}
+func (r *Repository) Log(ctx context.Context, limit int) ([]CommitInfo, error) {
+	r.mu.RLock()
+	head := r.Head
+	r.mu.RUnlock()
+
+	var log []CommitInfo
+	for next := head; next.Defined(); {
+		if limit > 0 && len(log) >= limit {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		c, err := r.loadCommit(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		log = append(log, CommitInfo{CID: next, Time: c.Time, Prev: c.Prev})
+		next = c.Prev
+	}
+
+	return log, nil
+}
+
+// ImportCAR восстанавливает репозиторий из CARv2 архива, созданного ExportCAR,
+// и возвращает CID загруженного коммита.
+//
+// Все блоки архива сохраняются в blockstore, затем корень архива загружается
+// через LoadHead. Корень должен быть узлом коммита, а все MST коллекций и
+// записи, на которые он ссылается, должны присутствовать в blockstore.
+//
+// Поврежденный или неполный архив не меняет состояние репозитория: HEAD
+// переключается только после успешной проверки. Блоки, уже сохраненные
+// до ошибки, остаются в blockstore, но недостижимы от HEAD.
+//
+// Использование:
+//
+//	file, err := os.Open("repo_backup.car")
+//	if err != nil {
+//	    return err
+//	}
+//	defer file.Close()
+//
+//	head, err := repo.ImportCAR(ctx, file)
+//	if err != nil {
+//	    return fmt.Errorf("ошибка импорта репозитория: %w", err)
+//	}
+func (r *Repository) ImportCAR(ctx context.Context, rd io.Reader) (cid.Cid, error) {
+	roots, err := r.bs.ImportCARV2(ctx, rd)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("import CAR blocks: %w", err)
+	}
+	if len(roots) != 1 {
+		return cid.Undef, fmt.Errorf("CAR must have exactly one root, got %d", len(roots))
+	}
+
+	if err := r.LoadHead(ctx, roots[0]); err != nil {
+		return cid.Undef, err
+	}
+
+	return roots[0], nil
+}
+
+// ExportCAR записывает в w CARv2 архив всего репозитория.
+//
+// Корнем архива является текущий HEAD коммит; explore-all селектор
+// включает все достижимые от него блоки: индекс коллекций, узлы MST
+// всех коллекций и узлы записей. Архив восстанавливается в другом
+// репозитории через ImportCAR.
+//
+// Экспортируется последнее зафиксированное состояние: изменения индекса,
+// не зафиксированные через Commit, в архив не попадают.
+//
+// Использование:
+//
+//	file, err := os.Create("repo_backup.car")
+//	if err != nil {
+//	    return err
+//	}
+//	defer file.Close()
+//
+//	if err := repo.ExportCAR(ctx, file); err != nil {
+//	    return fmt.Errorf("ошибка экспорта репозитория: %w", err)
+//	}
+func (r *Repository) ExportCAR(ctx context.Context, w io.Writer) error {
+	r.mu.RLock()
+	head := r.Head
+	r.mu.RUnlock()
+
+	if !head.Defined() {
+		return ErrNoCommits
+	}
+
+	return r.bs.ExportCARV2(ctx, head, blockstore.BuildSelectorNodeExploreAll(), w)
+}
+
+// storedRecord - запись коммита, загруженная для перестроения SQLite индекса
+type storedRecord struct {
+	collection string
+	entry      mst.Entry
+	data       map[string]interface{}
+}
+
+// collectRecords читает все записи индекса, проверяя, что узлы MST и записей
+// присутствуют в blockstore
+func (r *Repository) collectRecords(ctx context.Context, index *indexer.Index) ([]storedRecord, error) {
+	var records []storedRecord
+
+	for _, collection := range index.Collections() {
+		entries, err := index.ListCollection(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("list collection %s: %w", collection, err)
+		}
+		for _, e := range entries {
+			node, err := r.bs.GetNode(ctx, e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("load record %s/%s: %w", collection, e.Key, err)
+			}
+			data, err := extractDataFromNode(node)
+			if err != nil {
+				return nil, fmt.Errorf("extract record %s/%s: %w", collection, e.Key, err)
+			}
+			records = append(records, storedRecord{collection: collection, entry: e, data: data})
+		}
+	}
+
+	return records, nil
+}
+
+// reindexSQLite перестраивает SQLite индекс по записям, собранным collectRecords
+func (r *Repository) reindexSQLite(ctx context.Context, records []storedRecord) error {
+	return reindexRecords(ctx, r.sqliteIndex, records)
+}
+
+// reindexRecords перестраивает индекс idx по записям, собранным collectRecords
+func reindexRecords(ctx context.Context, idx *sqliteindexer.SimpleSQLiteIndexer, records []storedRecord) error {
+	now := time.Now()
+	return idx.Reindex(ctx, func(yield func(cid.Cid, sqliteindexer.IndexMetadata) bool) {
+		for _, rec := range records {
+			metadata := sqliteindexer.IndexMetadata{
+				Collection: rec.collection,
+				RKey:       rec.entry.Key,
+				RecordType: inferRecordType(rec.collection, rec.data),
+				Data:       rec.data,
+				SearchText: generateSearchText(rec.data),
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			if !yield(rec.entry.Value, metadata) {
+				return
+			}
+		}
+	})
+}
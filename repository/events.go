@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ipfs/go-cid"
+)
+
+// eventBufferSize - размер буфера канала подписчика. Событие, не
+// поместившееся в буфер, пропускается, чтобы медленный подписчик
+// не блокировал запись в репозиторий.
+const eventBufferSize = 64
+
+// RepoOp - вид изменения репозитория в RepoEvent
+type RepoOp string
+
+const (
+	OpPut    RepoOp = "put"    // Запись создана или заменена
+	OpDelete RepoOp = "delete" // Запись удалена
+	OpCommit RepoOp = "commit" // Создан коммит
+)
+
+// RepoEvent описывает изменение репозитория.
+//
+// Для OpPut и OpDelete заполнены Collection и RKey, а CID - это CID узла
+// записи (новой для OpPut, удаленной для OpDelete). Для OpCommit
+// Collection и RKey пустые, а CID - это CID нового коммита (HEAD).
+type RepoEvent struct {
+	Op         RepoOp
+	Collection string
+	RKey       string
+	CID        cid.Cid
+}
+
+// subscriptions - реестр подписчиков на события репозитория
+type subscriptions struct {
+	mu   sync.Mutex
+	subs map[chan RepoEvent]*subscription
+}
+
+// subscription - состояние подписчика
+type subscription struct {
+	// overflowed выставляется, когда событие пропущено из-за заполненного
+	// буфера; подписчик сбрасывает метку и восстанавливает состояние целиком
+	overflowed atomic.Bool
+}
+
+// Subscribe подписывает на изменения репозитория: PutRecord, DeleteRecord,
+// RepoBatch.Commit и коммиты (Commit, в том числе неявные после PutRecord
+// и Revert). События приходят в порядке изменений.
+//
+// Доставка неблокирующая: канал буферизован, и при переполнении буфера
+// новые события пропускаются, поэтому медленный подписчик не задерживает
+// запись, но может потерять события. Возвращаемая функция отменяет
+// подписку и закрывает канал; повторный вызов безопасен. Close
+// репозитория закрывает каналы всех подписчиков.
+//
+// Использование:
+//
+//	events, unsubscribe := repo.Subscribe()
+//	defer unsubscribe()
+//	for ev := range events {
+//	    if ev.Op == repository.OpPut {
+//	        cache.Invalidate(ev.Collection, ev.RKey)
+//	    }
+//	}
+func (r *Repository) Subscribe() (<-chan RepoEvent, func()) {
+	ch, _, unsubscribe := r.subscribe()
+	return ch, unsubscribe
+}
+
+// subscribe подписывает на события как Subscribe и дополнительно
+// возвращает метку пропуска событий подписчика
+func (r *Repository) subscribe() (<-chan RepoEvent, *atomic.Bool, func()) {
+	ch := make(chan RepoEvent, eventBufferSize)
+	sub := &subscription{}
+
+	r.events.mu.Lock()
+	if r.events.subs == nil {
+		r.events.subs = make(map[chan RepoEvent]*subscription)
+	}
+	r.events.subs[ch] = sub
+	r.events.mu.Unlock()
+
+	unsubscribe := func() {
+		r.events.mu.Lock()
+		defer r.events.mu.Unlock()
+		// Канал мог быть уже закрыт отпиской или Close репозитория
+		if _, ok := r.events.subs[ch]; ok {
+			delete(r.events.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, &sub.overflowed, unsubscribe
+}
+
+// publish рассылает событие подписчикам без блокировки
+func (r *Repository) publish(events ...RepoEvent) {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	for ch, sub := range r.events.subs {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+				// Буфер подписчика заполнен - пропускаем событие
+				sub.overflowed.Store(true)
+			}
+		}
+	}
+}
+
+// closeSubscriptions закрывает каналы всех подписчиков
+func (r *Repository) closeSubscriptions() {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	for ch := range r.events.subs {
+		close(ch)
+	}
+	r.events.subs = nil
+}
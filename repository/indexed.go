@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"ues/sqliteindexer"
+)
+
+// IndexedRepository - репозиторий с подключенным внешним SQLite индексером,
+// который обновляется автоматически по событиям изменений (см. Subscribe).
+// Избавляет от ручной двойной записи: записи, сохраненные через
+// репозиторий, становятся доступны для поиска в индексере без явных
+// вызовов IndexRecord/DeleteRecord.
+type IndexedRepository struct {
+	*Repository
+
+	indexer     *sqliteindexer.SimpleSQLiteIndexer
+	unsubscribe func()
+	done        chan struct{} // Закрывается при завершении обработки событий
+}
+
+// NewIndexedRepository подключает индексер idx к репозиторию repo.
+//
+// При подключении индексер перестраивается по текущему состоянию
+// репозитория (Reindex), затем обновляется в фоне по событиям: для каждой
+// измененной записи индексируется ее текущее состояние в репозитории
+// (метаданные строятся так же, как во встроенном SQLite индексе: Data -
+// поля записи, SearchText - текст строковых полей), а удаленные записи
+// удаляются из индексера. Индексер обновляется асинхронно, вскоре после
+// возврата из PutRecord, DeleteRecord и RepoBatch.Commit.
+//
+// Коммит без изменений записей (например, после Revert) заменяет состояние
+// целиком, поэтому индексер перестраивается заново. Если индексер не успевает
+// за изменениями и буфер событий переполняется (например, пакет из сотен
+// записей), пропущенные события не теряются: индексер перестраивается по
+// текущему состоянию. Checkout, LoadHead и DeleteCollection событий не
+// создают - после них вызовите Resync. Ошибки фоновой
+// индексации, как и ошибки встроенного SQLite индекса, выводятся
+// предупреждением и не влияют на репозиторий.
+//
+// Параметры:
+//   - ctx: контекст начального заполнения индексера
+//   - repo: репозиторий - источник записей
+//   - idx: индексер для автоматического обновления (содержимое заменяется)
+//
+// Возвращает:
+//   - *IndexedRepository: репозиторий с подключенным индексером
+//   - error: ошибка начального заполнения индексера
+//
+// Пример использования:
+//
+//	indexed, err := repository.NewIndexedRepository(ctx, repo, idx)
+//	if err != nil {
+//	    return err
+//	}
+//	defer indexed.Detach()
+//	indexed.PutRecord(ctx, "posts", "post1", node)
+//	results, err := idx.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts"})
+func NewIndexedRepository(ctx context.Context, repo *Repository, idx *sqliteindexer.SimpleSQLiteIndexer) (*IndexedRepository, error) {
+	// Подписываемся до заполнения: изменения, сделанные во время
+	// заполнения, будут применены из очереди событий
+	events, overflowed, unsubscribe := repo.subscribe()
+
+	ir := &IndexedRepository{
+		Repository:  repo,
+		indexer:     idx,
+		unsubscribe: unsubscribe,
+		done:        make(chan struct{}),
+	}
+	if err := ir.Resync(ctx); err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("backfill indexer: %w", err)
+	}
+
+	go ir.run(events, overflowed)
+	return ir, nil
+}
+
+// Indexer возвращает подключенный индексер
+func (ir *IndexedRepository) Indexer() *sqliteindexer.SimpleSQLiteIndexer {
+	return ir.indexer
+}
+
+// Resync перестраивает индексер по текущему состоянию репозитория
+func (ir *IndexedRepository) Resync(ctx context.Context) error {
+	ir.mu.RLock()
+	index := ir.index
+	ir.mu.RUnlock()
+
+	records, err := ir.collectRecords(ctx, index)
+	if err != nil {
+		return err
+	}
+	return reindexRecords(ctx, ir.indexer, records)
+}
+
+// Detach отключает индексер от репозитория и дожидается обработки
+// полученных событий. Ни репозиторий, ни индексер не закрываются;
+// повторный вызов безопасен.
+func (ir *IndexedRepository) Detach() {
+	ir.unsubscribe()
+	<-ir.done
+}
+
+// run обрабатывает события репозитория до отписки или закрытия репозитория.
+//
+// Событие пропускается только при заполненном буфере, поэтому после пропуска
+// в канале остаются события, и метка overflowed будет замечена при обработке
+// следующего из них. Изменение пропущенного события к этому моменту уже
+// применено к репозиторию, и Resync его учитывает.
+func (ir *IndexedRepository) run(events <-chan RepoEvent, overflowed *atomic.Bool) {
+	defer close(ir.done)
+
+	ctx := context.Background()
+	changed := false // Были ли события записей после последнего коммита
+	for ev := range events {
+		if overflowed.Swap(false) {
+			if err := ir.Resync(ctx); err != nil {
+				fmt.Printf("Warning: indexer resync after dropped events failed: %v\n", err)
+			}
+			changed = false
+			continue
+		}
+
+		var err error
+		switch ev.Op {
+		case OpPut, OpDelete:
+			changed = true
+			err = ir.syncRecord(ctx, ev)
+		case OpCommit:
+			if !changed {
+				err = ir.Resync(ctx)
+			}
+			changed = false
+		}
+		if err != nil {
+			fmt.Printf("Warning: indexer update failed for %s %s/%s: %v\n", ev.Op, ev.Collection, ev.RKey, err)
+		}
+	}
+}
+
+// syncRecord приводит запись события в индексере к ее текущему состоянию
+// в репозитории. Событие могло устареть, пока ждало в очереди, поэтому
+// индексируется актуальная версия записи, а не CID из события.
+func (ir *IndexedRepository) syncRecord(ctx context.Context, ev RepoEvent) error {
+	c, found, err := ir.GetRecordCID(ctx, ev.Collection, ev.RKey)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ir.indexer.DeleteRecordByKey(ctx, ev.Collection, ev.RKey)
+	}
+
+	node, err := ir.bs.GetNode(ctx, c)
+	if err != nil {
+		return fmt.Errorf("load record: %w", err)
+	}
+	data, err := extractDataFromNode(node)
+	if err != nil {
+		return fmt.Errorf("extract record: %w", err)
+	}
+
+	now := time.Now()
+	return ir.indexer.IndexRecord(ctx, c, sqliteindexer.IndexMetadata{
+		Collection: ev.Collection,
+		RKey:       ev.RKey,
+		RecordType: inferRecordType(ev.Collection, data),
+		Data:       data,
+		SearchText: generateSearchText(data),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ues/mst"
+
+	"github.com/ipfs/go-cid"
+)
+
+// MoveRecord переносит запись коллекции с ключа oldKey на ключ newKey.
+//
+// Узел записи не сохраняется заново: в MST коллекции удаляется запись
+// oldKey и добавляется newKey с тем же CID, после чего оба изменения
+// фиксируются одним коммитом, поэтому запись ни в какой момент не видна
+// под обоими ключами или ни под одним. Существующая запись newKey
+// перезаписывается, как при PutRecord. Перенос на тот же ключ ничего
+// не меняет.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//   - collection: имя коллекции
+//   - oldKey: текущий ключ записи
+//   - newKey: новый ключ записи
+//
+// Возвращает:
+//   - bool: true, если запись перенесена; false, если oldKey не существует
+//   - error: ошибка, если коллекция не найдена или обновление не удалось;
+//     indexer.ErrRootConflict, если коллекцию конкурентно изменила другая операция
+//
+// Пример использования:
+//
+//	moved, err := repo.MoveRecord(ctx, "posts", "draft-1", "2024-01-hello")
+//	if err != nil {
+//	    return err
+//	}
+//	if !moved {
+//	    return fmt.Errorf("черновик не найден")
+//	}
+func (r *Repository) MoveRecord(ctx context.Context, collection, oldKey, newKey string) (bool, error) {
+	root, ok := r.index.CollectionRoot(collection)
+	if !ok {
+		return false, fmt.Errorf("collection not found: %s", collection)
+	}
+
+	tree := mst.NewTree(r.bs)
+	if err := tree.Load(ctx, root); err != nil {
+		return false, fmt.Errorf("load collection %s: %w", collection, err)
+	}
+	value, found, err := tree.Get(ctx, oldKey)
+	if err != nil {
+		return false, fmt.Errorf("lookup %s/%s: %w", collection, oldKey, err)
+	}
+	if !found {
+		return false, nil
+	}
+	if oldKey == newKey {
+		return true, nil
+	}
+
+	if _, _, err := tree.Delete(ctx, oldKey); err != nil {
+		return false, fmt.Errorf("update collection %s: %w", collection, err)
+	}
+	if _, err := tree.Put(ctx, newKey, value); err != nil {
+		return false, fmt.Errorf("update collection %s: %w", collection, err)
+	}
+
+	head, err := r.commitRoots(ctx,
+		map[string]cid.Cid{collection: tree.Root()},
+		map[string]cid.Cid{collection: root})
+	if err != nil {
+		return false, err
+	}
+
+	// === Индексирование в SQLite (если включено) ===
+	// Запись newKey, если она была, заменяется при индексировании
+	if r.sqliteIndex != nil {
+		if err := r.sqliteIndex.DeleteRecordByKey(ctx, collection, oldKey); err != nil {
+			fmt.Printf("Warning: SQLite deletion failed for %s/%s: %v\n", collection, oldKey, err)
+		}
+		if node, err := r.bs.GetNode(ctx, value); err != nil {
+			fmt.Printf("Warning: SQLite indexing failed for %s/%s: %v\n", collection, newKey, err)
+		} else if err := r.indexRecordInSQLite(ctx, value, collection, newKey, node); err != nil {
+			fmt.Printf("Warning: SQLite indexing failed for %s/%s: %v\n", collection, newKey, err)
+		}
+	}
+
+	r.publish(
+		RepoEvent{Op: OpDelete, Collection: collection, RKey: oldKey, CID: value},
+		RepoEvent{Op: OpPut, Collection: collection, RKey: newKey, CID: value},
+		RepoEvent{Op: OpCommit, CID: head},
+	)
+	return true, r.saveHead(ctx)
+}
+
+// CopyOptions задает параметры CopyRecordWithOptions.
+type CopyOptions struct {
+	// CreateCollection создает отсутствующую коллекцию назначения.
+	// Без него копирование в отсутствующую коллекцию завершается ошибкой.
+	CreateCollection bool
+}
+
+// CopyRecord копирует запись srcCollection/srcKey в dstCollection/dstKey,
+// создавая отсутствующую коллекцию назначения. Подробности - в
+// CopyRecordWithOptions.
+//
+// Пример использования:
+//
+//	// Архивирование поста
+//	c, err := repo.CopyRecord(ctx, "posts", "post1", "archive", "2024/post1")
+func (r *Repository) CopyRecord(ctx context.Context, srcCollection, srcKey, dstCollection, dstKey string) (cid.Cid, error) {
+	return r.CopyRecordWithOptions(ctx, srcCollection, srcKey, dstCollection, dstKey, CopyOptions{CreateCollection: true})
+}
+
+// CopyRecordWithOptions копирует запись srcCollection/srcKey в
+// dstCollection/dstKey.
+//
+// Узел записи не сериализуется заново: в MST коллекции назначения
+// добавляется ссылка на тот же CID, поэтому содержимое хранится один раз.
+// Отсутствующая коллекция назначения создается только с
+// opts.CreateCollection; существующая запись dstKey перезаписывается,
+// как при PutRecord. Если включены лексиконы, запись проверяется схемой
+// коллекции назначения. Копия фиксируется коммитом.
+//
+// SQLite индекс хранит записи по паре (коллекция, ключ), поэтому после
+// копирования поиск находит и исходную запись, и копию.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//   - srcCollection: коллекция исходной записи
+//   - srcKey: ключ исходной записи
+//   - dstCollection: коллекция назначения
+//   - dstKey: ключ записи в коллекции назначения
+//   - opts: параметры копирования
+//
+// Возвращает:
+//   - cid.Cid: CID узла записи, общий для источника и копии
+//   - error: ошибка, если исходная запись не найдена, коллекция назначения
+//     отсутствует без opts.CreateCollection или обновление не удалось
+//
+// Пример использования:
+//
+//	// Копирование только в уже созданный архив
+//	c, err := repo.CopyRecordWithOptions(ctx, "posts", "post1", "archive", "2024/post1", repository.CopyOptions{})
+func (r *Repository) CopyRecordWithOptions(ctx context.Context, srcCollection, srcKey, dstCollection, dstKey string, opts CopyOptions) (cid.Cid, error) {
+	value, found, err := r.index.Get(ctx, srcCollection, srcKey)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !found {
+		return cid.Undef, fmt.Errorf("record not found: %s/%s", srcCollection, srcKey)
+	}
+	node, err := r.bs.GetNode(ctx, value)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("load record %s/%s: %w", srcCollection, srcKey, err)
+	}
+
+	if r.lexicon != nil {
+		if err := r.validateRecordWithLexicon(ctx, dstCollection, node); err != nil {
+			return cid.Undef, fmt.Errorf("lexicon validation failed for %s/%s: %w", dstCollection, dstKey, err)
+		}
+	}
+
+	if !r.index.HasCollection(dstCollection) {
+		if !opts.CreateCollection {
+			return cid.Undef, fmt.Errorf("collection not found: %s", dstCollection)
+		}
+		if _, err := r.index.CreateCollection(ctx, dstCollection); err != nil {
+			return cid.Undef, fmt.Errorf("create collection %s: %w", dstCollection, err)
+		}
+	}
+	if _, err := r.index.Put(ctx, dstCollection, dstKey, value); err != nil {
+		return cid.Undef, err
+	}
+	r.publish(RepoEvent{Op: OpPut, Collection: dstCollection, RKey: dstKey, CID: value})
+
+	// === Индексирование копии в SQLite (если включено) ===
+	if r.sqliteIndex != nil {
+		if err := r.indexRecordInSQLite(ctx, value, dstCollection, dstKey, node); err != nil {
+			fmt.Printf("Warning: SQLite indexing failed for %s/%s: %v\n", dstCollection, dstKey, err)
+		}
+	}
+
+	if err := r.Commit(ctx); err != nil {
+		return cid.Undef, fmt.Errorf("commit after copy record: %w", err)
+	}
+	return value, nil
+}
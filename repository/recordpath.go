@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// GetRecordPath возвращает узел записи по IPLD пути.
+//
+// Каждый сегмент path - это ключ карты или индекс списка ("0", "1", ...).
+// Блок записи загружается и декодируется целиком, после чего путь
+// проходится по узлу в памяти: метод избавляет вызывающий код от обхода,
+// но не от чтения записи. Если на пути встречается ссылка, связанный блок
+// загружается из blockstore и обход продолжается в нем; блоки вне пути
+// не читаются. Ссылка в конце пути возвращается как есть. Пустой путь
+// возвращает запись целиком.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//   - collection: имя коллекции
+//   - rkey: ключ записи
+//   - path: сегменты пути внутри записи
+//
+// Возвращает:
+//   - datamodel.Node: узел по пути
+//   - bool: false, если запись или путь не существуют (нет ключа карты,
+//     индекс вне списка или сегмент применен к скалярному значению)
+//   - error: ошибка поиска записи или загрузки блоков
+//
+// Пример использования:
+//
+//	// {"author": {"name": "alice"}, "tags": ["go", "ipld"]}
+//	name, found, err := repo.GetRecordPath(ctx, "posts", "post1", []string{"author", "name"})
+//	tag, found, err := repo.GetRecordPath(ctx, "posts", "post1", []string{"tags", "1"})
+func (r *Repository) GetRecordPath(ctx context.Context, collection, rkey string, path []string) (datamodel.Node, bool, error) {
+	node, found, err := r.GetRecord(ctx, collection, rkey)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	for i, segment := range path {
+		// Ссылка на пути - продолжаем обход в связанном блоке
+		if node.Kind() == datamodel.Kind_Link {
+			if node, err = r.resolvePathLink(ctx, node); err != nil {
+				return nil, false, fmt.Errorf("path %v: %w", path[:i], err)
+			}
+		}
+
+		var next datamodel.Node
+		switch node.Kind() {
+		case datamodel.Kind_Map:
+			next, err = node.LookupByString(segment)
+		case datamodel.Kind_List:
+			index, convErr := strconv.ParseInt(segment, 10, 64)
+			if convErr != nil || index < 0 || index >= node.Length() {
+				return nil, false, nil
+			}
+			next, err = node.LookupByIndex(index)
+		default:
+			return nil, false, nil // Скаляр не содержит вложенных значений
+		}
+		if err != nil {
+			if errors.As(err, new(datamodel.ErrNotExists)) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("path %v: %w", path[:i+1], err)
+		}
+		node = next
+	}
+	return node, true, nil
+}
+
+// resolvePathLink загружает блок, на который указывает узел-ссылка
+func (r *Repository) resolvePathLink(ctx context.Context, node datamodel.Node) (datamodel.Node, error) {
+	link, err := node.AsLink()
+	if err != nil {
+		return nil, err
+	}
+	cl, ok := link.(cidlink.Link)
+	if !ok {
+		return nil, fmt.Errorf("unsupported link type %T", link)
+	}
+	return r.bs.GetNode(ctx, cl.Cid)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"ues/blockstore"
 	"ues/datastore"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	badger4 "github.com/ipfs/go-ds-badger4"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	"github.com/ipld/go-ipld-prime/datamodel"
 )
 
@@ -39,11 +42,35 @@ type Repository struct {
 	lexicon     *lexicon.Registry                  // Реестр лексиконов для валидации схем
 	headStorage headstorage.HeadStorage            // Persistent storage для HEAD состояния
 	headstorage.RepositoryState
-	mu sync.RWMutex
+	mu     sync.RWMutex
+	events subscriptions // Подписчики на изменения (см. Subscribe)
+
+	lexiconPath    string      // Директория схем лексиконов
+	lexiconMu      sync.Mutex  // Сериализует загрузку лексиконов
+	lexiconsLoaded atomic.Bool // Схемы загружены, валидация включена (см. LoadLexicons)
+
+	maxRecordSize atomic.Int64 // Лимит размера записи в DAG-CBOR, 0 - без лимита (см. SetMaxRecordSize)
+}
+
+// DefaultMaxRecordSize - лимит размера записи в DAG-CBOR по умолчанию (1 МиБ).
+const DefaultMaxRecordSize = 1 << 20
+
+// RecordTooLargeError возвращается, если сериализованная запись превышает
+// лимит размера репозитория (см. SetMaxRecordSize).
+type RecordTooLargeError struct {
+	Size  int // Размер записи в DAG-CBOR, байт
+	Limit int // Действующий лимит, байт
+}
+
+func (e *RecordTooLargeError) Error() string {
+	return fmt.Sprintf("record size %d bytes exceeds limit of %d bytes", e.Size, e.Limit)
 }
 
 // NewWithFullFeatures создает репозиторий с поддержкой SQLite индексирования и лексиконов
 //
+// Схемы из lexiconPath при открытии не читаются: валидация по лексиконам
+// включается вызовом LoadLexicons (или первым PutTypedRecord/ValidateRecord).
+//
 // Параметры:
 //   - bs: блочное хранилище для сохранения IPLD данных
 //   - sqliteDBPath: путь к файлу SQLite базы данных для индексирования
@@ -69,27 +96,171 @@ func NewRepository(dataPath, sqliteDBPath, lexiconPath, repoID string) (*Reposit
 		return nil, fmt.Errorf("failed to load head state: %w", err)
 	}
 
-	index := indexer.NewIndex(bs, state.Head)
+	index, err := loadIndex(ctx, bs, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
 
 	sqliteIndex, err := sqliteindexer.NewSimpleSQLiteIndexer(sqliteDBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SQLite indexer: %w", err)
 	}
 
-	lex := lexicon.NewRegistry(lexiconPath)
-
-	return &Repository{
+	// Схемы не загружаются при открытии: валидация включается только
+	// по запросу (см. LoadLexicons), и ошибка в схеме не мешает открыть
+	// репозиторий
+	repo := &Repository{
 		bs:              bs,
 		index:           index,
 		sqliteIndex:     sqliteIndex,
-		lexicon:         lex,
+		lexicon:         lexicon.NewRegistry(lexiconPath),
 		headStorage:     hStorage,
 		RepositoryState: state,
-	}, nil
+		lexiconPath:     lexiconPath,
+	}
+	repo.maxRecordSize.Store(DefaultMaxRecordSize)
+	return repo, nil
 }
 
-// Commit сохраняет текущее состояние репозитория в headStorage.
+// SetMaxRecordSize задает лимит размера записи в DAG-CBOR (в байтах).
+// Лимит проверяют PutRecord, PutTypedRecord, пакеты и ValidateRecord;
+// запись большего размера отклоняется с *RecordTooLargeError до сохранения
+// в blockstore. Значение 0 или меньше снимает ограничение. По умолчанию
+// действует DefaultMaxRecordSize.
+func (r *Repository) SetMaxRecordSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	r.maxRecordSize.Store(int64(n))
+}
+
+// checkRecordSize сериализует узел в DAG-CBOR и сверяет размер с лимитом
+func (r *Repository) checkRecordSize(node datamodel.Node) error {
+	var size byteCounter
+	if err := dagcbor.Encode(node, &size); err != nil {
+		return fmt.Errorf("encode record: %w", err)
+	}
+	if limit := int(r.maxRecordSize.Load()); limit > 0 && int(size) > limit {
+		return &RecordTooLargeError{Size: int(size), Limit: limit}
+	}
+	return nil
+}
+
+// byteCounter - io.Writer, подсчитывающий записанные байты
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// LoadLexicons загружает схемы из директории лексиконов и включает валидацию.
+//
+// Репозиторий не загружает схемы при открытии: пока LoadLexicons не вызван,
+// PutRecord, пакеты и перемещение записей не проверяют записи по схемам
+// коллекций. PutTypedRecord и ValidateRecord, явно запрашивающие проверку,
+// вызывают LoadLexicons сами при первом обращении. После успешной загрузки
+// записи коллекций, для которых есть схема, проверяются во всех операциях.
+//
+// Отсутствие директории не является ошибкой: валидация включается без схем.
+// Ошибка в любой схеме возвращается вызывающему (с путем к файлу), а
+// валидация остается выключенной, поэтому после исправления файла загрузку
+// можно повторить. Повторный вызов после успешной загрузки ничего не делает;
+// для перечитывания измененных схем используйте lexicon.Registry.ReloadSchemas.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//
+// Возвращает:
+//   - error: ошибка чтения или разбора схем
+//
+// Пример использования:
+//
+//	repo, err := repository.NewRepository(dataPath, dbPath, lexiconPath, "main")
+//	if err != nil {
+//	    return err
+//	}
+//	if err := repo.LoadLexicons(ctx); err != nil {
+//	    return fmt.Errorf("невалидные схемы: %w", err)
+//	}
+func (r *Repository) LoadLexicons(ctx context.Context) error {
+	r.lexiconMu.Lock()
+	defer r.lexiconMu.Unlock()
+
+	if r.lexiconsLoaded.Load() {
+		return nil
+	}
+	if _, err := os.Stat(r.lexiconPath); err == nil {
+		if err := r.lexicon.LoadSchemas(ctx); err != nil {
+			return fmt.Errorf("failed to load lexicons: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load lexicons: %w", err)
+	}
+
+	r.lexiconsLoaded.Store(true)
+	return nil
+}
+
+// loadIndex восстанавливает индекс коллекций из сохраненного состояния HEAD.
+// Корень индекса берется из HEAD коммита; состояния, сохраненные до появления
+// узлов коммитов, содержат только RootIndex.
+func loadIndex(ctx context.Context, bs blockstore.Blockstore, state headstorage.RepositoryState) (*indexer.Index, error) {
+	root := state.RootIndex
+	if state.Head.Defined() {
+		n, err := bs.GetNode(ctx, state.Head)
+		if err != nil {
+			return nil, fmt.Errorf("load commit %s: %w", state.Head, err)
+		}
+		c, err := parseCommitNode(n)
+		if err != nil {
+			return nil, err
+		}
+		root = c.Index
+	}
+
+	index := indexer.NewIndex(bs, root)
+	if err := index.Load(ctx); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Commit фиксирует текущее состояние индекса новым узлом коммита и сохраняет
+// HEAD в headStorage. Узел коммита ссылается на корень индекса коллекций,
+// поэтому от HEAD достижимо все состояние репозитория (см. ExportCAR),
+// и на предыдущий HEAD, образуя историю (см. Log).
 func (r *Repository) Commit(ctx context.Context) error {
+	r.mu.Lock()
+	err := r.commitLocked(ctx)
+	head := r.Head
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	r.publish(RepoEvent{Op: OpCommit, CID: head})
+	return r.saveHead(ctx)
+}
+
+// commitLocked создает узел коммита и переключает на него HEAD;
+// вызывается под r.mu
+func (r *Repository) commitLocked(ctx context.Context) error {
+	node, err := buildCommitNode(commit{Index: r.index.Root(), Prev: r.Head, Time: time.Now()})
+	if err != nil {
+		return fmt.Errorf("build commit node: %w", err)
+	}
+	head, err := r.bs.PutNode(ctx, node)
+	if err != nil {
+		return fmt.Errorf("store commit node: %w", err)
+	}
+	r.Prev = r.Head
+	r.Head = head
+	return nil
+}
+
+// saveHead сохраняет текущее состояние HEAD в headStorage
+func (r *Repository) saveHead(ctx context.Context) error {
 	if r.headStorage == nil {
 		return nil // Если storage не настроен, просто пропускаем
 	}
@@ -137,6 +308,10 @@ func (r *Repository) PutRecord(ctx context.Context, collection, rkey string, nod
 		}
 	}
 
+	if err := r.checkRecordSize(node); err != nil {
+		return cid.Undef, fmt.Errorf("record %s/%s: %w", collection, rkey, err)
+	}
+
 	// === Сохранение узла записи в blockstore ===
 	// Сериализуем IPLD узел и сохраняем его в блочном хранилище
 	// blockstore автоматически вычисляет CID на основе содержимого узла
@@ -156,6 +331,7 @@ func (r *Repository) PutRecord(ctx context.Context, collection, rkey string, nod
 		// возвращаем ошибку. Узел уже сохранен в blockstore, но не проиндексирован
 		return cid.Undef, err
 	}
+	r.publish(RepoEvent{Op: OpPut, Collection: collection, RKey: rkey, CID: valueCID})
 
 	// === Индексирование записи в SQLite (если включено) ===
 	if r.sqliteIndex != nil {
@@ -175,6 +351,120 @@ func (r *Repository) PutRecord(ctx context.Context, collection, rkey string, nod
 	return valueCID, nil
 }
 
+// PutTypedRecord валидирует данные против схемы лексикона и сохраняет их
+// как запись коллекции.
+// В отличие от PutRecord, лексикон задается явно и должен быть
+// зарегистрирован: запись без схемы или не прошедшая валидацию отклоняется
+// с ошибкой схемы до сохранения чего-либо в blockstore. При первом вызове
+// загружает схемы лексиконов (см. LoadLexicons).
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: имя коллекции для сохранения записи
+//   - rkey: уникальный ключ записи в рамках коллекции
+//   - lexiconID: идентификатор схемы (например, "com.example.user")
+//   - data: данные записи (строки, bool, числа, []interface{}, map[string]interface{})
+//
+// Возвращает:
+//   - cid.Cid: CID сохраненного узла записи
+//   - error: ошибка валидации, преобразования или сохранения
+//
+// Использование:
+//
+//	c, err := repo.PutTypedRecord(ctx, "users", "alice", "com.example.user", map[string]interface{}{
+//	    "name":  "Alice",
+//	    "email": "alice@example.com",
+//	})
+//	if err != nil {
+//	    return fmt.Errorf("запись не соответствует схеме: %w", err)
+//	}
+func (r *Repository) PutTypedRecord(ctx context.Context, collection, rkey string, lexiconID string, data map[string]interface{}) (cid.Cid, error) {
+	if r.lexicon == nil {
+		return cid.Undef, fmt.Errorf("lexicon registry is not configured")
+	}
+	if err := r.LoadLexicons(ctx); err != nil {
+		return cid.Undef, err
+	}
+
+	definition, err := r.lexicon.GetSchema(lexiconID)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to get lexicon %s: %w", lexiconID, err)
+	}
+	if err := validateLexiconData(r.lexicon, definition, data); err != nil {
+		return cid.Undef, fmt.Errorf("lexicon validation failed for %s/%s: %w", collection, rkey, err)
+	}
+
+	node, err := NodeFromGo(data)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("convert record %s/%s: %w", collection, rkey, err)
+	}
+
+	return r.PutRecord(ctx, collection, rkey, node)
+}
+
+// ValidateRecord выполняет проверки PutTypedRecord без сохранения записи
+// (пробный запуск для предпросмотра и подтверждения в UI).
+//
+// Проверяется, что лексикон lexiconID зарегистрирован и может использоваться
+// для новых записей, что узел соответствует его схеме и схеме коллекции
+// (как в PutRecord), что коллекция существует и что узел сериализуется
+// в DAG-CBOR не длиннее лимита размера (см. SetMaxRecordSize). Ни blockstore,
+// ни индексы не изменяются. Как и PutTypedRecord,
+// при первом вызове загружает схемы лексиконов (см. LoadLexicons).
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: коллекция, в которую предполагается сохранить запись
+//   - lexiconID: идентификатор схемы (например, "com.example.user")
+//   - node: IPLD узел записи
+//
+// Возвращает:
+//   - error: первая найденная ошибка (ошибки схемы содержат
+//     lexicon.ValidationErrors, превышение лимита - *RecordTooLargeError)
+//     или nil, если запись будет принята
+//
+// Использование:
+//
+//	if err := repo.ValidateRecord(ctx, "users", "com.example.user", node); err != nil {
+//	    showErrors(err)
+//	    return
+//	}
+//	// пользователь подтвердил - сохраняем
+//	repo.PutRecord(ctx, "users", "alice", node)
+func (r *Repository) ValidateRecord(ctx context.Context, collection, lexiconID string, node datamodel.Node) error {
+	if r.lexicon == nil {
+		return fmt.Errorf("lexicon registry is not configured")
+	}
+	if err := r.LoadLexicons(ctx); err != nil {
+		return err
+	}
+
+	definition, err := r.lexicon.GetSchema(lexiconID)
+	if err != nil {
+		return fmt.Errorf("failed to get lexicon %s: %w", lexiconID, err)
+	}
+	if err := checkLexiconStatus(definition); err != nil {
+		return fmt.Errorf("lexicon validation failed for %s: %w", collection, err)
+	}
+	if err := r.lexicon.ValidateNode(definition.ID, node); err != nil {
+		return fmt.Errorf("lexicon validation failed for %s: data validation failed: %w", collection, err)
+	}
+
+	// Схема самой коллекции проверяется и при сохранении через PutRecord
+	if inferLexiconID(collection) != definition.ID {
+		if err := r.validateRecordWithLexicon(ctx, collection, node); err != nil {
+			return fmt.Errorf("lexicon validation failed for %s: %w", collection, err)
+		}
+	}
+
+	if !r.index.HasCollection(collection) {
+		return fmt.Errorf("collection not found: %s", collection)
+	}
+
+	// Узел должен сериализоваться так же, как при сохранении в blockstore
+	return r.checkRecordSize(node)
+}
+
 // indexRecordInSQLite индексирует запись в SQLite для быстрого поиска
 func (r *Repository) indexRecordInSQLite(ctx context.Context, recordCID cid.Cid, collection, rkey string, node datamodel.Node) error {
 
@@ -220,7 +510,7 @@ func extractDataFromNode(node datamodel.Node) (map[string]interface{}, error) {
 		}
 
 		// Конвертируем значение в go типы
-		goValue, err := nodeToGoValue(value)
+		goValue, err := NodeToGo(value)
 		if err != nil {
 			continue // Пропускаем проблемные значения
 		}
@@ -231,63 +521,6 @@ func extractDataFromNode(node datamodel.Node) (map[string]interface{}, error) {
 	return result, nil
 }
 
-// nodeToGoValue конвертирует IPLD Node в Go значение
-func nodeToGoValue(node datamodel.Node) (interface{}, error) {
-
-	switch node.Kind() {
-	case datamodel.Kind_String:
-		return node.AsString()
-
-	case datamodel.Kind_Bool:
-		return node.AsBool()
-
-	case datamodel.Kind_Int:
-		return node.AsInt()
-
-	case datamodel.Kind_Float:
-		return node.AsFloat()
-
-	case datamodel.Kind_List:
-		var result []interface{}
-		iterator := node.ListIterator()
-		for !iterator.Done() {
-			_, value, err := iterator.Next()
-			if err != nil {
-				return nil, err
-			}
-			goValue, err := nodeToGoValue(value)
-			if err != nil {
-				continue
-			}
-			result = append(result, goValue)
-		}
-		return result, nil
-
-	case datamodel.Kind_Map:
-		result := make(map[string]interface{})
-		iterator := node.MapIterator()
-		for !iterator.Done() {
-			key, value, err := iterator.Next()
-			if err != nil {
-				return nil, err
-			}
-			keyStr, err := key.AsString()
-			if err != nil {
-				continue
-			}
-			goValue, err := nodeToGoValue(value)
-			if err != nil {
-				continue
-			}
-			result[keyStr] = goValue
-		}
-		return result, nil
-
-	default:
-		return fmt.Sprintf("%v", node), nil
-	}
-}
-
 // inferRecordType определяет тип записи на основе коллекции и данных
 func inferRecordType(collection string, data map[string]interface{}) string {
 
@@ -365,8 +598,13 @@ func generateSearchText(data map[string]interface{}) string {
 //   - node: IPLD узел для валидации
 //
 // Возвращает:
-//   - error: ошибка валидации или nil при успехе
+//   - error: ошибка валидации или nil при успехе (в том числе, если
+//     лексиконы еще не загружены через LoadLexicons)
 func (r *Repository) validateRecordWithLexicon(ctx context.Context, collection string, node datamodel.Node) error {
+	// Без явно загруженных лексиконов валидация выключена
+	if !r.lexiconsLoaded.Load() {
+		return nil
+	}
 
 	lexiconID := inferLexiconID(collection)
 
@@ -383,23 +621,45 @@ func (r *Repository) validateRecordWithLexicon(ctx context.Context, collection s
 		return fmt.Errorf("failed to get lexicon %s: %w", lexiconID, err)
 	}
 
-	// Проверяем статус лексикона
-	if definition.Status == lexicon.SchemaStatusArchived {
-		return fmt.Errorf("lexicon %s is archived and cannot be used", lexiconID)
+	if err := checkLexiconStatus(definition); err != nil {
+		return err
 	}
 
-	if definition.Status == lexicon.SchemaStatusDeprecated {
-		return fmt.Errorf("lexicon %s is deprecated", lexiconID)
+	// Узел проверяется напрямую, без преобразования в Go значения
+	if err := r.lexicon.ValidateNode(definition.ID, node); err != nil {
+		return fmt.Errorf("data validation failed: %w", err)
+	}
+
+	return nil
+}
+
+// validateLexiconData проверяет статус лексикона и валидирует данные против его схемы
+func validateLexiconData(registry *lexicon.Registry, definition *lexicon.LexiconDefinition, data map[string]interface{}) error {
+	if err := checkLexiconStatus(definition); err != nil {
+		return err
 	}
 
 	// Валидируем данные против лексикона
-	if err := r.lexicon.ValidateData(lexiconID, node); err != nil {
+	if err := registry.ValidateData(definition.ID, data); err != nil {
 		return fmt.Errorf("data validation failed: %w", err)
 	}
 
 	return nil
 }
 
+// checkLexiconStatus проверяет, что лексикон можно использовать для новых записей
+func checkLexiconStatus(definition *lexicon.LexiconDefinition) error {
+	if definition.Status == lexicon.SchemaStatusArchived {
+		return fmt.Errorf("lexicon %s is archived and cannot be used", definition.ID)
+	}
+
+	if definition.Status == lexicon.SchemaStatusDeprecated {
+		return fmt.Errorf("lexicon %s is deprecated", definition.ID)
+	}
+
+	return nil
+}
+
 // inferRecordType определяет тип записи на основе коллекции и данных
 func inferLexiconID(collection string) string {
 	// return fmt.Sprintf("com.example.%s.record", collection)
@@ -428,16 +688,15 @@ func inferLexiconID(collection string) string {
 // Важно: данные в blockstore остаются доступными по CID даже после удаления из индекса
 func (r *Repository) DeleteRecord(ctx context.Context, collection, rkey string) (bool, error) {
 	// Получаем CID записи перед удалением для SQLite индексирования
+	// и события удаления подписчикам
 	var recordCID cid.Cid
-	if r.sqliteIndex != nil {
-		if cid, found, err := r.index.Get(ctx, collection, rkey); err == nil && found {
-			recordCID = cid
-		}
+	if cid, found, err := r.index.Get(ctx, collection, rkey); err == nil && found {
+		recordCID = cid
 	}
 
 	// Вызываем метод Delete индекса для удаления mapping (collection, rkey) -> CID
 	// index.Delete возвращает три значения:
-	// 1. старый CID (который мы игнорируем через _)
+	// 1. новый корень индекса (который мы игнорируем через _)
 	// 2. флаг removed - был ли элемент действительно удален
 	// 3. ошибка операции
 	_, removed, err := r.index.Delete(ctx, collection, rkey)
@@ -446,10 +705,13 @@ func (r *Repository) DeleteRecord(ctx context.Context, collection, rkey string)
 		// возвращаем false и ошибку операции
 		return false, err
 	}
+	if removed {
+		r.publish(RepoEvent{Op: OpDelete, Collection: collection, RKey: rkey, CID: recordCID})
+	}
 
 	// Удаляем из SQLite индекса (если включен и запись была найдена)
 	if r.sqliteIndex != nil && removed && recordCID != cid.Undef {
-		if err := r.sqliteIndex.DeleteRecord(ctx, recordCID); err != nil {
+		if err := r.sqliteIndex.DeleteRecordByKey(ctx, collection, rkey); err != nil {
 			// Логируем ошибку SQLite удаления, но не прерываем операцию
 			fmt.Printf("Warning: SQLite deletion failed for %s/%s: %v\n", collection, rkey, err)
 		}
@@ -492,6 +754,59 @@ func (r *Repository) GetRecordCID(ctx context.Context, collection, rkey string)
 	return r.index.Get(ctx, collection, rkey)
 }
 
+// HasRecord проверяет наличие записи в коллекции.
+// Выполняет только поиск в MST (как GetRecordCID) и не загружает содержимое
+// записи из blockstore.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: имя коллекции
+//   - rkey: ключ записи
+//
+// Возвращает:
+//   - bool: true, если запись существует
+//   - error: ошибка, если коллекция не найдена или MST недоступен
+//
+// Использование:
+//
+//	exists, err := repo.HasRecord(ctx, "posts", "post123")
+//	if err != nil {
+//	    return err
+//	}
+//	if !exists {
+//	    // создать запись
+//	}
+//
+// Производительность: O(log n) где n - количество записей в коллекции
+func (r *Repository) HasRecord(ctx context.Context, collection, rkey string) (bool, error) {
+	_, found, err := r.index.Get(ctx, collection, rkey)
+	return found, err
+}
+
+// CountRecords возвращает количество записей в коллекции, не строя список
+// их CID (в отличие от ListCollection и ListRecords).
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: имя коллекции
+//
+// Возвращает:
+//   - int: количество записей (0 для пустой коллекции)
+//   - error: ошибка, если коллекция не найдена или MST недоступен
+//
+// Использование:
+//
+//	n, err := repo.CountRecords(ctx, "posts")
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("В коллекции 'posts' %d записей\n", n)
+//
+// Производительность: O(1) по корню MST (см. mst.Tree.Count)
+func (r *Repository) CountRecords(ctx context.Context, collection string) (int, error) {
+	return r.index.Count(ctx, collection)
+}
+
 // ListCollection возвращает упорядоченные записи индекса для указанной коллекции.
 // Этот метод извлекает все записи из указанной коллекции и возвращает их CID в том порядке,
 // в котором они хранятся в MST индексе (лексикографический порядок по rkey).
@@ -542,6 +857,43 @@ func (r *Repository) ListCollection(ctx context.Context, collection string) ([]c
 	return out, nil
 }
 
+// RecordRef связывает ключ записи коллекции с CID ее содержимого
+type RecordRef struct {
+	Key string  // rkey записи
+	CID cid.Cid // CID узла записи в blockstore
+}
+
+// ListCollectionWithKeys возвращает пары (rkey, CID) всех записей коллекции,
+// упорядоченные по rkey. В отличие от ListCollection, позволяет сопоставить
+// запись с ее ключом без повторного поиска в MST.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции
+//   - collection: имя коллекции
+//
+// Возвращает:
+//   - []RecordRef: ключи и CID записей (пустой срез для пустой коллекции)
+//   - error: ошибка, если коллекция не найдена или MST недоступен
+//
+// Пример использования:
+//
+//	refs, err := repo.ListCollectionWithKeys(ctx, "posts")
+//	for _, ref := range refs {
+//	    fmt.Printf("%s -> %s\n", ref.Key, ref.CID)
+//	}
+func (r *Repository) ListCollectionWithKeys(ctx context.Context, collection string) ([]RecordRef, error) {
+	entries, err := r.index.ListCollection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]RecordRef, len(entries))
+	for i, entry := range entries {
+		refs[i] = RecordRef{Key: entry.Key, CID: entry.Value}
+	}
+	return refs, nil
+}
+
 // SearchRecords выполняет поиск записей через SQLite индексер (если включен)
 // Обеспечивает быстрый поиск с поддержкой фильтров, полнотекстового поиска и сортировки.
 //
@@ -635,26 +987,45 @@ func (r *Repository) CreateCollection(ctx context.Context, name string) (cid.Cid
 //   - name: имя коллекции для удаления из репозитория
 //
 // Возвращает:
-//   - cid.Cid: CID материализованного узла индекса после удаления коллекции
+//   - int: количество записей, которые содержала коллекция
 //   - error: ошибка удаления, если коллекция не найдена или операция не удалась
 //
 // Поведение:
 // - Удаляет коллекцию из карты индекса репозитория
 // - Материализует обновленный индекс без удаленной коллекции
 // - Возвращает ошибку, если коллекция не существует
+// - После удаления коллекция отсутствует в ListCollections, GetRecord возвращает found == false
 // - Данные MST остаются в blockstore (только ссылка удаляется)
+// - Записи коллекции удаляются из SQLite индекса (если он включен)
 //
 // Использование:
 //
-//	rootCID, err := repo.DeleteCollection(ctx, "posts")
+//	removed, err := repo.DeleteCollection(ctx, "posts")
 //	if err != nil {
 //	    // обработка ошибки (например, коллекция не найдена)
 //	}
+//	fmt.Printf("удалено записей: %d\n", removed)
 //	// коллекция "posts" больше недоступна в репозитории
 //
 // Важно: для полного удаления данных может потребоваться сборка мусора blockstore
-func (r *Repository) DeleteCollection(ctx context.Context, name string) (cid.Cid, error) {
-	return r.index.DeleteCollection(ctx, name)
+func (r *Repository) DeleteCollection(ctx context.Context, name string) (int, error) {
+	count, err := r.index.Count(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.index.DeleteCollection(ctx, name); err != nil {
+		return 0, err
+	}
+
+	// Удаляем записи коллекции из SQLite индекса (если включен)
+	if r.sqliteIndex != nil {
+		if _, err := r.sqliteIndex.DeleteCollection(ctx, name); err != nil {
+			// Логируем ошибку SQLite удаления, но не прерываем операцию
+			fmt.Printf("Warning: SQLite deletion failed for collection %s: %v\n", name, err)
+		}
+	}
+
+	return count, nil
 }
 
 // HasCollection проверяет существование коллекции в репозитории.
@@ -953,6 +1324,60 @@ func (r *Repository) InclusionPath(ctx context.Context, collection, rkey string)
 	return r.index.InclusionPath(ctx, collection, rkey)
 }
 
+// GetRecordWithProof возвращает запись вместе с доказательством ее включения
+// в MST коллекции (mst.Proof) и корнем коллекции, относительно которого
+// построено доказательство. Корень читается один раз, поэтому запись,
+// доказательство и корень согласованы, даже если коллекцию конкурентно
+// изменили, и клиент может проверить запись без доверия к серверу:
+//
+//	node, proof, root, err := repo.GetRecordWithProof(ctx, "posts", "post123")
+//	if err != nil {
+//	    return err
+//	}
+//	ok, err := mst.VerifyProof(root, "post123", proof.Value, proof)
+//
+// CID узла записи (proof.Value) клиент может пересчитать из node, а корень
+// коллекции - сверить с узлом индекса опубликованного коммита.
+//
+// Параметры:
+//   - ctx: контекст для отмены операции и передачи значений
+//   - collection: имя коллекции
+//   - rkey: ключ записи
+//
+// Возвращает:
+//   - datamodel.Node: узел записи или nil, если запись отсутствует
+//   - *mst.Proof: доказательство включения, а для отсутствующей записи -
+//     доказательство отсутствия (proof.Found == false)
+//   - cid.Cid: корень коллекции, относительно которого построено доказательство
+//   - error: ошибка, если коллекция не найдена или узлы недоступны
+func (r *Repository) GetRecordWithProof(ctx context.Context, collection, rkey string) (datamodel.Node, *mst.Proof, cid.Cid, error) {
+	r.mu.RLock()
+	root, ok := r.index.CollectionRoot(collection)
+	r.mu.RUnlock()
+	if !ok {
+		return nil, nil, cid.Undef, fmt.Errorf("collection not found: %s", collection)
+	}
+
+	// Доказательство и запись читаются из одного снимка корня коллекции
+	tree := mst.NewTree(r.bs)
+	if err := tree.Load(ctx, root); err != nil {
+		return nil, nil, cid.Undef, fmt.Errorf("load collection %s: %w", collection, err)
+	}
+	proof, err := tree.Prove(ctx, rkey)
+	if err != nil {
+		return nil, nil, cid.Undef, fmt.Errorf("prove %s/%s: %w", collection, rkey, err)
+	}
+	if !proof.Found {
+		return nil, proof, root, nil
+	}
+
+	node, err := r.bs.GetNode(ctx, proof.Value)
+	if err != nil {
+		return nil, nil, cid.Undef, fmt.Errorf("load record %s/%s: %w", collection, rkey, err)
+	}
+	return node, proof, root, nil
+}
+
 // ExportCollectionCAR записывает CARv2 для MST коллекции, используя explore-all селектор.
 // Этот метод экспортирует полное содержимое коллекции в формате CAR (Content Addressable aRchive),
 // включая все узлы MST и связанные данные. CAR файл может использоваться для резервного
@@ -1060,6 +1485,9 @@ func (r *Repository) ExportCollectionCAR(ctx context.Context, collection string,
 func (r *Repository) Close() error {
 	var firstErr error
 
+	// Закрываем каналы подписчиков на изменения
+	r.closeSubscriptions()
+
 	// Закрываем SQLite индексер, если он был инициализирован
 	if r.sqliteIndex != nil {
 		if err := r.sqliteIndex.Close(); err != nil && firstErr == nil {
@@ -0,0 +1,1714 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"ues/blockstore"
+	"ues/indexer"
+	"ues/lexicon"
+	"ues/mst"
+	"ues/sqliteindexer"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ========================================
+// ТЕСТЫ ЭКСПОРТА РЕПОЗИТОРИЯ
+// ========================================
+
+// TestExportCAR проверяет, что архив полного экспорта восстанавливает
+// все коллекции и записи в другом репозитории.
+func TestExportCAR(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("пустой репозиторий", func(t *testing.T) {
+		repo := createTestRepository(t)
+
+		var buf bytes.Buffer
+		assert.ErrorIs(t, repo.ExportCAR(ctx, &buf), ErrNoCommits)
+	})
+
+	t.Run("восстановление из архива", func(t *testing.T) {
+		src := createTestRepository(t)
+
+		records := map[string]map[string]string{
+			"posts": {"p1": "первый пост", "p2": "второй пост", "p3": "третий пост"},
+			"users": {"alice": "Alice", "bob": "Bob"},
+		}
+		want := make(map[string]map[string]cid.Cid)
+		for collection, items := range records {
+			_, err := src.CreateCollection(ctx, collection)
+			require.NoError(t, err)
+			want[collection] = make(map[string]cid.Cid)
+			for rkey, text := range items {
+				c, err := src.PutRecord(ctx, collection, rkey, makeRecord(t, text))
+				require.NoError(t, err)
+				want[collection][rkey] = c
+			}
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, src.ExportCAR(ctx, &buf))
+
+		dst := createTestRepository(t)
+		head, err := dst.ImportCAR(ctx, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, src.Head, head)
+
+		assert.Equal(t, src.Head, dst.Head)
+		assert.ElementsMatch(t, src.ListCollections(), dst.ListCollections())
+		for collection, items := range want {
+			for rkey, c := range items {
+				got, found, err := dst.GetRecordCID(ctx, collection, rkey)
+				require.NoError(t, err)
+				require.True(t, found, "%s/%s", collection, rkey)
+				assert.Equal(t, c, got)
+
+				node, found, err := dst.GetRecord(ctx, collection, rkey)
+				require.NoError(t, err)
+				require.True(t, found)
+				text, err := node.LookupByString("text")
+				require.NoError(t, err)
+				s, err := text.AsString()
+				require.NoError(t, err)
+				assert.Equal(t, records[collection][rkey], s)
+			}
+		}
+	})
+}
+
+// TestImportCAR проверяет, что поврежденный или неполный архив
+// не меняет состояние репозитория.
+func TestImportCAR(t *testing.T) {
+	ctx := context.Background()
+
+	src := createTestRepository(t)
+	_, err := src.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	for _, rkey := range []string{"p1", "p2", "p3"} {
+		_, err := src.PutRecord(ctx, "posts", rkey, makeRecord(t, "пост "+rkey))
+		require.NoError(t, err)
+	}
+
+	var full bytes.Buffer
+	require.NoError(t, src.ExportCAR(ctx, &full))
+
+	// assertUnchanged проверяет, что неудачный импорт не тронул репозиторий
+	assertUnchanged := func(t *testing.T, repo *Repository, head cid.Cid) {
+		t.Helper()
+		assert.Equal(t, head, repo.Head)
+		assert.Equal(t, []string{"local"}, repo.ListCollections())
+		_, found, err := repo.GetRecordCID(ctx, "local", "l1")
+		require.NoError(t, err)
+		assert.True(t, found)
+	}
+
+	// newTarget создает репозиторий с собственным состоянием
+	newTarget := func(t *testing.T) (*Repository, cid.Cid) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "local")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "local", "l1", makeRecord(t, "локальная запись"))
+		require.NoError(t, err)
+		return repo, repo.Head
+	}
+
+	t.Run("обрезанный архив", func(t *testing.T) {
+		dst, head := newTarget(t)
+
+		data := full.Bytes()
+		_, err := dst.ImportCAR(ctx, bytes.NewReader(data[:len(data)/2]))
+		require.Error(t, err)
+		assertUnchanged(t, dst, head)
+	})
+
+	t.Run("корень не является коммитом", func(t *testing.T) {
+		dst, head := newTarget(t)
+
+		var buf bytes.Buffer
+		require.NoError(t, src.ExportCollectionCAR(ctx, "posts", &buf))
+
+		_, err := dst.ImportCAR(ctx, &buf)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "commit")
+		assertUnchanged(t, dst, head)
+	})
+
+	t.Run("архив без блоков MST", func(t *testing.T) {
+		dst, head := newTarget(t)
+
+		// Архив только с узлом коммита
+		var buf bytes.Buffer
+		require.NoError(t, src.bs.ExportCARV2(ctx, src.Head, selectorparse.CommonSelector_MatchPoint, &buf))
+
+		_, err := dst.ImportCAR(ctx, &buf)
+		require.Error(t, err)
+		assertUnchanged(t, dst, head)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ЧТЕНИЯ ЗАПИСЕЙ
+// ========================================
+
+// TestHasRecord проверяет проверку наличия записи без ее загрузки.
+func TestHasRecord(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "пост"))
+	require.NoError(t, err)
+
+	exists, err := repo.HasRecord(ctx, "posts", "p1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = repo.HasRecord(ctx, "posts", "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = repo.HasRecord(ctx, "unknown", "p1")
+	assert.Error(t, err)
+}
+
+// TestCountRecords проверяет подсчет записей в пустой и заполненной коллекции.
+func TestCountRecords(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	_, err := repo.CreateCollection(ctx, "empty")
+	require.NoError(t, err)
+	_, err = repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	for i := 0; i < 25; i++ {
+		_, err := repo.PutRecord(ctx, "posts", fmt.Sprintf("p%02d", i), makeRecord(t, "пост"))
+		require.NoError(t, err)
+	}
+	_, err = repo.DeleteRecord(ctx, "posts", "p00")
+	require.NoError(t, err)
+
+	n, err := repo.CountRecords(ctx, "empty")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = repo.CountRecords(ctx, "posts")
+	require.NoError(t, err)
+	assert.Equal(t, 24, n)
+
+	_, err = repo.CountRecords(ctx, "unknown")
+	assert.Error(t, err)
+}
+
+// TestListCollectionWithKeys проверяет, что ключи и CID записей
+// соответствуют сохраненным и упорядочены по ключу.
+func TestListCollectionWithKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+
+	refs, err := repo.ListCollectionWithKeys(ctx, "posts")
+	require.NoError(t, err)
+	assert.NotNil(t, refs)
+	assert.Empty(t, refs)
+
+	put := map[string]cid.Cid{}
+	for _, key := range []string{"c", "a", "b"} {
+		c, err := repo.PutRecord(ctx, "posts", key, makeRecord(t, "пост "+key))
+		require.NoError(t, err)
+		put[key] = c
+	}
+
+	refs, err = repo.ListCollectionWithKeys(ctx, "posts")
+	require.NoError(t, err)
+	require.Len(t, refs, 3)
+	var keys []string
+	for _, ref := range refs {
+		keys = append(keys, ref.Key)
+		assert.Equal(t, put[ref.Key], ref.CID, "CID записи %s", ref.Key)
+
+		c, found, err := repo.GetRecordCID(ctx, "posts", ref.Key)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, c, ref.CID)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	// Порядок совпадает с ListCollection
+	cids, err := repo.ListCollection(ctx, "posts")
+	require.NoError(t, err)
+	for i, ref := range refs {
+		assert.Equal(t, cids[i], ref.CID)
+	}
+
+	_, err = repo.ListCollectionWithKeys(ctx, "unknown")
+	assert.Error(t, err)
+}
+
+// TestDeleteCollection проверяет удаление коллекции с подсчетом записей.
+func TestDeleteCollection(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	for _, collection := range []string{"posts", "users", "empty"} {
+		_, err := repo.CreateCollection(ctx, collection)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := repo.PutRecord(ctx, "posts", fmt.Sprintf("p%d", i), makeRecord(t, "пост"))
+		require.NoError(t, err)
+	}
+	_, err := repo.PutRecord(ctx, "users", "alice", makeRecord(t, "Alice"))
+	require.NoError(t, err)
+
+	n, err := repo.DeleteCollection(ctx, "posts")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.ElementsMatch(t, []string{"users", "empty"}, repo.ListCollections())
+	assert.False(t, repo.HasCollection("posts"))
+	_, found, err := repo.GetRecord(ctx, "posts", "p0")
+	assert.False(t, found)
+	assert.ErrorContains(t, err, "collection not found")
+
+	results, err := repo.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Остальные коллекции не затронуты
+	exists, err := repo.HasRecord(ctx, "users", "alice")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	n, err = repo.DeleteCollection(ctx, "empty")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = repo.DeleteCollection(ctx, "posts")
+	assert.ErrorContains(t, err, "collection not found")
+}
+
+// TestGetRecordWithProof проверяет доказательства включения и отсутствия
+// записи относительно корня коллекции.
+func TestGetRecordWithProof(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err := repo.PutRecord(ctx, "posts", fmt.Sprintf("p%02d", i), makeRecord(t, fmt.Sprintf("пост %d", i)))
+		require.NoError(t, err)
+	}
+	t.Run("включение", func(t *testing.T) {
+		node, proof, root, err := repo.GetRecordWithProof(ctx, "posts", "p07")
+		require.NoError(t, err)
+		require.NotNil(t, node)
+		require.True(t, proof.Found)
+
+		current, ok := repo.CollectionRoot("posts")
+		require.True(t, ok)
+		assert.Equal(t, current, root)
+
+		text, err := node.LookupByString("text")
+		require.NoError(t, err)
+		s, err := text.AsString()
+		require.NoError(t, err)
+		assert.Equal(t, "пост 7", s)
+
+		c, _, err := repo.GetRecordCID(ctx, "posts", "p07")
+		require.NoError(t, err)
+		assert.Equal(t, c, proof.Value)
+
+		valid, err := mst.VerifyProof(root, "p07", c, proof)
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		// Доказательство не подтверждает другое значение или другой корень
+		other, _, err := repo.GetRecordCID(ctx, "posts", "p08")
+		require.NoError(t, err)
+		valid, err = mst.VerifyProof(root, "p07", other, proof)
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		_, err = repo.PutRecord(ctx, "posts", "p07", makeRecord(t, "изменен"))
+		require.NoError(t, err)
+		newRoot, _ := repo.CollectionRoot("posts")
+		valid, err = mst.VerifyProof(newRoot, "p07", c, proof)
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		// Новое доказательство возвращается вместе с новым корнем
+		_, proof, root, err = repo.GetRecordWithProof(ctx, "posts", "p07")
+		require.NoError(t, err)
+		assert.Equal(t, newRoot, root)
+		valid, err = mst.VerifyProof(root, "p07", proof.Value, proof)
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("отсутствие", func(t *testing.T) {
+		node, proof, root, err := repo.GetRecordWithProof(ctx, "posts", "missing")
+		require.NoError(t, err)
+		assert.Nil(t, node)
+		assert.False(t, proof.Found)
+
+		valid, err := mst.VerifyProof(root, "missing", cid.Undef, proof)
+		require.NoError(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("отсутствующая коллекция", func(t *testing.T) {
+		_, _, root, err := repo.GetRecordWithProof(ctx, "unknown", "p01")
+		assert.Equal(t, cid.Undef, root)
+		assert.ErrorContains(t, err, "collection not found")
+	})
+}
+
+// TestGetRecordPath проверяет получение вложенных значений записи по пути,
+// в том числе через ссылку на отдельный блок, и отсутствующие пути.
+func TestGetRecordPath(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	// Часть записи хранится отдельным блоком и подключена ссылкой
+	profile, err := NodeFromGo(map[string]interface{}{"bio": "пишу на Go"})
+	require.NoError(t, err)
+	profileCID, err := repo.bs.PutNode(ctx, profile)
+	require.NoError(t, err)
+
+	record, err := NodeFromGo(map[string]interface{}{
+		"text": "привет",
+		"author": map[string]interface{}{
+			"name":    "alice",
+			"profile": profileCID,
+		},
+		"tags": []string{"go", "ipld"},
+	})
+	require.NoError(t, err)
+	_, err = repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	_, err = repo.PutRecord(ctx, "posts", "post1", record)
+	require.NoError(t, err)
+
+	getString := func(path ...string) string {
+		t.Helper()
+		node, found, err := repo.GetRecordPath(ctx, "posts", "post1", path)
+		require.NoError(t, err)
+		require.True(t, found, "путь %v", path)
+		s, err := node.AsString()
+		require.NoError(t, err)
+		return s
+	}
+
+	assert.Equal(t, "привет", getString("text"))
+	assert.Equal(t, "alice", getString("author", "name"))
+	assert.Equal(t, "ipld", getString("tags", "1"))
+	assert.Equal(t, "пишу на Go", getString("author", "profile", "bio"), "обход продолжается по ссылке")
+
+	// Ссылка в конце пути и пустой путь возвращаются как есть
+	node, found, err := repo.GetRecordPath(ctx, "posts", "post1", []string{"author", "profile"})
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, datamodel.Kind_Link, node.Kind())
+	node, found, err = repo.GetRecordPath(ctx, "posts", "post1", nil)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(3), node.Length())
+
+	for _, path := range [][]string{
+		{"missing"},
+		{"author", "email"},
+		{"tags", "2"},
+		{"tags", "-1"},
+		{"tags", "first"},
+		{"text", "nested"},
+		{"author", "profile", "missing"},
+	} {
+		node, found, err := repo.GetRecordPath(ctx, "posts", "post1", path)
+		require.NoError(t, err, "путь %v", path)
+		assert.False(t, found, "путь %v", path)
+		assert.Nil(t, node)
+	}
+
+	_, found, err = repo.GetRecordPath(ctx, "posts", "missing", []string{"text"})
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// TestPutTypedRecord проверяет валидацию записей против лексикона.
+func TestPutTypedRecord(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepositoryWithLexicons(t, map[string]string{
+		"user.yaml": userLexicon,
+	})
+	_, err := repo.CreateCollection(ctx, "users")
+	require.NoError(t, err)
+
+	t.Run("валидная запись", func(t *testing.T) {
+		c, err := repo.PutTypedRecord(ctx, "users", "alice", "com.example.user", map[string]interface{}{
+			"name":  "Alice",
+			"email": "alice@example.com",
+			"age":   30,
+		})
+		require.NoError(t, err)
+
+		got, found, err := repo.GetRecordCID(ctx, "users", "alice")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, c, got)
+
+		node, _, err := repo.GetRecord(ctx, "users", "alice")
+		require.NoError(t, err)
+		data, err := extractDataFromNode(node)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name":  "Alice",
+			"email": "alice@example.com",
+			"age":   int64(30),
+		}, data)
+	})
+
+	t.Run("невалидная запись", func(t *testing.T) {
+		for name, data := range map[string]map[string]interface{}{
+			"нет обязательного поля": {"name": "Bob"},
+			"неверный тип поля":      {"name": "Bob", "email": "bob@example.com", "age": "тридцать"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := repo.PutTypedRecord(ctx, "users", "bob", "com.example.user", data)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "validation failed")
+
+				exists, err := repo.HasRecord(ctx, "users", "bob")
+				require.NoError(t, err)
+				assert.False(t, exists)
+			})
+		}
+	})
+
+	t.Run("неизвестный лексикон", func(t *testing.T) {
+		_, err := repo.PutTypedRecord(ctx, "users", "carol", "com.example.unknown", map[string]interface{}{"name": "Carol"})
+		assert.Error(t, err)
+	})
+
+	t.Run("узел в коллекции лексикона", func(t *testing.T) {
+		_, err := repo.CreateCollection(ctx, "com.example.user")
+		require.NoError(t, err)
+
+		node, err := qp.BuildMap(basicnode.Prototype.Any, -1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Dave"))
+			qp.MapEntry(ma, "email", qp.String("dave@example.com"))
+			qp.MapEntry(ma, "age", qp.Float(30))
+		})
+		require.NoError(t, err)
+
+		// Float не принимается для поля Int
+		_, err = repo.PutRecord(ctx, "com.example.user", "dave", node)
+		var verrs lexicon.ValidationErrors
+		require.ErrorAs(t, err, &verrs)
+		assert.Equal(t, lexicon.ValidationErrors{{Path: "age", Expected: "int", Got: "float"}}, verrs)
+	})
+}
+
+// TestValidateRecord проверяет, что пробная валидация выполняет проверки
+// PutTypedRecord и не записывает блоки.
+func TestValidateRecord(t *testing.T) {
+	ctx := context.Background()
+
+	repo := createTestRepositoryWithLexicons(t, map[string]string{"user.yaml": userLexicon})
+	_, err := repo.CreateCollection(ctx, "users")
+	require.NoError(t, err)
+
+	// countBlocks возвращает количество блоков в blockstore
+	countBlocks := func(t *testing.T) int {
+		t.Helper()
+		keys, err := repo.bs.AllKeysChan(ctx)
+		require.NoError(t, err)
+		n := 0
+		for range keys {
+			n++
+		}
+		return n
+	}
+
+	user := func(t *testing.T, age datamodel.Node) datamodel.Node {
+		t.Helper()
+		node, err := qp.BuildMap(basicnode.Prototype.Any, -1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "name", qp.String("Alice"))
+			qp.MapEntry(ma, "email", qp.String("alice@example.com"))
+			qp.MapEntry(ma, "age", qp.Node(age))
+		})
+		require.NoError(t, err)
+		return node
+	}
+
+	t.Run("валидная запись", func(t *testing.T) {
+		blocks, head := countBlocks(t), repo.Head
+
+		require.NoError(t, repo.ValidateRecord(ctx, "users", "com.example.user", user(t, basicnode.NewInt(30))))
+
+		assert.Equal(t, blocks, countBlocks(t), "блоки не записываются")
+		assert.Equal(t, head, repo.Head)
+		n, err := repo.CountRecords(ctx, "users")
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("запись с ошибкой схемы", func(t *testing.T) {
+		blocks, head := countBlocks(t), repo.Head
+
+		err := repo.ValidateRecord(ctx, "users", "com.example.user", user(t, basicnode.NewFloat(30.5)))
+		var verrs lexicon.ValidationErrors
+		require.ErrorAs(t, err, &verrs)
+		assert.Equal(t, lexicon.ValidationErrors{{Path: "age", Expected: "int", Got: "float"}}, verrs)
+
+		assert.Equal(t, blocks, countBlocks(t), "блоки не записываются")
+		assert.Equal(t, head, repo.Head)
+	})
+
+	t.Run("запись больше лимита", func(t *testing.T) {
+		node := user(t, basicnode.NewInt(30))
+		require.NoError(t, repo.ValidateRecord(ctx, "users", "com.example.user", node))
+
+		repo.SetMaxRecordSize(32)
+		t.Cleanup(func() { repo.SetMaxRecordSize(DefaultMaxRecordSize) })
+		blocks, head := countBlocks(t), repo.Head
+
+		err := repo.ValidateRecord(ctx, "users", "com.example.user", node)
+		var tooLarge *RecordTooLargeError
+		require.ErrorAs(t, err, &tooLarge)
+		assert.Equal(t, 32, tooLarge.Limit)
+		assert.Greater(t, tooLarge.Size, 32)
+
+		// PutTypedRecord применяет тот же лимит
+		_, err = repo.PutTypedRecord(ctx, "users", "alice", "com.example.user", map[string]interface{}{
+			"name": "Alice", "email": "alice@example.com", "age": 30,
+		})
+		assert.ErrorAs(t, err, &tooLarge)
+
+		assert.Equal(t, blocks, countBlocks(t), "блоки не записываются")
+		assert.Equal(t, head, repo.Head)
+	})
+
+	t.Run("неизвестные лексикон и коллекция", func(t *testing.T) {
+		err := repo.ValidateRecord(ctx, "users", "com.example.missing", user(t, basicnode.NewInt(30)))
+		assert.ErrorContains(t, err, "failed to get lexicon")
+
+		err = repo.ValidateRecord(ctx, "missing", "com.example.user", user(t, basicnode.NewInt(30)))
+		assert.ErrorContains(t, err, "collection not found")
+	})
+}
+
+// TestLoadLexicons проверяет, что схемы загружаются только по запросу
+// и ошибка в схеме не мешает открыть репозиторий.
+func TestLoadLexicons(t *testing.T) {
+	ctx := context.Background()
+
+	// Запись с Float в поле Int не проходит схему com.example.user
+	invalidUser := func(t *testing.T) datamodel.Node {
+		node, err := NodeFromJSON([]byte(`{"name": "Dave", "email": "dave@example.com", "age": 30.5}`))
+		require.NoError(t, err)
+		return node
+	}
+
+	t.Run("валидация включается по запросу", func(t *testing.T) {
+		repo := createTestRepositoryWithLexicons(t, map[string]string{"user.yaml": userLexicon})
+		_, err := repo.CreateCollection(ctx, "com.example.user")
+		require.NoError(t, err)
+
+		// До загрузки схем записи не проверяются
+		_, err = repo.PutRecord(ctx, "com.example.user", "before", invalidUser(t))
+		require.NoError(t, err)
+
+		require.NoError(t, repo.LoadLexicons(ctx))
+		require.NoError(t, repo.LoadLexicons(ctx), "повторный вызов не является ошибкой")
+		_, err = repo.PutRecord(ctx, "com.example.user", "after", invalidUser(t))
+		var verrs lexicon.ValidationErrors
+		assert.ErrorAs(t, err, &verrs)
+	})
+
+	t.Run("ошибка в схеме", func(t *testing.T) {
+		repo := createTestRepositoryWithLexicons(t, map[string]string{
+			"user.yaml":   userLexicon,
+			"broken.yaml": "id: [не строка",
+		})
+		_, err := repo.CreateCollection(ctx, "com.example.user")
+		require.NoError(t, err)
+
+		// Репозиторий открыт и работает без валидации
+		_, err = repo.PutRecord(ctx, "com.example.user", "dave", invalidUser(t))
+		require.NoError(t, err)
+
+		err = repo.LoadLexicons(ctx)
+		assert.ErrorContains(t, err, "broken.yaml")
+		_, err = repo.PutTypedRecord(ctx, "com.example.user", "eve", "com.example.user", map[string]interface{}{"name": "Eve"})
+		assert.ErrorContains(t, err, "failed to load lexicons")
+	})
+
+	t.Run("без директории лексиконов", func(t *testing.T) {
+		repo := createTestRepository(t)
+		require.NoError(t, repo.LoadLexicons(ctx))
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПАКЕТНЫХ ИЗМЕНЕНИЙ
+// ========================================
+
+// TestBatch проверяет, что изменения пакета становятся видимы только
+// после Commit и применяются одним коммитом.
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *Repository {
+		repo := createTestRepository(t)
+		for _, collection := range []string{"posts", "users"} {
+			_, err := repo.CreateCollection(ctx, collection)
+			require.NoError(t, err)
+		}
+		_, err := repo.PutRecord(ctx, "posts", "old", makeRecord(t, "старый пост"))
+		require.NoError(t, err)
+		return repo
+	}
+
+	t.Run("атомарная видимость", func(t *testing.T) {
+		repo := setup(t)
+		head := repo.Head
+
+		batch := repo.Batch()
+		batch.Put("posts", "p1", makeRecord(t, "первый"))
+		batch.Put("posts", "p2", makeRecord(t, "черновик"))
+		batch.Put("posts", "p2", makeRecord(t, "второй"))
+		batch.Put("users", "alice", makeRecord(t, "Alice"))
+		batch.Delete("posts", "old")
+		batch.Delete("users", "missing")
+		assert.Equal(t, 6, batch.Len())
+
+		// До Commit репозиторий не меняется
+		exists, err := repo.HasRecord(ctx, "posts", "p1")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = repo.HasRecord(ctx, "posts", "old")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, head, repo.Head)
+
+		require.NoError(t, batch.Commit(ctx))
+		assert.Equal(t, 0, batch.Len())
+
+		// Один коммит поверх прежнего HEAD
+		assert.Equal(t, head, repo.Prev)
+
+		for _, rec := range []struct{ collection, rkey, text string }{
+			{"posts", "p1", "первый"},
+			{"posts", "p2", "второй"},
+			{"users", "alice", "Alice"},
+		} {
+			node, found, err := repo.GetRecord(ctx, rec.collection, rec.rkey)
+			require.NoError(t, err)
+			require.True(t, found, "%s/%s", rec.collection, rec.rkey)
+			text, err := node.LookupByString("text")
+			require.NoError(t, err)
+			s, err := text.AsString()
+			require.NoError(t, err)
+			assert.Equal(t, rec.text, s)
+		}
+		exists, err = repo.HasRecord(ctx, "posts", "old")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		n, err := repo.CountRecords(ctx, "posts")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("ошибка не оставляет изменений", func(t *testing.T) {
+		repo := setup(t)
+		head := repo.Head
+
+		batch := repo.Batch()
+		batch.Put("posts", "p1", makeRecord(t, "первый"))
+		batch.Put("unknown", "x", makeRecord(t, "x"))
+		require.Error(t, batch.Commit(ctx))
+
+		assert.Equal(t, head, repo.Head)
+		exists, err := repo.HasRecord(ctx, "posts", "p1")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.Equal(t, 2, batch.Len(), "операции сохраняются для повторной попытки")
+	})
+}
+
+// TestCommitRootsConflict проверяет, что пакетное изменение, построенное
+// по устаревшему корню коллекции, не затирает конкурентные записи.
+func TestCommitRootsConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+
+	t.Run("устаревший корень", func(t *testing.T) {
+		old, ok := repo.CollectionRoot("posts")
+		require.True(t, ok)
+		tree := mst.NewTree(repo.bs)
+		require.NoError(t, tree.Load(ctx, old))
+		value, err := repo.bs.PutNode(ctx, makeRecord(t, "из пакета"))
+		require.NoError(t, err)
+		_, err = tree.Put(ctx, "batch", value)
+		require.NoError(t, err)
+
+		// Между чтением корня и заменой коллекцию меняет PutRecord
+		_, err = repo.PutRecord(ctx, "posts", "concurrent", makeRecord(t, "конкурент"))
+		require.NoError(t, err)
+
+		_, err = repo.commitRoots(ctx,
+			map[string]cid.Cid{"posts": tree.Root()},
+			map[string]cid.Cid{"posts": old})
+		require.ErrorIs(t, err, indexer.ErrRootConflict)
+
+		_, found, err := repo.GetRecordCID(ctx, "posts", "concurrent")
+		require.NoError(t, err)
+		assert.True(t, found, "конкурентная запись не потеряна")
+		_, found, err = repo.GetRecordCID(ctx, "posts", "batch")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("параллельные пакеты и записи", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(2)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 10; i++ {
+					_, err := repo.PutRecord(ctx, "posts", fmt.Sprintf("single-%d-%d", w, i), makeRecord(t, "одиночная"))
+					assert.NoError(t, err)
+				}
+			}(w)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					batch := repo.Batch()
+					for j := 0; j < 3; j++ {
+						batch.Put("posts", fmt.Sprintf("batch-%d-%d-%d", w, i, j), makeRecord(t, "пакетная"))
+					}
+					// Конфликт - штатный исход: пакет сохраняется и повторяется
+					for {
+						err := batch.Commit(ctx)
+						if !errors.Is(err, indexer.ErrRootConflict) {
+							assert.NoError(t, err)
+							break
+						}
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		count, err := repo.CountRecords(ctx, "posts")
+		require.NoError(t, err)
+		assert.Equal(t, 1+4*10+4*5*3, count)
+	})
+}
+
+// TestMoveRecord проверяет перенос записи на новый ключ одним коммитом
+// без повторного сохранения узла.
+func TestMoveRecord(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *Repository {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "draft", makeRecord(t, "черновик"))
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "other", makeRecord(t, "другой"))
+		require.NoError(t, err)
+		return repo
+	}
+
+	t.Run("перенос в коллекции", func(t *testing.T) {
+		repo := setup(t)
+		value, _, err := repo.GetRecordCID(ctx, "posts", "draft")
+		require.NoError(t, err)
+		head := repo.Head
+
+		moved, err := repo.MoveRecord(ctx, "posts", "draft", "published")
+		require.NoError(t, err)
+		assert.True(t, moved)
+		assert.Equal(t, head, repo.Prev, "перенос - один коммит")
+
+		exists, err := repo.HasRecord(ctx, "posts", "draft")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		c, found, err := repo.GetRecordCID(ctx, "posts", "published")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, value, c, "CID узла записи переиспользуется")
+
+		n, err := repo.CountRecords(ctx, "posts")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		results, err := repo.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts", FullTextQuery: "черновик"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "published", results[0].RKey)
+	})
+
+	t.Run("перенос на существующий ключ перезаписывает", func(t *testing.T) {
+		repo := setup(t)
+		value, _, err := repo.GetRecordCID(ctx, "posts", "draft")
+		require.NoError(t, err)
+
+		moved, err := repo.MoveRecord(ctx, "posts", "draft", "other")
+		require.NoError(t, err)
+		assert.True(t, moved)
+
+		c, found, err := repo.GetRecordCID(ctx, "posts", "other")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, value, c)
+		n, err := repo.CountRecords(ctx, "posts")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		results, err := repo.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "other", results[0].RKey)
+		assert.Equal(t, "черновик", results[0].Data["text"])
+	})
+
+	t.Run("отсутствующий ключ", func(t *testing.T) {
+		repo := setup(t)
+		head := repo.Head
+
+		moved, err := repo.MoveRecord(ctx, "posts", "missing", "new")
+		require.NoError(t, err)
+		assert.False(t, moved)
+		assert.Equal(t, head, repo.Head, "коммит не создается")
+
+		_, err = repo.MoveRecord(ctx, "unknown", "draft", "new")
+		assert.ErrorContains(t, err, "collection not found")
+	})
+}
+
+// TestCopyRecord проверяет копирование записи между коллекциями со
+// ссылкой на тот же узел.
+func TestCopyRecord(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("копия в новую коллекцию", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		src, err := repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "пост"))
+		require.NoError(t, err)
+		head := repo.Head
+
+		c, err := repo.CopyRecord(ctx, "posts", "p1", "archive", "2024/p1")
+		require.NoError(t, err)
+		assert.Equal(t, src, c)
+		assert.Equal(t, head, repo.Prev, "копия фиксируется одним коммитом")
+		assert.True(t, repo.HasCollection("archive"))
+
+		for _, rec := range []struct{ collection, rkey string }{{"posts", "p1"}, {"archive", "2024/p1"}} {
+			got, found, err := repo.GetRecordCID(ctx, rec.collection, rec.rkey)
+			require.NoError(t, err)
+			require.True(t, found, "%s/%s", rec.collection, rec.rkey)
+			assert.Equal(t, src, got)
+		}
+	})
+
+	t.Run("существующая коллекция и ключ", func(t *testing.T) {
+		repo := createTestRepository(t)
+		for _, collection := range []string{"posts", "archive"} {
+			_, err := repo.CreateCollection(ctx, collection)
+			require.NoError(t, err)
+		}
+		src, err := repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "новый"))
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "archive", "p1", makeRecord(t, "старый"))
+		require.NoError(t, err)
+
+		_, err = repo.CopyRecord(ctx, "posts", "p1", "archive", "p1")
+		require.NoError(t, err)
+		got, _, err := repo.GetRecordCID(ctx, "archive", "p1")
+		require.NoError(t, err)
+		assert.Equal(t, src, got)
+	})
+
+	t.Run("отсутствующая запись", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		head := repo.Head
+
+		_, err = repo.CopyRecord(ctx, "posts", "missing", "archive", "x")
+		assert.ErrorContains(t, err, "record not found")
+		assert.Equal(t, head, repo.Head)
+		assert.False(t, repo.HasCollection("archive"))
+	})
+
+	t.Run("без создания коллекции", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "пост"))
+		require.NoError(t, err)
+		head := repo.Head
+
+		_, err = repo.CopyRecordWithOptions(ctx, "posts", "p1", "archive", "p1", CopyOptions{})
+		assert.ErrorContains(t, err, "collection not found")
+		assert.Equal(t, head, repo.Head)
+		assert.False(t, repo.HasCollection("archive"))
+
+		_, err = repo.CreateCollection(ctx, "archive")
+		require.NoError(t, err)
+		_, err = repo.CopyRecordWithOptions(ctx, "posts", "p1", "archive", "p1", CopyOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("поиск находит источник и копию", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		src, err := repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "пост"))
+		require.NoError(t, err)
+
+		_, err = repo.CopyRecord(ctx, "posts", "p1", "archive", "2024/p1")
+		require.NoError(t, err)
+
+		search := func(collection string) []string {
+			results, err := repo.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: collection})
+			require.NoError(t, err)
+			var keys []string
+			for _, r := range results {
+				assert.Equal(t, src, r.CID)
+				keys = append(keys, r.RKey)
+			}
+			return keys
+		}
+		assert.Equal(t, []string{"p1"}, search("posts"))
+		assert.Equal(t, []string{"2024/p1"}, search("archive"))
+
+		// Удаление источника не затрагивает копию
+		_, err = repo.DeleteRecord(ctx, "posts", "p1")
+		require.NoError(t, err)
+		assert.Empty(t, search("posts"))
+		assert.Equal(t, []string{"2024/p1"}, search("archive"))
+	})
+
+	t.Run("схема коллекции назначения", func(t *testing.T) {
+		repo := createTestRepositoryWithLexicons(t, map[string]string{"user.yaml": userLexicon})
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "пост"))
+		require.NoError(t, err)
+
+		require.NoError(t, repo.LoadLexicons(ctx))
+		_, err = repo.CopyRecord(ctx, "posts", "p1", "com.example.user", "u1")
+		var verrs lexicon.ValidationErrors
+		assert.ErrorAs(t, err, &verrs)
+		assert.False(t, repo.HasCollection("com.example.user"), "проверка выполняется до создания коллекции")
+	})
+}
+
+// ========================================
+// ТЕСТЫ ИСТОРИИ КОММИТОВ
+// ========================================
+
+// TestLog проверяет порядок коммитов и ссылки на родителей.
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("пустой репозиторий", func(t *testing.T) {
+		repo := createTestRepository(t)
+
+		log, err := repo.Log(ctx, 0)
+		require.NoError(t, err)
+		assert.Empty(t, log)
+	})
+
+	t.Run("цепочка коммитов", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+
+		// Каждый PutRecord создает коммит; запоминаем HEAD после каждого
+		var heads []cid.Cid
+		for _, rkey := range []string{"p1", "p2", "p3", "p4"} {
+			_, err := repo.PutRecord(ctx, "posts", rkey, makeRecord(t, rkey))
+			require.NoError(t, err)
+			heads = append(heads, repo.Head)
+		}
+		require.NoError(t, repo.Commit(ctx))
+		heads = append(heads, repo.Head)
+
+		log, err := repo.Log(ctx, 0)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(log), len(heads))
+
+		// Новейший коммит идет первым, каждый ссылается на следующий в логе
+		for i, h := range heads {
+			assert.Equal(t, h, log[len(heads)-1-i].CID)
+		}
+		for i := 0; i < len(log)-1; i++ {
+			assert.Equal(t, log[i+1].CID, log[i].Prev)
+			assert.False(t, log[i].Time.Before(log[i+1].Time))
+		}
+		assert.False(t, log[len(log)-1].Prev.Defined(), "у первого коммита нет родителя")
+		assert.Equal(t, repo.Prev, log[0].Prev)
+
+		limited, err := repo.Log(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, log[:2], limited)
+	})
+}
+
+// TestCheckout проверяет откат к коммиту из истории.
+func TestCheckout(t *testing.T) {
+	ctx := context.Background()
+	repo := createTestRepository(t)
+
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "первый"))
+	require.NoError(t, err)
+	require.NoError(t, repo.Commit(ctx))
+	first := repo.Head
+
+	_, err = repo.PutRecord(ctx, "posts", "p2", makeRecord(t, "второй"))
+	require.NoError(t, err)
+	_, err = repo.CreateCollection(ctx, "users")
+	require.NoError(t, err)
+	require.NoError(t, repo.Commit(ctx))
+
+	require.NoError(t, repo.Checkout(ctx, first))
+
+	assert.Equal(t, first, repo.Head)
+	assert.Equal(t, []string{"posts"}, repo.ListCollections())
+	_, found, err := repo.GetRecordCID(ctx, "posts", "p1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, found, err = repo.GetRecordCID(ctx, "posts", "p2")
+	require.NoError(t, err)
+	assert.False(t, found, "запись более позднего коммита должна исчезнуть")
+
+	log, err := repo.Log(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, log[0].CID)
+}
+
+// TestRevert проверяет, что Revert отменяет последний коммит новым коммитом.
+func TestRevert(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("пустой репозиторий", func(t *testing.T) {
+		repo := createTestRepository(t)
+
+		_, err := repo.Revert(ctx)
+		assert.ErrorIs(t, err, ErrNoCommits)
+	})
+
+	t.Run("отмена последнего коммита", func(t *testing.T) {
+		repo := createTestRepository(t)
+
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "первый"))
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p2", makeRecord(t, "второй"))
+		require.NoError(t, err)
+		reverted := repo.Head
+
+		head, err := repo.Revert(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, repo.Head, head)
+		assert.Equal(t, reverted, repo.Prev, "отмененный коммит остается в истории")
+
+		_, found, err := repo.GetRecordCID(ctx, "posts", "p1")
+		require.NoError(t, err)
+		assert.True(t, found)
+		_, found, err = repo.GetRecordCID(ctx, "posts", "p2")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	// searchKeys возвращает ключи записей коллекции posts из SQLite индекса
+	searchKeys := func(t *testing.T, repo *Repository) []string {
+		results, err := repo.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		var keys []string
+		for _, r := range results {
+			keys = append(keys, r.RKey)
+		}
+		return sortedStrings(keys)
+	}
+
+	t.Run("конкурентный коммит не теряется", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "первый"))
+		require.NoError(t, err)
+
+		st, err := repo.prepareRevert(ctx)
+		require.NoError(t, err)
+
+		// Между загрузкой состояния родителя и заменой индекса - новый коммит
+		_, err = repo.PutRecord(ctx, "posts", "p2", makeRecord(t, "конкурент"))
+		require.NoError(t, err)
+		head := repo.Head
+
+		_, err = repo.commitRevert(ctx, st)
+		require.ErrorIs(t, err, ErrHeadConflict)
+
+		assert.Equal(t, head, repo.Head)
+		for _, rkey := range []string{"p1", "p2"} {
+			_, found, err := repo.GetRecordCID(ctx, "posts", rkey)
+			require.NoError(t, err)
+			assert.True(t, found, "запись %s не должна быть отменена", rkey)
+		}
+		assert.Equal(t, []string{"p1", "p2"}, searchKeys(t, repo))
+	})
+
+	t.Run("ошибка коммита не оставляет отмену", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "первый"))
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "posts", "p2", makeRecord(t, "второй"))
+		require.NoError(t, err)
+		head := repo.Head
+
+		bs := repo.bs
+		repo.bs = failingPutNodeBlockstore{Blockstore: bs, err: errors.New("диск заполнен")}
+		_, err = repo.Revert(ctx)
+		repo.bs = bs
+		require.Error(t, err)
+
+		assert.Equal(t, head, repo.Head)
+		assert.Equal(t, []string{"p1", "p2"}, searchKeys(t, repo))
+
+		// Следующий коммит не фиксирует неудавшуюся отмену
+		_, err = repo.PutRecord(ctx, "posts", "p3", makeRecord(t, "третий"))
+		require.NoError(t, err)
+		_, found, err := repo.GetRecordCID(ctx, "posts", "p2")
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []string{"p1", "p2", "p3"}, searchKeys(t, repo))
+	})
+}
+
+// failingPutNodeBlockstore - blockstore, запись узлов в который
+// завершается ошибкой err
+type failingPutNodeBlockstore struct {
+	blockstore.Blockstore
+	err error
+}
+
+// PutNode возвращает ошибку, не сохраняя узел.
+func (f failingPutNodeBlockstore) PutNode(context.Context, datamodel.Node) (cid.Cid, error) {
+	return cid.Undef, f.err
+}
+
+// ========================================
+// ТЕСТЫ КОНВЕРТАЦИИ УЗЛОВ
+// ========================================
+
+// TestNodeCodec проверяет двустороннюю конвертацию значений Go и IPLD узлов.
+func TestNodeCodec(t *testing.T) {
+	ctx := context.Background()
+
+	link, err := cid.Parse("bafyreibvjvcv745gig4mvqs4hctx4zfkono4rjejm2ta6gtyzkqxfjeily")
+	require.NoError(t, err)
+
+	// Глубоко вложенная структура со всеми поддерживаемыми видами значений
+	value := map[string]interface{}{
+		"text":  "привет",
+		"int":   int64(42),
+		"neg":   int64(-7),
+		"float": 42.5,
+		"whole": 42.0,
+		"bool":  true,
+		"null":  nil,
+		"bytes": []byte{0x00, 0xff, 0x10},
+		"link":  link,
+		"empty": map[string]interface{}{},
+		"list": []interface{}{
+			"a", int64(1), 1.5, false, nil, []byte("b"),
+			[]interface{}{},
+			[]interface{}{int64(2), []interface{}{"deep", map[string]interface{}{"x": int64(3)}}},
+		},
+		"nested": map[string]interface{}{
+			"level2": map[string]interface{}{
+				"level3": map[string]interface{}{
+					"items": []interface{}{map[string]interface{}{"id": int64(1), "score": 0.25}},
+					"flag":  nil,
+				},
+			},
+		},
+	}
+
+	t.Run("туда и обратно", func(t *testing.T) {
+		node, err := NodeFromGo(value)
+		require.NoError(t, err)
+
+		got, err := NodeToGo(node)
+		require.NoError(t, err)
+		assert.Equal(t, value, got)
+	})
+
+	t.Run("через хранилище", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "docs")
+		require.NoError(t, err)
+
+		node, err := NodeFromGo(value)
+		require.NoError(t, err)
+		c, err := repo.PutRecord(ctx, "docs", "d1", node)
+		require.NoError(t, err)
+
+		stored, found, err := repo.GetRecord(ctx, "docs", "d1")
+		require.NoError(t, err)
+		require.True(t, found)
+		got, err := NodeToGo(stored)
+		require.NoError(t, err)
+		assert.Equal(t, value, got)
+
+		// Повторная конвертация дает тот же CID
+		again, err := NodeFromGo(got)
+		require.NoError(t, err)
+		c2, err := repo.PutRecord(ctx, "docs", "d2", again)
+		require.NoError(t, err)
+		assert.Equal(t, c, c2)
+	})
+
+	t.Run("типизированные значения Go", func(t *testing.T) {
+		node, err := NodeFromGo(map[string]interface{}{
+			"int":    7,
+			"uint":   uint64(8),
+			"f32":    float32(0.5),
+			"tags":   []string{"a", "b"},
+			"counts": map[string]int{"x": 1},
+			"list":   [2]bool{true, false},
+		})
+		require.NoError(t, err)
+
+		got, err := NodeToGo(node)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"int":    int64(7),
+			"uint":   int64(8),
+			"f32":    0.5,
+			"tags":   []interface{}{"a", "b"},
+			"counts": map[string]interface{}{"x": int64(1)},
+			"list":   []interface{}{true, false},
+		}, got)
+	})
+
+	t.Run("неподдерживаемые значения", func(t *testing.T) {
+		_, err := NodeFromGo(map[string]interface{}{"nested": []interface{}{struct{}{}}})
+		assert.ErrorContains(t, err, "field nested: list item 0: unsupported value type struct {}")
+
+		_, err = NodeFromGo(uint64(math.MaxUint64))
+		assert.ErrorContains(t, err, "overflows int64")
+
+		_, err = NodeFromGo(map[int]string{1: "a"})
+		assert.ErrorContains(t, err, "unsupported map key type int")
+	})
+}
+
+// TestNodeFromJSON проверяет, что целые и дробные числа JSON сохраняют
+// свой вид при конвертации и обратно.
+func TestNodeFromJSON(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("целые и дробные числа", func(t *testing.T) {
+		node, err := NodeFromJSON([]byte(`{"likes": 42, "score": 42.5, "ratio": 42.0, "big": 1e3, "neg": -7, "list": [1, 1.5]}`))
+		require.NoError(t, err)
+
+		kinds := map[string]datamodel.Kind{
+			"likes": datamodel.Kind_Int,
+			"score": datamodel.Kind_Float,
+			"ratio": datamodel.Kind_Float,
+			"big":   datamodel.Kind_Float,
+			"neg":   datamodel.Kind_Int,
+		}
+		for field, kind := range kinds {
+			value, err := node.LookupByString(field)
+			require.NoError(t, err)
+			assert.Equal(t, kind, value.Kind(), field)
+		}
+		list, err := node.LookupByString("list")
+		require.NoError(t, err)
+		first, err := list.LookupByIndex(0)
+		require.NoError(t, err)
+		assert.Equal(t, datamodel.Kind_Int, first.Kind())
+		second, err := list.LookupByIndex(1)
+		require.NoError(t, err)
+		assert.Equal(t, datamodel.Kind_Float, second.Kind())
+
+		// Обратно целое остается целым
+		got, err := NodeToGo(node)
+		require.NoError(t, err)
+		data := got.(map[string]interface{})
+		assert.Equal(t, int64(42), data["likes"])
+		assert.Equal(t, 42.5, data["score"])
+		assert.Equal(t, float64(42), data["ratio"])
+		assert.Equal(t, []interface{}{int64(1), 1.5}, data["list"])
+	})
+
+	t.Run("json.Number в NodeFromGo", func(t *testing.T) {
+		node, err := NodeFromGo(json.Number("42"))
+		require.NoError(t, err)
+		assert.Equal(t, datamodel.Kind_Int, node.Kind())
+
+		node, err = NodeFromGo(json.Number("42.5"))
+		require.NoError(t, err)
+		assert.Equal(t, datamodel.Kind_Float, node.Kind())
+	})
+
+	t.Run("ошибки", func(t *testing.T) {
+		_, err := NodeFromJSON([]byte(`{"n": 9223372036854775808}`))
+		assert.ErrorContains(t, err, "overflows int64")
+
+		_, err = NodeFromJSON([]byte(`{"a": 1} {"b": 2}`))
+		assert.Error(t, err)
+
+		_, err = NodeFromJSON([]byte(`{"a": `))
+		assert.Error(t, err)
+	})
+
+	t.Run("целое поле проходит проверку схемы", func(t *testing.T) {
+		repo := createTestRepositoryWithLexicons(t, map[string]string{"user.yaml": userLexicon})
+		_, err := repo.CreateCollection(ctx, "com.example.user")
+		require.NoError(t, err)
+
+		node, err := NodeFromJSON([]byte(`{"name": "Dave", "email": "dave@example.com", "age": 30}`))
+		require.NoError(t, err)
+		_, err = repo.PutRecord(ctx, "com.example.user", "dave", node)
+		require.NoError(t, err)
+
+		stored, found, err := repo.GetRecord(ctx, "com.example.user", "dave")
+		require.NoError(t, err)
+		require.True(t, found)
+		age, err := stored.LookupByString("age")
+		require.NoError(t, err)
+		assert.Equal(t, datamodel.Kind_Int, age.Kind())
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПОДПИСКИ НА ИЗМЕНЕНИЯ
+// ========================================
+
+// TestSubscribe проверяет события изменений репозитория и неблокирующую
+// доставку подписчикам.
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+
+	// next читает событие из канала без бесконечного ожидания
+	next := func(t *testing.T, events <-chan RepoEvent) RepoEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "канал закрыт")
+			return ev
+		default:
+			require.FailNow(t, "нет ожидаемого события")
+			return RepoEvent{}
+		}
+	}
+
+	t.Run("события записи, удаления и коммита", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+
+		events, unsubscribe := repo.Subscribe()
+		defer unsubscribe()
+
+		c, err := repo.PutRecord(ctx, "posts", "p1", makeRecord(t, "первый"))
+		require.NoError(t, err)
+		assert.Equal(t, RepoEvent{Op: OpPut, Collection: "posts", RKey: "p1", CID: c}, next(t, events))
+		assert.Equal(t, RepoEvent{Op: OpCommit, CID: repo.Head}, next(t, events))
+
+		removed, err := repo.DeleteRecord(ctx, "posts", "p1")
+		require.NoError(t, err)
+		require.True(t, removed)
+		assert.Equal(t, RepoEvent{Op: OpDelete, Collection: "posts", RKey: "p1", CID: c}, next(t, events))
+
+		// Удаление отсутствующей записи событий не создает
+		removed, err = repo.DeleteRecord(ctx, "posts", "missing")
+		require.NoError(t, err)
+		require.False(t, removed)
+		assert.Empty(t, events)
+	})
+
+	t.Run("события пакета", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+		old, err := repo.PutRecord(ctx, "posts", "old", makeRecord(t, "старый"))
+		require.NoError(t, err)
+
+		events, unsubscribe := repo.Subscribe()
+		defer unsubscribe()
+
+		batch := repo.Batch()
+		batch.Put("posts", "p1", makeRecord(t, "первый"))
+		batch.Delete("posts", "old")
+		require.NoError(t, batch.Commit(ctx))
+
+		p1, found, err := repo.GetRecordCID(ctx, "posts", "p1")
+		require.NoError(t, err)
+		require.True(t, found)
+
+		got := []RepoEvent{next(t, events), next(t, events), next(t, events)}
+		assert.ElementsMatch(t, []RepoEvent{
+			{Op: OpDelete, Collection: "posts", RKey: "old", CID: old},
+			{Op: OpPut, Collection: "posts", RKey: "p1", CID: p1},
+		}, got[:2])
+		assert.Equal(t, RepoEvent{Op: OpCommit, CID: repo.Head}, got[2], "коммит приходит последним")
+	})
+
+	t.Run("медленный подписчик не блокирует запись", func(t *testing.T) {
+		repo := createTestRepository(t)
+		_, err := repo.CreateCollection(ctx, "posts")
+		require.NoError(t, err)
+
+		events, unsubscribe := repo.Subscribe()
+		defer unsubscribe()
+
+		// Каждая запись создает два события - буфер переполняется
+		for i := 0; i < eventBufferSize; i++ {
+			_, err := repo.PutRecord(ctx, "posts", fmt.Sprintf("p%d", i), makeRecord(t, "текст"))
+			require.NoError(t, err)
+		}
+		assert.Len(t, events, eventBufferSize)
+	})
+
+	t.Run("отписка и закрытие", func(t *testing.T) {
+		repo := createTestRepository(t)
+
+		events, unsubscribe := repo.Subscribe()
+		unsubscribe()
+		unsubscribe() // Повторная отписка безопасна
+		_, ok := <-events
+		assert.False(t, ok)
+
+		events, unsubscribe = repo.Subscribe()
+		require.NoError(t, repo.Close())
+		_, ok = <-events
+		assert.False(t, ok)
+		unsubscribe() // Отписка после Close безопасна
+	})
+}
+
+// TestIndexedRepository проверяет автоматическое обновление подключенного
+// индексера по изменениям репозитория.
+func TestIndexedRepository(t *testing.T) {
+	ctx := context.Background()
+
+	repo := createTestRepository(t)
+	_, err := repo.CreateCollection(ctx, "posts")
+	require.NoError(t, err)
+	_, err = repo.PutRecord(ctx, "posts", "existing", makeRecord(t, "до подключения"))
+	require.NoError(t, err)
+
+	idx, err := sqliteindexer.NewSimpleSQLiteIndexer(filepath.Join(t.TempDir(), "external.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { idx.Close() })
+
+	indexed, err := NewIndexedRepository(ctx, repo, idx)
+	require.NoError(t, err)
+	t.Cleanup(indexed.Detach)
+
+	// rkeys возвращает ключи записей коллекции posts в индексере
+	rkeys := func() []string {
+		results, err := idx.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		keys := make([]string, 0, len(results))
+		for _, r := range results {
+			keys = append(keys, r.RKey)
+		}
+		return keys
+	}
+	// eventually ждет, пока индексер обработает события
+	eventually := func(t *testing.T, expected ...string) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual(expected, sortedStrings(rkeys()))
+		}, 2*time.Second, 10*time.Millisecond, "ожидались записи %v, в индексере %v", expected, rkeys())
+	}
+
+	// Начальное заполнение выполняется при подключении
+	assert.Equal(t, []string{"existing"}, rkeys())
+
+	t.Run("запись и удаление", func(t *testing.T) {
+		_, err := indexed.PutRecord(ctx, "posts", "p1", makeRecord(t, "новый пост"))
+		require.NoError(t, err)
+		eventually(t, "existing", "p1")
+
+		results, err := idx.SearchRecords(ctx, sqliteindexer.SearchQuery{FullTextQuery: "новый"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "p1", results[0].RKey)
+		assert.Equal(t, "новый пост", results[0].Data["text"])
+
+		removed, err := indexed.DeleteRecord(ctx, "posts", "existing")
+		require.NoError(t, err)
+		require.True(t, removed)
+		eventually(t, "p1")
+	})
+
+	t.Run("пакет", func(t *testing.T) {
+		batch := repo.Batch()
+		batch.Put("posts", "p2", makeRecord(t, "второй"))
+		batch.Delete("posts", "p1")
+		require.NoError(t, batch.Commit(ctx))
+		eventually(t, "p2")
+	})
+
+	t.Run("отмена коммита перестраивает индексер", func(t *testing.T) {
+		// Удаление existing не было закоммичено отдельно и отменяется вместе с пакетом
+		_, err := repo.Revert(ctx)
+		require.NoError(t, err)
+		eventually(t, "existing", "p1")
+	})
+
+	t.Run("после отключения индексер не меняется", func(t *testing.T) {
+		indexed.Detach()
+		_, err := repo.PutRecord(ctx, "posts", "p3", makeRecord(t, "третий"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"existing", "p1"}, sortedStrings(rkeys()))
+	})
+}
+
+// TestIndexedRepositoryLargeBatch проверяет, что пакет больше буфера событий
+// полностью попадает в индексер: пропущенные события восполняются Resync.
+func TestIndexedRepositoryLargeBatch(t *testing.T) {
+	ctx := context.Background()
+
+	repo := createTestRepository(t)
+	_, err := repo.CreateCollection(ctx, "bulk")
+	require.NoError(t, err)
+
+	idx, err := sqliteindexer.NewSimpleSQLiteIndexer(filepath.Join(t.TempDir(), "external.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { idx.Close() })
+
+	indexed, err := NewIndexedRepository(ctx, repo, idx)
+	require.NoError(t, err)
+	t.Cleanup(indexed.Detach)
+
+	const total = 200
+	batch := repo.Batch()
+	for i := 0; i < total; i++ {
+		batch.Put("bulk", fmt.Sprintf("r%03d", i), makeRecord(t, fmt.Sprintf("запись %d", i)))
+	}
+	require.NoError(t, batch.Commit(ctx))
+
+	count := func() int {
+		results, err := idx.SearchRecords(ctx, sqliteindexer.SearchQuery{Collection: "bulk"})
+		require.NoError(t, err)
+		return len(results)
+	}
+	assert.Eventually(t, func() bool { return count() == total },
+		5*time.Second, 10*time.Millisecond, "в индексере %d записей", count())
+}
+
+// ========================================
+// ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ
+// ========================================
+
+// userLexicon - лексикон пользователя для тестов валидации
+const userLexicon = `id: com.example.user
+version: "1.0.0"
+name: User
+description: Профиль пользователя
+status: active
+schema: |
+  type User struct {
+    name String
+    email String
+    age optional Int
+  }
+`
+
+// createTestRepository создает репозиторий во временной директории
+func createTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	return createTestRepositoryWithLexicons(t, nil)
+}
+
+// createTestRepositoryWithLexicons создает репозиторий с файлами лексиконов
+// (имя файла -> содержимое YAML); при пустом lexicons директория не создается
+func createTestRepositoryWithLexicons(t *testing.T, lexicons map[string]string) *Repository {
+	t.Helper()
+	dir := t.TempDir()
+
+	if len(lexicons) > 0 {
+		lexDir := filepath.Join(dir, "lexicons")
+		require.NoError(t, os.MkdirAll(lexDir, 0o755))
+		for name, content := range lexicons {
+			require.NoError(t, os.WriteFile(filepath.Join(lexDir, name), []byte(content), 0o644))
+		}
+	}
+
+	repo, err := NewRepository(
+		filepath.Join(dir, "data"),
+		filepath.Join(dir, "index.db"),
+		filepath.Join(dir, "lexicons"),
+		"test-repo",
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+// sortedStrings возвращает отсортированную копию ss
+func sortedStrings(ss []string) []string {
+	sorted := append([]string{}, ss...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// makeRecord строит узел записи с единственным полем text
+func makeRecord(t *testing.T, text string) datamodel.Node {
+	t.Helper()
+
+	b := basicnode.Prototype.Map.NewBuilder()
+	ma, err := b.BeginMap(1)
+	require.NoError(t, err)
+	entry, err := ma.AssembleEntry("text")
+	require.NoError(t, err)
+	require.NoError(t, entry.AssignString(text))
+	require.NoError(t, ma.Finish())
+
+	return b.Build()
+}
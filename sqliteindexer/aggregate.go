@@ -0,0 +1,156 @@
+package sqliteindexer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AggregateQuery описывает запрос агрегации (GROUP BY + COUNT).
+//
+// GroupBy задает поле из Data записи так же, как поля фильтров: вложенные
+// поля указываются путем с префиксом "$." ("$.author.name"), а имя без
+// префикса адресует ключ верхнего уровня целиком, даже если содержит точку.
+// Имена "collection" и "record_type" группируют по соответствующим колонкам
+// записи, а не по данным.
+type AggregateQuery struct {
+	Collection string                 `json:"collection,omitempty"`  // Фильтр по коллекции
+	RecordType string                 `json:"record_type,omitempty"` // Фильтр по типу записи
+	GroupBy    string                 `json:"group_by"`              // Поле группировки
+	Filters    map[string]interface{} `json:"filters,omitempty"`     // Фильтры равенства по атрибутам
+	Clauses    []FilterClause         `json:"clauses,omitempty"`     // Условия сравнения по атрибутам
+	Limit      int                    `json:"limit,omitempty"`       // Максимальное количество групп (0 - без ограничения)
+}
+
+// AggregateBucket - одна группа результата агрегации.
+//
+// Value имеет тип string, int64, float64 или bool в зависимости от данных;
+// для записей без поля Value равен nil, для объектов и массивов содержит
+// их JSON представление.
+type AggregateBucket struct {
+	Value interface{} `json:"value"` // Значение поля группировки
+	Count int         `json:"count"` // Количество записей в группе
+}
+
+// Aggregate группирует записи по полю и возвращает количество записей
+// в каждой группе, упорядоченные по убыванию количества (при равенстве -
+// по значению, группа записей без поля последней).
+//
+// Используется для фасетного поиска и дашбордов: "постов на автора",
+// "записей на тип", облака тегов и т.п.
+func (idx *SimpleSQLiteIndexer) Aggregate(ctx context.Context, query AggregateQuery) ([]AggregateBucket, error) {
+	if err := idx.rlock(); err != nil {
+		return nil, err
+	}
+	defer idx.mu.RUnlock()
+
+	if query.GroupBy == "" {
+		return nil, fmt.Errorf("aggregate query requires group_by field")
+	}
+
+	// Выражения для значения и его JSON типа (чтобы восстановить bool)
+	var valueExpr, typeExpr string
+	var args []interface{}
+	switch query.GroupBy {
+	case "collection", "record_type":
+		valueExpr, typeExpr = query.GroupBy, "'text'"
+	default:
+		path, err := fieldJSONPath(query.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+		valueExpr, typeExpr = "json_extract(data, ?)", "json_type(data, ?)"
+		args = append(args, path, path)
+	}
+
+	sql := "SELECT " + valueExpr + " AS value, " + typeExpr + " AS value_type, COUNT(*) AS cnt FROM records WHERE 1=1"
+
+	if query.Collection != "" {
+		sql += " AND collection = ?"
+		args = append(args, query.Collection)
+	}
+
+	if query.RecordType != "" {
+		sql += " AND record_type = ?"
+		args = append(args, query.RecordType)
+	}
+
+	// Истекшие записи не учитываются, как и при поиске
+	expirySQL, expiryArgs := notExpiredClause("", time.Now())
+	sql += expirySQL
+	args = append(args, expiryArgs...)
+
+	filterSQL, filterArgs, err := compileFilters(SearchQuery{Filters: query.Filters, Clauses: query.Clauses}, "")
+	if err != nil {
+		return nil, err
+	}
+	sql += filterSQL
+	args = append(args, filterArgs...)
+
+	sql += " GROUP BY value, value_type ORDER BY cnt DESC, value IS NULL, value"
+
+	if query.Limit > 0 {
+		sql += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := idx.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate records: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []AggregateBucket
+	for rows.Next() {
+		var value interface{}
+		var valueType *string
+		var bucket AggregateBucket
+
+		if err := rows.Scan(&value, &valueType, &bucket.Count); err != nil {
+			return nil, err
+		}
+
+		bucket.Value = aggregateValue(value, valueType)
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// aggregateValue приводит значение json_extract к типу Go.
+// SQLite возвращает JSON true/false как целые 1/0, поэтому тип берется из json_type.
+func aggregateValue(value interface{}, valueType *string) interface{} {
+	if valueType != nil {
+		switch *valueType {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+
+	// Драйвер возвращает текст как []byte для выражений без объявленного типа
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+// jsonPath преобразует путь через точку (address.city) в путь SQLite JSON
+// ($."address"."city"). Каждый сегмент заключается в кавычки, поэтому
+// ключи с пробелами и спецсимволами адресуются буквально.
+func jsonPath(field string) (string, error) {
+	segments := strings.Split(field, ".")
+
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range segments {
+		if seg == "" || strings.ContainsAny(seg, `"\`) {
+			return "", fmt.Errorf("invalid field path: %q", field)
+		}
+		b.WriteString(`."` + seg + `"`)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,283 @@
+package sqliteindexer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchPage представляет страницу результатов поиска.
+//
+// NextCursor передается в SearchQuery.After для получения следующей страницы.
+// В отличие от Offset, курсор указывает на конкретную запись (значение ключа
+// сортировки + CID, коллекция и ключ), поэтому вставки и удаления между запросами не приводят
+// к пропуску или повтору записей.
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`               // Записи текущей страницы
+	NextCursor string         `json:"next_cursor,omitempty"` // Курсор следующей страницы (пусто, если страница последняя)
+}
+
+// ErrInvalidCursor возвращается, если курсор поврежден или создан для другой сортировки.
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+// sortColumns - колонки таблицы records, по которым допускается сортировка.
+// Имя колонки подставляется в SQL напрямую, поэтому список закрыт.
+var sortColumns = map[string]bool{
+	"created_at":  true,
+	"updated_at":  true,
+	"collection":  true,
+	"rkey":        true,
+	"record_type": true,
+	"cid":         true,
+}
+
+// SortSpec - один ключ сортировки в SearchQuery.Sort.
+//
+// Field - колонка записи (created_at, updated_at, collection, rkey,
+// record_type, cid) или "relevance" для полнотекстового поиска через FTS5.
+type SortSpec struct {
+	Field string `json:"field"`          // Поле сортировки
+	Desc  bool   `json:"desc,omitempty"` // Сортировка по убыванию
+}
+
+// sortKey - проверенный ключ сортировки.
+type sortKey struct {
+	Column string // Колонка сортировки из sortColumns или relevance
+	Desc   bool   // Сортировка по убыванию
+}
+
+// searchOrder - проверенный порядок сортировки запроса.
+// Порядок всегда замыкают CID, коллекция и ключ записи: одно содержимое
+// может быть проиндексировано под несколькими ключами, а пара
+// (collection, rkey) уникальна, поэтому порядок полный, записи с равными
+// значениями ключей (одинаковая релевантность или время создания)
+// возвращаются в одном и том же порядке, а курсор однозначно указывает
+// на позицию.
+type searchOrder []sortKey
+
+// tieBreakColumns - ключи, замыкающие любой порядок сортировки
+var tieBreakColumns = []string{"cid", "collection", "rkey"}
+
+// searchCursor - содержимое непрозрачного курсора пагинации.
+type searchCursor struct {
+	Keys   []cursorKey `json:"k"` // Ключи сортировки, для которых создан курсор
+	Values []string    `json:"v"` // Значения ключей последней записи
+}
+
+// cursorKey - ключ сортировки в курсоре.
+type cursorKey struct {
+	Column string `json:"s"`
+	Desc   bool   `json:"d"`
+}
+
+// resolveOrder определяет порядок сортировки запроса; ranked - запрос
+// выполняется через FTS5 и содержит колонку relevance.
+//
+// Sort имеет приоритет над SortBy/SortOrder. Без них ранжированный поиск
+// упорядочивается по релевантности, остальные - как прежде: новые записи
+// первыми. CID, коллекция и ключ записи, если запрос не сортирует по ним
+// явно, добавляются последними в направлении первого ключа.
+func resolveOrder(query SearchQuery, ranked bool) (searchOrder, error) {
+	specs := query.Sort
+	if len(specs) == 0 {
+		switch {
+		case query.SortBy != "":
+			specs = []SortSpec{{Field: query.SortBy, Desc: strings.EqualFold(query.SortOrder, "DESC")}}
+		case ranked:
+			specs = []SortSpec{{Field: "relevance", Desc: true}}
+		default:
+			specs = []SortSpec{{Field: "created_at", Desc: true}}
+		}
+	}
+
+	order := make(searchOrder, 0, len(specs)+len(tieBreakColumns))
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if !(sortColumns[spec.Field] || spec.Field == "relevance" && ranked) {
+			return nil, fmt.Errorf("unsupported sort field: %q", spec.Field)
+		}
+		if seen[spec.Field] {
+			return nil, fmt.Errorf("duplicate sort field: %q", spec.Field)
+		}
+		seen[spec.Field] = true
+
+		order = append(order, sortKey{Column: spec.Field, Desc: spec.Desc})
+	}
+
+	desc := order[0].Desc
+	for _, column := range tieBreakColumns {
+		if !seen[column] {
+			order = append(order, sortKey{Column: column, Desc: desc})
+		}
+	}
+
+	return order, nil
+}
+
+// column возвращает имя колонки с псевдонимом таблицы; relevance - псевдоним
+// вычисляемого выражения и префикса не получает.
+func (k sortKey) column(prefix string) string {
+	if k.Column == "relevance" {
+		return k.Column
+	}
+	return prefix + k.Column
+}
+
+// orderBy возвращает выражение ORDER BY; prefix - псевдоним таблицы records
+// (например, "r.") или пустая строка.
+func (o searchOrder) orderBy(prefix string) string {
+	terms := make([]string, len(o))
+	for i, k := range o {
+		dir := "ASC"
+		if k.Desc {
+			dir = "DESC"
+		}
+		terms[i] = k.column(prefix) + " " + dir
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// limitClause возвращает выражение LIMIT/OFFSET запроса. SQLite не
+// допускает OFFSET без LIMIT, поэтому Offset без Limit раскрывается в
+// LIMIT -1 (без ограничения).
+func limitClause(query SearchQuery) (string, []interface{}) {
+	var sql string
+	var args []interface{}
+
+	if query.Limit > 0 {
+		sql += " LIMIT ?"
+		args = append(args, query.Limit)
+	} else if query.Offset > 0 {
+		sql += " LIMIT -1"
+	}
+
+	if query.Offset > 0 {
+		sql += " OFFSET ?"
+		args = append(args, query.Offset)
+	}
+	return sql, args
+}
+
+// afterClause возвращает условие, отбирающее записи строго после курсора.
+//
+// Для ключей k1..kn условие раскрывается лексикографически с учетом
+// направления каждого ключа:
+//
+//	k1 > v1 OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND kn > vn)
+func (o searchOrder) afterClause(prefix, after string) (string, []interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+
+	var cur searchCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+	if !o.matches(cur.Keys) {
+		return "", nil, fmt.Errorf("%w: cursor was created for a different sort order", ErrInvalidCursor)
+	}
+	if len(cur.Values) != len(o) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(o))
+	for i, k := range o {
+		if values[i], err = cursorValue(k.Column, cur.Values[i]); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var alternatives []string
+	var args []interface{}
+	for i, k := range o {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, o[j].column(prefix)+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if k.Desc {
+			op = "<"
+		}
+		terms = append(terms, k.column(prefix)+" "+op+" ?")
+		args = append(args, values[i])
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return " AND (" + strings.Join(alternatives, " OR ") + ")", args, nil
+}
+
+// matches проверяет, что курсор создан для того же порядка сортировки.
+func (o searchOrder) matches(keys []cursorKey) bool {
+	if len(keys) != len(o) {
+		return false
+	}
+	for i, k := range o {
+		if keys[i].Column != k.Column || keys[i].Desc != k.Desc {
+			return false
+		}
+	}
+	return true
+}
+
+// cursorValue восстанавливает значение ключа сортировки из курсора.
+// Временные метки передаются как time.Time, чтобы драйвер отформатировал
+// их так же, как при вставке, и строковое сравнение в SQLite было корректным.
+func cursorValue(column, value string) (interface{}, error) {
+	switch column {
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	case "relevance":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return f, nil
+	default:
+		return value, nil
+	}
+}
+
+// cursorFor создает курсор, указывающий на позицию сразу после записи r.
+func (o searchOrder) cursorFor(r SearchResult) string {
+	var cur searchCursor
+
+	for _, k := range o {
+		cur.Keys = append(cur.Keys, cursorKey{Column: k.Column, Desc: k.Desc})
+
+		var value string
+		switch k.Column {
+		case "cid":
+			value = r.CID.String()
+		case "created_at":
+			value = r.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			value = r.UpdatedAt.Format(time.RFC3339Nano)
+		case "collection":
+			value = r.Collection
+		case "rkey":
+			value = r.RKey
+		case "record_type":
+			value = r.RecordType
+		case "relevance":
+			// Формат 'g' с точностью -1 восстанавливает то же значение float64
+			value = strconv.FormatFloat(r.Relevance, 'g', -1, 64)
+		}
+		cur.Values = append(cur.Values, value)
+	}
+
+	// Маршалинг структуры из строк и bool не может завершиться ошибкой
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
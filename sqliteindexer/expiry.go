@@ -0,0 +1,62 @@
+package sqliteindexer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// expirySchema - частичный индекс по сроку жизни записей.
+// Создается после миграции, так как в базах до версии 3 колонки еще нет.
+// В индекс попадают только записи со сроком жизни, поэтому он не растет
+// за счет постоянных записей.
+const expirySchema = `
+	CREATE INDEX IF NOT EXISTS idx_records_expires_at ON records(expires_at) WHERE expires_at IS NOT NULL;
+`
+
+// expiryEpoch преобразует срок жизни в значение колонки expires_at:
+// миллисекунды Unix или NULL для записей без срока жизни.
+func expiryEpoch(expiresAt time.Time) interface{} {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return expiresAt.UnixMilli()
+}
+
+// notExpiredClause возвращает условие, исключающее истекшие записи;
+// prefix - псевдоним таблицы records ("r." или "").
+func notExpiredClause(prefix string, now time.Time) (string, []interface{}) {
+	return fmt.Sprintf(" AND (%sexpires_at IS NULL OR %sexpires_at > ?)", prefix, prefix),
+		[]interface{}{now.UnixMilli()}
+}
+
+// PurgeExpired удаляет записи, срок жизни которых истек, и возвращает
+// количество удаленных записей.
+//
+// Истекшие записи и так не попадают в результаты поиска (если не задан
+// SearchQuery.IncludeExpired), PurgeExpired освобождает занимаемое ими
+// место. Атрибуты удаляются каскадно, полнотекстовый индекс - триггерами.
+func (idx *SimpleSQLiteIndexer) PurgeExpired(ctx context.Context) (int, error) {
+	if err := idx.lock(); err != nil {
+		return 0, err
+	}
+	defer idx.mu.Unlock()
+
+	var deleted int
+	err := idx.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"DELETE FROM records WHERE expires_at IS NOT NULL AND expires_at <= ?", time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to purge expired records: %w", err)
+		}
+		n, err := res.RowsAffected()
+		deleted = int(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
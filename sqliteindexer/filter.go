@@ -0,0 +1,332 @@
+package sqliteindexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FilterOp - оператор сравнения в FilterClause.
+type FilterOp string
+
+const (
+	FilterEq  FilterOp = "eq"  // Равно
+	FilterNe  FilterOp = "ne"  // Не равно (записи без атрибута тоже подходят)
+	FilterGt  FilterOp = "gt"  // Больше
+	FilterGte FilterOp = "gte" // Больше или равно
+	FilterLt  FilterOp = "lt"  // Меньше
+	FilterLte FilterOp = "lte" // Меньше или равно
+	FilterIn  FilterOp = "in"  // Равно одному из элементов слайса Value
+
+	// FilterExists проверяет наличие поля в Data; Value - bool (nil означает true).
+	// Поле со значением null считается существующим.
+	FilterExists FilterOp = "exists"
+)
+
+// FilterClause - условие на атрибут записи.
+//
+// ТИПИЗАЦИЯ СРАВНЕНИЙ:
+// Атрибуты хранятся в record_attributes как текст с указанием типа.
+// Если Value - число, сравнение выполняется численно по атрибутам типа
+// "number" (включая числа, пришедшие из JSON как float64). Для строк
+// используется текстовое сравнение, для time.Time - сравнение строк RFC3339.
+//
+// ПУТИ JSON:
+// Поле с префиксом "$." ("$.address.city", "$.skills") адресует значение
+// внутри Data и сравнивается через json_extract/json_each по сохраненному
+// JSON записи, а не по таблице атрибутов. Имя без префикса - атрибут
+// верхнего уровня, даже если содержит точку ("app.version"). Если путь указывает
+// на массив, условие выполняется, когда ему удовлетворяет хотя бы один
+// элемент. Отсутствующий путь - несовпадение, а не ошибка (для ne - совпадение).
+//
+// Примеры:
+//
+//	{Field: "likes", Op: FilterGte, Value: 40}
+//	{Field: "status", Op: FilterIn, Value: []string{"draft", "review"}}
+//	{Field: "$.address.city", Op: FilterEq, Value: "Berlin"}
+//	{Field: "$.skills", Op: FilterEq, Value: "go"}
+//	{Field: "$.meta.lang", Op: FilterExists, Value: false}
+type FilterClause struct {
+	Field string      `json:"field"` // Имя атрибута
+	Op    FilterOp    `json:"op"`    // Оператор сравнения
+	Value interface{} `json:"value"` // Значение (для FilterIn - слайс значений)
+}
+
+// filterComparators - SQL операторы сравнения для FilterOp.
+var filterComparators = map[FilterOp]string{
+	FilterGt:  ">",
+	FilterGte: ">=",
+	FilterLt:  "<",
+	FilterLte: "<=",
+}
+
+// attributeSubquery - подзапрос по таблице атрибутов; условие на значение
+// подставляется вместо %s.
+const attributeSubquery = "SELECT cid FROM record_attributes WHERE attribute_name = ? AND %s"
+
+// queryClauses объединяет Filters (как условия eq) и Clauses запроса.
+// Ключи карты Filters сортируются, чтобы генерируемый SQL был детерминированным.
+func queryClauses(query SearchQuery) []FilterClause {
+	clauses := make([]FilterClause, 0, len(query.Filters)+len(query.Clauses))
+
+	fields := make([]string, 0, len(query.Filters))
+	for field := range query.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		clauses = append(clauses, FilterClause{Field: field, Op: FilterEq, Value: query.Filters[field]})
+	}
+
+	return append(clauses, query.Clauses...)
+}
+
+// compileFilters компилирует условия запроса в параметризованный SQL,
+// дописываемый к WHERE. prefix - псевдоним таблицы records ("r." или "").
+func compileFilters(query SearchQuery, prefix string) (string, []interface{}, error) {
+	var sql strings.Builder
+	var args []interface{}
+
+	for _, c := range queryClauses(query) {
+		if c.Field == "" {
+			return "", nil, fmt.Errorf("filter clause has empty field")
+		}
+
+		// Пути JSON и проверка существования вычисляются по колонке data
+		if isJSONPathField(c.Field) || c.Op == FilterExists {
+			cond, condArgs, err := jsonCondition(c, prefix)
+			if err != nil {
+				return "", nil, err
+			}
+			sql.WriteString(" AND " + cond)
+			args = append(args, condArgs...)
+			continue
+		}
+
+		switch c.Op {
+		case FilterEq, "":
+			cond, condArgs := equalityCondition(c.Value)
+			fmt.Fprintf(&sql, " AND %scid IN ("+attributeSubquery+")", prefix, cond)
+			args = append(append(args, c.Field), condArgs...)
+
+		case FilterNe:
+			cond, condArgs := equalityCondition(c.Value)
+			fmt.Fprintf(&sql, " AND %scid NOT IN ("+attributeSubquery+")", prefix, cond)
+			args = append(append(args, c.Field), condArgs...)
+
+		case FilterIn:
+			values, ok := sliceValues(c.Value)
+			if !ok {
+				return "", nil, fmt.Errorf("filter %q: operator %q requires a slice value", c.Field, c.Op)
+			}
+
+			// Пустой список не совпадает ни с одной записью
+			if len(values) == 0 {
+				sql.WriteString(" AND 0")
+				continue
+			}
+
+			conds := make([]string, 0, len(values))
+			condArgs := []interface{}{c.Field}
+			for _, v := range values {
+				cond, vArgs := equalityCondition(v)
+				conds = append(conds, cond)
+				condArgs = append(condArgs, vArgs...)
+			}
+			fmt.Fprintf(&sql, " AND %scid IN ("+attributeSubquery+")", prefix, "("+strings.Join(conds, " OR ")+")")
+			args = append(args, condArgs...)
+
+		case FilterGt, FilterGte, FilterLt, FilterLte:
+			cmp := filterComparators[c.Op]
+			var cond string
+			var arg interface{}
+			if n, ok := numericValue(c.Value); ok {
+				cond = "value_type = 'number' AND CAST(attribute_value AS REAL) " + cmp + " ?"
+				arg = n
+			} else {
+				cond = "attribute_value " + cmp + " ?"
+				arg = textValue(c.Value)
+			}
+			fmt.Fprintf(&sql, " AND %scid IN ("+attributeSubquery+")", prefix, cond)
+			args = append(args, c.Field, arg)
+
+		default:
+			return "", nil, fmt.Errorf("filter %q: unsupported operator %q", c.Field, c.Op)
+		}
+	}
+
+	return sql.String(), args, nil
+}
+
+// isJSONPathField сообщает, что поле адресует значение внутри Data по пути JSON.
+// Путем считается только поле с явным префиксом "$.", поэтому ключи верхнего
+// уровня с точкой в имени остаются обычными атрибутами.
+func isJSONPathField(field string) bool {
+	return strings.HasPrefix(field, "$.")
+}
+
+// fieldJSONPath возвращает путь SQLite JSON для поля условия: путь после
+// префикса "$." разбирается по точкам, имя без префикса адресует ключ
+// верхнего уровня целиком.
+func fieldJSONPath(field string) (string, error) {
+	if isJSONPathField(field) {
+		return jsonPath(strings.TrimPrefix(field, "$."))
+	}
+	if strings.ContainsAny(field, `"\`) {
+		return "", fmt.Errorf("invalid field path: %q", field)
+	}
+	return `$."` + field + `"`, nil
+}
+
+// jsonCondition строит условие на значение по пути JSON в колонке data.
+//
+// Значение пути разворачивается через json_each: для скаляра это одна строка
+// с key = NULL, для массива - строки элементов с целыми key. Строки объекта
+// (текстовые key) исключаются, чтобы объект не совпадал по своим полям.
+// Тип элемента проверяется по колонке type, поэтому строка "1", число 1
+// и true не совпадают друг с другом.
+func jsonCondition(c FilterClause, prefix string) (string, []interface{}, error) {
+	path, err := fieldJSONPath(c.Field)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if c.Op == FilterExists {
+		exists := true
+		if c.Value != nil {
+			b, ok := c.Value.(bool)
+			if !ok {
+				return "", nil, fmt.Errorf("filter %q: operator %q requires a bool value", c.Field, c.Op)
+			}
+			exists = b
+		}
+		if exists {
+			return "json_type(" + prefix + "data, ?) IS NOT NULL", []interface{}{path}, nil
+		}
+		return "json_type(" + prefix + "data, ?) IS NULL", []interface{}{path}, nil
+	}
+
+	// anyElement - хотя бы один элемент по пути удовлетворяет условию cond
+	anyElement := func(cond string) string {
+		return "EXISTS (SELECT 1 FROM json_each(" + prefix + "data, ?) WHERE typeof(key) != 'text' AND " + cond + ")"
+	}
+
+	switch c.Op {
+	case FilterEq, "":
+		cond, condArgs := jsonEqualityCondition(c.Value)
+		return anyElement(cond), append([]interface{}{path}, condArgs...), nil
+
+	case FilterNe:
+		cond, condArgs := jsonEqualityCondition(c.Value)
+		return "NOT " + anyElement(cond), append([]interface{}{path}, condArgs...), nil
+
+	case FilterIn:
+		values, ok := sliceValues(c.Value)
+		if !ok {
+			return "", nil, fmt.Errorf("filter %q: operator %q requires a slice value", c.Field, c.Op)
+		}
+		if len(values) == 0 {
+			return "0", nil, nil
+		}
+
+		conds := make([]string, 0, len(values))
+		args := []interface{}{path}
+		for _, v := range values {
+			cond, condArgs := jsonEqualityCondition(v)
+			conds = append(conds, cond)
+			args = append(args, condArgs...)
+		}
+		return anyElement("(" + strings.Join(conds, " OR ") + ")"), args, nil
+
+	case FilterGt, FilterGte, FilterLt, FilterLte:
+		cmp := filterComparators[c.Op]
+		if n, ok := numericValue(c.Value); ok {
+			return anyElement("type IN ('integer', 'real') AND value " + cmp + " ?"), []interface{}{path, n}, nil
+		}
+		return anyElement("type = 'text' AND value " + cmp + " ?"), []interface{}{path, textValue(c.Value)}, nil
+
+	default:
+		return "", nil, fmt.Errorf("filter %q: unsupported operator %q", c.Field, c.Op)
+	}
+}
+
+// jsonEqualityCondition строит условие равенства элемента json_each value.
+func jsonEqualityCondition(value interface{}) (string, []interface{}) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return "type = 'true'", nil
+		}
+		return "type = 'false'", nil
+	}
+	if value == nil {
+		return "type = 'null'", nil
+	}
+	if n, ok := numericValue(value); ok {
+		return "(type IN ('integer', 'real') AND value = ?)", []interface{}{n}
+	}
+	return "(type = 'text' AND value = ?)", []interface{}{textValue(value)}
+}
+
+// equalityCondition строит условие равенства значения атрибута value.
+// Числа сравниваются и как текст (совместимость с прежним поведением
+// Filters), и численно, поэтому 40 совпадает с сохранённым "40" и 40.0.
+func equalityCondition(value interface{}) (string, []interface{}) {
+	if n, ok := numericValue(value); ok {
+		return "(attribute_value = ? OR (value_type = 'number' AND CAST(attribute_value AS REAL) = ?))",
+			[]interface{}{textValue(value), n}
+	}
+	return "attribute_value = ?", []interface{}{textValue(value)}
+}
+
+// numericValue приводит числовые типы Go (и json.Number) к float64.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool, string, nil:
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// textValue форматирует значение так же, как getAttributeValue при индексации.
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// sliceValues разворачивает слайс или массив произвольного типа.
+func sliceValues(value interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
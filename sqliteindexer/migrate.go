@@ -0,0 +1,275 @@
+package sqliteindexer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ipfs/go-cid"
+)
+
+// currentSchemaVersion - версия схемы, которую создает и ожидает этот код.
+//
+// ИСТОРИЯ ВЕРСИЙ:
+//   - 1: исходная схема без таблицы index_meta
+//   - 2: атрибуты пересобраны из data, так как в версии 1 запись и ее
+//     атрибуты сохранялись отдельными выражениями, и сбой между ними
+//     оставлял запись без атрибутов
+//   - 3: колонка records.expires_at для срока жизни записей
+//   - 4: запись идентифицируется ключом (collection, rkey), а не CID,
+//     чтобы одно содержимое индексировалось под несколькими ключами;
+//     атрибуты хранятся по CID без внешнего ключа
+const currentSchemaVersion = 4
+
+// metaSchema - служебная таблица с параметрами базы индекса
+const metaSchema = `
+	CREATE TABLE IF NOT EXISTS index_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+`
+
+// schemaMigrations - шаги миграции; ключ - версия, к которой приводит шаг
+var schemaMigrations = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	2: rebuildAttributes,
+	3: addExpiresAt,
+	4: rekeyRecords,
+}
+
+// SchemaVersion возвращает версию схемы базы индекса.
+// После открытия базы она всегда равна текущей: старые базы мигрируются
+// в NewSimpleSQLiteIndexer.
+func (idx *SimpleSQLiteIndexer) SchemaVersion() int {
+	return idx.version
+}
+
+// migrate определяет версию схемы и применяет недостающие миграции в одной
+// транзакции. existed - таблица records существовала до открытия базы;
+// такая база без записи о версии считается базой версии 1.
+func (idx *SimpleSQLiteIndexer) migrate(ctx context.Context, existed bool) error {
+	if _, err := idx.db.ExecContext(ctx, metaSchema); err != nil {
+		return err
+	}
+
+	version, found, err := readSchemaVersion(ctx, idx.db)
+	if err != nil {
+		return err
+	}
+	if !found {
+		version = currentSchemaVersion
+		if existed {
+			version = 1
+		}
+	}
+
+	if version > currentSchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, currentSchemaVersion)
+	}
+
+	if version < currentSchemaVersion || !found {
+		err = idx.inTx(ctx, func(tx *sql.Tx) error {
+			for v := version + 1; v <= currentSchemaVersion; v++ {
+				if step := schemaMigrations[v]; step != nil {
+					if err := step(ctx, tx); err != nil {
+						return fmt.Errorf("migration to version %d failed: %w", v, err)
+					}
+				}
+			}
+			return setSchemaVersion(ctx, tx, currentSchemaVersion)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	idx.version = currentSchemaVersion
+	return nil
+}
+
+// Reindex перестраивает индекс из внешнего источника записей.
+//
+// provider перечисляет записи, вызывая yield для каждой; если yield вернул
+// false, перечисление должно прекратиться. Сигнатура совместима с
+// iter.Seq2[cid.Cid, IndexMetadata].
+//
+// Все записи удаляются, производные таблицы (атрибуты, полнотекстовый
+// индекс) пересоздаются, затем записи загружаются заново - все в одной
+// транзакции. Если загрузка прервется ошибкой или отменой контекста,
+// транзакция откатывается и индекс остается в прежнем состоянии.
+// Ошибка записи возвращается как *BatchError с порядковым номером записи.
+func (idx *SimpleSQLiteIndexer) Reindex(ctx context.Context, provider func(yield func(cid.Cid, IndexMetadata) bool)) error {
+	if err := idx.lock(); err != nil {
+		return err
+	}
+	defer idx.mu.Unlock()
+
+	return idx.inTx(ctx, func(tx *sql.Tx) error {
+		// Удаляем производные данные и сами записи
+		for _, stmt := range []string{
+			"DELETE FROM records",
+			"DROP TABLE IF EXISTS record_attributes",
+			attributesSchema,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to reset index: %w", err)
+			}
+		}
+
+		w, err := prepareRecordWriter(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer w.close()
+
+		// Загружаем записи, останавливая перечисление на первой ошибке
+		var loadErr error
+		n := 0
+		provider(func(c cid.Cid, metadata IndexMetadata) bool {
+			if err := ctx.Err(); err != nil {
+				loadErr = err
+				return false
+			}
+			if err := w.write(ctx, c, metadata); err != nil {
+				loadErr = &BatchError{Index: n, CID: c, Err: err}
+				return false
+			}
+			n++
+			return true
+		})
+		if loadErr != nil {
+			return loadErr
+		}
+
+		// Пересобираем полнотекстовый индекс по итоговому содержимому
+		if idx.fts {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO records_search_fts(records_search_fts) VALUES ('rebuild')"); err != nil {
+				return fmt.Errorf("failed to rebuild full-text index: %w", err)
+			}
+		}
+
+		return setSchemaVersion(ctx, tx, currentSchemaVersion)
+	})
+}
+
+// rebuildAttributes пересобирает атрибуты всех записей из сохраненного JSON data
+func rebuildAttributes(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT cid, data FROM records")
+	if err != nil {
+		return err
+	}
+
+	// Считываем записи полностью, чтобы не писать в базу при открытом курсоре
+	type stored struct {
+		cid  string
+		data map[string]interface{}
+	}
+	var records []stored
+	for rows.Next() {
+		var rec stored
+		var dataJSON string
+		if err := rows.Scan(&rec.cid, &dataJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal([]byte(dataJSON), &rec.data); err != nil {
+			rows.Close()
+			return fmt.Errorf("invalid JSON data for record %s: %w", rec.cid, err)
+		}
+		records = append(records, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	w, err := prepareAttributeWriter(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	for _, rec := range records {
+		if err := w.indexAttributes(ctx, rec.cid, rec.data); err != nil {
+			return fmt.Errorf("failed to index attributes for record %s: %w", rec.cid, err)
+		}
+	}
+
+	return nil
+}
+
+// addExpiresAt добавляет колонку срока жизни; индекс по ней создается
+// при открытии базы (expirySchema)
+func addExpiresAt(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "ALTER TABLE records ADD COLUMN expires_at INTEGER")
+	return err
+}
+
+// rekeyRecords пересоздает таблицу records без первичного ключа по CID.
+//
+// SQLite не позволяет изменить ограничения таблицы, поэтому записи
+// переносятся в новую таблицу с сохранением rowid (на него ссылается
+// полнотекстовый индекс). Триггеры удаляются вместе со старой таблицей:
+// основные создаются заново здесь, триггеры FTS5 - при открытии базы
+// (initSearchSchema), которое заодно перестраивает полнотекстовый индекс.
+// Атрибуты пересобираются из data в таблице без внешнего ключа.
+func rekeyRecords(ctx context.Context, tx *sql.Tx) error {
+	const columns = "cid, collection, rkey, record_type, data, search_text, created_at, updated_at, expires_at"
+
+	for _, stmt := range []string{
+		"DROP VIEW IF EXISTS collection_stats",
+		"DROP TABLE IF EXISTS record_attributes",
+		"CREATE TABLE records_rekeyed " + recordsColumns,
+		"INSERT INTO records_rekeyed (rowid, " + columns + ") SELECT rowid, " + columns + " FROM records",
+		"DROP TABLE records",
+		"ALTER TABLE records_rekeyed RENAME TO records",
+		recordsSchema,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return rebuildAttributes(ctx, tx)
+}
+
+// readSchemaVersion читает версию схемы из index_meta
+func readSchemaVersion(ctx context.Context, db *sql.DB) (int, bool, error) {
+	var value string
+	err := db.QueryRowContext(ctx, "SELECT value FROM index_meta WHERE key = 'schema_version'").Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+
+	return version, true, nil
+}
+
+// setSchemaVersion сохраняет версию схемы в index_meta
+func setSchemaVersion(ctx context.Context, tx *sql.Tx, version int) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT OR REPLACE INTO index_meta (key, value) VALUES ('schema_version', ?)", strconv.Itoa(version))
+	return err
+}
+
+// tableExists проверяет наличие таблицы в базе
+func tableExists(db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	return n > 0, err
+}
+
+// columnExists проверяет наличие колонки в таблице
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,193 @@
+package sqliteindexer
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// textTerm - отдельный элемент полнотекстового запроса.
+type textTerm struct {
+	Text    string // Текст термина или фразы без операторов
+	Phrase  bool   // Термин задан в кавычках и ищется как точная фраза
+	Prefix  bool   // Термин оканчивается на '*' (поиск по префиксу)
+	Negated bool   // Термин задан с '-' и должен отсутствовать
+}
+
+// textQuery - разобранный полнотекстовый запрос.
+//
+// СЕМАНТИКА:
+// - Groups объединяются через AND
+// - Термины внутри одной группы объединяются через OR
+// - Negated - термины, которые не должны встречаться в тексте
+//
+// Например, запрос `"distributed systems" go OR rust -draft` разбирается в
+// Groups = [["distributed systems"], ["go", "rust"]], Negated = ["draft"].
+type textQuery struct {
+	Groups  [][]textTerm // Конъюнкция дизъюнкций положительных терминов
+	Negated []textTerm   // Исключаемые термины
+}
+
+// errNoPositiveTerms возвращается, когда запрос нельзя выразить через FTS5 MATCH:
+// оператор NOT в FTS5 бинарный и требует хотя бы одного положительного термина.
+var errNoPositiveTerms = errors.New("full-text query must contain at least one positive term")
+
+// Empty сообщает, что после удаления операторов в запросе не осталось терминов.
+func (q textQuery) Empty() bool {
+	return len(q.Groups) == 0 && len(q.Negated) == 0
+}
+
+// parseTextQuery разбирает строку полнотекстового запроса.
+//
+// ПОДДЕРЖИВАЕМЫЙ СИНТАКСИС:
+// - word         - слово должно встречаться в тексте
+// - "a phrase"   - точная фраза
+// - word*        - слово с заданным префиксом
+// - a OR b       - хотя бы один из терминов (оператор OR в верхнем регистре)
+// - -word        - слово не должно встречаться (также -"a phrase")
+//
+// Пустые термины, оставшиеся после удаления операторов (одиночный "-",
+// пустые кавычки, висячий OR), игнорируются. Незакрытая кавычка
+// закрывается концом строки.
+func parseTextQuery(s string) textQuery {
+	var q textQuery
+
+	// joinNext - предыдущий токен был OR, следующий термин присоединяется
+	// к последней группе
+	joinNext := false
+
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		// Пропускаем разделители
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+
+		var term textTerm
+		if rs[i] == '-' {
+			term.Negated = true
+			i++
+		}
+
+		if i < len(rs) && rs[i] == '"' {
+			// Фраза до закрывающей кавычки или конца строки
+			i++
+			j := i
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			term.Text = strings.Join(strings.Fields(string(rs[i:j])), " ")
+			term.Phrase = true
+			i = j + 1
+		} else {
+			// Слово до ближайшего разделителя
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) {
+				j++
+			}
+			word := string(rs[i:j])
+			i = j
+
+			// Оператор OR распознаётся только без модификаторов
+			if word == "OR" && !term.Negated {
+				joinNext = len(q.Groups) > 0
+				continue
+			}
+
+			word = strings.Trim(word, `"`)
+			if strings.HasSuffix(word, "*") {
+				word = strings.TrimRight(word, "*")
+				term.Prefix = true
+			}
+			term.Text = word
+		}
+
+		// Термин без текста (например, "-" или "") ничего не ограничивает
+		if term.Text == "" {
+			continue
+		}
+
+		switch {
+		case term.Negated:
+			q.Negated = append(q.Negated, term)
+			joinNext = false
+		case joinNext:
+			last := len(q.Groups) - 1
+			q.Groups[last] = append(q.Groups[last], term)
+			joinNext = false
+		default:
+			q.Groups = append(q.Groups, []textTerm{term})
+		}
+	}
+
+	return q
+}
+
+// likeSQL строит условие WHERE для поиска через LIKE по колонке column.
+// Пользовательский ввод передаётся только через параметры, а символы
+// шаблона LIKE (%, _) экранируются, поэтому ищутся буквально.
+func (q textQuery) likeSQL(column string) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+
+	for _, group := range q.Groups {
+		alts := make([]string, 0, len(group))
+		for _, term := range group {
+			alts = append(alts, column+` LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(term.Text)+"%")
+		}
+		parts = append(parts, "("+strings.Join(alts, " OR ")+")")
+	}
+
+	// Записи без текста не содержат исключаемых терминов
+	for _, term := range q.Negated {
+		parts = append(parts, "("+column+" IS NULL OR "+column+` NOT LIKE ? ESCAPE '\')`)
+		args = append(args, "%"+escapeLike(term.Text)+"%")
+	}
+
+	return strings.Join(parts, " AND "), args
+}
+
+// matchExpr строит выражение для FTS5 MATCH.
+// Каждый термин заключается в кавычки, поэтому служебные символы и
+// ключевые слова FTS5 во вводе пользователя теряют специальное значение.
+func (q textQuery) matchExpr() (string, error) {
+	if len(q.Groups) == 0 {
+		return "", errNoPositiveTerms
+	}
+
+	parts := make([]string, 0, len(q.Groups))
+	for _, group := range q.Groups {
+		alts := make([]string, 0, len(group))
+		for _, term := range group {
+			alts = append(alts, quoteFTS(term))
+		}
+		if len(alts) == 1 {
+			parts = append(parts, alts[0])
+		} else {
+			parts = append(parts, "("+strings.Join(alts, " OR ")+")")
+		}
+	}
+
+	expr := strings.Join(parts, " AND ")
+	for _, term := range q.Negated {
+		expr += " NOT " + quoteFTS(term)
+	}
+
+	return expr, nil
+}
+
+// quoteFTS заключает термин в кавычки FTS5, удваивая внутренние кавычки.
+func quoteFTS(term textTerm) string {
+	s := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+	if term.Prefix {
+		s += "*"
+	}
+	return s
+}
+
+// escapeLike экранирует символы шаблона LIKE для использования с ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
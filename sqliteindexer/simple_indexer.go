@@ -1,14 +1,17 @@
-// Package sqliteindexer - упрощенная версия без FTS5 для совместимости
+// Package sqliteindexer - упрощенная версия с необязательным FTS5
 //
-// Эта версия реализует все основные функции SQLiteIndexer, но использует
-// обычный LIKE поиск вместо FTS5 для совместимости с системами где
-// FTS5 не поддерживается.
+// Эта версия реализует все основные функции SQLiteIndexer, но не требует
+// FTS5: модуль определяется при открытии базы, и если он доступен
+// (сборка с тегом sqlite_fts5), текстовый поиск идет через FTS5 с
+// ранжированием bm25(). Иначе используется обычный LIKE поиск для
+// совместимости с системами, где FTS5 не поддерживается.
 package sqliteindexer
 
 import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -17,37 +20,222 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// SimpleSQLiteIndexer представляет упрощенный SQLite-based индексер без FTS5
+// SimpleSQLiteIndexer представляет SQLite-based индексер с FTS5 при наличии
+// и LIKE поиском в остальных случаях
+//
+// ПАРАЛЛЕЛЬНЫЙ ДОСТУП:
+// Индексер безопасен для использования из нескольких горутин. Чтения
+// выполняются параллельно, записи сериализуются мьютексом. База открывается
+// в режиме WAL с тайм-аутом ожидания блокировки, поэтому параллельная работа
+// с той же базой из другого процесса или другого экземпляра индексера
+// приводит к ожиданию, а не к ошибке "database is locked".
+// После Close все методы возвращают ErrClosed.
 type SimpleSQLiteIndexer struct {
-	db *sql.DB
-	mu sync.RWMutex
+	db      *sql.DB
+	mu      sync.RWMutex
+	closed  bool // Индексер закрыт, доступ к базе запрещен
+	fts     bool // Текстовый поиск идет через FTS5 таблицу records_search_fts
+	version int  // Версия схемы базы после миграции
+}
+
+// ErrClosed возвращается методами индексера после вызова Close.
+var ErrClosed = errors.New("sqlite indexer is closed")
+
+// Параметры подключения к базе.
+//
+// Пул ограничен maxOpenConns соединениями: в режиме WAL читатели не
+// блокируют друг друга и писателя, поэтому несколько соединений позволяют
+// выполнять поиск параллельно. Писатель в каждый момент один (мьютекс
+// индексера), остальные соединения пула заняты только чтением. Больше
+// соединений не ускоряет SQLite, а лишь увеличивает число открытых файлов
+// и кэшей страниц. Все соединения держатся открытыми (maxIdleConns =
+// maxOpenConns), так как настройки PRAGMA задаются при открытии соединения.
+//
+// busyTimeoutMs - время ожидания блокировки другим соединением до ошибки
+// SQLITE_BUSY. Транзакции открываются сразу с блокировкой записи
+// (_txlock=immediate): повышение уровня блокировки внутри отложенной
+// транзакции не ждет busy timeout и завершается ошибкой немедленно.
+const (
+	maxOpenConns  = 8
+	maxIdleConns  = maxOpenConns
+	busyTimeoutMs = 5000
+)
+
+// sqliteDSN формирует строку подключения с параметрами для параллельного доступа
+func sqliteDSN(dbPath string) string {
+	return fmt.Sprintf("%s?_journal_mode=WAL&_foreign_keys=ON&_busy_timeout=%d&_txlock=immediate&_synchronous=NORMAL",
+		dbPath, busyTimeoutMs)
+}
+
+// Options задает параметры SimpleSQLiteIndexer
+type Options struct {
+	// DisableFTS отключает FTS5 даже при его наличии: поиск всегда идет через LIKE
+	DisableFTS bool
 }
 
-// NewSimpleSQLiteIndexer создает новый простой SQLite индексер без FTS5
+// NewSimpleSQLiteIndexer создает новый SQLite индексер с настройками по умолчанию
 func NewSimpleSQLiteIndexer(dbPath string) (*SimpleSQLiteIndexer, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_foreign_keys=ON")
+	return NewSimpleSQLiteIndexerWithOptions(dbPath, Options{})
+}
+
+// NewSimpleSQLiteIndexerWithOptions создает SQLite индексер с заданными параметрами.
+//
+// Доступность FTS5 определяется при открытии базы. Если FTS5 используется,
+// а полнотекстовый индекс отсутствует или не синхронизировался (база
+// открывалась сборкой без FTS5), он перестраивается из таблицы records.
+func NewSimpleSQLiteIndexerWithOptions(dbPath string, opts Options) (*SimpleSQLiteIndexer, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
 	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
 
 	indexer := &SimpleSQLiteIndexer{
 		db: db,
 	}
 
+	// Базы, созданные до появления версии схемы, распознаются по таблице records
+	existed, err := tableExists(db, "records")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+
 	if err := indexer.initSimpleSchema(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if err := indexer.migrate(context.Background(), existed); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	if _, err := db.Exec(expirySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize expiry index: %w", err)
+	}
+
+	if !opts.DisableFTS {
+		available, err := fts5Available(db)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to detect FTS5 support: %w", err)
+		}
+		indexer.fts = available
+	}
+
+	if err := indexer.initSearchSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize full-text schema: %w", err)
+	}
+
 	return indexer, nil
 }
 
-// initSimpleSchema инициализирует упрощенную схему без FTS5
-func (idx *SimpleSQLiteIndexer) initSimpleSchema() error {
+// HasFTS сообщает, используется ли FTS5 для полнотекстового поиска
+func (idx *SimpleSQLiteIndexer) HasFTS() bool {
+	return idx.fts
+}
+
+// fts5Available проверяет, собран ли SQLite с модулем FTS5
+func fts5Available(db *sql.DB) (bool, error) {
+	var used bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return used, err
+}
+
+// ftsTriggers - триггеры синхронизации records_search_fts с таблицей records
+var ftsTriggers = []string{"records_search_fts_insert", "records_search_fts_delete", "records_search_fts_update"}
+
+// initSearchSchema создает или отключает полнотекстовый индекс.
+//
+// records_search_fts - FTS5 таблица с внешним содержимым (content='records'):
+// текст хранится только в records, а триггеры поддерживают инвертированный
+// индекс. Если FTS5 не используется, триггеры удаляются, чтобы запись
+// не зависела от модуля; при следующем открытии с FTS5 индекс
+// перестраивается командой 'rebuild'.
+func (idx *SimpleSQLiteIndexer) initSearchSchema() error {
+	if !idx.fts {
+		for _, name := range ftsTriggers {
+			if _, err := idx.db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Отсутствие триггера означает, что индекс не поддерживался
+	var triggers int
+	err := idx.db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", ftsTriggers[0],
+	).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+
 	schema := `
-	-- Основная таблица записей (без FTS5)
-	CREATE TABLE IF NOT EXISTS records (
-		cid TEXT PRIMARY KEY,
+	CREATE VIRTUAL TABLE IF NOT EXISTS records_search_fts USING fts5(
+		search_text,
+		content='records',
+		content_rowid='rowid'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS records_search_fts_insert AFTER INSERT ON records BEGIN
+		INSERT INTO records_search_fts(rowid, search_text) VALUES (new.rowid, new.search_text);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS records_search_fts_delete AFTER DELETE ON records BEGIN
+		INSERT INTO records_search_fts(records_search_fts, rowid, search_text)
+		VALUES ('delete', old.rowid, old.search_text);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS records_search_fts_update AFTER UPDATE OF search_text ON records BEGIN
+		INSERT INTO records_search_fts(records_search_fts, rowid, search_text)
+		VALUES ('delete', old.rowid, old.search_text);
+		INSERT INTO records_search_fts(rowid, search_text) VALUES (new.rowid, new.search_text);
+	END;
+	`
+	if _, err := idx.db.Exec(schema); err != nil {
+		return err
+	}
+
+	if triggers == 0 {
+		_, err = idx.db.Exec("INSERT INTO records_search_fts(records_search_fts) VALUES ('rebuild')")
+	}
+	return err
+}
+
+// attributesSchema - таблица атрибутов, производная от data записей.
+// Выделена отдельно, так как пересоздается при Reindex.
+//
+// Атрибуты определяются содержимым записи, поэтому хранятся по CID и общие
+// для записей с одинаковым содержимым под разными ключами (например, копий
+// CopyRecord). Внешнего ключа на records нет: CID в records не уникален,
+// а атрибуты удаляет триггер records_attributes_cleanup вместе с последней
+// записью, ссылающейся на CID.
+const attributesSchema = `
+	-- Таблица атрибутов для структурированного поиска
+	CREATE TABLE IF NOT EXISTS record_attributes (
+		cid TEXT NOT NULL,
+		attribute_name TEXT NOT NULL,
+		attribute_value TEXT NOT NULL,
+		value_type TEXT NOT NULL,
+		PRIMARY KEY (cid, attribute_name)
+	);
+
+	-- Индексы для атрибутов
+	CREATE INDEX IF NOT EXISTS idx_attr_name_value ON record_attributes(attribute_name, attribute_value);
+	CREATE INDEX IF NOT EXISTS idx_attr_name_type ON record_attributes(attribute_name, value_type);
+`
+
+// recordsColumns - определение колонок таблицы records.
+//
+// Запись идентифицируется ключом (collection, rkey): одно содержимое (CID)
+// может храниться под несколькими ключами, и каждый из них ищется отдельно.
+const recordsColumns = `(
+		cid TEXT NOT NULL,
 		collection TEXT NOT NULL,
 		rkey TEXT NOT NULL,
 		record_type TEXT NOT NULL,
@@ -55,10 +243,15 @@ func (idx *SimpleSQLiteIndexer) initSimpleSchema() error {
 		search_text TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at INTEGER,
 		UNIQUE(collection, rkey)
-	);
+	)`
 
+// recordsSchema - индексы, триггеры и представления таблицы records.
+// Выполняется при открытии базы и после пересоздания таблицы миграцией.
+const recordsSchema = `
 	-- Индексы для оптимизации
+	CREATE INDEX IF NOT EXISTS idx_records_cid ON records(cid);
 	CREATE INDEX IF NOT EXISTS idx_records_collection ON records(collection);
 	CREATE INDEX IF NOT EXISTS idx_records_type ON records(record_type);
 	CREATE INDEX IF NOT EXISTS idx_records_collection_type ON records(collection, record_type);
@@ -67,26 +260,21 @@ func (idx *SimpleSQLiteIndexer) initSimpleSchema() error {
 	
 	-- Индекс для текстового поиска через LIKE
 	CREATE INDEX IF NOT EXISTS idx_records_search_text ON records(search_text);
+	` + attributesSchema + `
 
-	-- Таблица атрибутов для структурированного поиска
-	CREATE TABLE IF NOT EXISTS record_attributes (
-		cid TEXT NOT NULL,
-		attribute_name TEXT NOT NULL,
-		attribute_value TEXT NOT NULL,
-		value_type TEXT NOT NULL,
-		PRIMARY KEY (cid, attribute_name),
-		FOREIGN KEY (cid) REFERENCES records(cid) ON DELETE CASCADE
-	);
-
-	-- Индексы для атрибутов
-	CREATE INDEX IF NOT EXISTS idx_attr_name_value ON record_attributes(attribute_name, attribute_value);
-	CREATE INDEX IF NOT EXISTS idx_attr_name_type ON record_attributes(attribute_name, value_type);
+	-- Атрибуты удаляются вместе с последней записью с тем же CID
+	CREATE TRIGGER IF NOT EXISTS records_attributes_cleanup
+		AFTER DELETE ON records
+		WHEN NOT EXISTS (SELECT 1 FROM records WHERE cid = OLD.cid)
+	BEGIN
+		DELETE FROM record_attributes WHERE cid = OLD.cid;
+	END;
 
 	-- Триггер для обновления времени
 	CREATE TRIGGER IF NOT EXISTS update_records_timestamp 
 		AFTER UPDATE ON records
 	BEGIN
-		UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE cid = NEW.cid;
+		UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE rowid = NEW.rowid;
 	END;
 
 	-- Представление для статистики
@@ -99,34 +287,190 @@ func (idx *SimpleSQLiteIndexer) initSimpleSchema() error {
 		MAX(updated_at) as last_updated
 	FROM records 
 	GROUP BY collection;
-	`
+`
 
-	_, err := idx.db.Exec(schema)
+// initSimpleSchema инициализирует основную схему (FTS5 таблица создается в initSearchSchema)
+func (idx *SimpleSQLiteIndexer) initSimpleSchema() error {
+	// Основная таблица записей (без FTS5)
+	_, err := idx.db.Exec("CREATE TABLE IF NOT EXISTS records " + recordsColumns + ";" + recordsSchema)
 	return err
 }
 
-// IndexRecord индексирует запись в SQLite (простая версия)
+// IndexedRecord связывает CID записи с метаданными для пакетной индексации
+type IndexedRecord struct {
+	CID      cid.Cid       // CID записи в blockstore
+	Metadata IndexMetadata // Метаданные для индексации
+}
+
+// BatchError сообщает, на какой записи прервалась пакетная индексация
+type BatchError struct {
+	Index int     // Позиция записи в переданном слайсе
+	CID   cid.Cid // CID записи
+	Err   error   // Исходная ошибка
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to index record %d (%s): %v", e.Index, e.CID, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// IndexRecord индексирует запись в SQLite (простая версия).
+// Запись и ее атрибуты сохраняются в одной транзакции.
 func (idx *SimpleSQLiteIndexer) IndexRecord(ctx context.Context, recordCID cid.Cid, metadata IndexMetadata) error {
-	idx.mu.Lock()
+	if err := idx.lock(); err != nil {
+		return err
+	}
 	defer idx.mu.Unlock()
 
+	return idx.writeRecords(ctx, func(w *recordWriter) error {
+		return w.write(ctx, recordCID, metadata)
+	})
+}
+
+// BatchIndexRecords индексирует набор записей в одной транзакции.
+//
+// Операция атомарна: при ошибке на любой записи транзакция откатывается
+// и индекс остается в исходном состоянии. Возвращаемая ошибка имеет тип
+// *BatchError и указывает позицию и CID записи, вызвавшей сбой.
+// Выражения подготавливаются один раз на весь пакет, поэтому пакетная
+// загрузка значительно быстрее вызова IndexRecord в цикле.
+func (idx *SimpleSQLiteIndexer) BatchIndexRecords(ctx context.Context, records []IndexedRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := idx.lock(); err != nil {
+		return err
+	}
+	defer idx.mu.Unlock()
+
+	return idx.writeRecords(ctx, func(w *recordWriter) error {
+		for i, rec := range records {
+			if err := w.write(ctx, rec.CID, rec.Metadata); err != nil {
+				return &BatchError{Index: i, CID: rec.CID, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// writeRecords выполняет fn в транзакции с подготовленными выражениями записи.
+// Транзакция фиксируется, только если fn завершилась без ошибки.
+func (idx *SimpleSQLiteIndexer) writeRecords(ctx context.Context, fn func(w *recordWriter) error) error {
+	return idx.inTx(ctx, func(tx *sql.Tx) error {
+		w, err := prepareRecordWriter(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer w.close()
+
+		return fn(w)
+	})
+}
+
+// inTx выполняет fn в транзакции и фиксирует ее, если fn завершилась без ошибки
+func (idx *SimpleSQLiteIndexer) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := idx.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// recordWriter содержит подготовленные выражения для записи в индекс
+type recordWriter struct {
+	deleteRecord *sql.Stmt // Удаление прежней версии записи
+	insertRecord *sql.Stmt // Вставка основной записи
+	deleteAttrs  *sql.Stmt // Удаление старых атрибутов записи
+	insertAttr   *sql.Stmt // Вставка одного атрибута
+}
+
+// prepareRecordWriter подготавливает выражения записи в рамках транзакции
+func prepareRecordWriter(ctx context.Context, tx *sql.Tx) (*recordWriter, error) {
+	return prepareWriter(ctx, tx, true)
+}
+
+// prepareAttributeWriter подготавливает только выражения атрибутов.
+// Используется миграциями, которые выполняются до того, как таблица records
+// приведена к текущей схеме, и не могут подготовить вставку записи.
+func prepareAttributeWriter(ctx context.Context, tx *sql.Tx) (*recordWriter, error) {
+	return prepareWriter(ctx, tx, false)
+}
+
+// prepareWriter подготавливает выражения атрибутов и, если records, выражения записи
+func prepareWriter(ctx context.Context, tx *sql.Tx, records bool) (*recordWriter, error) {
+	w := &recordWriter{}
+
+	type statement struct {
+		dst   **sql.Stmt
+		query string
+	}
+	stmts := []statement{
+		{&w.deleteAttrs, "DELETE FROM record_attributes WHERE cid = ?"},
+		{&w.insertAttr, `
+			INSERT INTO record_attributes (cid, attribute_name, attribute_value, value_type)
+			VALUES (?, ?, ?, ?)
+		`},
+	}
+	if records {
+		stmts = append(stmts,
+			statement{&w.deleteRecord, "DELETE FROM records WHERE collection = ? AND rkey = ?"},
+			statement{&w.insertRecord, `
+				INSERT INTO records 
+				(cid, collection, rkey, record_type, data, search_text, created_at, updated_at, expires_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`},
+		)
+	}
+
+	for _, st := range stmts {
+		stmt, err := tx.PrepareContext(ctx, st.query)
+		if err != nil {
+			w.close()
+			return nil, fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		*st.dst = stmt
+	}
+
+	return w, nil
+}
+
+// write сохраняет запись и ее атрибуты
+func (w *recordWriter) write(ctx context.Context, recordCID cid.Cid, metadata IndexMetadata) error {
 	dataJSON, err := json.Marshal(metadata.Data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal record data: %w", err)
 	}
 
-	_, err = idx.db.ExecContext(ctx, `
-		INSERT OR REPLACE INTO records 
-		(cid, collection, rkey, record_type, data, search_text, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, recordCID.String(), metadata.Collection, metadata.RKey, metadata.RecordType,
-		string(dataJSON), metadata.SearchText, metadata.CreatedAt, metadata.UpdatedAt)
+	// Прежняя версия записи с тем же ключом удаляется явно, а не через
+	// INSERT OR REPLACE: неявное удаление при REPLACE не вызывает триггеры,
+	// и полнотекстовый индекс разошелся бы с таблицей. Записи с тем же CID
+	// под другими ключами не затрагиваются
+	if _, err := w.deleteRecord.ExecContext(ctx, metadata.Collection, metadata.RKey); err != nil {
+		return fmt.Errorf("failed to replace record: %w", err)
+	}
 
+	_, err = w.insertRecord.ExecContext(ctx, recordCID.String(), metadata.Collection, metadata.RKey,
+		metadata.RecordType, string(dataJSON), metadata.SearchText, metadata.CreatedAt, metadata.UpdatedAt,
+		expiryEpoch(metadata.ExpiresAt))
 	if err != nil {
 		return fmt.Errorf("failed to index record: %w", err)
 	}
 
-	if err := idx.indexAttributes(ctx, recordCID.String(), metadata.Data); err != nil {
+	if err := w.indexAttributes(ctx, recordCID.String(), metadata.Data); err != nil {
 		return fmt.Errorf("failed to index attributes: %w", err)
 	}
 
@@ -134,19 +478,14 @@ func (idx *SimpleSQLiteIndexer) IndexRecord(ctx context.Context, recordCID cid.C
 }
 
 // indexAttributes индексирует атрибуты записи
-func (idx *SimpleSQLiteIndexer) indexAttributes(ctx context.Context, cidStr string, data map[string]interface{}) error {
-	_, err := idx.db.ExecContext(ctx, "DELETE FROM record_attributes WHERE cid = ?", cidStr)
-	if err != nil {
+func (w *recordWriter) indexAttributes(ctx context.Context, cidStr string, data map[string]interface{}) error {
+	if _, err := w.deleteAttrs.ExecContext(ctx, cidStr); err != nil {
 		return err
 	}
 
 	for key, value := range data {
 		valueStr, valueType := getAttributeValue(value)
-		_, err = idx.db.ExecContext(ctx, `
-			INSERT INTO record_attributes (cid, attribute_name, attribute_value, value_type)
-			VALUES (?, ?, ?, ?)
-		`, cidStr, key, valueStr, valueType)
-		if err != nil {
+		if _, err := w.insertAttr.ExecContext(ctx, cidStr, key, valueStr, valueType); err != nil {
 			return err
 		}
 	}
@@ -154,35 +493,276 @@ func (idx *SimpleSQLiteIndexer) indexAttributes(ctx context.Context, cidStr stri
 	return nil
 }
 
-// DeleteRecord удаляет запись из индекса
+// close освобождает подготовленные выражения
+func (w *recordWriter) close() {
+	for _, stmt := range []*sql.Stmt{w.deleteRecord, w.insertRecord, w.deleteAttrs, w.insertAttr} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// DeleteRecord удаляет из индекса все записи с содержимым recordCID,
+// под какими бы ключами они ни хранились. Чтобы удалить одну запись,
+// не затрагивая копии того же содержимого, используйте DeleteRecordByKey.
 func (idx *SimpleSQLiteIndexer) DeleteRecord(ctx context.Context, recordCID cid.Cid) error {
-	idx.mu.Lock()
+	if err := idx.lock(); err != nil {
+		return err
+	}
 	defer idx.mu.Unlock()
 
 	_, err := idx.db.ExecContext(ctx, "DELETE FROM records WHERE cid = ?", recordCID.String())
 	return err
 }
 
-// SearchRecords выполняет поиск записей (простая версия)
+// DeleteRecordByKey удаляет из индекса запись collection/rkey.
+// Записи с тем же CID под другими ключами остаются в индексе.
+func (idx *SimpleSQLiteIndexer) DeleteRecordByKey(ctx context.Context, collection, rkey string) error {
+	if err := idx.lock(); err != nil {
+		return err
+	}
+	defer idx.mu.Unlock()
+
+	_, err := idx.db.ExecContext(ctx, "DELETE FROM records WHERE collection = ? AND rkey = ?", collection, rkey)
+	return err
+}
+
+// DeleteCollection удаляет все записи коллекции из индекса.
+// Возвращает количество удаленных записей. Атрибуты и строки
+// полнотекстового индекса удаляются триггерами в той же транзакции.
+func (idx *SimpleSQLiteIndexer) DeleteCollection(ctx context.Context, collection string) (int, error) {
+	if err := idx.lock(); err != nil {
+		return 0, err
+	}
+	defer idx.mu.Unlock()
+
+	var deleted int
+	err := idx.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM records WHERE collection = ?", collection)
+		if err != nil {
+			return fmt.Errorf("failed to delete collection: %w", err)
+		}
+		n, err := res.RowsAffected()
+		deleted = int(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// DeleteByQuery удаляет записи, соответствующие запросу, и возвращает их количество.
+//
+// Отбор выполняется так же, как в SearchRecords (включая текстовый запрос,
+// фильтры, Limit/Offset и курсор), а удаление - в одной транзакции.
+// Запрос без единого условия отклоняется, чтобы случайно не очистить индекс;
+// для удаления коллекции целиком используйте DeleteCollection.
+func (idx *SimpleSQLiteIndexer) DeleteByQuery(ctx context.Context, query SearchQuery) (int, error) {
+	if query.Collection == "" && query.RecordType == "" && len(query.Filters) == 0 &&
+		len(query.Clauses) == 0 && parseTextQuery(query.FullTextQuery).Empty() {
+		return 0, fmt.Errorf("delete query must have at least one condition")
+	}
+
+	// Блокировка на запись удерживается на время отбора и удаления,
+	// поэтому набор записей не может измениться между ними
+	if err := idx.lock(); err != nil {
+		return 0, err
+	}
+	defer idx.mu.Unlock()
+
+	results, err := idx.search(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	var deleted int
+	err = idx.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, "DELETE FROM records WHERE collection = ? AND rkey = ?")
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, r := range results {
+			res, err := stmt.ExecContext(ctx, r.Collection, r.RKey)
+			if err != nil {
+				return fmt.Errorf("failed to delete record %s/%s: %w", r.Collection, r.RKey, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += int(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// SearchRecords выполняет поиск записей.
+//
+// Текстовый запрос выполняется через FTS5 с ранжированием bm25(), если FTS5
+// доступен и в запросе есть положительные термины; иначе - через LIKE.
 func (idx *SimpleSQLiteIndexer) SearchRecords(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
-	idx.mu.RLock()
+	if err := idx.rlock(); err != nil {
+		return nil, err
+	}
 	defer idx.mu.RUnlock()
 
-	if query.FullTextQuery != "" {
-		return idx.searchSimpleText(ctx, query)
-	} else {
+	return idx.search(ctx, query)
+}
+
+// search выполняет поиск без захвата блокировки
+func (idx *SimpleSQLiteIndexer) search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	text := parseTextQuery(query.FullTextQuery)
+	switch {
+	case idx.rankedSearch(text):
+		return idx.searchFTS(ctx, query, text)
+	case !text.Empty():
+		return idx.searchSimpleText(ctx, query, text)
+	default:
+		// Запрос, состоящий только из операторов, не ограничивает выборку
 		return idx.searchStructured(ctx, query)
 	}
 }
 
-// searchSimpleText выполняет простой текстовый поиск через LIKE
-func (idx *SimpleSQLiteIndexer) searchSimpleText(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+// rankedSearch сообщает, будет ли текстовый запрос выполнен через FTS5.
+// Запрос только из исключений FTS5 не выражает и выполняется через LIKE.
+func (idx *SimpleSQLiteIndexer) rankedSearch(text textQuery) bool {
+	return idx.fts && len(text.Groups) > 0
+}
+
+// GetRecordByCID возвращает запись индекса по CID.
+// Поиск идет по первичному ключу cid и не требует сканирования таблицы.
+// Второе значение равно false, если запись не проиндексирована.
+func (idx *SimpleSQLiteIndexer) GetRecordByCID(ctx context.Context, c cid.Cid) (*SearchResult, bool, error) {
+	if err := idx.rlock(); err != nil {
+		return nil, false, err
+	}
+	defer idx.mu.RUnlock()
+
+	return idx.getRecord(ctx, "cid = ?", c.String())
+}
+
+// GetRecordByKey возвращает запись индекса по коллекции и ключу.
+// Поиск использует уникальный индекс (collection, rkey).
+func (idx *SimpleSQLiteIndexer) GetRecordByKey(ctx context.Context, collection, rkey string) (*SearchResult, bool, error) {
+	if err := idx.rlock(); err != nil {
+		return nil, false, err
+	}
+	defer idx.mu.RUnlock()
+
+	return idx.getRecord(ctx, "collection = ? AND rkey = ?", collection, rkey)
+}
+
+// getRecord выбирает одну запись по условию where
+func (idx *SimpleSQLiteIndexer) getRecord(ctx context.Context, where string, args ...interface{}) (*SearchResult, bool, error) {
+	expirySQL, expiryArgs := notExpiredClause("", time.Now())
+	results, err := idx.executeSearchQuery(ctx,
+		"SELECT cid, collection, rkey, record_type, data, created_at, updated_at FROM records WHERE "+where+expirySQL+" LIMIT 1",
+		append(args, expiryArgs...)...)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(results) == 0 {
+		return nil, false, nil
+	}
+
+	return &results[0], true, nil
+}
+
+// SearchRecordsPage выполняет поиск как SearchRecords и дополнительно
+// возвращает курсор следующей страницы.
+//
+// Курсор формируется, только если задан Limit и страница заполнена целиком;
+// он учитывает активный порядок сортировки (SortBy/SortOrder или Sort)
+// и отклоняется при его изменении.
+func (idx *SimpleSQLiteIndexer) SearchRecordsPage(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	results, err := idx.SearchRecords(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: results}
+	if query.Limit > 0 && len(results) == query.Limit {
+		order, err := resolveOrder(query, idx.rankedSearch(parseTextQuery(query.FullTextQuery)))
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = order.cursorFor(results[len(results)-1])
+	}
+
+	return page, nil
+}
+
+// searchFTS выполняет полнотекстовый поиск через FTS5.
+//
+// Релевантность вычисляется как -bm25(), чтобы большее значение означало
+// лучшее совпадение. Поиск оформлен подзапросом: вспомогательные функции
+// FTS5 нельзя использовать в WHERE, а курсор пагинации сравнивает
+// релевантность как обычную колонку.
+func (idx *SimpleSQLiteIndexer) searchFTS(ctx context.Context, query SearchQuery, text textQuery) ([]SearchResult, error) {
+	match, err := text.matchExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+		SELECT cid, collection, rkey, record_type, data, created_at, updated_at, relevance
+		FROM (
+			SELECT r.cid, r.collection, r.rkey, r.record_type, r.data, r.created_at, r.updated_at,
+			       r.expires_at, -bm25(records_search_fts) AS relevance
+			FROM records_search_fts
+			JOIN records r ON r.rowid = records_search_fts.rowid
+			WHERE records_search_fts MATCH ?
+		)
+		WHERE 1=1`
+	args := []interface{}{match}
+
+	if query.Collection != "" {
+		sql += " AND collection = ?"
+		args = append(args, query.Collection)
+	}
+
+	if query.RecordType != "" {
+		sql += " AND record_type = ?"
+		args = append(args, query.RecordType)
+	}
+
+	if !query.IncludeExpired {
+		expirySQL, expiryArgs := notExpiredClause("", time.Now())
+		sql += expirySQL
+		args = append(args, expiryArgs...)
+	}
+
+	filterSQL, filterArgs, err := compileFilters(query, "")
+	if err != nil {
+		return nil, err
+	}
+	sql += filterSQL
+	args = append(args, filterArgs...)
+
+	return idx.executePagedQuery(ctx, query, true, sql, args)
+}
+
+// searchSimpleText выполняет простой текстовый поиск через LIKE.
+// Фразы, группы OR и исключения из разобранного запроса транслируются
+// в комбинацию условий LIKE / NOT LIKE.
+func (idx *SimpleSQLiteIndexer) searchSimpleText(ctx context.Context, query SearchQuery, text textQuery) ([]SearchResult, error) {
+	where, args := text.likeSQL("search_text")
 	sql := `
 		SELECT cid, collection, rkey, record_type, data, created_at, updated_at
 		FROM records 
-		WHERE search_text LIKE ?
-	`
-	args := []interface{}{"%" + query.FullTextQuery + "%"}
+		WHERE ` + where
 
 	if query.Collection != "" {
 		sql += " AND collection = ?"
@@ -194,27 +774,21 @@ func (idx *SimpleSQLiteIndexer) searchSimpleText(ctx context.Context, query Sear
 		args = append(args, query.RecordType)
 	}
 
-	if query.SortBy != "" {
-		order := "ASC"
-		if query.SortOrder == "DESC" {
-			order = "DESC"
-		}
-		sql += fmt.Sprintf(" ORDER BY %s %s", query.SortBy, order)
-	} else {
-		sql += " ORDER BY created_at DESC"
+	if !query.IncludeExpired {
+		expirySQL, expiryArgs := notExpiredClause("", time.Now())
+		sql += expirySQL
+		args = append(args, expiryArgs...)
 	}
 
-	if query.Limit > 0 {
-		sql += " LIMIT ?"
-		args = append(args, query.Limit)
-
-		if query.Offset > 0 {
-			sql += " OFFSET ?"
-			args = append(args, query.Offset)
-		}
+	// Фильтры по атрибутам применяются и к текстовому поиску
+	filterSQL, filterArgs, err := compileFilters(query, "")
+	if err != nil {
+		return nil, err
 	}
+	sql += filterSQL
+	args = append(args, filterArgs...)
 
-	return idx.executeSearchQuery(ctx, sql, args...)
+	return idx.executePagedQuery(ctx, query, false, sql, args)
 }
 
 // searchStructured выполняет структурированный поиск
@@ -232,33 +806,45 @@ func (idx *SimpleSQLiteIndexer) searchStructured(ctx context.Context, query Sear
 		args = append(args, query.RecordType)
 	}
 
-	if len(query.Filters) > 0 {
-		for attr, value := range query.Filters {
-			sql += " AND cid IN (SELECT cid FROM record_attributes WHERE attribute_name = ? AND attribute_value = ?)"
-			args = append(args, attr, fmt.Sprintf("%v", value))
-		}
+	if !query.IncludeExpired {
+		expirySQL, expiryArgs := notExpiredClause("", time.Now())
+		sql += expirySQL
+		args = append(args, expiryArgs...)
 	}
 
-	if query.SortBy != "" {
-		order := "ASC"
-		if query.SortOrder == "DESC" {
-			order = "DESC"
-		}
-		sql += fmt.Sprintf(" ORDER BY %s %s", query.SortBy, order)
-	} else {
-		sql += " ORDER BY created_at DESC"
+	filterSQL, filterArgs, err := compileFilters(query, "")
+	if err != nil {
+		return nil, err
 	}
+	sql += filterSQL
+	args = append(args, filterArgs...)
 
-	if query.Limit > 0 {
-		sql += " LIMIT ?"
-		args = append(args, query.Limit)
+	return idx.executePagedQuery(ctx, query, false, sql, args)
+}
 
-		if query.Offset > 0 {
-			sql += " OFFSET ?"
-			args = append(args, query.Offset)
+// executePagedQuery дополняет запрос сортировкой, курсором и ограничениями
+// страницы, после чего выполняет его; ranked - запрос содержит колонку relevance
+func (idx *SimpleSQLiteIndexer) executePagedQuery(ctx context.Context, query SearchQuery, ranked bool, sql string, args []interface{}) ([]SearchResult, error) {
+	order, err := resolveOrder(query, ranked)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.After != "" {
+		clause, afterArgs, err := order.afterClause("", query.After)
+		if err != nil {
+			return nil, err
 		}
+		sql += clause
+		args = append(args, afterArgs...)
 	}
 
+	sql += order.orderBy("")
+
+	limit, limitArgs := limitClause(query)
+	sql += limit
+	args = append(args, limitArgs...)
+
 	return idx.executeSearchQuery(ctx, sql, args...)
 }
 
@@ -270,14 +856,25 @@ func (idx *SimpleSQLiteIndexer) executeSearchQuery(ctx context.Context, sql stri
 	}
 	defer rows.Close()
 
+	// Запросы FTS5 возвращают дополнительную колонку relevance
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	ranked := len(columns) > 7
+
 	var results []SearchResult
 
 	for rows.Next() {
 		var result SearchResult
 		var cidStr, dataJSON string
 
-		err = rows.Scan(&cidStr, &result.Collection, &result.RKey, &result.RecordType,
-			&dataJSON, &result.CreatedAt, &result.UpdatedAt)
+		dest := []interface{}{&cidStr, &result.Collection, &result.RKey, &result.RecordType,
+			&dataJSON, &result.CreatedAt, &result.UpdatedAt}
+		if ranked {
+			dest = append(dest, &result.Relevance)
+		}
+		err = rows.Scan(dest...)
 
 		if err != nil {
 			return nil, err
@@ -299,7 +896,9 @@ func (idx *SimpleSQLiteIndexer) executeSearchQuery(ctx context.Context, sql stri
 
 // GetCollectionStats возвращает статистику по коллекции
 func (idx *SimpleSQLiteIndexer) GetCollectionStats(ctx context.Context, collection string) (map[string]interface{}, error) {
-	idx.mu.RLock()
+	if err := idx.rlock(); err != nil {
+		return nil, err
+	}
 	defer idx.mu.RUnlock()
 
 	row := idx.db.QueryRowContext(ctx, `
@@ -344,8 +943,36 @@ func (idx *SimpleSQLiteIndexer) GetCollectionStats(ctx context.Context, collecti
 }
 
 // Close закрывает подключение к базе данных
+// Операции, выполняющиеся в других горутинах, завершаются до закрытия.
+// Повторный вызов безопасен и ничего не делает.
 func (idx *SimpleSQLiteIndexer) Close() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
+
+	if idx.closed {
+		return nil
+	}
+	idx.closed = true
+
 	return idx.db.Close()
 }
+
+// lock захватывает блокировку записи; для закрытого индексера возвращает ErrClosed
+func (idx *SimpleSQLiteIndexer) lock() error {
+	idx.mu.Lock()
+	if idx.closed {
+		idx.mu.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// rlock захватывает блокировку чтения; для закрытого индексера возвращает ErrClosed
+func (idx *SimpleSQLiteIndexer) rlock() error {
+	idx.mu.RLock()
+	if idx.closed {
+		idx.mu.RUnlock()
+		return ErrClosed
+	}
+	return nil
+}
@@ -0,0 +1,1564 @@
+package sqliteindexer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ========================================
+// ТЕСТЫ ПОЛНОТЕКСТОВОГО ПОИСКА
+// ========================================
+
+// TestParseTextQuery проверяет разбор фраз, групп OR и исключений.
+func TestParseTextQuery(t *testing.T) {
+	t.Run("одиночный термин", func(t *testing.T) {
+		q := parseTextQuery("golang")
+		require.Len(t, q.Groups, 1)
+		assert.Equal(t, "golang", q.Groups[0][0].Text)
+		assert.Empty(t, q.Negated)
+	})
+
+	t.Run("фраза, OR и исключение", func(t *testing.T) {
+		q := parseTextQuery(`"distributed  systems" go OR rust -draft`)
+		require.Len(t, q.Groups, 2)
+		assert.Equal(t, textTerm{Text: "distributed systems", Phrase: true}, q.Groups[0][0])
+		require.Len(t, q.Groups[1], 2)
+		assert.Equal(t, "go", q.Groups[1][0].Text)
+		assert.Equal(t, "rust", q.Groups[1][1].Text)
+		require.Len(t, q.Negated, 1)
+		assert.Equal(t, "draft", q.Negated[0].Text)
+	})
+
+	t.Run("пустые термины после удаления операторов", func(t *testing.T) {
+		assert.True(t, parseTextQuery(`- "" OR`).Empty())
+		assert.True(t, parseTextQuery("   ").Empty())
+
+		// Висячий OR не создаёт пустую альтернативу
+		q := parseTextQuery("OR go OR")
+		require.Len(t, q.Groups, 1)
+		assert.Len(t, q.Groups[0], 1)
+	})
+
+	t.Run("экранирование для FTS5", func(t *testing.T) {
+		expr, err := parseTextQuery(`a"b OR c* -"d e"`).matchExpr()
+		require.NoError(t, err)
+		assert.Equal(t, `("a""b" OR "c"*) NOT "d e"`, expr)
+
+		_, err = parseTextQuery("-draft").matchExpr()
+		assert.ErrorIs(t, err, errNoPositiveTerms)
+	})
+}
+
+// TestSearchFullTextOperators проверяет поиск по фразам, OR и исключениям через LIKE.
+func TestSearchFullTextOperators(t *testing.T) {
+	idx := createTestIndexerWithOptions(t, Options{DisableFTS: true})
+	ctx := context.Background()
+
+	indexText(t, idx, "p1", "notes on distributed systems design")
+	indexText(t, idx, "p2", "systems that are distributed across regions")
+	indexText(t, idx, "p3", "golang draft about channels")
+	indexText(t, idx, "p4", "rust ownership explained")
+	indexText(t, idx, "p5", "100% coverage_report")
+
+	search := func(q string) []string {
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", FullTextQuery: q})
+		require.NoError(t, err)
+		return resultKeys(results)
+	}
+
+	t.Run("обычный термин", func(t *testing.T) {
+		assert.Equal(t, []string{"p1", "p2"}, search("distributed"))
+	})
+
+	t.Run("фраза", func(t *testing.T) {
+		assert.Equal(t, []string{"p1"}, search(`"distributed systems"`))
+	})
+
+	t.Run("OR", func(t *testing.T) {
+		assert.Equal(t, []string{"p3", "p4"}, search("golang OR rust"))
+	})
+
+	t.Run("исключение", func(t *testing.T) {
+		assert.Equal(t, []string{"p4"}, search("golang OR rust -draft"))
+	})
+
+	t.Run("только исключение", func(t *testing.T) {
+		assert.Equal(t, []string{"p1", "p2", "p4", "p5"}, search("-draft"))
+	})
+
+	t.Run("символы шаблона LIKE ищутся буквально", func(t *testing.T) {
+		assert.Equal(t, []string{"p5"}, search("100%"))
+		assert.Equal(t, []string{"p5"}, search("e_r"))
+		assert.Empty(t, search("%"+"ownership"))
+	})
+
+	t.Run("попытка SQL injection", func(t *testing.T) {
+		assert.Empty(t, search(`'; DROP TABLE records; --`))
+		assert.Len(t, search("-nothing"), 5)
+	})
+
+	t.Run("запрос без терминов", func(t *testing.T) {
+		assert.Len(t, search(`- ""`), 5)
+	})
+}
+
+// TestSearchFTS проверяет ранжирование bm25() при наличии FTS5 и откат на LIKE.
+func TestSearchFTS(t *testing.T) {
+	ctx := context.Background()
+
+	// Более новые записи упоминают термин реже: LIKE упорядочивает по
+	// времени создания, а FTS5 - по релевантности
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	texts := []string{
+		"merkle merkle merkle tree",
+		"merkle tree with a few other words here",
+		"a long document that mentions merkle only once among many unrelated words in the text",
+	}
+	seed := func(idx *SimpleSQLiteIndexer) {
+		for i, text := range texts {
+			c := testCID(t, "posts/"+keyN(i))
+			created := base.Add(time.Duration(i) * time.Hour)
+			require.NoError(t, idx.IndexRecord(ctx, c, IndexMetadata{
+				Collection: "posts", RKey: keyN(i), RecordType: "post",
+				Data: map[string]interface{}{"text": text}, SearchText: text,
+				CreatedAt: created, UpdatedAt: created,
+			}))
+		}
+	}
+	search := func(idx *SimpleSQLiteIndexer) []SearchResult {
+		results, err := idx.SearchRecords(ctx, SearchQuery{FullTextQuery: "merkle"})
+		require.NoError(t, err)
+		return results
+	}
+
+	t.Run("откат на LIKE", func(t *testing.T) {
+		idx := createTestIndexerWithOptions(t, Options{DisableFTS: true})
+		assert.False(t, idx.HasFTS())
+		seed(idx)
+
+		results := search(idx)
+		require.Len(t, results, 3)
+		assert.Equal(t, []string{keyN(2), keyN(1), keyN(0)}, []string{results[0].RKey, results[1].RKey, results[2].RKey})
+		for _, r := range results {
+			assert.Zero(t, r.Relevance)
+		}
+	})
+
+	t.Run("ранжирование FTS5", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		if !idx.HasFTS() {
+			t.Skip("FTS5 недоступен: запустите тесты с -tags sqlite_fts5")
+		}
+		seed(idx)
+
+		results := search(idx)
+		require.Len(t, results, 3)
+		assert.Equal(t, []string{keyN(0), keyN(1), keyN(2)}, []string{results[0].RKey, results[1].RKey, results[2].RKey})
+		assert.Greater(t, results[0].Relevance, results[1].Relevance)
+		assert.Greater(t, results[1].Relevance, results[2].Relevance)
+
+		// Замена записи обновляет полнотекстовый индекс
+		c := testCID(t, "posts/"+keyN(0))
+		require.NoError(t, idx.IndexRecord(ctx, c, IndexMetadata{
+			Collection: "posts", RKey: keyN(0), RecordType: "post", SearchText: "nothing relevant",
+		}))
+		assert.Len(t, search(idx), 2)
+		require.NoError(t, idx.DeleteRecord(ctx, testCID(t, "posts/"+keyN(1))))
+		assert.Len(t, search(idx), 1)
+	})
+
+	t.Run("перестроение индекса после открытия без FTS5", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "index.db")
+
+		// База заполняется без FTS5, триггеры синхронизации отсутствуют
+		plain, err := NewSimpleSQLiteIndexerWithOptions(path, Options{DisableFTS: true})
+		require.NoError(t, err)
+		seed(plain)
+		require.NoError(t, plain.Close())
+
+		idx, err := NewSimpleSQLiteIndexer(path)
+		require.NoError(t, err)
+		defer idx.Close()
+		if !idx.HasFTS() {
+			t.Skip("FTS5 недоступен: запустите тесты с -tags sqlite_fts5")
+		}
+
+		results := search(idx)
+		require.Len(t, results, 3)
+		assert.Equal(t, keyN(0), results[0].RKey)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПАГИНАЦИИ
+// ========================================
+
+// TestSearchRecordsPage проверяет постраничный обход курсорами без пропусков и повторов.
+func TestSearchRecordsPage(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+
+	// Половина записей имеет одинаковое время создания, чтобы проверить
+	// разрешение равенства ключа сортировки по CID
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		created := base.Add(time.Duration(i/2) * time.Minute)
+		indexAt(t, idx, "posts", keyN(i), map[string]interface{}{"n": i}, created)
+	}
+
+	// collectPages проходит все страницы и возвращает ключи в порядке выдачи
+	collectPages := func(t *testing.T, query SearchQuery) []string {
+		var keys []string
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 10, "слишком много страниц")
+
+			page, err := idx.SearchRecordsPage(ctx, query)
+			require.NoError(t, err)
+			for _, r := range page.Results {
+				keys = append(keys, r.RKey)
+			}
+			if page.NextCursor == "" {
+				return keys
+			}
+			query.After = page.NextCursor
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query SearchQuery
+	}{
+		{"по умолчанию", SearchQuery{Collection: "posts", Limit: 7}},
+		{"created_at ASC", SearchQuery{Collection: "posts", Limit: 7, SortBy: "created_at", SortOrder: "ASC"}},
+		{"rkey DESC", SearchQuery{Collection: "posts", Limit: 4, SortBy: "rkey", SortOrder: "DESC"}},
+		{"полнотекстовый", SearchQuery{Collection: "posts", Limit: 6, FullTextQuery: "record"}},
+		{"несколько ключей", SearchQuery{Collection: "posts", Limit: 5, Sort: []SortSpec{
+			{Field: "created_at"}, {Field: "rkey", Desc: true},
+		}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paged := collectPages(t, tc.query)
+
+			// Полный результат без пагинации задает эталонный порядок
+			all := tc.query
+			all.Limit = 0
+			results, err := idx.SearchRecords(ctx, all)
+			require.NoError(t, err)
+			require.Len(t, results, 25)
+
+			expected := make([]string, 0, len(results))
+			for _, r := range results {
+				expected = append(expected, r.RKey)
+			}
+			assert.Equal(t, expected, paged)
+		})
+	}
+
+	t.Run("вставка между страницами", func(t *testing.T) {
+		query := SearchQuery{Collection: "posts", Limit: 10, SortBy: "rkey"}
+		first, err := idx.SearchRecordsPage(ctx, query)
+		require.NoError(t, err)
+		require.NotEmpty(t, first.NextCursor)
+
+		// Запись перед курсором не должна сдвигать следующую страницу
+		indexAt(t, idx, "posts", "r000a", nil, base)
+		t.Cleanup(func() { require.NoError(t, idx.DeleteRecord(ctx, testCID(t, "posts/r000a"))) })
+
+		query.After = first.NextCursor
+		second, err := idx.SearchRecordsPage(ctx, query)
+		require.NoError(t, err)
+		require.NotEmpty(t, second.Results)
+		assert.Equal(t, keyN(10), second.Results[0].RKey)
+	})
+
+	t.Run("смещение без лимита", func(t *testing.T) {
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", SortBy: "rkey", Offset: 20})
+		require.NoError(t, err)
+
+		keys := make([]string, 0, len(results))
+		for _, r := range results {
+			keys = append(keys, r.RKey)
+		}
+		assert.Equal(t, []string{keyN(20), keyN(21), keyN(22), keyN(23), keyN(24)}, keys)
+	})
+
+	t.Run("некорректный курсор", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", After: "not-a-cursor!"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("курсор другой сортировки", func(t *testing.T) {
+		page, err := idx.SearchRecordsPage(ctx, SearchQuery{Collection: "posts", Limit: 5, SortBy: "rkey"})
+		require.NoError(t, err)
+
+		_, err = idx.SearchRecords(ctx, SearchQuery{Collection: "posts", SortBy: "created_at", After: page.NextCursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("недопустимое поле сортировки", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, SearchQuery{SortBy: "created_at; DROP TABLE records"})
+		assert.Error(t, err)
+	})
+}
+
+// TestSearchSortDeterministic проверяет стабильный порядок записей
+// с одинаковыми ключами сортировки.
+func TestSearchSortDeterministic(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+
+	// Одинаковые время создания и текст дают равные created_at и релевантность
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var cids []string
+	for i := 0; i < 12; i++ {
+		c := indexAt(t, idx, "posts", keyN(i), map[string]interface{}{"group": i % 3}, created)
+		cids = append(cids, c.String())
+	}
+	sort.Strings(cids)
+
+	resultCIDs := func(query SearchQuery) []string {
+		results, err := idx.SearchRecords(ctx, query)
+		require.NoError(t, err)
+		out := make([]string, 0, len(results))
+		for _, r := range results {
+			out = append(out, r.CID.String())
+		}
+		return out
+	}
+
+	// Равные ключи упорядочиваются по CID в направлении первого ключа
+	reversed := make([]string, len(cids))
+	for i, c := range cids {
+		reversed[len(cids)-1-i] = c
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    SearchQuery
+		expected []string
+	}{
+		{"по умолчанию", SearchQuery{Collection: "posts"}, reversed},
+		{"created_at ASC", SearchQuery{Collection: "posts", SortBy: "created_at", SortOrder: "ASC"}, cids},
+		{"полнотекстовый", SearchQuery{Collection: "posts", FullTextQuery: "record"}, reversed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			first := resultCIDs(tc.query)
+			assert.Equal(t, tc.expected, first)
+			for i := 0; i < 5; i++ {
+				assert.Equal(t, first, resultCIDs(tc.query))
+			}
+		})
+	}
+
+	t.Run("несколько ключей", func(t *testing.T) {
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", Sort: []SortSpec{
+			{Field: "created_at"}, {Field: "rkey", Desc: true},
+		}})
+		require.NoError(t, err)
+		require.Len(t, results, 12)
+		for i, r := range results {
+			assert.Equal(t, keyN(11-i), r.RKey)
+		}
+
+		// Sort имеет приоритет над SortBy
+		results, err = idx.SearchRecords(ctx, SearchQuery{Collection: "posts", SortBy: "rkey",
+			Sort: []SortSpec{{Field: "rkey", Desc: true}}})
+		require.NoError(t, err)
+		assert.Equal(t, keyN(11), results[0].RKey)
+	})
+
+	t.Run("релевантность и поле", func(t *testing.T) {
+		if !idx.HasFTS() {
+			t.Skip("FTS5 недоступен")
+		}
+
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", FullTextQuery: "record",
+			Sort: []SortSpec{{Field: "relevance", Desc: true}, {Field: "rkey"}}})
+		require.NoError(t, err)
+		require.Len(t, results, 12)
+		for i, r := range results {
+			assert.Equal(t, keyN(i), r.RKey)
+		}
+	})
+
+	t.Run("некорректные ключи", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, SearchQuery{Sort: []SortSpec{{Field: "rkey"}, {Field: "rkey"}}})
+		assert.Error(t, err)
+
+		_, err = idx.SearchRecords(ctx, SearchQuery{Sort: []SortSpec{{Field: "relevance"}}})
+		assert.Error(t, err)
+
+		_, err = idx.SearchRecords(ctx, SearchQuery{Sort: []SortSpec{{Field: "data"}}})
+		assert.Error(t, err)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ФИЛЬТРОВ
+// ========================================
+
+// TestSearchFilterClauses проверяет сравнения, диапазоны и списки в Clauses.
+func TestSearchFilterClauses(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+
+	// Значения likes приходят как из Go (int), так и из JSON (float64)
+	indexData(t, idx, "posts", "a", map[string]interface{}{"likes": 10, "status": "draft"}, "")
+	indexData(t, idx, "posts", "b", map[string]interface{}{"likes": float64(40), "status": "published"}, "")
+	indexData(t, idx, "posts", "c", map[string]interface{}{"likes": 41.5, "status": "published"}, "")
+	indexData(t, idx, "posts", "d", map[string]interface{}{"likes": 100, "status": "review"}, "")
+	indexData(t, idx, "posts", "e", map[string]interface{}{"status": "draft"}, "")
+
+	search := func(query SearchQuery) []string {
+		query.Collection = "posts"
+		results, err := idx.SearchRecords(ctx, query)
+		require.NoError(t, err)
+		return resultKeys(results)
+	}
+	where := func(clauses ...FilterClause) SearchQuery {
+		return SearchQuery{Clauses: clauses}
+	}
+
+	t.Run("численные сравнения", func(t *testing.T) {
+		assert.Equal(t, []string{"b", "c", "d"}, search(where(FilterClause{"likes", FilterGte, 40})))
+		assert.Equal(t, []string{"c", "d"}, search(where(FilterClause{"likes", FilterGt, 40})))
+		assert.Equal(t, []string{"a"}, search(where(FilterClause{"likes", FilterLt, 40.0})))
+		assert.Equal(t, []string{"a", "b"}, search(where(FilterClause{"likes", FilterLte, int64(40)})))
+
+		// Числовое сравнение, а не строковое: "100" < "40" как строки
+		assert.Equal(t, []string{"d"}, search(where(FilterClause{"likes", FilterGt, 50})))
+	})
+
+	t.Run("диапазон", func(t *testing.T) {
+		got := search(where(
+			FilterClause{"likes", FilterGte, 20},
+			FilterClause{"likes", FilterLte, 50},
+		))
+		assert.Equal(t, []string{"b", "c"}, got)
+	})
+
+	t.Run("равенство числа из JSON", func(t *testing.T) {
+		assert.Equal(t, []string{"b"}, search(where(FilterClause{"likes", FilterEq, 40})))
+		assert.Equal(t, []string{"b"}, search(where(FilterClause{"likes", FilterEq, json.Number("40.0")})))
+	})
+
+	t.Run("не равно", func(t *testing.T) {
+		// Записи без атрибута тоже удовлетворяют ne
+		assert.Equal(t, []string{"a", "c", "d", "e"}, search(where(FilterClause{"likes", FilterNe, 40})))
+	})
+
+	t.Run("in", func(t *testing.T) {
+		assert.Equal(t, []string{"a", "d", "e"}, search(where(FilterClause{"status", FilterIn, []string{"draft", "review"}})))
+		assert.Equal(t, []string{"a", "d"}, search(where(FilterClause{"likes", FilterIn, []interface{}{10, 100.0, "x"}})))
+		assert.Empty(t, search(where(FilterClause{"status", FilterIn, []string{}})))
+	})
+
+	t.Run("карта Filters работает как eq", func(t *testing.T) {
+		got := search(SearchQuery{
+			Filters: map[string]interface{}{"status": "published"},
+			Clauses: []FilterClause{{"likes", FilterGt, 41}},
+		})
+		assert.Equal(t, []string{"c"}, got)
+	})
+
+	t.Run("некорректные условия", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, where(FilterClause{"likes", "like", 1}))
+		assert.Error(t, err)
+
+		_, err = idx.SearchRecords(ctx, where(FilterClause{"likes", FilterIn, 1}))
+		assert.Error(t, err)
+	})
+}
+
+// TestSearchJSONPathFilters проверяет фильтры по вложенным полям Data.
+func TestSearchJSONPathFilters(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+	seedDemoPosts(t, idx)
+
+	search := func(clauses ...FilterClause) []string {
+		results, err := idx.SearchRecords(ctx, SearchQuery{Clauses: clauses})
+		require.NoError(t, err)
+		return resultKeys(results)
+	}
+
+	t.Run("вложенный объект", func(t *testing.T) {
+		assert.Equal(t, []string{"alice"}, search(FilterClause{"$.address.city", FilterEq, "Berlin"}))
+		assert.Equal(t, []string{"post3"}, search(FilterClause{"$.meta.lang", FilterEq, "ru"}))
+		assert.Equal(t, []string{"post1", "post2", "post4", "post6"},
+			search(FilterClause{"$.meta.lang", FilterIn, []string{"en", "de"}}))
+
+		// Карта Filters принимает те же пути
+		results, err := idx.SearchRecords(ctx, SearchQuery{Filters: map[string]interface{}{"$.address.city": "Paris"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bob"}, resultKeys(results))
+	})
+
+	t.Run("элементы массива", func(t *testing.T) {
+		assert.Equal(t, []string{"alice"}, search(FilterClause{"$.skills", FilterEq, "go"}))
+		assert.Equal(t, []string{"alice", "bob"}, search(FilterClause{"$.skills", FilterIn, []string{"sql", "rust"}}))
+		assert.Equal(t, []string{"bob"}, search(
+			FilterClause{"$.skills", FilterNe, "go"},
+			FilterClause{Field: "skills", Op: FilterExists},
+		))
+	})
+
+	t.Run("типы значений", func(t *testing.T) {
+		assert.Equal(t, []string{"post1", "post6"}, search(FilterClause{"$.likes", FilterGt, 40}))
+		assert.Equal(t, []string{"post3", "post5"}, search(FilterClause{"$.published", FilterEq, false}))
+
+		// Строка "42" не совпадает с числом 42
+		assert.Empty(t, search(FilterClause{"$.likes", FilterEq, "42"}))
+	})
+
+	t.Run("отсутствующий путь", func(t *testing.T) {
+		assert.Empty(t, search(FilterClause{"$.address.zip", FilterEq, "10115"}))
+		assert.Empty(t, search(FilterClause{"$.meta.lang.code", FilterEq, "en"}))
+
+		// ne выбирает и записи без поля
+		assert.Equal(t, []string{"alice", "bob", "post3", "post5"},
+			search(FilterClause{"$.meta.lang", FilterNe, "en"}))
+	})
+
+	t.Run("существование поля", func(t *testing.T) {
+		assert.Equal(t, []string{"alice", "bob"}, search(FilterClause{Field: "address", Op: FilterExists}))
+		assert.Equal(t, []string{"alice", "bob", "post5"},
+			search(FilterClause{Field: "$.meta.lang", Op: FilterExists, Value: false}))
+
+		_, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"meta", FilterExists, "yes"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("некорректный путь", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"$.address..city", FilterEq, "x"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("ключ верхнего уровня с точкой", func(t *testing.T) {
+		now := time.Now()
+		for rkey, data := range map[string]map[string]interface{}{
+			"flat":   {"app.version": "1.0"},
+			"nested": {"app": map[string]interface{}{"version": "1.0"}},
+		} {
+			require.NoError(t, idx.IndexRecord(ctx, testCID(t, "apps/"+rkey), IndexMetadata{
+				Collection: "apps",
+				RKey:       rkey,
+				Data:       data,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}))
+		}
+
+		find := func(query SearchQuery) []string {
+			query.Collection = "apps"
+			results, err := idx.SearchRecords(ctx, query)
+			require.NoError(t, err)
+			return resultKeys(results)
+		}
+
+		// Имя без префикса "$." - атрибут верхнего уровня, а не путь
+		assert.Equal(t, []string{"flat"}, find(SearchQuery{Filters: map[string]interface{}{"app.version": "1.0"}}))
+		assert.Equal(t, []string{"flat"}, find(SearchQuery{Clauses: []FilterClause{{"app.version", FilterEq, "1.0"}}}))
+		assert.Equal(t, []string{"flat"}, find(SearchQuery{Clauses: []FilterClause{{Field: "app.version", Op: FilterExists}}}))
+
+		assert.Equal(t, []string{"nested"}, find(SearchQuery{Filters: map[string]interface{}{"$.app.version": "1.0"}}))
+	})
+}
+
+// ========================================
+// ТЕСТЫ АГРЕГАЦИИ
+// ========================================
+
+// TestAggregate проверяет фасетные подсчеты по полям данных и колонкам записи.
+func TestAggregate(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+	seedDemoPosts(t, idx)
+
+	t.Run("по автору", func(t *testing.T) {
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{Collection: "posts", GroupBy: "author"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{
+			{Value: "alice", Count: 3},
+			{Value: "bob", Count: 2},
+			{Value: "carol", Count: 1},
+		}, buckets)
+	})
+
+	t.Run("по статусу публикации", func(t *testing.T) {
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{Collection: "posts", GroupBy: "published"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{
+			{Value: true, Count: 4},
+			{Value: false, Count: 2},
+		}, buckets)
+	})
+
+	t.Run("вложенное поле", func(t *testing.T) {
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{Collection: "posts", GroupBy: "$.meta.lang"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{
+			{Value: "en", Count: 4},
+			{Value: "ru", Count: 1},
+			{Value: nil, Count: 1},
+		}, buckets)
+	})
+
+	t.Run("с фильтром и лимитом", func(t *testing.T) {
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{
+			Collection: "posts",
+			GroupBy:    "author",
+			Filters:    map[string]interface{}{"published": true},
+			Limit:      1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{{Value: "alice", Count: 2}}, buckets)
+	})
+
+	t.Run("по типу записи", func(t *testing.T) {
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{GroupBy: "record_type"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{
+			{Value: "post", Count: 6},
+			{Value: "user", Count: 2},
+		}, buckets)
+	})
+
+	t.Run("некорректное поле", func(t *testing.T) {
+		_, err := idx.Aggregate(ctx, AggregateQuery{GroupBy: ""})
+		assert.Error(t, err)
+
+		_, err = idx.Aggregate(ctx, AggregateQuery{GroupBy: `$.a..b`})
+		assert.Error(t, err)
+
+		_, err = idx.Aggregate(ctx, AggregateQuery{GroupBy: `a"b`})
+		assert.Error(t, err)
+	})
+
+	t.Run("ключ верхнего уровня с точкой", func(t *testing.T) {
+		now := time.Now()
+		for rkey, data := range map[string]map[string]interface{}{
+			"flat":   {"app.version": "1.0"},
+			"nested": {"app": map[string]interface{}{"version": "2.0"}},
+		} {
+			require.NoError(t, idx.IndexRecord(ctx, testCID(t, "apps/"+rkey), IndexMetadata{
+				Collection: "apps",
+				RKey:       rkey,
+				Data:       data,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}))
+		}
+
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{Collection: "apps", GroupBy: "app.version"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{{Value: "1.0", Count: 1}, {Value: nil, Count: 1}}, buckets)
+
+		buckets, err = idx.Aggregate(ctx, AggregateQuery{Collection: "apps", GroupBy: "$.app.version"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{{Value: "2.0", Count: 1}, {Value: nil, Count: 1}}, buckets)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПАКЕТНОЙ ИНДЕКСАЦИИ
+// ========================================
+
+// TestBatchIndexRecords проверяет пакетную загрузку и ее атомарность.
+func TestBatchIndexRecords(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+
+	t.Run("успешный пакет", func(t *testing.T) {
+		records := makeIndexedRecords(t, "posts", 50)
+		require.NoError(t, idx.BatchIndexRecords(ctx, records))
+
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		assert.Len(t, results, 50)
+
+		// Атрибуты индексируются вместе с записями
+		results, err = idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"n", FilterLt, 10}}})
+		require.NoError(t, err)
+		assert.Len(t, results, 10)
+	})
+
+	t.Run("ошибка откатывает весь пакет", func(t *testing.T) {
+		records := makeIndexedRecords(t, "broken", 10)
+		// Канал нельзя сериализовать в JSON
+		records[7].Metadata.Data["bad"] = make(chan int)
+
+		err := idx.BatchIndexRecords(ctx, records)
+		require.Error(t, err)
+
+		var batchErr *BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 7, batchErr.Index)
+		assert.Equal(t, records[7].CID, batchErr.CID)
+
+		results, err := idx.SearchRecords(ctx, SearchQuery{Collection: "broken"})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("пустой пакет", func(t *testing.T) {
+		assert.NoError(t, idx.BatchIndexRecords(ctx, nil))
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПОИСКА ЗАПИСИ
+// ========================================
+
+// TestGetRecord проверяет поиск записи по CID и по ключу.
+func TestGetRecord(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+	seedDemoPosts(t, idx)
+
+	t.Run("по CID", func(t *testing.T) {
+		rec, ok, err := idx.GetRecordByCID(ctx, testCID(t, "posts/post4"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "posts", rec.Collection)
+		assert.Equal(t, "post4", rec.RKey)
+		assert.Equal(t, "post", rec.RecordType)
+		assert.Equal(t, "bob", rec.Data["author"])
+	})
+
+	t.Run("по ключу", func(t *testing.T) {
+		rec, ok, err := idx.GetRecordByKey(ctx, "users", "alice")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, testCID(t, "users/alice"), rec.CID)
+	})
+
+	t.Run("отсутствующая запись", func(t *testing.T) {
+		rec, ok, err := idx.GetRecordByCID(ctx, testCID(t, "missing"))
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, rec)
+
+		_, ok, err = idx.GetRecordByKey(ctx, "posts", "missing")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("поиск использует индекс", func(t *testing.T) {
+		for _, q := range []string{
+			"SELECT * FROM records WHERE cid = 'x'",
+			"SELECT * FROM records WHERE collection = 'x' AND rkey = 'y'",
+		} {
+			rows, err := idx.db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+q)
+			require.NoError(t, err)
+
+			var plan []string
+			for rows.Next() {
+				var id, parent, notused int
+				var detail string
+				require.NoError(t, rows.Scan(&id, &parent, &notused, &detail))
+				plan = append(plan, detail)
+			}
+			require.NoError(t, rows.Close())
+
+			require.Len(t, plan, 1, q)
+			assert.Contains(t, plan[0], "USING INDEX", q)
+		}
+	})
+}
+
+// ========================================
+// ТЕСТЫ УДАЛЕНИЯ
+// ========================================
+
+// TestDeleteCollectionAndQuery проверяет массовое удаление и подсчет удаленных записей.
+func TestDeleteCollectionAndQuery(t *testing.T) {
+	ctx := context.Background()
+
+	// attributeCount возвращает число строк атрибутов, оставшихся в индексе
+	attributeCount := func(t *testing.T, idx *SimpleSQLiteIndexer) int {
+		var n int
+		require.NoError(t, idx.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM record_attributes").Scan(&n))
+		return n
+	}
+
+	t.Run("удаление коллекции", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		seedDemoPosts(t, idx)
+
+		n, err := idx.DeleteCollection(ctx, "posts")
+		require.NoError(t, err)
+		assert.Equal(t, 6, n)
+
+		posts, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		assert.Empty(t, posts)
+
+		// Другие коллекции не затронуты, атрибуты удалены триггером
+		users, err := idx.SearchRecords(ctx, SearchQuery{Collection: "users"})
+		require.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, 2*3, attributeCount(t, idx))
+
+		// Полнотекстовый поиск не находит удаленных записей
+		found, err := idx.SearchRecords(ctx, SearchQuery{FullTextQuery: "draft"})
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		n, err = idx.DeleteCollection(ctx, "posts")
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("одинаковое содержимое под двумя ключами", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		c := testCID(t, "shared")
+		for _, key := range []struct{ collection, rkey string }{{"posts", "p1"}, {"archive", "p1"}} {
+			require.NoError(t, idx.IndexRecord(ctx, c, IndexMetadata{
+				Collection: key.collection, RKey: key.rkey, RecordType: "post",
+				Data: map[string]interface{}{"likes": 3}, SearchText: "shared",
+			}))
+		}
+
+		both, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"likes", FilterEq, 3}}})
+		require.NoError(t, err)
+		assert.Len(t, both, 2)
+
+		// Атрибуты общие и живут, пока остается хотя бы одна запись CID
+		require.NoError(t, idx.DeleteRecordByKey(ctx, "posts", "p1"))
+		left, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"likes", FilterEq, 3}}})
+		require.NoError(t, err)
+		require.Len(t, left, 1)
+		assert.Equal(t, "archive", left[0].Collection)
+
+		require.NoError(t, idx.DeleteRecordByKey(ctx, "archive", "p1"))
+		assert.Zero(t, attributeCount(t, idx))
+	})
+
+	t.Run("удаление по запросу", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		seedDemoPosts(t, idx)
+
+		n, err := idx.DeleteByQuery(ctx, SearchQuery{
+			Collection: "posts",
+			Filters:    map[string]interface{}{"published": false},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		remaining, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post1", "post2", "post4", "post6"}, resultKeys(remaining))
+
+		// Текстовый запрос и сравнения
+		n, err = idx.DeleteByQuery(ctx, SearchQuery{
+			FullTextQuery: "go",
+			Clauses:       []FilterClause{{"likes", FilterGte, 41}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		remaining, err = idx.SearchRecords(ctx, SearchQuery{Collection: "posts"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"post2", "post4", "post6"}, resultKeys(remaining))
+	})
+
+	t.Run("нет совпадений", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		seedDemoPosts(t, idx)
+
+		n, err := idx.DeleteByQuery(ctx, SearchQuery{Collection: "missing"})
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("запрос без условий отклоняется", func(t *testing.T) {
+		idx := createTestIndexer(t)
+		seedDemoPosts(t, idx)
+
+		_, err := idx.DeleteByQuery(ctx, SearchQuery{Limit: 10, FullTextQuery: "-"})
+		assert.Error(t, err)
+
+		all, err := idx.SearchRecords(ctx, SearchQuery{})
+		require.NoError(t, err)
+		assert.Len(t, all, 8)
+	})
+}
+
+// ========================================
+// ТЕСТЫ МИГРАЦИИ И ПЕРЕИНДЕКСАЦИИ
+// ========================================
+
+// TestSchemaMigration проверяет автоматическую миграцию базы исходной схемы.
+func TestSchemaMigration(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.db")
+
+	// Создаем базу версии 1: без index_meta и с записью, атрибуты которой
+	// не были сохранены
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE records (
+			cid TEXT PRIMARY KEY,
+			collection TEXT NOT NULL,
+			rkey TEXT NOT NULL,
+			record_type TEXT NOT NULL,
+			data TEXT NOT NULL,
+			search_text TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(collection, rkey)
+		);
+		CREATE TABLE record_attributes (
+			cid TEXT NOT NULL,
+			attribute_name TEXT NOT NULL,
+			attribute_value TEXT NOT NULL,
+			value_type TEXT NOT NULL,
+			PRIMARY KEY (cid, attribute_name),
+			FOREIGN KEY (cid) REFERENCES records(cid) ON DELETE CASCADE
+		);
+	`)
+	require.NoError(t, err)
+	c := testCID(t, "posts/old")
+	_, err = db.Exec(`INSERT INTO records (cid, collection, rkey, record_type, data, search_text)
+		VALUES (?, 'posts', 'old', 'post', '{"author":"alice","likes":7}', 'legacy post')`, c.String())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	idx, err := NewSimpleSQLiteIndexer(path)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	assert.Equal(t, currentSchemaVersion, idx.SchemaVersion())
+
+	// Миграция восстановила атрибуты из data
+	results, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"likes", FilterGt, 5}}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, c, results[0].CID)
+
+	// Записи ключуются по (collection, rkey): тот же CID индексируется
+	// под вторым ключом, не заменяя первый
+	require.NoError(t, idx.IndexRecord(ctx, c, IndexMetadata{
+		Collection: "archive", RKey: "old", RecordType: "post",
+		Data: map[string]interface{}{"author": "alice", "likes": 7},
+	}))
+	results, err = idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"likes", FilterGt, 5}}})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// Версия сохранена: повторное открытие не требует миграции
+	require.NoError(t, idx.Close())
+	idx, err = NewSimpleSQLiteIndexer(path)
+	require.NoError(t, err)
+	version, found, err := readSchemaVersion(ctx, idx.db)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, currentSchemaVersion, version)
+
+	// Колонка срока жизни добавлена в существующую таблицу
+	expired := testCID(t, "posts/expired")
+	require.NoError(t, idx.IndexRecord(ctx, expired, IndexMetadata{
+		Collection: "posts", RKey: "expired", RecordType: "post",
+		CreatedAt: time.Now(), UpdatedAt: time.Now(), ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+	purged, err := idx.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	t.Run("база более новой версии", func(t *testing.T) {
+		_, err := idx.db.Exec("UPDATE index_meta SET value = ? WHERE key = 'schema_version'", currentSchemaVersion+1)
+		require.NoError(t, err)
+
+		_, err = NewSimpleSQLiteIndexer(path)
+		assert.Error(t, err)
+	})
+}
+
+// TestReindex проверяет перестроение индекса и его атомарность.
+func TestReindex(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+	seedDemoPosts(t, idx)
+
+	t.Run("перестроение из источника", func(t *testing.T) {
+		records := makeIndexedRecords(t, "notes", 20)
+		err := idx.Reindex(ctx, func(yield func(cid.Cid, IndexMetadata) bool) {
+			for _, rec := range records {
+				if !yield(rec.CID, rec.Metadata) {
+					return
+				}
+			}
+		})
+		require.NoError(t, err)
+
+		all, err := idx.SearchRecords(ctx, SearchQuery{})
+		require.NoError(t, err)
+		assert.Len(t, all, 20)
+
+		filtered, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"n", FilterGte, 15}}})
+		require.NoError(t, err)
+		assert.Len(t, filtered, 5)
+
+		found, err := idx.SearchRecords(ctx, SearchQuery{FullTextQuery: "r019"})
+		require.NoError(t, err)
+		assert.Len(t, found, 1)
+	})
+
+	t.Run("ошибка посередине не теряет данные", func(t *testing.T) {
+		records := makeIndexedRecords(t, "broken", 10)
+		records[5].Metadata.Data["bad"] = make(chan int)
+
+		yielded := 0
+		err := idx.Reindex(ctx, func(yield func(cid.Cid, IndexMetadata) bool) {
+			for _, rec := range records {
+				yielded++
+				if !yield(rec.CID, rec.Metadata) {
+					return
+				}
+			}
+		})
+		var batchErr *BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 5, batchErr.Index)
+		assert.Equal(t, 6, yielded, "перечисление должно остановиться на ошибке")
+
+		// Индекс остался в состоянии после предыдущей переиндексации
+		all, err := idx.SearchRecords(ctx, SearchQuery{})
+		require.NoError(t, err)
+		assert.Len(t, all, 20)
+
+		filtered, err := idx.SearchRecords(ctx, SearchQuery{Clauses: []FilterClause{{"n", FilterLt, 3}}})
+		require.NoError(t, err)
+		assert.Len(t, filtered, 3)
+	})
+}
+
+// ========================================
+// ТЕСТЫ СРОКА ЖИЗНИ ЗАПИСЕЙ
+// ========================================
+
+// TestRecordExpiry проверяет скрытие истекших записей и их удаление.
+func TestRecordExpiry(t *testing.T) {
+	idx := createTestIndexer(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	index := func(rkey string, expiresAt time.Time) {
+		err := idx.IndexRecord(ctx, testCID(t, "cache/"+rkey), IndexMetadata{
+			Collection: "cache",
+			RKey:       rkey,
+			RecordType: "entry",
+			Data:       map[string]interface{}{"kind": "entry"},
+			SearchText: "cached entry " + rkey,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			ExpiresAt:  expiresAt,
+		})
+		require.NoError(t, err)
+	}
+	index("permanent", time.Time{})
+	index("fresh", now.Add(time.Hour))
+	index("stale", now.Add(-time.Second))
+	index("old", now.Add(-24*time.Hour))
+
+	search := func(query SearchQuery) []string {
+		query.Collection = "cache"
+		results, err := idx.SearchRecords(ctx, query)
+		require.NoError(t, err)
+		return resultKeys(results)
+	}
+
+	t.Run("истекшие записи скрыты", func(t *testing.T) {
+		assert.Equal(t, []string{"fresh", "permanent"}, search(SearchQuery{}))
+		assert.Equal(t, []string{"fresh", "permanent"}, search(SearchQuery{FullTextQuery: "cached"}))
+		assert.Equal(t, []string{"fresh", "permanent"}, search(SearchQuery{Filters: map[string]interface{}{"kind": "entry"}}))
+
+		_, found, err := idx.GetRecordByKey(ctx, "cache", "stale")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		buckets, err := idx.Aggregate(ctx, AggregateQuery{Collection: "cache", GroupBy: "kind"})
+		require.NoError(t, err)
+		assert.Equal(t, []AggregateBucket{{Value: "entry", Count: 2}}, buckets)
+	})
+
+	t.Run("IncludeExpired", func(t *testing.T) {
+		assert.Equal(t, []string{"fresh", "old", "permanent", "stale"}, search(SearchQuery{IncludeExpired: true}))
+		assert.Equal(t, []string{"fresh", "old", "permanent", "stale"},
+			search(SearchQuery{FullTextQuery: "cached", IncludeExpired: true}))
+	})
+
+	t.Run("продление срока при переиндексации", func(t *testing.T) {
+		index("stale", now.Add(time.Hour))
+		assert.Equal(t, []string{"fresh", "permanent", "stale"}, search(SearchQuery{}))
+		index("stale", now.Add(-time.Second))
+	})
+
+	t.Run("PurgeExpired", func(t *testing.T) {
+		purged, err := idx.PurgeExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, purged)
+
+		assert.Equal(t, []string{"fresh", "permanent"}, search(SearchQuery{IncludeExpired: true}))
+
+		// Атрибуты удалены вместе с записями
+		var attrs int
+		require.NoError(t, idx.db.QueryRow("SELECT COUNT(*) FROM record_attributes").Scan(&attrs))
+		assert.Equal(t, 2, attrs)
+
+		purged, err = idx.PurgeExpired(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, purged)
+	})
+}
+
+// TestSQLiteIndexerSearch проверяет, что SQLiteIndexer учитывает срок жизни
+// записей и курсор пагинации как в полнотекстовом, так и в структурированном поиске.
+func TestSQLiteIndexerSearch(t *testing.T) {
+	idx, err := NewSQLiteIndexer(filepath.Join(t.TempDir(), "fts.db"))
+	if err != nil {
+		t.Skip("FTS5 недоступен: запустите тесты с -tags sqlite_fts5")
+	}
+	t.Cleanup(func() { idx.Close() })
+
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		expiresAt := time.Time{}
+		if i == 4 {
+			expiresAt = now.Add(-time.Minute)
+		}
+		rkey := fmt.Sprintf("entry%d", i)
+		require.NoError(t, idx.IndexRecord(ctx, testCID(t, "cache/"+rkey), IndexMetadata{
+			Collection: "cache",
+			RKey:       rkey,
+			RecordType: "entry",
+			Data:       map[string]interface{}{"kind": "entry"},
+			SearchText: "cached entry",
+			CreatedAt:  now.Add(time.Duration(i) * time.Second),
+			UpdatedAt:  now,
+			ExpiresAt:  expiresAt,
+		}))
+	}
+
+	search := func(query SearchQuery) []string {
+		results, err := idx.SearchRecords(ctx, query)
+		require.NoError(t, err)
+		return resultKeys(results)
+	}
+
+	live := []string{"entry0", "entry1", "entry2", "entry3"}
+	all := []string{"entry0", "entry1", "entry2", "entry3", "entry4"}
+
+	t.Run("истекшие записи скрыты", func(t *testing.T) {
+		assert.Equal(t, live, search(SearchQuery{Collection: "cache"}))
+		assert.Equal(t, live, search(SearchQuery{FullTextQuery: "cached"}))
+
+		assert.Equal(t, all, search(SearchQuery{Collection: "cache", IncludeExpired: true}))
+		assert.Equal(t, all, search(SearchQuery{FullTextQuery: "cached", IncludeExpired: true}))
+	})
+
+	for name, query := range map[string]SearchQuery{
+		"курсор полнотекстового поиска":    {FullTextQuery: "cached", Limit: 3},
+		"курсор структурированного поиска": {Collection: "cache", Limit: 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var keys []string
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 3, "пагинация не должна зацикливаться")
+
+				page, err := idx.SearchRecordsPage(ctx, query)
+				require.NoError(t, err)
+				for _, r := range page.Results {
+					keys = append(keys, r.RKey)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.After = page.NextCursor
+			}
+
+			sort.Strings(keys)
+			assert.Equal(t, live, keys)
+		})
+	}
+
+	t.Run("смещение без лимита", func(t *testing.T) {
+		assert.Equal(t, live[1:], search(SearchQuery{Collection: "cache", SortBy: "rkey", Offset: 1}))
+		assert.Equal(t, live[1:], search(SearchQuery{FullTextQuery: "cached", SortBy: "rkey", Offset: 1}))
+	})
+
+	t.Run("поврежденный курсор", func(t *testing.T) {
+		_, err := idx.SearchRecords(ctx, SearchQuery{FullTextQuery: "cached", After: "не курсор"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+// ========================================
+// ТЕСТЫ ПАРАЛЛЕЛЬНОГО ДОСТУПА
+// ========================================
+
+// TestConcurrentAccess проверяет параллельную индексацию и поиск, в том числе
+// двумя экземплярами индексера над одной базой, без ошибок блокировки.
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.db")
+
+	first, err := NewSimpleSQLiteIndexer(path)
+	require.NoError(t, err)
+	defer first.Close()
+
+	// Второй экземпляр имеет собственный мьютекс, поэтому конкуренция
+	// за базу разрешается только блокировками SQLite
+	second, err := NewSimpleSQLiteIndexer(path)
+	require.NoError(t, err)
+	defer second.Close()
+
+	const (
+		writers   = 8
+		readers   = 8
+		perWriter = 25
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, (writers+readers)*perWriter)
+
+	for w := 0; w < writers; w++ {
+		idx := first
+		if w%2 == 1 {
+			idx = second
+		}
+		wg.Add(1)
+		go func(w int, idx *SimpleSQLiteIndexer) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// Одиночные записи чередуются с пакетами, чтобы транзакции
+				// записи разной длины пересекались с чтениями
+				rkey := fmt.Sprintf("w%d-%03d", w, i)
+				metadata := IndexMetadata{
+					Collection: "posts",
+					RKey:       rkey,
+					RecordType: "post",
+					Data:       map[string]interface{}{"writer": w, "n": i},
+					SearchText: "concurrent post " + rkey,
+					CreatedAt:  time.Now(),
+					UpdatedAt:  time.Now(),
+				}
+
+				var err error
+				if i%5 == 0 {
+					batch := makeIndexedRecords(t, fmt.Sprintf("batch-w%d-%03d", w, i), 20)
+					err = idx.BatchIndexRecords(ctx, append(batch, IndexedRecord{CID: testCID(t, "posts/"+rkey), Metadata: metadata}))
+				} else {
+					err = idx.IndexRecord(ctx, testCID(t, "posts/"+rkey), metadata)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("index %s: %w", rkey, err)
+				}
+			}
+		}(w, idx)
+	}
+
+	for r := 0; r < readers; r++ {
+		idx := first
+		if r%2 == 1 {
+			idx = second
+		}
+		wg.Add(1)
+		go func(idx *SimpleSQLiteIndexer) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if _, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts", FullTextQuery: "concurrent", Limit: 10}); err != nil {
+					errs <- fmt.Errorf("search: %w", err)
+				}
+				if _, err := idx.Aggregate(ctx, AggregateQuery{Collection: "posts", GroupBy: "writer"}); err != nil {
+					errs <- fmt.Errorf("aggregate: %w", err)
+				}
+			}
+		}(idx)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stats, err := first.GetCollectionStats(ctx, "posts")
+	require.NoError(t, err)
+	assert.EqualValues(t, writers*perWriter, stats["record_count"])
+}
+
+// TestCloseWhileInUse проверяет, что Close безопасен при параллельных операциях.
+func TestCloseWhileInUse(t *testing.T) {
+	idx, err := NewSimpleSQLiteIndexer(filepath.Join(t.TempDir(), "index.db"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				rkey := fmt.Sprintf("g%d-%d", g, i)
+				err := idx.IndexRecord(ctx, testCID(t, rkey), IndexMetadata{
+					Collection: "posts", RKey: rkey, RecordType: "post",
+					Data: map[string]interface{}{"n": i}, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+				})
+				if err != nil {
+					assert.ErrorIs(t, err, ErrClosed)
+					return
+				}
+				if _, err := idx.SearchRecords(ctx, SearchQuery{Collection: "posts"}); err != nil {
+					assert.ErrorIs(t, err, ErrClosed)
+					return
+				}
+			}
+		}(g)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, idx.Close())
+	wg.Wait()
+
+	// Повторное закрытие и вызовы после закрытия
+	assert.NoError(t, idx.Close())
+	_, err = idx.SearchRecords(ctx, SearchQuery{})
+	assert.ErrorIs(t, err, ErrClosed)
+	_, _, err = idx.GetRecordByKey(ctx, "posts", "g0-0")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+// ========================================
+// БЕНЧМАРКИ
+// ========================================
+
+// benchRecords - размер загружаемого набора в бенчмарках индексации.
+const benchRecords = 10000
+
+// BenchmarkIndexRecordLoop измеряет загрузку набора вызовами IndexRecord.
+func BenchmarkIndexRecordLoop(b *testing.B) {
+	records := makeIndexedRecords(b, "posts", benchRecords)
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		idx := createTestIndexer(b)
+		b.StartTimer()
+
+		for _, rec := range records {
+			if err := idx.IndexRecord(ctx, rec.CID, rec.Metadata); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkBatchIndexRecords измеряет загрузку того же набора одним пакетом.
+func BenchmarkBatchIndexRecords(b *testing.B) {
+	records := makeIndexedRecords(b, "posts", benchRecords)
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		idx := createTestIndexer(b)
+		b.StartTimer()
+
+		if err := idx.BatchIndexRecords(ctx, records); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// ========================================
+// ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ
+// ========================================
+
+// createTestIndexer создаёт индексер во временной директории теста.
+func createTestIndexer(t testing.TB) *SimpleSQLiteIndexer {
+	t.Helper()
+
+	return createTestIndexerWithOptions(t, Options{})
+}
+
+// createTestIndexerWithOptions создаёт индексер с заданными параметрами.
+func createTestIndexerWithOptions(t testing.TB, opts Options) *SimpleSQLiteIndexer {
+	t.Helper()
+
+	idx, err := NewSimpleSQLiteIndexerWithOptions(filepath.Join(t.TempDir(), "index.db"), opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { idx.Close() })
+
+	return idx
+}
+
+// testCID создаёт детерминированный CID для тестовых данных.
+func testCID(t testing.TB, data string) cid.Cid {
+	t.Helper()
+
+	mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+
+	return cid.NewCidV1(cid.DagCBOR, mh)
+}
+
+// indexText индексирует запись коллекции "posts" с заданным текстом.
+func indexText(t testing.TB, idx *SimpleSQLiteIndexer, rkey, text string) cid.Cid {
+	t.Helper()
+
+	return indexData(t, idx, "posts", rkey, map[string]interface{}{"text": text}, text)
+}
+
+// indexData индексирует запись с данными data и текстом для поиска.
+func indexData(t testing.TB, idx *SimpleSQLiteIndexer, collection, rkey string, data map[string]interface{}, text string) cid.Cid {
+	t.Helper()
+
+	c := testCID(t, collection+"/"+rkey)
+	now := time.Now()
+	err := idx.IndexRecord(context.Background(), c, IndexMetadata{
+		Collection: collection,
+		RKey:       rkey,
+		RecordType: collection,
+		Data:       data,
+		SearchText: text,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	require.NoError(t, err)
+
+	return c
+}
+
+// seedDemoPosts заполняет индекс демонстрационными постами и пользователями.
+func seedDemoPosts(t testing.TB, idx *SimpleSQLiteIndexer) {
+	t.Helper()
+
+	posts := []struct {
+		rkey, author, text string
+		published          bool
+		lang               string
+		likes              int
+	}{
+		{"post1", "alice", "distributed systems in go", true, "en", 42},
+		{"post2", "alice", "consensus algorithms", true, "en", 17},
+		{"post3", "alice", "draft notes", false, "ru", 0},
+		{"post4", "bob", "rust and go compared", true, "en", 40},
+		{"post5", "bob", "unfinished draft", false, "", 3},
+		{"post6", "carol", "sqlite full-text search", true, "en", 99},
+	}
+
+	now := time.Now()
+	for _, p := range posts {
+		data := map[string]interface{}{
+			"author":    p.author,
+			"text":      p.text,
+			"published": p.published,
+			"likes":     p.likes,
+		}
+		if p.lang != "" {
+			data["meta"] = map[string]interface{}{"lang": p.lang}
+		}
+
+		err := idx.IndexRecord(context.Background(), testCID(t, "posts/"+p.rkey), IndexMetadata{
+			Collection: "posts",
+			RKey:       p.rkey,
+			RecordType: "post",
+			Data:       data,
+			SearchText: p.text,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		require.NoError(t, err)
+	}
+
+	users := []map[string]interface{}{
+		{"name": "alice", "skills": []interface{}{"go", "sql"}, "address": map[string]interface{}{"city": "Berlin"}},
+		{"name": "bob", "skills": []interface{}{"rust"}, "address": map[string]interface{}{"city": "Paris"}},
+	}
+	for _, u := range users {
+		name := u["name"].(string)
+		err := idx.IndexRecord(context.Background(), testCID(t, "users/"+name), IndexMetadata{
+			Collection: "users",
+			RKey:       name,
+			RecordType: "user",
+			Data:       u,
+			SearchText: name,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		require.NoError(t, err)
+	}
+}
+
+// indexAt индексирует запись с заданным временем создания.
+func indexAt(t testing.TB, idx *SimpleSQLiteIndexer, collection, rkey string, data map[string]interface{}, created time.Time) cid.Cid {
+	t.Helper()
+
+	c := testCID(t, collection+"/"+rkey)
+	err := idx.IndexRecord(context.Background(), c, IndexMetadata{
+		Collection: collection,
+		RKey:       rkey,
+		RecordType: collection,
+		Data:       data,
+		SearchText: "record " + rkey,
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	})
+	require.NoError(t, err)
+
+	return c
+}
+
+// makeIndexedRecords создает n записей коллекции для пакетной индексации.
+func makeIndexedRecords(t testing.TB, collection string, n int) []IndexedRecord {
+	t.Helper()
+
+	now := time.Now()
+	records := make([]IndexedRecord, n)
+	for i := range records {
+		records[i] = IndexedRecord{
+			CID: testCID(t, collection+"/"+keyN(i)),
+			Metadata: IndexMetadata{
+				Collection: collection,
+				RKey:       keyN(i),
+				RecordType: collection,
+				Data:       map[string]interface{}{"n": i, "title": "record " + keyN(i)},
+				SearchText: "record " + keyN(i),
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			},
+		}
+	}
+
+	return records
+}
+
+// keyN форматирует ключ записи с порядковым номером.
+func keyN(i int) string {
+	return fmt.Sprintf("r%03d", i)
+}
+
+// resultKeys возвращает отсортированные ключи записей из результатов поиска.
+func resultKeys(results []SearchResult) []string {
+	keys := make([]string, 0, len(results))
+	for _, r := range results {
+		keys = append(keys, r.RKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -76,6 +76,11 @@ type IndexMetadata struct {
 	SearchText string                 `json:"search_text"` // Объединенный текст из всех текстовых полей для FTS5
 	CreatedAt  time.Time              `json:"created_at"`  // Время создания записи
 	UpdatedAt  time.Time              `json:"updated_at"`  // Время последнего обновления записи
+
+	// ExpiresAt - срок жизни записи (нулевое значение - бессрочно).
+	// Учитывается SimpleSQLiteIndexer: истекшие записи скрываются из поиска
+	// и удаляются PurgeExpired.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
 }
 
 // SearchQuery представляет запрос для поиска записей
@@ -90,18 +95,23 @@ type IndexMetadata struct {
 // ТИПЫ ПОИСКА:
 // 1. Поиск по коллекции: Collection != ""
 // 2. Полнотекстовый: FullTextQuery != ""
-// 3. Фильтрация: Filters содержит условия
-// 4. Сортировка: SortBy + SortOrder
-// 5. Пагинация: Limit + Offset
+// 3. Фильтрация: Filters содержит условия равенства, Clauses - сравнения и диапазоны
+// 4. Пути JSON: поля с префиксом "$." ("$.address.city") адресуют значения внутри Data
+// 5. Сортировка: SortBy + SortOrder или несколько ключей в Sort
+// 6. Пагинация: Limit + Offset или Limit + After (курсор)
 type SearchQuery struct {
-	Collection    string                 `json:"collection,omitempty"`      // Фильтр по коллекции ("posts", "users", и т.д.)
-	RecordType    string                 `json:"record_type,omitempty"`     // Фильтр по типу записи
-	Filters       map[string]interface{} `json:"filters,omitempty"`         // Фильтры по атрибутам записи (WHERE conditions)
-	FullTextQuery string                 `json:"full_text_query,omitempty"` // FTS5 запрос для полнотекстового поиска
-	SortBy        string                 `json:"sort_by,omitempty"`         // Поле для сортировки (created_at, updated_at, и т.д.)
-	SortOrder     string                 `json:"sort_order,omitempty"`      // Направление сортировки: "ASC" или "DESC"
-	Limit         int                    `json:"limit,omitempty"`           // Максимальное количество результатов
-	Offset        int                    `json:"offset,omitempty"`          // Смещение для пагинации
+	Collection     string                 `json:"collection,omitempty"`      // Фильтр по коллекции ("posts", "users", и т.д.)
+	RecordType     string                 `json:"record_type,omitempty"`     // Фильтр по типу записи
+	Filters        map[string]interface{} `json:"filters,omitempty"`         // Фильтры по атрибутам записи (WHERE conditions)
+	Clauses        []FilterClause         `json:"clauses,omitempty"`         // Условия сравнения по атрибутам (eq, ne, gt, gte, lt, lte, in, exists)
+	FullTextQuery  string                 `json:"full_text_query,omitempty"` // FTS5 запрос для полнотекстового поиска
+	SortBy         string                 `json:"sort_by,omitempty"`         // Поле для сортировки (created_at, updated_at, и т.д.)
+	SortOrder      string                 `json:"sort_order,omitempty"`      // Направление сортировки: "ASC" или "DESC"
+	Sort           []SortSpec             `json:"sort,omitempty"`            // Ключи сортировки по приоритету (заменяют SortBy/SortOrder)
+	Limit          int                    `json:"limit,omitempty"`           // Максимальное количество результатов
+	Offset         int                    `json:"offset,omitempty"`          // Смещение для пагинации (без Limit - все записи после смещения)
+	After          string                 `json:"after,omitempty"`           // Курсор SearchPage.NextCursor: записи строго после него
+	IncludeExpired bool                   `json:"include_expired,omitempty"` // Включать записи с истекшим сроком жизни (IndexMetadata.ExpiresAt)
 }
 
 // SearchResult представляет результат поиска
@@ -216,6 +226,7 @@ func (idx *SQLiteIndexer) initSchema() error {
 		search_text TEXT,                  -- Агрегированный текст для полнотекстового поиска
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,  -- Время создания записи
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,  -- Время последнего обновления
+		expires_at INTEGER,                -- Срок жизни (миллисекунды Unix), NULL - бессрочная запись
 		UNIQUE(collection, rkey)           -- Бизнес-ключ: уникальность в рамках коллекции
 	);
 
@@ -388,7 +399,22 @@ func (idx *SQLiteIndexer) initSchema() error {
 
 	// Выполняем весь DDL скрипт как одну транзакцию
 	// Это обеспечивает атомарность создания схемы
-	_, err := idx.db.Exec(schema)
+	if _, err := idx.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// В базах, созданных до появления срока жизни, колонки expires_at нет
+	hasExpiry, err := columnExists(idx.db, "records", "expires_at")
+	if err != nil {
+		return err
+	}
+	if !hasExpiry {
+		if _, err := idx.db.Exec("ALTER TABLE records ADD COLUMN expires_at INTEGER"); err != nil {
+			return err
+		}
+	}
+
+	_, err = idx.db.Exec(expirySchema)
 	return err
 }
 
@@ -446,10 +472,11 @@ func (idx *SQLiteIndexer) IndexRecord(ctx context.Context, recordCID cid.Cid, me
 	// Это корректно обрабатывает обновления записей в Repository
 	_, err = idx.db.ExecContext(ctx, `
 		INSERT OR REPLACE INTO records 
-		(cid, collection, rkey, record_type, data, search_text, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		(cid, collection, rkey, record_type, data, search_text, created_at, updated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, recordCID.String(), metadata.Collection, metadata.RKey, metadata.RecordType,
-		string(dataJSON), metadata.SearchText, metadata.CreatedAt, metadata.UpdatedAt)
+		string(dataJSON), metadata.SearchText, metadata.CreatedAt, metadata.UpdatedAt,
+		expiryEpoch(metadata.ExpiresAt))
 
 	if err != nil {
 		return fmt.Errorf("failed to index record: %w", err)
@@ -661,7 +688,8 @@ func (idx *SQLiteIndexer) DeleteRecord(ctx context.Context, recordCID cid.Cid) e
 // ОБЩИЕ ВОЗМОЖНОСТИ:
 // - Комбинирование фильтров (коллекция + тип + атрибуты)
 // - Сортировка по любому полю
-// - Пагинация результатов
+// - Пагинация через Limit + Offset или курсор After (см. SearchRecordsPage)
+// - Истекшие записи (IndexMetadata.ExpiresAt) скрыты, если не задан IncludeExpired
 // - Thread-safe операции через RWMutex
 //
 // ПРОИЗВОДИТЕЛЬНОСТЬ:
@@ -678,12 +706,14 @@ func (idx *SQLiteIndexer) SearchRecords(ctx context.Context, query SearchQuery)
 
 	// === ДИСПЕТЧЕРИЗАЦИЯ ТИПА ПОИСКА ===
 
-	if query.FullTextQuery != "" {
+	// Запрос разбирается заранее: строка, состоящая только из операторов
+	// (например, "-" или пустые кавычки), не ограничивает выборку
+	if text := parseTextQuery(query.FullTextQuery); !text.Empty() {
 		// ПОЛНОТЕКСТОВЫЙ ПОИСК через FTS5
 		// Приоритет отдается FTS5 когда указан FullTextQuery
 		// поскольку он обеспечивает лучшее ранжирование и производительность
 		// для текстовых запросов
-		results, err = idx.searchFullText(ctx, query)
+		results, err = idx.searchFullText(ctx, query, text)
 	} else {
 		// СТРУКТУРИРОВАННЫЙ ПОИСК через SQL WHERE
 		// Используется для точных соответствий, фильтров по атрибутам
@@ -694,6 +724,29 @@ func (idx *SQLiteIndexer) SearchRecords(ctx context.Context, query SearchQuery)
 	return results, err
 }
 
+// SearchRecordsPage выполняет поиск как SearchRecords и дополнительно
+// возвращает курсор следующей страницы для SearchQuery.After.
+//
+// Курсор формируется, только если задан Limit и страница заполнена целиком;
+// он учитывает активный порядок сортировки и отклоняется при его изменении.
+func (idx *SQLiteIndexer) SearchRecordsPage(ctx context.Context, query SearchQuery) (*SearchPage, error) {
+	results, err := idx.SearchRecords(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: results}
+	if query.Limit > 0 && len(results) == query.Limit {
+		order, err := resolveOrder(query, !parseTextQuery(query.FullTextQuery).Empty())
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = order.cursorFor(results[len(results)-1])
+	}
+
+	return page, nil
+}
+
 // searchFullText выполняет полнотекстовый поиск
 //
 // МЕХАНИЗМ FTS5 ПОИСКА:
@@ -722,68 +775,88 @@ func (idx *SQLiteIndexer) SearchRecords(ctx context.Context, query SearchQuery)
 // - Фильтрация по коллекции и типу через основную таблицу
 // - Сортировка по релевантности или пользовательскому полю
 // - Пагинация для управления размером результата
-func (idx *SQLiteIndexer) searchFullText(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+func (idx *SQLiteIndexer) searchFullText(ctx context.Context, query SearchQuery, text textQuery) ([]SearchResult, error) {
 	// === ПОСТРОЕНИЕ FTS5 ЗАПРОСА ===
 
+	// Разобранный запрос транслируется в синтаксис MATCH, а не передаётся
+	// как есть: каждый термин экранируется кавычками, поэтому ввод
+	// пользователя не может нарушить синтаксис FTS5
+	match, err := text.matchExpr()
+	if err != nil {
+		return nil, err
+	}
+
 	// Базовый SQL для полнотекстового поиска:
 	// - records_fts.rank содержит оценку релевантности BM25
 	// - JOIN с основной таблицей для получения полных метаданных
 	// - MATCH оператор для FTS5 поиска
+	// Поиск оформлен подзапросом: rank нельзя сравнивать в WHERE, а курсор
+	// пагинации сравнивает релевантность как обычную колонку
 	sql := `
-		SELECT r.cid, r.collection, r.rkey, r.record_type, r.data, r.created_at, r.updated_at,
-		       fts.rank as relevance
-		FROM records_fts fts
-		JOIN records r ON r.cid = fts.cid
-		WHERE records_fts MATCH ?
-	`
-	// Первый параметр - FullTextQuery для FTS5 MATCH
-	args := []interface{}{query.FullTextQuery}
+		SELECT cid, collection, rkey, record_type, data, created_at, updated_at, relevance
+		FROM (
+			SELECT r.cid, r.collection, r.rkey, r.record_type, r.data, r.created_at, r.updated_at,
+			       r.expires_at, fts.rank AS relevance
+			FROM records_fts fts
+			JOIN records r ON r.cid = fts.cid
+			WHERE records_fts MATCH ?
+		)
+		WHERE 1=1`
+	// Первый параметр - выражение для FTS5 MATCH
+	args := []interface{}{match}
 
 	// === ДОПОЛНИТЕЛЬНЫЕ ФИЛЬТРЫ ===
 
 	// Фильтр по коллекции (если указан)
 	// Ограничивает FTS поиск конкретной коллекцией для повышения точности
 	if query.Collection != "" {
-		sql += " AND r.collection = ?"
+		sql += " AND collection = ?"
 		args = append(args, query.Collection)
 	}
 
 	// Фильтр по типу записи (если указан)
 	// Дополнительная категоризация внутри коллекции
 	if query.RecordType != "" {
-		sql += " AND r.record_type = ?"
+		sql += " AND record_type = ?"
 		args = append(args, query.RecordType)
 	}
 
+	// Истекшие записи исключаются, если не запрошены явно
+	if !query.IncludeExpired {
+		expirySQL, expiryArgs := notExpiredClause("", time.Now())
+		sql += expirySQL
+		args = append(args, expiryArgs...)
+	}
+
 	// === СОРТИРОВКА ===
 
-	if query.SortBy != "" {
-		// ПОЛЬЗОВАТЕЛЬСКАЯ СОРТИРОВКА
-		// Клиент может переопределить сортировку по релевантности
-		order := "ASC"
-		if query.SortOrder == "DESC" {
-			order = "DESC"
-		}
-		sql += fmt.Sprintf(" ORDER BY r.%s %s", query.SortBy, order)
-	} else {
-		// СОРТИРОВКА ПО РЕЛЕВАНТНОСТИ (по умолчанию)
-		// FTS5 rank сортируется по убыванию для лучших результатов вверху
-		sql += " ORDER BY relevance DESC"
+	// По умолчанию - по релевантности; клиент может переопределить порядок
+	// через SortBy или Sort. Имена полей проверяются по закрытому списку,
+	// а CID замыкает порядок, чтобы записи с равной релевантностью
+	// возвращались в одном и том же порядке
+	order, err := resolveOrder(query, true)
+	if err != nil {
+		return nil, err
 	}
 
 	// === ПАГИНАЦИЯ ===
 
-	// LIMIT для ограничения количества результатов
-	if query.Limit > 0 {
-		sql += " LIMIT ?"
-		args = append(args, query.Limit)
-
-		// OFFSET для пагинации (только если указан LIMIT)
-		if query.Offset > 0 {
-			sql += " OFFSET ?"
-			args = append(args, query.Offset)
+	// Курсор After отбирает записи строго после последней записи
+	// предыдущей страницы в том же порядке сортировки
+	if query.After != "" {
+		clause, afterArgs, err := order.afterClause("", query.After)
+		if err != nil {
+			return nil, err
 		}
+		sql += clause
+		args = append(args, afterArgs...)
 	}
+	sql += order.orderBy("")
+
+	// LIMIT и OFFSET для пагинации
+	limit, limitArgs := limitClause(query)
+	sql += limit
+	args = append(args, limitArgs...)
 
 	// Выполняем построенный SQL запрос
 	return idx.executeSearchQuery(ctx, sql, args...)
@@ -846,50 +919,52 @@ func (idx *SQLiteIndexer) searchStructured(ctx context.Context, query SearchQuer
 		args = append(args, query.RecordType)
 	}
 
+	// Истекшие записи исключаются, если не запрошены явно
+	if !query.IncludeExpired {
+		expirySQL, expiryArgs := notExpiredClause("", time.Now())
+		sql += expirySQL
+		args = append(args, expiryArgs...)
+	}
+
 	// === ФИЛЬТРЫ ПО АТРИБУТАМ (EAV МОДЕЛЬ) ===
 
 	// Обрабатываем фильтры по произвольным атрибутам записей
-	// Каждый фильтр добавляет субзапрос к таблице record_attributes
-	if len(query.Filters) > 0 {
-		for attr, value := range query.Filters {
-			// IN субзапрос для поиска записей с конкретным атрибутом
-			// Это эффективный способ фильтрации в EAV модели:
-			// "Найти все CID, которые имеют атрибут X со значением Y"
-			sql += " AND cid IN (SELECT cid FROM record_attributes WHERE attribute_name = ? AND attribute_value = ?)"
-			args = append(args, attr, fmt.Sprintf("%v", value))
-		}
+	// Каждый фильтр добавляет субзапрос к таблице record_attributes:
+	// "Найти все CID, которые имеют атрибут X со значением, удовлетворяющим условию"
+	filterSQL, filterArgs, err := compileFilters(query, "")
+	if err != nil {
+		return nil, err
 	}
+	sql += filterSQL
+	args = append(args, filterArgs...)
 
 	// === СОРТИРОВКА ===
 
-	if query.SortBy != "" {
-		// ПОЛЬЗОВАТЕЛЬСКАЯ СОРТИРОВКА
-		// Клиент может сортировать по любому полю из таблицы records
-		order := "ASC"
-		if query.SortOrder == "DESC" {
-			order = "DESC"
-		}
-		sql += fmt.Sprintf(" ORDER BY %s %s", query.SortBy, order)
-	} else {
-		// СОРТИРОВКА ПО ВРЕМЕНИ СОЗДАНИЯ (по умолчанию)
-		// Показывает новые записи первыми
-		// Использует индекс idx_records_created_at
-		sql += " ORDER BY created_at DESC"
+	// По умолчанию новые записи первыми (индекс idx_records_created_at);
+	// SortBy или Sort задают пользовательский порядок по колонкам records,
+	// CID используется как последний ключ для детерминированности
+	order, err := resolveOrder(query, false)
+	if err != nil {
+		return nil, err
 	}
 
 	// === ПАГИНАЦИЯ ===
 
-	// LIMIT для ограничения количества результатов
-	if query.Limit > 0 {
-		sql += " LIMIT ?"
-		args = append(args, query.Limit)
-
-		// OFFSET для пагинации
-		if query.Offset > 0 {
-			sql += " OFFSET ?"
-			args = append(args, query.Offset)
+	// Курсор After - продолжение с позиции после последней записи страницы
+	if query.After != "" {
+		clause, afterArgs, err := order.afterClause("", query.After)
+		if err != nil {
+			return nil, err
 		}
+		sql += clause
+		args = append(args, afterArgs...)
 	}
+	sql += order.orderBy("")
+
+	// LIMIT и OFFSET для пагинации
+	limit, limitArgs := limitClause(query)
+	sql += limit
+	args = append(args, limitArgs...)
 
 	// Выполняем построенный SQL запрос
 	return idx.executeSearchQuery(ctx, sql, args...)